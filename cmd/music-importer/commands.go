@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// cmdRip implements `importer rip [--import]`: it rips the inserted CD into
+// IMPORT_DIR and optionally imports it straight away.
+func cmdRip(args []string) error {
+	importDir := library.LocalImportDir()
+	if importDir == "" {
+		return fmt.Errorf("IMPORT_DIR must be set")
+	}
+	logf := func(msg string) { fmt.Println("→", msg) }
+	albums, err := importer.RipCD(importDir, logf)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Ripped:", strings.Join(albums, ", "))
+	if len(args) > 0 && args[0] == "--import" {
+		if _, err := importer.Run(context.Background(), importer.Config{Folders: albums}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commands maps CLI subcommands to their implementations. Running the binary
+// without a subcommand starts the web server.
+var commands = map[string]func(args []string) error{
+	"scrub":      cmdScrub,
+	"rip":        cmdRip,
+	"pull":       cmdPull,
+	"retag":      cmdRetag,
+	"stats":      cmdStats,
+	"lyrics":     cmdLyrics,
+	"art":        cmdArt,
+	"replaygain": cmdReplayGain,
+	"duplicates": cmdDuplicates,
+	"views":      cmdViews,
+	"nfo":        cmdNFO,
+}
+
+// runCommand dispatches a CLI subcommand and returns the process exit code.
+func runCommand(name string, args []string) int {
+	fn, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command %q (available: %v)\n", name, names)
+		return 2
+	}
+	if err := fn(args); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// cmdPull implements `importer pull`: it pulls from the configured remote
+// sources into IMPORT_DIR without importing.
+func cmdPull(args []string) error {
+	importDir := library.LocalImportDir()
+	if importDir == "" {
+		return fmt.Errorf("IMPORT_DIR must be set")
+	}
+	if len(importer.ConfiguredSources()) == 0 {
+		return fmt.Errorf("no remote source configured (set REMOTE_SOURCE)")
+	}
+	importer.PullSources(importDir, func(msg string) { fmt.Println("→", msg) })
+	return nil
+}
+
+// cmdRetag implements `importer retag --query "..." [--file-tags] [--dry-run] [--yes]`:
+// it reapplies the metadata rules to every library album matching the query,
+// showing where its files would go and asking before each one unless --yes
+// is given.
+func cmdRetag(args []string) error {
+	fs := flag.NewFlagSet("retag", flag.ContinueOnError)
+	query := fs.String("query", "", `albums to retag, e.g. "albumartist:Radiohead" (see query.go)`)
+	fileTags := fs.Bool("file-tags", false, "keep the current tags and only re-render paths (after a template or alias change)")
+	dryRun := fs.Bool("dry-run", false, "show where matching albums would move without changing anything")
+	yes := fs.Bool("yes", false, "do not ask before each album")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *query == "" {
+		return fmt.Errorf("--query is required")
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("retag needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	entries, err := library.QueryJournal(*query)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d album(s) match %q\n", len(entries), *query)
+
+	in := bufio.NewReader(os.Stdin)
+	var failed int
+	for _, e := range entries {
+		label := fmt.Sprintf("%s — %s (%s)", e.Artist, e.Album, e.Dir)
+		if _, err := os.Stat(filepath.Join(libraryDir, e.Dir)); err != nil {
+			fmt.Println("Missing from library, skipping:", label)
+			continue
+		}
+		if *dryRun || !*yes {
+			plan, err := importer.PlanRetag(libraryDir, e)
+			if err != nil {
+				fmt.Println("Cannot plan retag:", label, err)
+				failed++
+				continue
+			}
+			fmt.Println("Retag:", label)
+			printRetagPlan(plan)
+		}
+		if *dryRun {
+			continue
+		}
+		if !*yes {
+			fmt.Printf("Retag %s? [y/N/a(ll)/q(uit)] ", label)
+			answer, _ := in.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+			case "a", "all":
+				*yes = true
+			case "q", "quit":
+				return nil
+			default:
+				continue
+			}
+		}
+
+		plan, err := importer.RetagAlbum(libraryDir, e, *fileTags, func(msg string) { fmt.Println("→", msg) })
+		if err != nil {
+			fmt.Println("Retag failed:", label, err)
+			failed++
+			continue
+		}
+		fmt.Printf("→ Retagged: %s → %s (%d files moved)\n", label, plan.NewDir, len(plan.Moves))
+	}
+	if !*dryRun {
+		library.ExportRecent()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d album(s) failed to retag", failed)
+	}
+	return nil
+}
+
+// printRetagPlan prints an album's new directory and file renames, noting
+// that paths come from the current tags.
+func printRetagPlan(plan *importer.RetagPlan) {
+	if len(plan.Moves) == 0 {
+		fmt.Println("  paths unchanged (from current tags)")
+		return
+	}
+	if plan.NewDir != plan.Dir {
+		fmt.Printf("  %s → %s\n", plan.Dir, plan.NewDir)
+	}
+	for _, m := range plan.Moves {
+		fmt.Printf("    %s → %s\n", m.From, m.To)
+	}
+}
+
+// cmdScrub implements `importer scrub`: it prints every issue found and exits
+// non-zero if the library failed verification.
+func cmdScrub(args []string) error {
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("scrub needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	fmt.Println("=== Scrubbing library:", libraryDir, "===")
+	report, err := library.ScrubLibrary(libraryDir)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		fmt.Printf("%-10s %s %s\n", issue.Problem, issue.Path, issue.Detail)
+	}
+	fmt.Printf("Checked %d files, %d issues\n", report.FilesChecked, len(report.Issues))
+	if len(report.Issues) > 0 {
+		return fmt.Errorf("library scrub found %d issues", len(report.Issues))
+	}
+	return nil
+}
+
+// cmdViews implements `importer views`: it rebuilds the LIBRARY_VIEWS
+// symlink trees from the journal, or removes them when the variable is
+// unset.
+func cmdViews(args []string) error {
+	if os.Getenv("LIBRARY_DIR") == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("views need a local LIBRARY_DIR, not an rclone remote")
+	}
+	views := library.LibraryViews()
+	links, err := library.BuildLibraryViews(library.LocalLibraryDir(), views)
+	fmt.Printf("%d links in views %s\n", links, strings.Join(views, ", "))
+	return err
+}
+
+// cmdNFO implements `importer nfo [--force]`: it writes album.nfo and
+// artist.nfo for library albums that have none, or for all with --force.
+func cmdNFO(args []string) error {
+	fs := flag.NewFlagSet("nfo", flag.ContinueOnError)
+	force := fs.Bool("force", false, "rewrite existing album.nfo files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("nfo needs a local LIBRARY_DIR, not an rclone remote")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	n, err := importer.WriteLibraryNFOs(ctx, libraryDir, *force, func(msg string) { fmt.Println("→", msg) })
+	fmt.Printf("%d albums written\n", n)
+	return err
+}
+
+// cmdStats implements `importer stats`: it prints the match-source
+// distribution and each provider's hit rate.
+func cmdStats(args []string) error {
+	st, err := importer.CollectImportStats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d albums in the journal\n\nFinal match source:\n", st.Albums)
+	sources := make([]string, 0, len(st.BySource))
+	for s := range st.BySource {
+		sources = append(sources, string(s))
+	}
+	sort.Strings(sources)
+	for _, s := range sources {
+		n := st.BySource[metadata.Source(s)]
+		fmt.Printf("  %-12s %5d  %5.1f%%\n", s, n, 100*float64(n)/float64(max(st.Albums, 1)))
+	}
+
+	fmt.Println("\nProvider hit rate:")
+	providers := make([]string, 0, len(st.Providers))
+	for p := range st.Providers {
+		providers = append(providers, string(p))
+	}
+	sort.Strings(providers)
+	for _, p := range providers {
+		ps := st.Providers[metadata.Source(p)]
+		fmt.Printf("  %-12s %5d / %-5d %5.1f%%\n", p, ps.Hits, ps.Attempts, 100*float64(ps.Hits)/float64(max(ps.Attempts, 1)))
+	}
+	return nil
+}
+
+// cmdLyrics implements `importer lyrics backfill [--restart]`: it fetches
+// lyrics for library tracks that have none, resuming an interrupted run
+// unless --restart is given.
+func cmdLyrics(args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return fmt.Errorf("usage: lyrics backfill [--restart]")
+	}
+	fs := flag.NewFlagSet("lyrics backfill", flag.ContinueOnError)
+	restart := fs.Bool("restart", false, "ignore the saved progress and walk the whole library again")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("lyrics backfill needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stats, err := importer.BackfillLyrics(ctx, libraryDir, *restart, func(msg string) { fmt.Println("→", msg) })
+	fmt.Printf("%d tracks: %d synced, %d plain, %d already had lyrics, %d instrumental, %d not found, %d failed\n",
+		stats.Total, stats.Synced, stats.Plain, stats.AlreadyHad, stats.Instrumental, stats.NotFound, stats.Failed)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Interrupted; run again to resume")
+		return nil
+	}
+	return err
+}
+
+// cmdArt implements `importer art backfill [--dry-run]`: it adds missing
+// cover files and embedded art across the library and prints what changed.
+func cmdArt(args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return fmt.Errorf("usage: art backfill [--dry-run]")
+	}
+	fs := flag.NewFlagSet("art backfill", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("art backfill needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := importer.BackfillArt(ctx, libraryDir, *dryRun, func(msg string) { fmt.Println("→", msg) })
+	failed := 0
+	for _, f := range report.Fixed {
+		if f.Error != "" {
+			failed++
+		}
+	}
+	verb := "changed"
+	if *dryRun {
+		verb = "would change"
+	}
+	fmt.Printf("%d albums checked, %d %s, %d failed\n", report.Albums, len(report.Fixed)-failed, verb, failed)
+	return err
+}
+
+// cmdReplayGain implements `importer replaygain backfill`: it re-runs
+// rsgain on library albums with missing or inconsistent ReplayGain tags.
+func cmdReplayGain(args []string) error {
+	if len(args) == 0 || args[0] != "backfill" {
+		return fmt.Errorf("usage: replaygain backfill [--restart] [--dry-run] [--limit N]")
+	}
+	fs := flag.NewFlagSet("replaygain backfill", flag.ContinueOnError)
+	restart := fs.Bool("restart", false, "ignore the saved progress and walk the whole library again")
+	dryRun := fs.Bool("dry-run", false, "list the albums that would be reprocessed without changing them")
+	limit := fs.Int("limit", 0, "stop after reprocessing this many albums (0 = no limit)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("replaygain backfill needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stats, err := importer.BackfillReplayGain(ctx, libraryDir, *restart, *dryRun, *limit, func(msg string) { fmt.Println("→", msg) })
+	verb := "reprocessed"
+	if *dryRun {
+		verb = "to reprocess"
+	}
+	fmt.Printf("%d albums: %d already tagged, %d %s, %d failed\n",
+		stats.Albums, stats.Tagged, stats.Processed, verb, stats.Failed)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Interrupted; run again to resume")
+		return nil
+	}
+	return err
+}
+
+// cmdDuplicates implements `importer duplicates [--fingerprint]`: it scans
+// the library for duplicates and prints each group, best quality first.
+// Groups are resolved in the web UI.
+func cmdDuplicates(args []string) error {
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	fingerprint := fs.Bool("fingerprint", false, "also compare tracks by audio fingerprint (needs fpcalc; slow)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" {
+		return fmt.Errorf("LIBRARY_DIR must be set")
+	}
+	if library.RemoteLibrary() != "" {
+		return fmt.Errorf("duplicates needs a local LIBRARY_DIR, not an rclone remote")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := importer.FindDuplicates(ctx, libraryDir, *fingerprint, func(string) {})
+	if err != nil {
+		return err
+	}
+	for _, g := range report.Groups {
+		fmt.Printf("#%s %s duplicates (%s):\n", g.ID, g.Kind, g.Reason)
+		for _, it := range g.Items {
+			fmt.Printf("  %-20s %s\n", it.Quality, metadata.FirstNonEmpty(it.Path, it.Dir))
+		}
+	}
+	fmt.Printf("%d albums scanned, %d duplicate groups\n", report.Albums, len(report.Groups))
+	return nil
+}
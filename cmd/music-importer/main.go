@@ -0,0 +1,30 @@
+// Command music-importer serves the web UI, or runs one of the CLI
+// subcommands when given one.
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/web"
+)
+
+func main() {
+	if err := setupProcessUser(); err != nil {
+		log.Fatal(err)
+	}
+	metadata.SetCacheDir(library.APICacheDir())
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	log.Printf("Music Importer %s starting on http://localhost:8080", web.Version)
+	importer.StartMonitor()
+	importer.StartScheduler()
+	importer.StartRetryWorker()
+	log.Fatal(http.ListenAndServe(":8080", web.Handler()))
+}
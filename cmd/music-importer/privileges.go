@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// envInt reads a non-negative integer from env in the given base, reporting
+// whether it was set.
+func envInt(env string, base int) (int, bool, error) {
+	raw := strings.TrimSpace(os.Getenv(env))
+	if raw == "" {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseUint(raw, base, 32)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s %q", env, raw)
+	}
+	return int(n), true, nil
+}
+
+// setupProcessUser applies the linuxserver-style UMASK, PUID and PGID
+// variables: it sets the umask, and when started as root it hands DATA_DIR
+// to PUID:PGID and drops to that user and group, so everything the importer
+// creates afterwards is theirs. Started as another user, PUID and PGID are
+// ignored with a warning unless they already match.
+func setupProcessUser() error {
+	umask, ok, err := envInt("UMASK", 8)
+	if err != nil {
+		return err
+	}
+	if ok {
+		syscall.Umask(umask & 0o777)
+	}
+
+	uid, hasUID, err := envInt("PUID", 10)
+	if err != nil {
+		return err
+	}
+	gid, hasGID, err := envInt("PGID", 10)
+	if err != nil {
+		return err
+	}
+	if !hasUID && !hasGID {
+		return nil
+	}
+	if !hasUID {
+		uid = os.Getuid()
+	}
+	if !hasGID {
+		gid = os.Getgid()
+	}
+	if os.Getuid() != 0 {
+		if uid != os.Getuid() || gid != os.Getgid() {
+			log.Printf("Not running as root; ignoring PUID=%d PGID=%d (running as %d:%d)", uid, gid, os.Getuid(), os.Getgid())
+		}
+		return nil
+	}
+
+	if dir := library.DataDir(); dir != "" {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil {
+				os.Lchown(path, uid, gid)
+			}
+			return nil
+		})
+	}
+	// Group first: once the uid is dropped the gid can no longer change.
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setting groups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setting gid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setting uid %d: %w", uid, err)
+	}
+	log.Printf("Running as %d:%d", uid, gid)
+	return nil
+}
@@ -2,6 +2,7 @@ module github.com/gabehf/music-import
 
 go 1.24.2
 
-require github.com/bogem/id3v2 v1.2.0
-
-require golang.org/x/text v0.3.2 // indirect
+require (
+	github.com/bogem/id3v2 v1.2.0
+	golang.org/x/text v0.3.2
+)
@@ -0,0 +1,139 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// ripTOC returns the TOC of a CD rip: from its rip log or cue sheet, or for
+// albums ripped from the web UI (which have a disc ID), from the track
+// lengths. It is nil for anything that is not a CD rip.
+func ripTOC(a *AlbumRun) *metadata.TOC {
+	if toc := metadata.AlbumTOC(a.Result.Path); toc != nil {
+		return toc
+	}
+	if st, err := LoadAlbumState(a.Result.Path); err != nil || st.DiscID == "" {
+		return nil
+	}
+	toc, err := metadata.TOCFromTracks(a.Tracks)
+	if err != nil {
+		return nil
+	}
+	return toc
+}
+
+// trackAccurateRipChecksum decodes a track to 16-bit stereo PCM with ffmpeg
+// and computes its AccurateRip checksums as it streams.
+func trackAccurateRipChecksum(path string, first, last bool) (v1, v2 uint32, err error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tools.Stream(pw, "ffmpeg", "-v", "error", "-i", path, "-map", "0:a:0",
+			"-f", "s16le", "-acodec", "pcm_s16le", "-ac", "2", "-ar", "44100", "-"))
+	}()
+	v1, v2, err = metadata.AccurateRipChecksum(pr, first, last)
+	pr.CloseWithError(err)
+	return v1, v2, err
+}
+
+// accurateRipResult describes a verification for the log and the
+// ACCURATERIPRESULT tag.
+func accurateRipResult(conf int) string {
+	if conf == 0 {
+		return "AccurateRip: Not accurate"
+	}
+	return fmt.Sprintf("AccurateRip: Accurate (confidence %d)", conf)
+}
+
+// accurateRipStage verifies a CD rip against the AccurateRip database: each
+// track's v1 and v2 checksums are looked up among the pressings of the disc
+// (identified by the TOC in its rip log or cue sheet), and the matching
+// confidence is tagged as ACCURATERIPRESULT, with ACCURATERIPDISCID, and
+// recorded in the journal. It is not in the default pipeline; add
+// "accuraterip" to PIPELINE_STAGES. Albums with tracks no pressing matches
+// are flagged, and moved to ACCURATERIP_REVIEW_FOLDER when it is set.
+func accurateRipStage(a *AlbumRun) error {
+	toc := ripTOC(a)
+	if toc == nil {
+		a.Result.AccurateRip.Skipped = true
+		return nil
+	}
+	if len(toc.Offsets) != len(a.Tracks) {
+		a.Logf(fmt.Sprintf("Skipping AccurateRip: the TOC lists %d tracks but the folder has %d", len(toc.Offsets), len(a.Tracks)))
+		a.Result.AccurateRip.Skipped = true
+		return nil
+	}
+	if a.offline() {
+		a.Logf("Offline: skipping AccurateRip verification")
+		a.Result.AccurateRip.Skipped = true
+		return nil
+	}
+
+	discID := toc.AccurateRipID()
+	a.Logf("Verifying rip with AccurateRip (" + discID + ")")
+	pressings, err := metadata.FetchAccurateRip(toc)
+	if errors.Is(err, metadata.ErrNotInAccurateRip) {
+		a.Logf("Disc is not in the AccurateRip database; the rip cannot be verified")
+		a.Result.AccurateRipInfo = &library.AccurateRip{DiscID: discID}
+		return nil
+	}
+	if err != nil {
+		a.Result.AccurateRip.Err = err
+		a.Logf(fmt.Sprintf("AccurateRip lookup failed: %v", err))
+		return nil
+	}
+
+	info := &library.AccurateRip{DiscID: discID, Found: true}
+	var errs []error
+	bad := 0
+	for i, t := range a.Tracks {
+		v1, v2, err := trackAccurateRipChecksum(t, i == 0, i == len(a.Tracks)-1)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("track %d: %w", i+1, err))
+			continue
+		}
+		conf := 0
+		for _, p := range pressings {
+			if p.CRC[i] == v1 || p.CRC[i] == v2 {
+				conf = max(conf, p.Confidence[i])
+			}
+		}
+		if conf == 0 {
+			bad++
+		}
+		info.Tracks = append(info.Tracks, library.AccurateRipTrack{Track: i + 1, CRC: fmt.Sprintf("%08X", v2), Confidence: conf})
+		a.Logf(fmt.Sprintf("Track %d: %s [%08X]", i+1, accurateRipResult(conf), v2))
+		err = metadata.WriteTags(t, map[string]string{
+			"ACCURATERIPDISCID": discID,
+			"ACCURATERIPRESULT": accurateRipResult(conf),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("track %d: %w", i+1, err))
+		}
+	}
+	a.Result.AccurateRipInfo = info
+
+	if bad > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d tracks not accurately ripped", bad, len(a.Tracks)))
+	}
+	a.Result.AccurateRip.Err = errors.Join(errs...)
+	if bad == 0 {
+		if a.Result.AccurateRip.Failed() {
+			a.Logf(fmt.Sprintf("AccurateRip verification incomplete: %v", a.Result.AccurateRip.Err))
+		}
+		return nil
+	}
+	a.Logf(a.Result.AccurateRip.Err.Error())
+	if st, err := LoadAlbumState(a.Result.Path); err == nil {
+		st.AccurateRip = strconv.Itoa(bad) + "/" + strconv.Itoa(len(a.Tracks)) + " tracks not verified"
+		if err := SaveAlbumState(a.Result.Path, st); err != nil {
+			a.Logf(fmt.Sprintf("Could not save AccurateRip result: %v", err))
+		}
+	}
+	return sendToReview(a, "ACCURATERIP_REVIEW_FOLDER", &a.Result.AccurateRip)
+}
@@ -0,0 +1,117 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/tools"
+)
+
+// albumLogsEnabled reports whether per-album logs are captured; on unless
+// ALBUM_LOGS=false.
+func albumLogsEnabled() bool {
+	return strings.ToLower(os.Getenv("ALBUM_LOGS")) != "false"
+}
+
+// albumLogMu serializes albums whose output is being captured: the capture
+// swaps the process's stdout and stderr, so two at once would interleave.
+var albumLogMu sync.Mutex
+
+// lockedBuffer is a bytes.Buffer safe for the copying goroutines and the
+// tool transcript to write at once.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// runAlbumLogged runs fn, the hooks and pipeline of one album, saving
+// everything printed or logged meanwhile and every tool run as the album's log (see
+// library.SaveAlbumLog) and linking the log from its journal entry.
+func runAlbumLogged(result *AlbumResult, fn func()) {
+	if !albumLogsEnabled() {
+		fn()
+		return
+	}
+	albumLogMu.Lock()
+	defer albumLogMu.Unlock()
+
+	buf := &lockedBuffer{}
+	fmt.Fprintf(buf, "Album: %s\nSource: %s\nStarted: %s\n\n", result.Name, result.Path, time.Now().Format(time.RFC3339))
+	restore, err := teeOutput(buf)
+	if err != nil {
+		log.Printf("[albumlog] not capturing %s: %v", result.Name, err)
+		fn()
+		return
+	}
+	logOut := log.Writer()
+	log.SetOutput(io.MultiWriter(logOut, buf))
+	tools.SetTranscript(buf)
+	fn()
+	tools.SetTranscript(nil)
+	log.SetOutput(logOut)
+	restore()
+
+	status := "ok"
+	if !result.Succeeded() {
+		status = "failed at " + result.FatalStep
+	}
+	fmt.Fprintf(buf, "\nFinished: %s (%s)\n", time.Now().Format(time.RFC3339), status)
+
+	result.LogID = library.NewJournalID()
+	if err := library.SaveAlbumLog(result.LogID, buf.buf.Bytes()); err != nil {
+		log.Printf("[albumlog] saving log for %s: %v", result.Name, err)
+		result.LogID = ""
+		return
+	}
+	if result.JournalID != "" {
+		if err := library.SetJournalLog(result.JournalID, result.LogID); err != nil {
+			log.Printf("[albumlog] linking log for %s: %v", result.Name, err)
+		}
+	}
+}
+
+// teeOutput copies everything written to os.Stdout and os.Stderr into w as
+// well, until restore is called.
+func teeOutput(w io.Writer) (restore func(), err error) {
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return nil, err
+	}
+	origOut, origErr := os.Stdout, os.Stderr
+	var wg sync.WaitGroup
+	copyTo := func(dst io.Writer, r *os.File) {
+		defer wg.Done()
+		io.Copy(io.MultiWriter(dst, w), r)
+		r.Close()
+	}
+	wg.Add(2)
+	go copyTo(origOut, outR)
+	go copyTo(origErr, errR)
+	os.Stdout, os.Stderr = outW, errW
+
+	return func() {
+		os.Stdout, os.Stderr = origOut, origErr
+		outW.Close()
+		errW.Close()
+		wg.Wait()
+	}, nil
+}
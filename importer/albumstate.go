@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// albumStateFile is kept inside a pending album folder and carries decisions
+// made in the web UI into the pipeline. It is never moved into the library.
+const albumStateFile = ".music-importer.json"
+
+// AlbumState is the contents of albumStateFile.
+type AlbumState struct {
+	Edits *AlbumEdits `json:"edits,omitempty"`
+
+	// ReleaseMBID is a MusicBrainz release picked in the web UI. It is passed
+	// to beets as --search-id in place of beets' own match.
+	ReleaseMBID string `json:"release_mbid,omitempty"`
+
+	// DiscID is the MusicBrainz disc ID of a CD rip, used to find the release
+	// when none was picked.
+	DiscID string `json:"disc_id,omitempty"`
+
+	// Cover is the art candidate picked in the web UI (see artpicker.go). The
+	// image itself has already been saved as the folder's cover file.
+	Cover string `json:"cover,omitempty"`
+
+	// Spectral is the spectral check's verdict on a suspect album.
+	Spectral *SpectralVerdict `json:"spectral,omitempty"`
+
+	// AccurateRip summarises the failed AccurateRip check of a flagged rip.
+	AccurateRip string `json:"accuraterip,omitempty"`
+
+	// Editions are the releases the autotagger could not choose between
+	// (see editions.go); picking one sets ReleaseMBID.
+	Editions []metadata.Edition `json:"editions,omitempty"`
+
+	// Stages maps the stages an interrupted or failed import completed to
+	// the fingerprint of the tracks they ran on (see resume.go).
+	Stages map[string]string `json:"stages,omitempty"`
+
+	// GroupSeen is when release grouping first saw the folder with
+	// GroupTracks tracks; GROUP_BY_RELEASE_WAIT counts from it (see
+	// grouping.go).
+	GroupSeen   time.Time `json:"group_seen,omitzero"`
+	GroupTracks int       `json:"group_tracks,omitempty"`
+}
+
+// AlbumEdits are metadata corrections entered in the web UI before import.
+// They are written into the files' tags when saved; their presence makes the
+// pipeline trust the file tags instead of re-tagging with beets.
+type AlbumEdits struct {
+	Artist string            `json:"artist"`
+	Album  string            `json:"album"`
+	Year   string            `json:"year"`
+	Genre  string            `json:"genre"`
+	Titles map[string]string `json:"titles,omitempty"` // track filename → title
+}
+
+// LoadAlbumState reads the state file in albumPath. A missing file yields an
+// empty state.
+func LoadAlbumState(albumPath string) (*AlbumState, error) {
+	st := &AlbumState{}
+	data, err := os.ReadFile(filepath.Join(albumPath, albumStateFile))
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return st, json.Unmarshal(data, st)
+}
+
+// SaveAlbumState writes st to the state file in albumPath.
+func SaveAlbumState(albumPath string, st *AlbumState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(albumPath, albumStateFile), data, 0644)
+}
+
+// ApplyAlbumEdits writes edits into the tags of every track in albumPath.
+// The album artist is always set; a track's ARTIST is only replaced when it
+// was empty or matched the previous album artist (when there was one), so
+// per-track credits on compilations survive.
+func ApplyAlbumEdits(albumPath string, edits *AlbumEdits) error {
+	tracks, err := metadata.AudioFiles(albumPath)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tracks {
+		old, err := metadata.ReadTags(t)
+		if err != nil {
+			return err
+		}
+		tags := map[string]string{
+			"ALBUMARTIST": edits.Artist,
+			"ALBUM":       edits.Album,
+			"DATE":        edits.Year,
+			"GENRE":       edits.Genre,
+		}
+		if old.Artist == "" || old.AlbumArtist != "" && old.Artist == old.AlbumArtist {
+			tags["ARTIST"] = edits.Artist
+		}
+		if title, ok := edits.Titles[filepath.Base(t)]; ok {
+			tags["TITLE"] = title
+		}
+		if err := metadata.WriteTags(t, tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
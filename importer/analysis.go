@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// keyNotation returns KEY_NOTATION, how keyfinder-cli writes INITIALKEY:
+// "standard" (the default, e.g. "Am"), "camelot" ("8A") or "openkey" ("1m").
+func keyNotation() string {
+	switch n := strings.ToLower(os.Getenv("KEY_NOTATION")); n {
+	case "camelot", "openkey":
+		return n
+	}
+	return "standard"
+}
+
+// analysisOverwrite reports whether ANALYSIS_OVERWRITE=true, which replaces
+// BPM and key tags a track already has instead of keeping them.
+func analysisOverwrite() bool {
+	return strings.ToLower(os.Getenv("ANALYSIS_OVERWRITE")) == "true"
+}
+
+// AnalysisStats counts the tags the analysis stage wrote for an album.
+type AnalysisStats struct {
+	BPM  int
+	Key  int
+	Kept int // tracks whose existing tags were left alone
+}
+
+// trackBPM runs "aubio tempo" on a track and returns its tempo rounded to a
+// whole number, as ID3's TBPM requires.
+func trackBPM(path string) (string, error) {
+	out, err := tools.Output("aubio", "tempo", path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 || f[1] != "bpm" {
+			continue
+		}
+		bpm, err := strconv.ParseFloat(f[0], 64)
+		if err != nil || bpm <= 0 {
+			break
+		}
+		return strconv.Itoa(int(math.Round(bpm))), nil
+	}
+	return "", errors.New("aubio found no tempo")
+}
+
+// trackKey runs keyfinder-cli on a track and returns its key in
+// KEY_NOTATION.
+func trackKey(path string) (string, error) {
+	out, err := tools.Output("keyfinder-cli", "-n", keyNotation(), path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" || strings.EqualFold(key, "silence") {
+		return "", errors.New("keyfinder-cli found no key")
+	}
+	return key, nil
+}
+
+// analysisStage tags each track's tempo (BPM) and musical key (INITIALKEY)
+// for DJ software. It is not in the default pipeline; add "analysis" to
+// PIPELINE_STAGES to run it. Tracks keep tags they already have unless
+// ANALYSIS_OVERWRITE=true, and a missing aubio or keyfinder-cli only loses
+// its half of the analysis.
+func analysisStage(a *AlbumRun) error {
+	doBPM := !a.Caps.degrade(&a.Result.Degraded, featureBPM)
+	doKey := !a.Caps.degrade(&a.Result.Degraded, featureKey)
+	if !doBPM && !doKey {
+		a.Logf("Skipping BPM/key analysis: " + a.Caps.missing[featureBPM] + ", " + a.Caps.missing[featureKey])
+		a.Result.Analysis.Skipped = true
+		return nil
+	}
+
+	a.Logf("Analysing BPM and key")
+	stats := &a.Result.AnalysisStats
+	overwrite := analysisOverwrite()
+	var errs []error
+	for _, t := range a.Tracks {
+		bpm, key := "", ""
+		if !overwrite {
+			bpm, key = metadata.ReadBPMKey(t)
+		}
+		tags := map[string]string{}
+		if doBPM && bpm == "" {
+			v, err := trackBPM(t)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(t), err))
+			} else {
+				tags["BPM"] = v
+			}
+		}
+		if doKey && key == "" {
+			v, err := trackKey(t)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(t), err))
+			} else {
+				tags["INITIALKEY"] = v
+			}
+		}
+		if len(tags) == 0 {
+			if bpm != "" || key != "" {
+				stats.Kept++
+			}
+			continue
+		}
+		if err := metadata.WriteTags(t, tags); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(t), err))
+			continue
+		}
+		if _, ok := tags["BPM"]; ok {
+			stats.BPM++
+		}
+		if _, ok := tags["INITIALKEY"]; ok {
+			stats.Key++
+		}
+	}
+	a.Logf(fmt.Sprintf("Tagged BPM on %d and key on %d tracks (%d kept their tags)", stats.BPM, stats.Key, stats.Kept))
+
+	a.Result.Analysis.Err = errors.Join(errs...)
+	if a.Result.Analysis.Failed() {
+		a.Logf(fmt.Sprintf("BPM/key analysis failed for some tracks: %v", a.Result.Analysis.Err))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// ArtFix records what an art backfill did (or, in a dry run, would do) to
+// one album, e.g. "cover embedded in 3 tracks".
+type ArtFix struct {
+	Dir     string   `json:"dir"` // relative to LIBRARY_DIR
+	Actions []string `json:"actions,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// ArtBackfillReport is the outcome of BackfillArt, also saved as
+// DATA_DIR/art-backfill.json.
+type ArtBackfillReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	Albums     int       `json:"albums"` // albums examined
+	Fixed      []ArtFix  `json:"fixed"`  // albums changed, or that failed to be
+}
+
+// BackfillArt gives every library album a cover file and embedded art in
+// every track. A missing cover file is taken from a track's embedded
+// picture, else downloaded from the Cover Art Archive for the release in
+// the tags (or found by searching MusicBrainz); tracks without a picture
+// then get the cover embedded. Journal checksums are refreshed for changed
+// albums. With dryRun nothing is written and the report lists what would
+// change.
+func BackfillArt(ctx context.Context, libraryDir string, dryRun bool, logf func(string)) (*ArtBackfillReport, error) {
+	report := &ArtBackfillReport{StartedAt: time.Now(), DryRun: dryRun, Fixed: []ArtFix{}}
+	dirs, err := libraryAlbumDirs(libraryDir)
+	if err != nil {
+		return report, err
+	}
+	for i, rel := range dirs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Albums++
+		fix := backfillAlbumArt(filepath.Join(libraryDir, rel), dryRun)
+		if len(fix.Actions) == 0 && fix.Error == "" {
+			continue
+		}
+		fix.Dir = rel
+		msg := strings.Join(fix.Actions, "; ")
+		if fix.Error != "" {
+			msg = strings.TrimPrefix(msg+"; failed: "+fix.Error, "; ")
+		}
+		logf(fmt.Sprintf("[%d/%d] %s: %s", i+1, len(dirs), rel, msg))
+		if !dryRun && len(fix.Actions) > 0 {
+			if err := library.RefreshJournalFiles(libraryDir, rel); err != nil {
+				logf(fmt.Sprintf("Could not update journal for %s: %v", rel, err))
+			}
+		}
+		report.Fixed = append(report.Fixed, fix)
+	}
+	report.FinishedAt = time.Now()
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		os.MkdirAll(library.DataDir(), 0755)
+		if err := os.WriteFile(filepath.Join(library.DataDir(), "art-backfill.json"), data, 0644); err != nil {
+			logf(fmt.Sprintf("Could not save art backfill report: %v", err))
+		}
+	}
+	return report, nil
+}
+
+// backfillAlbumArt fixes the art of one album directory.
+func backfillAlbumArt(albumDir string, dryRun bool) ArtFix {
+	var fix ArtFix
+	tracks, err := metadata.AudioFiles(albumDir)
+	if err != nil || len(tracks) == 0 {
+		return fix
+	}
+	var bare []string
+	var embedded []byte
+	for _, t := range tracks {
+		if f := metadata.AudioFormat(t); f != metadata.FormatMP3 && f != metadata.FormatFLAC {
+			continue // art is only read from and embedded into MP3 and FLAC
+		}
+		if data, err := extractEmbeddedArt(t); err == nil && len(data) > 0 {
+			if embedded == nil {
+				embedded = data
+			}
+		} else {
+			bare = append(bare, t)
+		}
+	}
+
+	cover, err := metadata.FindCoverImage(albumDir)
+	if err != nil {
+		switch {
+		case embedded != nil:
+			ext := "jpg"
+			if GuessMimeType(embedded) == "image/png" {
+				ext = "png"
+			}
+			cover = filepath.Join(albumDir, "cover."+ext)
+			fix.Actions = append(fix.Actions, "cover file from embedded art ("+filepath.Base(cover)+")")
+			if !dryRun {
+				if err := os.WriteFile(cover, embedded, 0644); err != nil {
+					fix.Error = err.Error()
+					return fix
+				}
+			}
+		case dryRun:
+			fix.Actions = append(fix.Actions, "cover file from the Cover Art Archive")
+			cover = ""
+		default:
+			md, err := metadata.ReadTags(tracks[0])
+			if err == nil {
+				err = DownloadCoverArt(albumDir, md, md.ReleaseMBID)
+				time.Sleep(time.Second) // MusicBrainz rate limit
+			}
+			if err != nil {
+				fix.Error = "no cover: " + err.Error()
+				return fix
+			}
+			if cover, err = metadata.FindCoverImage(albumDir); err != nil {
+				fix.Error = err.Error()
+				return fix
+			}
+			fix.Actions = append(fix.Actions, "cover file from the Cover Art Archive ("+filepath.Base(cover)+")")
+		}
+	}
+
+	if len(bare) == 0 {
+		return fix
+	}
+	fix.Actions = append(fix.Actions, fmt.Sprintf("cover embedded in %d tracks", len(bare)))
+	if dryRun || cover == "" {
+		return fix
+	}
+	data, err := os.ReadFile(cover)
+	if err != nil {
+		fix.Error = err.Error()
+		return fix
+	}
+	for _, t := range bare {
+		var err error
+		switch metadata.AudioFormat(t) {
+		case metadata.FormatMP3:
+			err = embedCoverMP3(t, data)
+		case metadata.FormatFLAC:
+			err = embedCoverFLAC(t, data)
+		}
+		if err != nil {
+			fix.Error = fmt.Sprintf("embedding into %s: %v", filepath.Base(t), err)
+			return fix
+		}
+	}
+	return fix
+}
@@ -0,0 +1,156 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Plexamp, Jellyfin and Kodi show artist.jpg as the artist's portrait and
+// fanart.jpg as the backdrop of its page.
+const (
+	artistImageName = "artist.jpg"
+	fanartImageName = "fanart.jpg"
+)
+
+// variousArtistsMBID is MusicBrainz's special "Various Artists" artist,
+// which has no picture worth fetching.
+const variousArtistsMBID = "89ad4ac3-39f7-470e-963a-56509c546377"
+
+// artistImagesEnabled reports whether ARTIST_IMAGES is on.
+func artistImagesEnabled() bool {
+	return os.Getenv("ARTIST_IMAGES") == "true"
+}
+
+// fanartArtistImages returns the URLs of fanart.tv's most liked portrait
+// and background for an artist. It needs FANART_API_KEY and returns nothing
+// without it.
+func fanartArtistImages(artistMBID string) (thumb, background string, err error) {
+	key := os.Getenv("FANART_API_KEY")
+	if key == "" || artistMBID == "" {
+		return "", "", nil
+	}
+	var resp struct {
+		Thumbs      []fanartCover `json:"artistthumb"`
+		Backgrounds []fanartCover `json:"artistbackground"`
+	}
+	data, err := httpGetBytes("https://webservice.fanart.tv/v3/music/" +
+		url.PathEscape(artistMBID) + "?api_key=" + url.QueryEscape(key))
+	if err != nil {
+		return "", "", err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", "", err
+	}
+	if len(resp.Thumbs) > 0 {
+		thumb = resp.Thumbs[0].URL
+	}
+	if len(resp.Backgrounds) > 0 {
+		background = resp.Backgrounds[0].URL
+	}
+	return thumb, background, nil
+}
+
+// deezerArtistPicture returns the URL of Deezer's picture of the artist
+// whose name matches exactly (ignoring case), or "" if there is none.
+// Deezer needs no API key.
+func deezerArtistPicture(name string) (string, error) {
+	var resp struct {
+		Data []struct {
+			Name       string `json:"name"`
+			PictureXL  string `json:"picture_xl"`
+			PictureBig string `json:"picture_big"`
+		} `json:"data"`
+	}
+	data, err := httpGetBytes("https://api.deezer.com/search/artist?limit=5&q=" + url.QueryEscape(name))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	for _, a := range resp.Data {
+		pic := metadata.FirstNonEmpty(a.PictureXL, a.PictureBig)
+		// Artists without a picture get a placeholder with an empty hash.
+		if strings.EqualFold(a.Name, name) && pic != "" && !strings.Contains(pic, "/artist//") {
+			return pic, nil
+		}
+	}
+	return "", nil
+}
+
+// saveJPEG downloads an image to path, re-encoding it if it isn't a JPEG.
+func saveJPEG(u, path string) error {
+	data, err := httpGetBytes(u)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if format != "jpeg" {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// fetchArtistImages saves artist.jpg and fanart.jpg into the artist folder
+// of an album just moved into the library, unless it already has them, so
+// they are only looked up on the first import of an artist. The portrait
+// comes from fanart.tv (by the album artist MBID in the tags) or else
+// Deezer (by name); the backdrop only from fanart.tv.
+func fetchArtistImages(libDir, albumDir string, md *metadata.MusicMetadata) error {
+	artistDir := library.ArtistDir(libDir, albumDir, md)
+	if artistDir == "" {
+		return nil
+	}
+	artistPath := filepath.Join(artistDir, artistImageName)
+	fanartPath := filepath.Join(artistDir, fanartImageName)
+	_, errArtist := os.Stat(artistPath)
+	_, errFanart := os.Stat(fanartPath)
+	if errArtist == nil && (errFanart == nil || os.Getenv("FANART_API_KEY") == "") {
+		return nil
+	}
+
+	name := metadata.FirstNonEmpty(md.AlbumArtist, md.Artist)
+	mbid := md.AlbumArtistMBID
+	if tracks, _ := metadata.AudioFiles(albumDir); mbid == "" && len(tracks) > 0 {
+		if t, err := metadata.ReadTags(tracks[0]); err == nil {
+			mbid = t.AlbumArtistMBID
+		}
+	}
+	if mbid == variousArtistsMBID || strings.EqualFold(name, "Various Artists") {
+		return nil
+	}
+
+	var errs []error
+	thumb, background, err := fanartArtistImages(mbid)
+	errs = append(errs, err)
+	if errArtist != nil {
+		if thumb == "" {
+			thumb, err = deezerArtistPicture(name)
+			errs = append(errs, err)
+		}
+		if thumb != "" {
+			errs = append(errs, saveJPEG(thumb, artistPath))
+		}
+	}
+	if errFanart != nil && background != "" {
+		errs = append(errs, saveJPEG(background, fanartPath))
+	}
+	return errors.Join(errs...)
+}
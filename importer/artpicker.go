@@ -0,0 +1,276 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// artCandidate is one cover image offered in the web UI's art picker.
+type artCandidate struct {
+	ID     string `json:"id"`     // "folder:<file>", "embedded", "caa:<id>" or "fanart:<id>"
+	Source string `json:"source"` // folder, embedded, coverartarchive, fanart
+	Label  string `json:"label"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int64  `json:"bytes"`
+	Format string `json:"format"` // jpeg, png
+}
+
+// artCacheDir holds downloaded and extracted candidates for one pending album
+// so the picker can show and later save them without fetching them again.
+func artCacheDir(albumPath string) string {
+	return filepath.Join(library.DataDir(), "art-candidates", hex.EncodeToString([]byte(filepath.Base(albumPath))))
+}
+
+// artCachePath is where a candidate's image bytes are kept.
+func artCachePath(albumPath, id string) string {
+	return filepath.Join(artCacheDir(albumPath), hex.EncodeToString([]byte(id)))
+}
+
+// describeImage fills in a candidate's dimensions, size and format.
+func describeImage(c *artCandidate, data []byte) {
+	c.Bytes = int64(len(data))
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		c.Width, c.Height, c.Format = cfg.Width, cfg.Height, format
+	}
+}
+
+// CollectArtCandidates gathers every cover image available for a pending
+// album: image files in the folder, art embedded in the first track, the
+// Cover Art Archive and fanart.tv. Remote and embedded images are cached in
+// artCacheDir. Failing sources are skipped.
+func CollectArtCandidates(albumPath string) ([]artCandidate, error) {
+	cache := artCacheDir(albumPath)
+	os.RemoveAll(cache)
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		return nil, err
+	}
+
+	candidates := []artCandidate{}
+	add := func(c artCandidate, data []byte, cached bool) {
+		if cached {
+			if err := os.WriteFile(artCachePath(albumPath, c.ID), data, 0644); err != nil {
+				return
+			}
+		}
+		describeImage(&c, data)
+		candidates = append(candidates, c)
+	}
+
+	entries, _ := os.ReadDir(albumPath)
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".jpg" && ext != ".jpeg" && ext != ".png") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(albumPath, e.Name()))
+		if err != nil {
+			continue
+		}
+		add(artCandidate{ID: "folder:" + e.Name(), Source: "folder", Label: e.Name()}, data, false)
+	}
+
+	if tracks, err := metadata.AudioFiles(albumPath); err == nil && len(tracks) > 0 {
+		if data, err := extractEmbeddedArt(tracks[0]); err == nil {
+			add(artCandidate{ID: "embedded", Source: "embedded", Label: "Embedded in " + filepath.Base(tracks[0])}, data, true)
+		}
+	}
+
+	mbid := albumReleaseMBID(albumPath)
+	if mbid == "" {
+		return candidates, nil
+	}
+
+	if imgs, err := coverArtArchiveFronts(mbid); err == nil {
+		for _, img := range imgs {
+			if data, err := httpGetBytes(img.Image); err == nil {
+				add(artCandidate{ID: "caa:" + img.ID.String(), Source: "coverartarchive", Label: "Cover Art Archive"}, data, true)
+			}
+		}
+	}
+
+	if rel, err := metadata.GetMBRelease(mbid); err == nil && rel.ReleaseGroup.ID != "" {
+		if covers, err := fanartAlbumCovers(rel.ReleaseGroup.ID); err == nil {
+			for _, fc := range covers {
+				if data, err := httpGetBytes(fc.URL); err == nil {
+					add(artCandidate{ID: "fanart:" + fc.ID, Source: "fanart", Label: "fanart.tv"}, data, true)
+				}
+			}
+		}
+	}
+
+	return candidates, nil
+}
+
+// albumReleaseMBID returns the release to look up remote art for: the one
+// picked in the web UI, else the one in the first track's tags.
+func albumReleaseMBID(albumPath string) string {
+	if st, err := LoadAlbumState(albumPath); err == nil && st.ReleaseMBID != "" {
+		return st.ReleaseMBID
+	}
+	tracks, err := metadata.AudioFiles(albumPath)
+	if err != nil || len(tracks) == 0 {
+		return ""
+	}
+	md, err := metadata.ReadTags(tracks[0])
+	if err != nil {
+		return ""
+	}
+	return md.ReleaseMBID
+}
+
+// extractEmbeddedArt returns the first picture embedded in an MP3 or FLAC file.
+func extractEmbeddedArt(path string) ([]byte, error) {
+	switch metadata.AudioFormat(path) {
+	case metadata.FormatMP3:
+		tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+		if err != nil {
+			return nil, err
+		}
+		defer tag.Close()
+		for _, f := range tag.GetFrames(tag.CommonID("Attached picture")) {
+			if pic, ok := f.(id3v2.PictureFrame); ok && len(pic.Picture) > 0 {
+				return pic.Picture, nil
+			}
+		}
+		return nil, errors.New("no embedded picture")
+
+	case metadata.FormatFLAC:
+		tmp, err := os.CreateTemp("", "embedded-art-*")
+		if err != nil {
+			return nil, err
+		}
+		tmp.Close()
+		defer os.Remove(tmp.Name())
+		if _, err := tools.Output("metaflac", "--export-picture-to="+tmp.Name(), path); err != nil {
+			return nil, fmt.Errorf("metaflac: %w", err)
+		}
+		return os.ReadFile(tmp.Name())
+	}
+	return nil, errors.New("unsupported format")
+}
+
+// caaImage is an entry in a Cover Art Archive release listing.
+type caaImage struct {
+	ID    json.Number `json:"id"`
+	Image string      `json:"image"`
+	Front bool        `json:"front"`
+	Types []string    `json:"types"`
+}
+
+// coverArtArchiveFronts lists the front cover images of a release.
+func coverArtArchiveFronts(mbid string) ([]caaImage, error) {
+	var listing struct {
+		Images []caaImage `json:"images"`
+	}
+	data, err := httpGetBytes("https://coverartarchive.org/release/" + url.PathEscape(mbid))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, err
+	}
+	var fronts []caaImage
+	for _, img := range listing.Images {
+		if img.Front || slices.Contains(img.Types, "Front") {
+			fronts = append(fronts, img)
+		}
+	}
+	return fronts, nil
+}
+
+// fanartCover is an album cover listed by fanart.tv.
+type fanartCover struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// fanartAlbumCovers lists fanart.tv album covers for a release group. It needs
+// FANART_API_KEY and returns nothing without it.
+func fanartAlbumCovers(releaseGroupMBID string) ([]fanartCover, error) {
+	key := os.Getenv("FANART_API_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	var resp struct {
+		Albums map[string]struct {
+			AlbumCover []fanartCover `json:"albumcover"`
+		} `json:"albums"`
+	}
+	data, err := httpGetBytes("https://webservice.fanart.tv/v3/music/albums/" +
+		url.PathEscape(releaseGroupMBID) + "?api_key=" + url.QueryEscape(key))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Albums[releaseGroupMBID].AlbumCover, nil
+}
+
+// httpGetBytes fetches url and returns the body of a 200 response.
+func httpGetBytes(u string) ([]byte, error) {
+	resp, err := metadata.HTTPGet(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", u, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ArtCandidateData returns the image bytes of a candidate listed by
+// collectArtCandidates.
+func ArtCandidateData(albumPath, id string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(id, "folder:"); ok {
+		if name != filepath.Base(name) {
+			return nil, errors.New("invalid candidate")
+		}
+		return os.ReadFile(filepath.Join(albumPath, name))
+	}
+	return os.ReadFile(artCachePath(albumPath, id))
+}
+
+// SaveArtCandidate makes a candidate the album's cover: it replaces any
+// existing cover files with cover.jpg or cover.png, which the pipeline then
+// embeds into every track.
+func SaveArtCandidate(albumPath, id string) error {
+	data, err := ArtCandidateData(albumPath, id)
+	if err != nil {
+		return err
+	}
+	ext := "jpg"
+	if GuessMimeType(data) == "image/png" {
+		ext = "png"
+	}
+
+	entries, _ := os.ReadDir(albumPath)
+	for _, e := range entries {
+		if !e.IsDir() && slices.Contains(metadata.CoverNames, strings.ToLower(e.Name())) {
+			if _, err := library.MoveToTrash(filepath.Join(albumPath, e.Name()), "replaced cover", nil); err != nil {
+				return err
+			}
+		}
+	}
+	return os.WriteFile(filepath.Join(albumPath, "cover."+ext), data, 0644)
+}
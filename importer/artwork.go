@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// artworkExts are the file types kept as album artwork: scans and photos of
+// the back cover, disc and booklet, and booklet PDFs.
+var artworkExts = []string{".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".pdf"}
+
+// artworkDir returns ARTWORK_DIR, the album subfolder artwork is moved
+// into (default "Artwork"), or "" when it is "none" and artwork is left in
+// the import folder.
+func artworkDir() string {
+	dir := strings.Trim(os.Getenv("ARTWORK_DIR"), `/\ `)
+	switch {
+	case dir == "":
+		return "Artwork"
+	case strings.EqualFold(dir, "none"):
+		return ""
+	}
+	return dir
+}
+
+// artworkFiles returns the artwork in an album folder beside the front
+// cover (back.jpg, disc.png, Scans/01.jpg, booklet.pdf, …), mapped to its
+// name in the library: its path relative to the album under artworkDir, a
+// leading folder of the same name dropped so Artwork/back.jpg stays put.
+// Artwork matching JUNK_MOVE goes here too; cover file names, JUNK_DELETE
+// and JUNK_EXCLUDE are left alone.
+func artworkFiles(albumPath string) (map[string]string, error) {
+	dir := artworkDir()
+	if dir == "" {
+		return nil, nil
+	}
+	delPats, exclude := junkDeletePatterns(), junkExcludePatterns()
+	out := map[string]string{}
+	err := filepath.WalkDir(albumPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || albumOwnFile(d.Name()) || strings.HasPrefix(d.Name(), ".") {
+			return err
+		}
+		if !slices.Contains(artworkExts, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		rel, _ := filepath.Rel(albumPath, path)
+		if matchGlobs(exclude, rel) || matchGlobs(delPats, rel) {
+			return nil
+		}
+		if first, rest, ok := strings.Cut(filepath.ToSlash(rel), "/"); ok && strings.EqualFold(first, dir) {
+			rel = rest
+		}
+		out[path] = filepath.Join(dir, rel)
+		return nil
+	})
+	return out, err
+}
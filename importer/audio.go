@@ -0,0 +1,86 @@
+package importer
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// applyReplayGain runs rsgain in "easy" mode on a directory. With
+// REPLAYGAIN_REFERENCE set it runs "custom" mode instead, targeting that
+// loudness, once per folder of tracks as easy mode treats each as an album.
+func applyReplayGain(path string) error {
+	fmt.Println("→ Applying ReplayGain:", path)
+	ref, ok := replayGainReference()
+	if !ok {
+		return tools.Run("rsgain", "easy", path)
+	}
+	albums := map[string][]string{}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && metadata.IsAudioFile(p) {
+			albums[filepath.Dir(p)] = append(albums[filepath.Dir(p)], p)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range slices.Sorted(maps.Keys(albums)) {
+		args := []string{"custom", "-a", "-s", "i", "-c", "p", "-l", strconv.FormatFloat(ref, 'f', -1, 64)}
+		if err := tools.Run("rsgain", append(args, albums[dir]...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanAlbumTags strips COMMENT and DESCRIPTION tags from all files in dir.
+func cleanAlbumTags(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := rmDescAndCommentTags(filepath.Join(dir, e.Name())); err != nil {
+			fmt.Println("Failed to clean comment and description tags:", err)
+		}
+	}
+	return nil
+}
+
+// convertID3Tags rewrites MP3 tags the stages didn't touch in the
+// ID3_VERSION and ID3_ENCODING policy (see metadata.OpenID3).
+func convertID3Tags(a *AlbumRun) {
+	n := 0
+	for _, t := range a.Tracks {
+		converted, err := metadata.ConvertID3(t)
+		if err != nil {
+			a.Logf(fmt.Sprintf("Could not convert ID3 tag of %s: %v", filepath.Base(t), err))
+		} else if converted {
+			n++
+		}
+	}
+	if n > 0 {
+		a.Logf(fmt.Sprintf("Converted %d ID3 tags to the configured version and encoding", n))
+	}
+}
+
+// rmDescAndCommentTags removes COMMENT and DESCRIPTION tags from a single file.
+// Currently only handles FLAC; other formats are silently skipped.
+func rmDescAndCommentTags(trackpath string) error {
+	if strings.HasSuffix(strings.ToLower(trackpath), ".flac") {
+		return tools.Run("metaflac", "--remove-tag=COMMENT", "--remove-tag=DESCRIPTION", trackpath)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// audiobookDir returns AUDIOBOOK_DIR, the local library audiobooks and
+// podcasts are moved into. The audiobook profile is off when it is unset.
+func audiobookDir() string {
+	return os.Getenv("AUDIOBOOK_DIR")
+}
+
+// audiobookGenres returns AUDIOBOOK_GENRES, the lower-cased genre tags that
+// mark a folder as an audiobook or podcast.
+func audiobookGenres() []string {
+	raw := os.Getenv("AUDIOBOOK_GENRES")
+	if raw == "" {
+		raw = "audiobook,audiobooks,podcast"
+	}
+	var out []string
+	for _, g := range strings.Split(raw, ",") {
+		if g = strings.ToLower(strings.TrimSpace(g)); g != "" {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// audiobookTracks returns the files of albumPath to import with the
+// audiobook profile, or nil when the folder is music: it must contain an
+// .m4b file or have a genre listed in AUDIOBOOK_GENRES.
+func audiobookTracks(albumPath string) []string {
+	if audiobookDir() == "" {
+		return nil
+	}
+	tracks, err := metadata.AudiobookFiles(albumPath)
+	if err != nil || len(tracks) == 0 {
+		return nil
+	}
+	for _, t := range tracks {
+		if strings.EqualFold(filepath.Ext(t), ".m4b") {
+			return tracks
+		}
+	}
+	md, err := metadata.ReadTags(tracks[0])
+	if err != nil {
+		return nil
+	}
+	genre := strings.ToLower(strings.TrimSpace(md.Genre))
+	for _, g := range audiobookGenres() {
+		if genre == g {
+			return tracks
+		}
+	}
+	return nil
+}
+
+// audiobookStages is the pipeline for audiobooks and podcasts. It leaves
+// out tag cleanup (descriptions are the book's blurb), lyrics and
+// ReplayGain, and never rewrites the audio files, so chapters survive.
+var audiobookStages = []Stage{
+	NewStage("metadata", audiobookMetadataStage),
+	NewStage("cover", audiobookCoverStage),
+	NewStage("move", moveStage),
+}
+
+// audiobookMetadataStage takes the author and title from the file's own
+// tags; MusicBrainz knows nothing about most audiobooks.
+func audiobookMetadataStage(a *AlbumRun) error {
+	md, err := metadata.ReadTags(a.Tracks[0])
+	a.Result.TagMetadata.Err = err
+	if err != nil {
+		return err
+	}
+	md.Audiobook = true
+	a.Result.Metadata = md
+	a.Result.MetadataSource = metadata.SourceFileTags
+	a.Logf(fmt.Sprintf("Audiobook: %s — %s", metadata.FirstNonEmpty(md.AlbumArtist, md.Artist), md.Album))
+	return nil
+}
+
+// audiobookCoverStage records a cover image found in the folder without
+// downloading or embedding one.
+func audiobookCoverStage(a *AlbumRun) error {
+	if coverImg, err := metadata.FindCoverImage(a.Result.Path); err == nil {
+		a.Result.CoverArtStats.Found = true
+		a.Result.CoverArtStats.Source = filepath.Base(coverImg)
+		a.Result.Palette = library.AlbumPalette(a.Result.Path)
+	} else {
+		a.Result.CoverArt.Skipped = true
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// backfillCheckpoint is what a resumable library backfill saves after every
+// album, in DATA_DIR/<name>-backfill.json, so an interrupted run picks up
+// where it stopped.
+type backfillCheckpoint[S any] struct {
+	name      string
+	StartedAt time.Time       `json:"started_at"`
+	Done      map[string]bool `json:"done"` // album directories relative to LIBRARY_DIR
+	Stats     S               `json:"stats"`
+}
+
+func backfillCheckpointPath(name string) string {
+	return filepath.Join(library.DataDir(), name+"-backfill.json")
+}
+
+// loadBackfillCheckpoint returns the saved progress of the named backfill,
+// or a fresh checkpoint when there is none or restart is set.
+func loadBackfillCheckpoint[S any](name string, restart bool) *backfillCheckpoint[S] {
+	fresh := &backfillCheckpoint[S]{name: name, StartedAt: time.Now(), Done: map[string]bool{}}
+	if restart {
+		os.Remove(backfillCheckpointPath(name))
+		return fresh
+	}
+	data, err := os.ReadFile(backfillCheckpointPath(name))
+	if err != nil {
+		return fresh
+	}
+	cp := &backfillCheckpoint[S]{name: name}
+	if err := json.Unmarshal(data, cp); err != nil || cp.Done == nil {
+		return fresh
+	}
+	return cp
+}
+
+func (cp *backfillCheckpoint[S]) save() error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(library.DataDir(), 0755); err != nil {
+		return err
+	}
+	path := backfillCheckpointPath(cp.name)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// finish removes the checkpoint once the whole library has been walked.
+func (cp *backfillCheckpoint[S]) finish() {
+	os.Remove(backfillCheckpointPath(cp.name))
+}
+
+// libraryAlbumDirs returns every directory under libraryDir that holds
+// audio files, relative to it, skipping hidden directories and DATA_DIR.
+func libraryAlbumDirs(libraryDir string) ([]string, error) {
+	dataDir := library.DataDir()
+	var dirs []string
+	err := filepath.WalkDir(libraryDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path == dataDir || path == library.TrashDir() || (path != libraryDir && strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if tracks, _ := metadata.AudioFiles(path); len(tracks) > 0 {
+			rel, _ := filepath.Rel(libraryDir, path)
+			dirs = append(dirs, rel)
+		}
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs, err
+}
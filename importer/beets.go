@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// "Match (96.8%):" (beets 1.5+) or "(Similarity: 96.8%)" (older).
+	beetsSimilarity = regexp.MustCompile(`(?:Match \(|Similarity: )([0-9.]+)%`)
+	beetsReleaseURL = regexp.MustCompile(`musicbrainz\.org/release/([0-9a-f-]{36})`)
+)
+
+// parseBeetsOutput extracts the first applied match from the output of
+// `beet import`. It returns nil when beets did not apply a match, e.g. when
+// it printed "Skipping." or found no candidates.
+func parseBeetsOutput(out string) *metadata.Match {
+	lines := strings.Split(ansiEscape.ReplaceAllString(out, ""), "\n")
+	for i, line := range lines {
+		m := beetsSimilarity.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		match := &metadata.Match{}
+		match.Similarity, _ = strconv.ParseFloat(m[1], 64)
+
+		// The "Artist - Album" line follows "Match (…):" directly; older
+		// versions print it under "Tagging:" before the similarity.
+		title := ""
+		if strings.Contains(line, "Match (") && i+1 < len(lines) {
+			title = lines[i+1]
+		} else {
+			for j := i - 1; j > 0; j-- {
+				if strings.TrimSpace(lines[j-1]) == "Tagging:" {
+					title = lines[j]
+					break
+				}
+			}
+		}
+		if artist, album, ok := strings.Cut(strings.TrimSpace(title), " - "); ok {
+			match.Artist, match.Album = artist, album
+		}
+
+		// The release URL comes within a few lines either side.
+		for j := max(0, i-4); j < min(len(lines), i+8); j++ {
+			if u := beetsReleaseURL.FindStringSubmatch(lines[j]); u != nil {
+				match.ReleaseMBID = u[1]
+				match.ReleaseURL = "https://musicbrainz.org/release/" + u[1]
+				break
+			}
+		}
+		return match
+	}
+	return nil
+}
+
+// beetsMinSimilarity returns BEETS_MIN_SIMILARITY, the lowest match
+// similarity in percent beets may apply unattended, or 0 to keep beets' own
+// threshold.
+func beetsMinSimilarity() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("BEETS_MIN_SIMILARITY"), 64)
+	if err != nil || v <= 0 || v > 100 {
+		return 0
+	}
+	return v
+}
+
+// beetsThresholdConfig writes a beets config overlay that makes quiet imports
+// accept only matches at least min percent similar, and returns its path.
+// beets expresses the threshold as a distance: 1 - similarity.
+func beetsThresholdConfig(min float64) (string, error) {
+	f, err := os.CreateTemp("", "beets-config-*.yaml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "match:\n  strong_rec_thresh: %.4f\n", 1-min/100)
+	return f.Name(), err
+}
+
+// beetsDir returns the directory beets runs with as BEETSDIR: the inherited
+// BEETSDIR if set, else DATA_DIR/beets, so imports never touch the user's own
+// beets library and config.
+func beetsDir() string {
+	return cmp.Or(os.Getenv("BEETSDIR"), filepath.Join(library.DataDir(), "beets"))
+}
+
+// beetsCommand returns a beet invocation of the given subcommand with the
+// configured global options (BEETS_CONFIG, BEETS_LIBRARY and overlay configs
+// in extraConfigs) before it and BEETS_FLAGS right after it.
+func beetsCommand(subcommand string, extraConfigs []string, args ...string) (tools.Command, error) {
+	dir := beetsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return tools.Command{}, fmt.Errorf("beets: could not create %s: %w", dir, err)
+	}
+	var global []string
+	if conf := os.Getenv("BEETS_CONFIG"); conf != "" {
+		global = append(global, "-c", conf)
+	}
+	for _, conf := range extraConfigs {
+		global = append(global, "-c", conf)
+	}
+	if lib := os.Getenv("BEETS_LIBRARY"); lib != "" {
+		global = append(global, "-l", lib)
+	}
+	global = append(global, subcommand)
+	global = append(global, strings.Fields(os.Getenv("BEETS_FLAGS"))...)
+	args = append(global, args...)
+	return tools.Command{Name: "beet", Args: args, Env: []string{"BEETSDIR=" + dir}, Echo: true}, nil
+}
@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// Optional pipeline features that can be lost to a missing tool or setting.
+const (
+	featureBeets            = "beets tagging"
+	featureReplayGain       = "ReplayGain"
+	featureTagCleanup       = "FLAC tag cleanup"
+	featurePlaybackThrottle = "playback throttling"
+	featureBPM              = "BPM analysis"
+	featureKey              = "key analysis"
+)
+
+// capabilities records which optional features are unavailable for a run and
+// why. It is probed once at the start of each run.
+type capabilities struct {
+	missing map[string]string // feature → reason
+}
+
+func probeCapabilities() capabilities {
+	c := capabilities{missing: map[string]string{}}
+	required := map[string]string{
+		featureBeets:      "beet",
+		featureReplayGain: "rsgain",
+		featureTagCleanup: "metaflac",
+		featureBPM:        "aubio",
+		featureKey:        "keyfinder-cli",
+	}
+	if !usesBeets() {
+		delete(required, featureBeets)
+	}
+	for feature, tool := range required {
+		if _, err := tools.LookPath(tool); err != nil {
+			c.missing[feature] = tool + " not found"
+		}
+	}
+	if mediaServerThrottleEnabled() && os.Getenv("JELLYFIN_URL") == "" && os.Getenv("PLEX_URL") == "" {
+		c.missing[featurePlaybackThrottle] = "MEDIA_SERVER_THROTTLE is on but neither JELLYFIN_URL nor PLEX_URL is set"
+	}
+	reason := offlineReason()
+	if reason != "" {
+		c.missing[featureNetwork] = reason
+	}
+	metadata.SetOffline(reason != "")
+	return c
+}
+
+// degrade reports whether feature is unavailable, adding it to list if so.
+func (c capabilities) degrade(list *[]string, feature string) bool {
+	if _, ok := c.missing[feature]; !ok {
+		return false
+	}
+	*list = append(*list, feature)
+	return true
+}
+
+// hasFLAC reports whether any of tracks is a FLAC file.
+func hasFLAC(tracks []string) bool {
+	for _, t := range tracks {
+		if metadata.AudioFormat(t) == metadata.FormatFLAC {
+			return true
+		}
+	}
+	return false
+}
+
+// Degradation is one line of a run's capability report: an optional feature
+// that some albums were imported without.
+type Degradation struct {
+	Feature string `json:"feature"`
+	Reason  string `json:"reason"`
+	Albums  int    `json:"albums"`
+}
+
+func (d Degradation) String() string {
+	noun := "albums"
+	if d.Albums == 1 {
+		noun = "album"
+	}
+	return fmt.Sprintf("%s — %d %s imported without %s", d.Reason, d.Albums, noun, d.Feature)
+}
+
+// degradationReport counts, per missing feature, the albums that went without
+// it, in a stable feature order.
+func degradationReport(c capabilities, albums []*AlbumResult) []Degradation {
+	var out []Degradation
+	for _, feature := range []string{featureNetwork, featureBeets, featureTagCleanup, featureReplayGain, featurePlaybackThrottle, featureBPM, featureKey} {
+		reason, ok := c.missing[feature]
+		if !ok {
+			continue
+		}
+		n := 0
+		for _, a := range albums {
+			for _, f := range a.Degraded {
+				if f == feature {
+					n++
+					break
+				}
+			}
+		}
+		if n > 0 {
+			out = append(out, Degradation{Feature: feature, Reason: reason, Albums: n})
+		}
+	}
+	return out
+}
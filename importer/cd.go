@@ -0,0 +1,208 @@
+package importer
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// CDRipper returns the configured ripper, from CD_RIPPER ("whipper" or
+// "abcde"). CD import is disabled when it is unset.
+func CDRipper() string {
+	switch r := strings.ToLower(os.Getenv("CD_RIPPER")); r {
+	case "whipper", "abcde":
+		return r
+	}
+	return ""
+}
+
+// CDDevice returns CD_DEVICE, defaulting to /dev/cdrom.
+func CDDevice() string {
+	if d := os.Getenv("CD_DEVICE"); d != "" {
+		return d
+	}
+	return "/dev/cdrom"
+}
+
+// discIDPattern matches the disc ID line whipper prints and writes to its
+// rip logs, e.g. "MusicBrainz disc id: Wn8eRBtfLDfM0qjYPdxrz.Zjs_U-".
+var discIDPattern = regexp.MustCompile(`(?i)MusicBrainz disc id:?\s+([A-Za-z0-9._-]{28})`)
+
+// readDiscID asks the ripper for the MusicBrainz disc ID of the inserted
+// disc. Only whipper reports one; abcde returns "".
+func readDiscID(device string) (string, error) {
+	if CDRipper() != "whipper" {
+		return "", nil
+	}
+	out, err := exec.Command("whipper", "cd", "-d", device, "info").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("whipper cd info: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if m := discIDPattern.FindSubmatch(out); m != nil {
+		return string(m[1]), nil
+	}
+	return "", nil
+}
+
+// discIDFromRipLog looks for a disc ID in the rip logs of an album folder,
+// so existing whipper output directories get the same match hint.
+func discIDFromRipLog(albumPath string) string {
+	logs, _ := filepath.Glob(filepath.Join(albumPath, "*.log"))
+	for _, l := range logs {
+		data, err := os.ReadFile(l)
+		if err != nil {
+			continue
+		}
+		if m := discIDPattern.FindSubmatch(data); m != nil {
+			return string(m[1])
+		}
+	}
+	return ""
+}
+
+// releaseForDiscID looks a disc ID up on MusicBrainz and returns the
+// preferred matching release, or "" if there is none. If the TOC is known it
+// is sent too, so MusicBrainz can fall back to a fuzzy TOC match for discs
+// whose ID it has not seen.
+func releaseForDiscID(discID string, toc *metadata.TOC) (string, error) {
+	var result struct {
+		Releases []metadata.MBRelease `json:"releases"`
+	}
+	path := fmt.Sprintf("/ws/2/discid/%s?fmt=json&inc=artist-credits", url.PathEscape(discID))
+	if toc != nil {
+		path += "&toc=" + toc.Query()
+	}
+	if err := metadata.MBGet(path, &result); err != nil {
+		return "", err
+	}
+	if best := metadata.PickBestRelease(result.Releases); best != nil {
+		return best.ID, nil
+	}
+	return "", nil
+}
+
+// releaseFromDiscID resolves the release of a CD rip from the disc ID in its
+// state file or rip log, or one computed from the TOC in a rip log or cue
+// sheet. It returns "" when there is no disc ID or no match.
+func releaseFromDiscID(albumPath string, st *AlbumState) string {
+	toc := metadata.AlbumTOC(albumPath)
+	discID := metadata.FirstNonEmpty(st.DiscID, discIDFromRipLog(albumPath))
+	if discID == "" && toc != nil {
+		discID = toc.DiscID()
+		fmt.Println("→ Computed disc ID from TOC:", discID)
+	}
+	if discID == "" {
+		return ""
+	}
+	id, err := releaseForDiscID(discID, toc)
+	if err != nil {
+		fmt.Println("Disc ID lookup failed:", err)
+		return ""
+	}
+	if id != "" {
+		fmt.Println("→ Using release matched by disc ID:", id)
+	}
+	return id
+}
+
+// ripCommand builds the ripper invocation writing into outDir.
+func ripCommand(ripper, device, outDir string) (*exec.Cmd, error) {
+	switch ripper {
+	case "whipper":
+		return exec.Command("whipper", "cd", "-d", device, "rip",
+			"--output-directory", outDir, "--unknown"), nil
+	case "abcde":
+		// abcde reads its output location from a config file, not flags.
+		conf := filepath.Join(outDir, ".abcde.conf")
+		body := fmt.Sprintf("OUTPUTDIR=%q\nWAVOUTPUTDIR=%q\nOUTPUTTYPE=flac\n", outDir, outDir)
+		if err := os.WriteFile(conf, []byte(body), 0644); err != nil {
+			return nil, err
+		}
+		return exec.Command("abcde", "-c", conf, "-d", device, "-N", "-x"), nil
+	}
+	return nil, fmt.Errorf("CD_RIPPER is not set")
+}
+
+// RipCD rips the inserted disc into a staging folder in importDir, then
+// publishes every album folder it produced with the disc ID and matching
+// release recorded in its state file, so the pipeline tags from that
+// release. It returns the new album folder names.
+func RipCD(importDir string, logf func(string)) ([]string, error) {
+	ripper, device := CDRipper(), CDDevice()
+	if ripper == "" {
+		return nil, fmt.Errorf("CD_RIPPER is not set")
+	}
+	if _, err := os.Stat(device); err != nil {
+		return nil, fmt.Errorf("no CD device at %s", device)
+	}
+
+	discID, err := readDiscID(device)
+	if err != nil {
+		logf(fmt.Sprintf("Could not read disc ID: %v", err))
+	}
+	releaseID := ""
+	if discID != "" {
+		logf("Disc ID: " + discID)
+		if releaseID, err = releaseForDiscID(discID, nil); err != nil {
+			logf(fmt.Sprintf("Disc ID lookup failed: %v", err))
+		} else if releaseID != "" {
+			logf("Matched release: " + releaseID)
+		}
+	}
+
+	staging, err := os.MkdirTemp(importDir, ".rip-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	cmd, err := ripCommand(ripper, device, staging)
+	if err != nil {
+		return nil, err
+	}
+	logf(fmt.Sprintf("Ripping %s with %s…", device, ripper))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", ripper, err)
+	}
+
+	// Rippers nest output as Artist/Album or "Artist - Album"; publish every
+	// directory holding audio as an album folder.
+	var albums []string
+	err = filepath.WalkDir(staging, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		tracks, _ := metadata.AudioFiles(path)
+		if len(tracks) == 0 {
+			return nil
+		}
+		if discID == "" {
+			discID = discIDFromRipLog(path)
+		}
+		st := &AlbumState{DiscID: discID, ReleaseMBID: releaseID}
+		if err := SaveAlbumState(path, st); err != nil {
+			return err
+		}
+		dst := UniqueDir(filepath.Join(importDir, filepath.Base(path)))
+		if err := os.Rename(path, dst); err != nil {
+			return err
+		}
+		albums = append(albums, filepath.Base(dst))
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return albums, err
+	}
+	if len(albums) == 0 {
+		return nil, fmt.Errorf("%s produced no audio files", ripper)
+	}
+	return albums, nil
+}
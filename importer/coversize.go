@@ -0,0 +1,157 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Where an album's cover came from, as recorded in CoverArtStats.Origin and
+// the journal.
+const (
+	coverFromFolder = "folder"
+	coverFromCAA    = "coverartarchive"
+	coverFromITunes = "itunes"
+)
+
+// minCoverSize returns COVER_MIN_SIZE, the smallest acceptable cover, as
+// "500" (square) or "500x500". Unset or invalid, it is 0×0 and any cover is
+// kept.
+func minCoverSize() (w, h int) {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("COVER_MIN_SIZE")))
+	ws, hs, found := strings.Cut(raw, "x")
+	if !found {
+		hs = ws
+	}
+	w, errW := strconv.Atoi(ws)
+	h, errH := strconv.Atoi(hs)
+	if errW != nil || errH != nil || w < 0 || h < 0 {
+		return 0, 0
+	}
+	return w, h
+}
+
+// imageSize returns the pixel dimensions of an image file.
+func imageSize(path string) (w, h int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	return cfg.Width, cfg.Height, err
+}
+
+// itunesCoverURL finds an album in the iTunes Store and returns its artwork
+// URL at the largest size the store serves.
+func itunesCoverURL(artist, album string) (string, error) {
+	var resp struct {
+		Results []struct {
+			ArtistName     string `json:"artistName"`
+			CollectionName string `json:"collectionName"`
+			ArtworkURL100  string `json:"artworkUrl100"`
+		} `json:"results"`
+	}
+	data, err := httpGetBytes("https://itunes.apple.com/search?entity=album&limit=10&term=" + url.QueryEscape(artist+" "+album))
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	// The store titles EPs and singles "Title - EP" and "Title - Single".
+	title := func(s string) string {
+		s = strings.ToLower(s)
+		return strings.TrimSuffix(strings.TrimSuffix(s, " - ep"), " - single")
+	}
+	for _, r := range resp.Results {
+		if strings.EqualFold(r.ArtistName, artist) && title(r.CollectionName) == title(album) && r.ArtworkURL100 != "" {
+			return strings.Replace(r.ArtworkURL100, "100x100bb", "3000x3000bb", 1), nil
+		}
+	}
+	return "", fmt.Errorf("%q by %q is not in the iTunes Store", album, artist)
+}
+
+// upgradeCover replaces an album's cover when it is smaller than
+// COVER_MIN_SIZE with the largest bigger one found: the Cover Art Archive's
+// original for the matched release (unless that is where the cover came
+// from) and the iTunes Store's artwork. The old cover goes to the trash.
+// It returns where the album's cover now comes from.
+func upgradeCover(a *AlbumRun, cover, origin string) string {
+	minW, minH := minCoverSize()
+	w, h, err := imageSize(cover)
+	md := a.Result.Metadata
+	if (minW == 0 && minH == 0) || err != nil || (w >= minW && h >= minH) || md == nil || a.offline() {
+		return origin
+	}
+	a.Logf(fmt.Sprintf("Cover art is %d×%d, below %d×%d; looking for a larger one", w, h, minW, minH))
+
+	type candidate struct {
+		origin string
+		data   []byte
+		w, h   int
+	}
+	var found []candidate
+	consider := func(origin string, data []byte, err error) {
+		if err != nil {
+			a.Logf(fmt.Sprintf("No larger cover from %s: %v", origin, err))
+			return
+		}
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			found = append(found, candidate{origin, data, cfg.Width, cfg.Height})
+		}
+	}
+	if mbid := metadata.FirstNonEmpty(a.MBID, md.ReleaseMBID); mbid != "" && origin != coverFromCAA {
+		data, _, err := fetchCoverArtArchiveFront(mbid)
+		consider(coverFromCAA, data, err)
+	}
+	if u, err := itunesCoverURL(metadata.FirstNonEmpty(md.AlbumArtist, md.Artist), md.Album); err != nil {
+		consider(coverFromITunes, nil, err)
+	} else {
+		data, err := httpGetBytes(u)
+		consider(coverFromITunes, data, err)
+	}
+
+	var best *candidate
+	for i, c := range found {
+		if c.w*c.h > w*h && (best == nil || c.w*c.h > best.w*best.h) {
+			best = &found[i]
+		}
+	}
+	if best == nil {
+		a.Logf(fmt.Sprintf("No cover larger than %d×%d found; keeping it", w, h))
+		return origin
+	}
+	ext := "jpg"
+	if bytes.HasPrefix(best.data, []byte{0x89, 0x50, 0x4E, 0x47}) {
+		ext = "png"
+	}
+	dest := filepath.Join(filepath.Dir(cover), "cover."+ext)
+	if err := os.WriteFile(dest+".tmp", best.data, 0644); err != nil {
+		a.Logf(fmt.Sprintf("Could not write cover: %v", err))
+		return origin
+	}
+	if _, err := library.MoveToTrash(cover, "low-resolution cover", nil); err != nil {
+		os.Remove(dest + ".tmp")
+		a.Logf(fmt.Sprintf("Could not replace low-resolution cover: %v", err))
+		return origin
+	}
+	if err := os.Rename(dest+".tmp", dest); err != nil {
+		a.Logf(fmt.Sprintf("Could not write cover: %v", err))
+		return origin
+	}
+	a.Logf(fmt.Sprintf("Replaced cover art with %d×%d from %s", best.w, best.h, best.origin))
+	if best.w < minW || best.h < minH {
+		a.Logf(fmt.Sprintf("Cover art is still below %d×%d", minW, minH))
+	}
+	return best.origin
+}
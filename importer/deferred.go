@@ -0,0 +1,285 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Enrichment tasks that can be retried on a library album after the import,
+// in the order they run: ones deferred by an offline import, and ones that
+// failed on a transient error.
+const (
+	deferMetadata = "metadata" // MusicBrainz release tags
+	deferGenre    = "genre"
+	deferCover    = "cover"
+	deferLyrics   = "lyrics"
+)
+
+var deferredOrder = []string{deferMetadata, deferGenre, deferCover, deferLyrics}
+
+// deferTask records a task to retry on the album once it is in the library.
+func (a *AlbumRun) deferTask(task string) {
+	if !slices.Contains(a.Deferred, task) {
+		a.Deferred = append(a.Deferred, task)
+	}
+}
+
+// DeferredAlbum is a library album with enrichment tasks still to run.
+type DeferredAlbum struct {
+	Dir         string    `json:"dir"` // absolute
+	Tasks       []string  `json:"tasks"`
+	QueuedAt    time.Time `json:"queued_at"`
+	Attempts    int       `json:"attempts,omitempty"` // retries that left tasks failed
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// retryMaxAttempts returns ENRICH_RETRY_MAX (default 6), how many retries
+// an album's tasks get before they are given up on.
+func retryMaxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("ENRICH_RETRY_MAX")); err == nil && n > 0 {
+		return n
+	}
+	return 6
+}
+
+// retryBackoff returns ENRICH_RETRY_BACKOFF (default 15m), the wait before
+// the first retry; it doubles after each failed one, up to a day.
+func retryBackoff(attempts int) time.Duration {
+	d := 15 * time.Minute
+	if v, err := time.ParseDuration(os.Getenv("ENRICH_RETRY_BACKOFF")); err == nil && v > 0 {
+		d = v
+	}
+	for i := 0; i < attempts && d < 24*time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, 24*time.Hour)
+}
+
+var deferredMu sync.Mutex
+
+func deferredPath() string {
+	return filepath.Join(library.DataDir(), "deferred.json")
+}
+
+// DeferredAlbums returns the albums with enrichment tasks waiting.
+func DeferredAlbums() ([]DeferredAlbum, error) {
+	deferredMu.Lock()
+	defer deferredMu.Unlock()
+	return loadDeferred()
+}
+
+func loadDeferred() ([]DeferredAlbum, error) {
+	data, err := os.ReadFile(deferredPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return []DeferredAlbum{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var out []DeferredAlbum
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func saveDeferred(albums []DeferredAlbum) error {
+	if len(albums) == 0 {
+		if err := os.Remove(deferredPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(albums, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(library.DataDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(deferredPath(), data, 0644)
+}
+
+// queueDeferred adds tasks for the library album in dir to
+// DATA_DIR/deferred.json, merging them with any already queued for it. The
+// first attempt is due straight away; after an offline import that means
+// the next online run.
+func queueDeferred(dir string, tasks []string) error {
+	deferredMu.Lock()
+	defer deferredMu.Unlock()
+	albums, err := loadDeferred()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if i := slices.IndexFunc(albums, func(d DeferredAlbum) bool { return d.Dir == dir }); i >= 0 {
+		for _, t := range tasks {
+			if !slices.Contains(albums[i].Tasks, t) {
+				albums[i].Tasks = append(albums[i].Tasks, t)
+			}
+		}
+		albums[i].Attempts, albums[i].NextAttempt = 0, now
+	} else {
+		albums = append(albums, DeferredAlbum{Dir: dir, Tasks: tasks, QueuedAt: now, NextAttempt: now})
+	}
+	return saveDeferred(albums)
+}
+
+// RunDeferred runs the queued tasks of every album that is due (or all of
+// them, with force), in deferredOrder. Albums whose tasks all succeed leave
+// the queue; failed tasks are retried after an exponential backoff, up to
+// ENRICH_RETRY_MAX times. Albums no longer in the library are dropped. It
+// returns how many albums it worked on.
+func RunDeferred(force bool, logf func(string)) (int, error) {
+	deferredMu.Lock()
+	defer deferredMu.Unlock()
+	albums, err := loadDeferred()
+	if err != nil || len(albums) == 0 {
+		return 0, err
+	}
+	now := time.Now()
+	var remaining []DeferredAlbum
+	n := 0
+	for _, d := range albums {
+		if !force && d.NextAttempt.After(now) {
+			remaining = append(remaining, d)
+			continue
+		}
+		if _, err := os.Stat(d.Dir); err != nil {
+			logf(fmt.Sprintf("%s: no longer in the library, dropping its queued tasks", d.Dir))
+			continue
+		}
+		n++
+		var failed []string
+		var errs []error
+		for _, task := range deferredOrder {
+			if !slices.Contains(d.Tasks, task) {
+				continue
+			}
+			if err := runDeferredTask(d.Dir, task); err != nil {
+				logf(fmt.Sprintf("%s: %s failed: %v", d.Dir, task, err))
+				failed = append(failed, task)
+				errs = append(errs, fmt.Errorf("%s: %w", task, err))
+			}
+		}
+		libDir := library.LocalLibraryDir()
+		if rel, err := filepath.Rel(libDir, d.Dir); err == nil && !strings.HasPrefix(rel, "..") {
+			if err := library.RefreshJournalFiles(libDir, rel); err != nil {
+				logf(fmt.Sprintf("Could not update journal for %s: %v", rel, err))
+			}
+		}
+		switch {
+		case len(failed) == 0:
+			logf(fmt.Sprintf("%s: queued tasks done", d.Dir))
+		case d.Attempts+1 >= retryMaxAttempts():
+			logf(fmt.Sprintf("%s: giving up on %s after %d attempts", d.Dir, strings.Join(failed, ", "), d.Attempts+1))
+		default:
+			d.Tasks = failed
+			d.LastError = errors.Join(errs...).Error()
+			d.NextAttempt = time.Now().Add(retryBackoff(d.Attempts)).UTC()
+			d.Attempts++
+			logf(fmt.Sprintf("%s: retrying %s at %s", d.Dir, strings.Join(failed, ", "), d.NextAttempt.Local().Format("2006-01-02 15:04")))
+			remaining = append(remaining, d)
+		}
+	}
+	return n, saveDeferred(remaining)
+}
+
+// runDeferredTask runs one task on a library album.
+func runDeferredTask(dir, task string) error {
+	tracks, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		return errors.New("no audio files")
+	}
+	logf := func(msg string) { fmt.Println("→", msg) }
+	switch task {
+	case deferMetadata:
+		md, err := metadata.ReadTags(tracks[0])
+		if err != nil {
+			return err
+		}
+		if md.ReleaseMBID == "" {
+			id, err := searchMusicBrainzRelease(metadata.FirstNonEmpty(md.AlbumArtist, md.Artist), md.Album)
+			if err != nil {
+				return err
+			}
+			md.ReleaseMBID = id
+		}
+		writeTagRules(dir, tracks, md, nil, logf)
+		return nil
+	case deferGenre:
+		sources := metadata.GenreSources()
+		if len(sources) == 0 {
+			return nil
+		}
+		md, err := metadata.ReadTags(tracks[0])
+		if err != nil {
+			return err
+		}
+		a := &AlbumRun{Result: &AlbumResult{Path: dir}, Tracks: tracks, Logf: logf}
+		lookupGenre(a, md, sources)
+		if len(a.Deferred) > 0 {
+			return errors.New("genre lookup failed")
+		}
+		return nil
+	case deferCover:
+		if fix := backfillAlbumArt(dir, false); fix.Error != "" {
+			return errors.New(fix.Error)
+		}
+		return nil
+	case deferLyrics:
+		stats, err := DownloadAlbumLyrics(dir, logf)
+		if err == nil && stats.Failed > 0 {
+			err = fmt.Errorf("lookup failed for %d track(s)", stats.Failed)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown task %q", task)
+}
+
+// retryWorkerInterval is how often the retry worker looks for due tasks.
+const retryWorkerInterval = 5 * time.Minute
+
+// StartRetryWorker starts a background loop running due enrichment tasks
+// between imports. It stays idle while an import is running (which runs
+// them itself) or the importer is offline.
+func StartRetryWorker() {
+	go func() {
+		for range time.Tick(retryWorkerInterval) {
+			if Running() {
+				continue
+			}
+			albums, err := DeferredAlbums()
+			if err != nil {
+				log.Printf("[retry] reading queue: %v", err)
+				continue
+			}
+			due := slices.ContainsFunc(albums, func(d DeferredAlbum) bool { return !d.NextAttempt.After(time.Now()) })
+			if !due {
+				continue
+			}
+			if reason := offlineReason(); reason != "" {
+				continue
+			}
+			metadata.SetOffline(false)
+			if _, err := RunDeferred(false, func(msg string) { log.Printf("[retry] %s", msg) }); err != nil {
+				log.Printf("[retry] %v", err)
+			}
+		}
+	}()
+}
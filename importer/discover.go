@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// FetchArtist fetches every Album and EP release group for an artist by running
+// fetchRelease for each one sequentially, then registers each for monitoring.
+func FetchArtist(artistMBID, artistName string, logf func(string)) error {
+	log.Printf("[discover] artist fetch started: %s (%s)", artistName, artistMBID)
+	logf(fmt.Sprintf("Looking up discography for %s on MusicBrainz…", artistName))
+
+	groups, err := metadata.GetMBArtistReleaseGroups(artistMBID)
+	if err != nil {
+		return fmt.Errorf("MusicBrainz discography lookup failed: %w", err)
+	}
+	if len(groups) == 0 {
+		return fmt.Errorf("no albums or EPs found for %s on MusicBrainz", artistName)
+	}
+
+	log.Printf("[discover] found %d release groups for %s", len(groups), artistName)
+	logf(fmt.Sprintf("Found %d albums/EPs", len(groups)))
+
+	failed := 0
+	for i, rg := range groups {
+		logf(fmt.Sprintf("[%d/%d] %s", i+1, len(groups), rg.Title))
+		// Pick the best release for this group. beets --search-id requires a
+		// release MBID; release group MBIDs are not accepted.
+		time.Sleep(time.Second) // MusicBrainz rate limit
+		rel := metadata.PickBestReleaseForGroup(rg.ID)
+		releaseMBID := ""
+		trackCount := 0
+		if rel == nil {
+			logf(fmt.Sprintf("  ↳ warning: could not resolve release for group %s, beets will search by name", rg.ID))
+		} else {
+			releaseMBID = rel.ID
+			trackCount = metadata.ReleaseTrackCount(*rel)
+			format := ""
+			if len(rel.Media) > 0 {
+				format = rel.Media[0].Format
+			}
+			logf(fmt.Sprintf("  ↳ selected release: %s [%s / %s / %d tracks]", releaseMBID, format, rel.Country, trackCount))
+		}
+
+		folder, err := FetchRelease(artistName, rg.Title, releaseMBID, trackCount, logf)
+		if err != nil {
+			log.Printf("[discover] fetch failed for %q by %s: %v", rg.Title, artistName, err)
+			logf(fmt.Sprintf("  ↳ failed: %v", err))
+			failed++
+			continue
+		}
+		// Key the pending download by release group ID for dedup; beets uses releaseMBID.
+		RegisterDownload(rg.ID, releaseMBID, artistName, rg.Title, trackCount, folder, nil)
+		logf(fmt.Sprintf("  ↳ registered for import (release mbid: %s)", releaseMBID))
+	}
+
+	if failed > 0 {
+		logf(fmt.Sprintf("Done — %d/%d queued, %d failed", len(groups)-failed, len(groups), failed))
+	} else {
+		logf(fmt.Sprintf("Done — all %d downloads queued, monitoring for import", len(groups)))
+	}
+	log.Printf("[discover] artist fetch complete: %s (%d/%d succeeded)", artistName, len(groups)-failed, len(groups))
+	return nil
+}
+
+// ── Fetch state ───────────────────────────────────────────────────────────────
+
+// fetchStatus is the JSON-serialisable state of a fetch entry.
+type fetchStatus struct {
+	ID      string   `json:"id"`
+	Artist  string   `json:"artist"`
+	Album   string   `json:"album"`
+	Log     []string `json:"log"`
+	Done    bool     `json:"done"`
+	Success bool     `json:"success"`
+	ErrMsg  string   `json:"error,omitempty"`
+}
+
+// fetchEntry is a fetch in progress. Its state lives in the embedded
+// fetchStatus so Snapshot can copy it without copying the mutex.
+type fetchEntry struct {
+	mu sync.Mutex
+	fetchStatus
+}
+
+var (
+	fetchesMu sync.Mutex
+	fetchMap  = make(map[string]*fetchEntry)
+)
+
+func NewFetchEntry(id, artist, album string) *fetchEntry {
+	e := &fetchEntry{fetchStatus: fetchStatus{ID: id, Artist: artist, Album: album}}
+	fetchesMu.Lock()
+	fetchMap[id] = e
+	fetchesMu.Unlock()
+	return e
+}
+
+func (e *fetchEntry) AppendLog(msg string) {
+	e.mu.Lock()
+	e.Log = append(e.Log, msg)
+	e.mu.Unlock()
+}
+
+func (e *fetchEntry) Finish(err error) {
+	e.mu.Lock()
+	e.Done = true
+	if err != nil {
+		e.ErrMsg = err.Error()
+	} else {
+		e.Success = true
+	}
+	e.mu.Unlock()
+}
+
+func (e *fetchEntry) Snapshot() fetchStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cp := e.fetchStatus
+	cp.Log = append([]string(nil), e.Log...)
+	return cp
+}
+
+// LookupFetch returns the fetch entry with the given ID, or nil.
+func LookupFetch(id string) *fetchEntry {
+	fetchesMu.Lock()
+	defer fetchesMu.Unlock()
+	return fetchMap[id]
+}
+
+// FetchSnapshots returns a snapshot of every known fetch entry.
+func FetchSnapshots() []fetchStatus {
+	fetchesMu.Lock()
+	defer fetchesMu.Unlock()
+	out := make([]fetchStatus, 0, len(fetchMap))
+	for _, e := range fetchMap {
+		out = append(out, e.Snapshot())
+	}
+	return out
+}
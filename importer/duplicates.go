@@ -0,0 +1,558 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// Why items were grouped as duplicates.
+const (
+	DuplicateMBID        = "mbid"        // albums tagged with the same MusicBrainz release
+	DuplicateTracks      = "tracks"      // same artist and album with matching track durations
+	DuplicateFingerprint = "fingerprint" // tracks whose audio fingerprints match
+)
+
+// DuplicateItem is one album, or one track of a track group, in a duplicate
+// group. Paths are relative to LIBRARY_DIR.
+type DuplicateItem struct {
+	Dir        string `json:"dir"`
+	Path       string `json:"path,omitempty"` // the track, for track groups
+	JournalID  string `json:"journal_id,omitempty"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	Title      string `json:"title,omitempty"`
+	Quality    string `json:"quality,omitempty"`
+	TrackCount int    `json:"track_count"`
+	Rank       int    `json:"rank"` // higher is better quality, see qualityRank
+}
+
+// key identifies the item within the library.
+func (it DuplicateItem) key() string {
+	return metadata.FirstNonEmpty(it.Path, it.Dir)
+}
+
+// DuplicateGroup is a set of library items that look like the same music,
+// best quality first.
+type DuplicateGroup struct {
+	ID     string          `json:"id"`
+	Kind   string          `json:"kind"` // "album" or "track"
+	Reason string          `json:"reason"`
+	Items  []DuplicateItem `json:"items"`
+}
+
+// DuplicateReport is the result of the last duplicate scan, saved in
+// DATA_DIR/duplicates.json.
+type DuplicateReport struct {
+	ScannedAt time.Time        `json:"scanned_at"`
+	Albums    int              `json:"albums"`
+	Groups    []DuplicateGroup `json:"groups"`
+}
+
+func duplicateReportPath() string {
+	return filepath.Join(library.DataDir(), "duplicates.json")
+}
+
+// LoadDuplicateReport returns the saved duplicate report, or nil if no scan
+// has run.
+func LoadDuplicateReport() (*DuplicateReport, error) {
+	data, err := os.ReadFile(duplicateReportPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var r DuplicateReport
+	return &r, json.Unmarshal(data, &r)
+}
+
+func (r *DuplicateReport) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(library.DataDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(duplicateReportPath(), data, 0644)
+}
+
+// qualityRank orders quality strings: lossless above lossy, then by bit
+// depth and sample rate, or by bitrate.
+func qualityRank(q string) int {
+	parts := strings.Split(q, "-")
+	num := func(s, suffix string) int {
+		n, _ := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), suffix), 64)
+		return int(n)
+	}
+	switch {
+	case parts[0] == "FLAC" || parts[0] == "ALAC":
+		rank := 100000
+		if len(parts) > 1 {
+			rank += num(parts[1], "bit") * 1000
+		}
+		if len(parts) > 2 {
+			rank += num(parts[2], "khz")
+		}
+		return rank
+	case len(parts) > 1:
+		return num(parts[1], "kbps")
+	}
+	return 0
+}
+
+// dupKey folds a name for comparison: lower case, letters and digits only.
+func dupKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// scannedTrack is what the scan keeps of each track.
+type scannedTrack struct {
+	path        string
+	title       string
+	duration    int
+	fingerprint []uint32
+}
+
+// scannedAlbum is what the scan keeps of each album.
+type scannedAlbum struct {
+	item   DuplicateItem
+	mbid   string
+	tracks []scannedTrack
+}
+
+// FindDuplicates scans the library for albums tagged with the same
+// MusicBrainz release, or with the same artist, album and track durations,
+// and with fingerprint set for tracks whose chromaprint fingerprints (from
+// fpcalc) match across albums. The report is saved for the web UI.
+func FindDuplicates(ctx context.Context, libraryDir string, fingerprint bool, logf func(string)) (*DuplicateReport, error) {
+	if fingerprint {
+		if _, err := tools.LookPath("fpcalc"); err != nil {
+			return nil, fmt.Errorf("fingerprinting needs fpcalc (chromaprint): %w", err)
+		}
+	}
+	dirs, err := libraryAlbumDirs(libraryDir)
+	if err != nil {
+		return nil, err
+	}
+	journalIDs := map[string]string{}
+	if entries, err := library.JournalEntries(); err == nil {
+		for _, e := range entries {
+			journalIDs[e.Dir] = e.ID
+		}
+	}
+
+	var albums []*scannedAlbum
+	for i, rel := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		logf(fmt.Sprintf("[%d/%d] %s", i+1, len(dirs), rel))
+		a, err := scanDuplicateAlbum(libraryDir, rel, fingerprint)
+		if err != nil {
+			logf(fmt.Sprintf("Skipping %s: %v", rel, err))
+			continue
+		}
+		a.item.JournalID = journalIDs[rel]
+		albums = append(albums, a)
+	}
+
+	report := &DuplicateReport{ScannedAt: time.Now(), Albums: len(albums)}
+	report.Groups = append(report.Groups, albumDuplicates(albums)...)
+	if fingerprint {
+		report.Groups = append(report.Groups, fingerprintDuplicates(albums, report.Groups)...)
+	}
+	for i := range report.Groups {
+		g := &report.Groups[i]
+		g.ID = strconv.Itoa(i + 1)
+		sort.SliceStable(g.Items, func(a, b int) bool { return g.Items[a].Rank > g.Items[b].Rank })
+	}
+	return report, report.save()
+}
+
+func scanDuplicateAlbum(libraryDir, rel string, fingerprint bool) (*scannedAlbum, error) {
+	tracks, err := metadata.AudioFiles(filepath.Join(libraryDir, rel))
+	if err != nil {
+		return nil, err
+	}
+	md, err := metadata.ReadTags(tracks[0])
+	if err != nil {
+		return nil, err
+	}
+	metadata.AttachQuality(md, tracks[0])
+	a := &scannedAlbum{
+		item: DuplicateItem{
+			Dir:        rel,
+			Artist:     metadata.FirstNonEmpty(md.AlbumArtist, md.Artist),
+			Album:      md.Album,
+			Quality:    md.Quality,
+			TrackCount: len(tracks),
+			Rank:       qualityRank(md.Quality),
+		},
+		mbid: md.ReleaseMBID,
+	}
+	for _, t := range tracks {
+		st := scannedTrack{path: t}
+		st.duration, _ = TrackDuration(t)
+		if tmd, err := metadata.ReadTags(t); err == nil {
+			st.title = tmd.Title
+		}
+		if fingerprint {
+			st.fingerprint, _ = trackFingerprint(t)
+		}
+		a.tracks = append(a.tracks, st)
+	}
+	return a, nil
+}
+
+// albumDuplicates groups albums by MusicBrainz release, then albums with
+// the same artist, album title and track durations (±2s) not already
+// grouped by release.
+func albumDuplicates(albums []*scannedAlbum) []DuplicateGroup {
+	var groups []DuplicateGroup
+	grouped := map[*scannedAlbum]bool{}
+	byMBID := map[string][]*scannedAlbum{}
+	for _, a := range albums {
+		if a.mbid != "" {
+			byMBID[a.mbid] = append(byMBID[a.mbid], a)
+		}
+	}
+	for _, a := range albums {
+		same := byMBID[a.mbid]
+		if len(same) < 2 || grouped[same[0]] {
+			continue
+		}
+		g := DuplicateGroup{Kind: "album", Reason: DuplicateMBID}
+		for _, s := range same {
+			grouped[s] = true
+			g.Items = append(g.Items, s.item)
+		}
+		groups = append(groups, g)
+	}
+
+	byName := map[string][]*scannedAlbum{}
+	var names []string
+	for _, a := range albums {
+		if grouped[a] || a.item.Album == "" {
+			continue
+		}
+		k := dupKey(a.item.Artist) + "\x00" + dupKey(a.item.Album)
+		if byName[k] == nil {
+			names = append(names, k)
+		}
+		byName[k] = append(byName[k], a)
+	}
+	for _, k := range names {
+		same := byName[k]
+		used := make([]bool, len(same))
+		for i, a := range same {
+			if used[i] {
+				continue
+			}
+			g := DuplicateGroup{Kind: "album", Reason: DuplicateTracks, Items: []DuplicateItem{a.item}}
+			for j := i + 1; j < len(same); j++ {
+				if !used[j] && sameDurations(a.tracks, same[j].tracks) {
+					used[j] = true
+					g.Items = append(g.Items, same[j].item)
+				}
+			}
+			if len(g.Items) > 1 {
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+// sameDurations reports whether two track lists have the same number of
+// tracks with durations within two seconds of each other, in order.
+func sameDurations(a, b []scannedTrack) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if d := a[i].duration - b[i].duration; d < -2 || d > 2 {
+			return false
+		}
+	}
+	return true
+}
+
+// trackFingerprint returns the raw chromaprint fingerprint of the first two
+// minutes of a track.
+func trackFingerprint(path string) ([]uint32, error) {
+	out, err := tools.Output("fpcalc", "-raw", "-json", "-length", "120", path)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Fingerprint []uint32 `json:"fingerprint"`
+	}
+	return data.Fingerprint, json.Unmarshal(out, &data)
+}
+
+// fingerprintMatch reports whether two raw fingerprints, aligned at the
+// start, differ in fewer than 15% of their bits.
+func fingerprintMatch(a, b []uint32) bool {
+	n := min(len(a), len(b))
+	if n < 10 {
+		return false
+	}
+	diff := 0
+	for i := range n {
+		diff += bits.OnesCount32(a[i] ^ b[i])
+	}
+	return float64(diff)/float64(n*32) < 0.15
+}
+
+// fingerprintDuplicates groups tracks of different albums whose
+// fingerprints match, skipping pairs of albums already grouped whole.
+func fingerprintDuplicates(albums []*scannedAlbum, albumGroups []DuplicateGroup) []DuplicateGroup {
+	sameGroup := map[[2]string]bool{}
+	for _, g := range albumGroups {
+		for _, a := range g.Items {
+			for _, b := range g.Items {
+				sameGroup[[2]string{a.Dir, b.Dir}] = true
+			}
+		}
+	}
+	type ref struct {
+		album *scannedAlbum
+		track scannedTrack
+	}
+	var refs []ref
+	for _, a := range albums {
+		for _, t := range a.tracks {
+			if len(t.fingerprint) > 0 {
+				refs = append(refs, ref{a, t})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].track.duration < refs[j].track.duration })
+
+	var groups []DuplicateGroup
+	used := make([]bool, len(refs))
+	for i, r := range refs {
+		if used[i] {
+			continue
+		}
+		g := DuplicateGroup{Kind: "track", Reason: DuplicateFingerprint}
+		dirs := map[string]bool{r.album.item.Dir: true}
+		for j := i + 1; j < len(refs) && refs[j].track.duration-r.track.duration <= 3; j++ {
+			o := refs[j]
+			if used[j] || dirs[o.album.item.Dir] || sameGroup[[2]string{r.album.item.Dir, o.album.item.Dir}] {
+				continue
+			}
+			if fingerprintMatch(r.track.fingerprint, o.track.fingerprint) {
+				used[j] = true
+				dirs[o.album.item.Dir] = true
+				g.Items = append(g.Items, trackItem(o.album, o.track))
+			}
+		}
+		if len(g.Items) > 0 {
+			g.Items = append([]DuplicateItem{trackItem(r.album, r.track)}, g.Items...)
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func trackItem(a *scannedAlbum, t scannedTrack) DuplicateItem {
+	it := a.item
+	it.Path = filepath.Join(it.Dir, filepath.Base(t.path))
+	it.Title = metadata.FirstNonEmpty(t.title, filepath.Base(t.path))
+	it.TrackCount = 1
+	return it
+}
+
+// Ways to resolve a duplicate group.
+const (
+	ResolveKeep   = "keep"   // keep the target, delete the rest of the group
+	ResolveDelete = "delete" // delete only the target
+	ResolveMerge  = "merge"  // move tracks the target album lacks into it, then delete the rest
+)
+
+// ResolveDuplicates applies a resolution to a group of the saved report,
+// target being an item's path (tracks) or directory (albums). Deleted albums
+// lose their journal entries; albums that lose a track have their journal
+// checksums refreshed. Resolved items are dropped from the report.
+func ResolveDuplicates(libraryDir, groupID, action, target string) error {
+	report, err := LoadDuplicateReport()
+	if err != nil {
+		return err
+	}
+	if report == nil {
+		return fmt.Errorf("no duplicate scan to resolve")
+	}
+	var g *DuplicateGroup
+	for i := range report.Groups {
+		if report.Groups[i].ID == groupID {
+			g = &report.Groups[i]
+		}
+	}
+	if g == nil {
+		return fmt.Errorf("no duplicate group %q", groupID)
+	}
+	var keep *DuplicateItem
+	var others []DuplicateItem
+	for i, it := range g.Items {
+		if it.key() == target {
+			keep = &g.Items[i]
+		} else {
+			others = append(others, it)
+		}
+	}
+	if keep == nil {
+		return fmt.Errorf("%q is not in duplicate group %s", target, groupID)
+	}
+
+	var removed []DuplicateItem
+	switch action {
+	case ResolveDelete:
+		removed = []DuplicateItem{*keep}
+	case ResolveKeep:
+		removed = others
+	case ResolveMerge:
+		if g.Kind != "album" {
+			return fmt.Errorf("only album groups can be merged")
+		}
+		for _, o := range others {
+			if err := mergeAlbumInto(libraryDir, o.Dir, keep.Dir); err != nil {
+				return fmt.Errorf("merging %s: %w", o.Dir, err)
+			}
+		}
+		if err := library.RefreshJournalFiles(libraryDir, keep.Dir); err != nil {
+			return err
+		}
+		removed = others
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	var errs []error
+	for _, it := range removed {
+		if err := deleteDuplicate(libraryDir, it); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	report.dropItems(removed)
+	return errors.Join(append(errs, report.save())...)
+}
+
+// deleteDuplicate moves an album directory to the trash and drops its
+// journal entry, or trashes a track with its lyrics.
+func deleteDuplicate(libraryDir string, it DuplicateItem) error {
+	if it.Path == "" {
+		dir := filepath.Join(libraryDir, it.Dir)
+		fmt.Println("→ Deleting duplicate album:", dir)
+		var entry *library.JournalEntry
+		if it.JournalID != "" {
+			entry, _ = library.LookupJournalEntry(it.JournalID)
+		}
+		if _, err := library.MoveToTrash(dir, "duplicate album", entry); err != nil {
+			return err
+		}
+		library.RemoveEmptyParents(filepath.Dir(dir), libraryDir)
+		if it.JournalID != "" {
+			return library.RemoveJournalEntry(it.JournalID)
+		}
+		return nil
+	}
+	path := filepath.Join(libraryDir, it.Path)
+	fmt.Println("→ Deleting duplicate track:", path)
+	if _, err := library.MoveToTrash(path, "duplicate track", nil); err != nil {
+		return err
+	}
+	library.MoveToTrash(strings.TrimSuffix(path, filepath.Ext(path))+".lrc", "duplicate track lyrics", nil)
+	return library.RefreshJournalFiles(libraryDir, it.Dir)
+}
+
+// mergeAlbumInto moves the tracks of srcDir whose titles dstDir lacks, with
+// their lyrics, into dstDir. Both are relative to libraryDir.
+func mergeAlbumInto(libraryDir, srcDir, dstDir string) error {
+	have := map[string]bool{}
+	dstTracks, err := metadata.AudioFiles(filepath.Join(libraryDir, dstDir))
+	if err != nil {
+		return err
+	}
+	for _, t := range dstTracks {
+		have[trackTitleKey(t)] = true
+	}
+	srcTracks, err := metadata.AudioFiles(filepath.Join(libraryDir, srcDir))
+	if err != nil {
+		return err
+	}
+	for _, t := range srcTracks {
+		k := trackTitleKey(t)
+		if have[k] {
+			continue
+		}
+		have[k] = true
+		stem := strings.TrimSuffix(filepath.Base(t), filepath.Ext(t))
+		for _, f := range []string{t, filepath.Join(filepath.Dir(t), stem+".lrc")} {
+			dst := filepath.Join(libraryDir, dstDir, filepath.Base(f))
+			if _, err := os.Stat(f); err != nil {
+				continue
+			}
+			if _, err := os.Stat(dst); err == nil {
+				return fmt.Errorf("%s already exists", dst)
+			}
+			fmt.Println("→ Merging:", f, "→", dst)
+			if err := os.Rename(f, dst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// trackTitleKey identifies a track by its title tag, or its file name
+// without the track number when untagged.
+func trackTitleKey(path string) string {
+	if md, err := metadata.ReadTags(path); err == nil && md.Title != "" {
+		return dupKey(md.Title)
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return dupKey(strings.TrimLeft(stem, "0123456789 .-_"))
+}
+
+// dropItems removes items from every group, and groups left with fewer
+// than two items.
+func (r *DuplicateReport) dropItems(items []DuplicateItem) {
+	gone := map[string]bool{}
+	for _, it := range items {
+		gone[it.key()] = true
+	}
+	groups := r.Groups[:0]
+	for _, g := range r.Groups {
+		kept := g.Items[:0]
+		for _, it := range g.Items {
+			// A deleted album takes its tracks with it.
+			if !gone[it.key()] && !(it.Path != "" && gone[it.Dir]) {
+				kept = append(kept, it)
+			}
+		}
+		if g.Items = kept; len(kept) > 1 {
+			groups = append(groups, g)
+		}
+	}
+	r.Groups = groups
+}
@@ -0,0 +1,240 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// drReportFile is the per-album dynamic range report, moved into the library
+// with the album.
+const drReportFile = "dr.txt"
+
+// dynamicRangeEnabled reports whether DYNAMIC_RANGE=true, which measures
+// each album's dynamic range during the ReplayGain stage.
+func dynamicRangeEnabled() bool {
+	return strings.ToLower(os.Getenv("DYNAMIC_RANGE")) == "true"
+}
+
+// trackDR is the DR14 measurement of one track.
+type trackDR struct {
+	Path     string
+	DR       int
+	Peak     float64 // dBFS, highest sample peak over all channels
+	RMS      float64 // dBFS, whole-track RMS averaged over channels
+	Duration int     // seconds
+}
+
+// drBlock is the peak and RMS (both linear) of one channel over one 3 second
+// block.
+type drBlock struct{ peak, rms float64 }
+
+// sampleRate returns the sample rate of a track's first audio stream.
+func sampleRate(path string) (int, error) {
+	out, err := tools.Output("ffprobe", "-v", "error", "-select_streams", "a:0",
+		"-show_entries", "stream=sample_rate", "-of", "default=noprint_wrappers=1:nokey=1", path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("no sample rate for %s", filepath.Base(path))
+	}
+	return n, nil
+}
+
+// drBlocks decodes a track with ffmpeg, cut into 3 second blocks whose
+// per-channel peak and RMS levels astats reports, and returns the blocks of
+// each channel.
+func drBlocks(path string) ([][]drBlock, error) {
+	rate, err := sampleRate(path)
+	if err != nil {
+		return nil, err
+	}
+	filter := fmt.Sprintf("asetnsamples=n=%d:p=0,astats=metadata=1:reset=1,ametadata=mode=print:file=-", 3*rate)
+	out, err := tools.Output("ffmpeg", "-v", "error", "-nostats", "-i", path,
+		"-map", "0:a:0", "-af", filter, "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+	return parseDRBlocks(out), nil
+}
+
+// parseDRBlocks reads ametadata's astats output: a "frame:" line per block
+// followed by lavfi.astats.<channel>.Peak_level and RMS_level in dBFS.
+func parseDRBlocks(out []byte) [][]drBlock {
+	var channels [][]drBlock
+	frame := -1
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "frame:") {
+			frame++
+			continue
+		}
+		key, val, ok := strings.Cut(strings.TrimPrefix(line, "lavfi.astats."), "=")
+		if !ok || frame < 0 {
+			continue
+		}
+		chStr, stat, _ := strings.Cut(key, ".")
+		ch, err := strconv.Atoi(chStr)
+		if err != nil || ch < 1 || (stat != "Peak_level" && stat != "RMS_level") {
+			continue
+		}
+		db, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			db = math.Inf(-1) // "-inf" for digital silence
+		}
+		for len(channels) < ch {
+			channels = append(channels, nil)
+		}
+		for len(channels[ch-1]) <= frame {
+			channels[ch-1] = append(channels[ch-1], drBlock{})
+		}
+		if stat == "Peak_level" {
+			channels[ch-1][frame].peak = math.Pow(10, db/20)
+		} else {
+			channels[ch-1][frame].rms = math.Pow(10, db/20)
+		}
+	}
+	return channels
+}
+
+// dr14 computes the DR14 value of a channel's blocks: the second highest
+// block peak over the RMS of the loudest 20% of blocks (RMS scaled by √2,
+// as the DR meter does), in dB.
+func dr14(blocks []drBlock) (float64, bool) {
+	if len(blocks) == 0 {
+		return 0, false
+	}
+	peaks := make([]float64, len(blocks))
+	rms := make([]float64, len(blocks))
+	for i, b := range blocks {
+		peaks[i] = b.peak
+		rms[i] = b.rms * math.Sqrt2
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(peaks)))
+	sort.Sort(sort.Reverse(sort.Float64Slice(rms)))
+	peak := peaks[0]
+	if len(peaks) > 1 {
+		peak = peaks[1]
+	}
+	n := max(len(rms)/5, 1)
+	sum := 0.0
+	for _, r := range rms[:n] {
+		sum += r * r
+	}
+	loud := math.Sqrt(sum / float64(n))
+	if loud == 0 || peak == 0 {
+		return 0, false
+	}
+	return 20 * math.Log10(peak/loud), true
+}
+
+// measureTrackDR measures one track's dynamic range, averaging the DR of its
+// channels.
+func measureTrackDR(path string) (trackDR, error) {
+	channels, err := drBlocks(path)
+	if err != nil {
+		return trackDR{}, err
+	}
+	t := trackDR{Path: path, Peak: math.Inf(-1), RMS: math.Inf(-1)}
+	var drSum, energy float64
+	n := 0
+	for _, blocks := range channels {
+		dr, ok := dr14(blocks)
+		if !ok {
+			continue
+		}
+		drSum += dr
+		n++
+		for _, b := range blocks {
+			t.Peak = math.Max(t.Peak, 20*math.Log10(b.peak))
+			energy += b.rms * b.rms / float64(len(blocks))
+		}
+	}
+	if n == 0 {
+		return trackDR{}, errors.New("no audio to measure")
+	}
+	t.DR = int(math.Round(drSum / float64(n)))
+	t.RMS = 10 * math.Log10(energy/float64(n))
+	t.Duration, _ = TrackDuration(path)
+	return t, nil
+}
+
+// albumDR is the album's official DR value: the rounded mean of its tracks'.
+func albumDR(tracks []trackDR) int {
+	sum := 0
+	for _, t := range tracks {
+		sum += t.DR
+	}
+	return int(math.Round(float64(sum) / float64(len(tracks))))
+}
+
+// writeDRReport writes dr.txt in the album folder, laid out like the
+// foobar2000 DR Meter's log.
+func writeDRReport(albumPath string, md *metadata.MusicMetadata, tracks []trackDR, album int) error {
+	var b strings.Builder
+	rule := strings.Repeat("-", 64) + "\n"
+	title := filepath.Base(albumPath)
+	if md != nil && md.Artist != "" && md.Album != "" {
+		title = md.Artist + " — " + md.Album
+	}
+	fmt.Fprintf(&b, "Dynamic range of %s\n", title)
+	b.WriteString(rule)
+	fmt.Fprintf(&b, "%-6s %10s %10s %9s  %s\n", "DR", "Peak", "RMS", "Duration", "Track")
+	b.WriteString(rule)
+	for _, t := range tracks {
+		fmt.Fprintf(&b, "DR%-4d %7.2f dB %7.2f dB %6d:%02d  %s\n",
+			t.DR, t.Peak, t.RMS, t.Duration/60, t.Duration%60, filepath.Base(t.Path))
+	}
+	b.WriteString(rule)
+	fmt.Fprintf(&b, "Number of tracks:  %d\n", len(tracks))
+	fmt.Fprintf(&b, "Official DR value: DR%d\n", album)
+	return os.WriteFile(filepath.Join(albumPath, drReportFile), []byte(b.String()), 0644)
+}
+
+// measureDynamicRange measures every track's DR14, tags each with
+// DYNAMIC_RANGE and the album's value as ALBUM_DYNAMIC_RANGE, and writes
+// dr.txt. Tracks that fail to measure are left out; failures are logged and
+// never fail the album.
+func measureDynamicRange(a *AlbumRun) {
+	a.Logf("Measuring dynamic range")
+	var tracks []trackDR
+	for _, path := range a.Tracks {
+		t, err := measureTrackDR(path)
+		if err != nil {
+			a.Logf(fmt.Sprintf("Dynamic range of %s: %v", filepath.Base(path), err))
+			continue
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return
+	}
+	album := albumDR(tracks)
+	a.Result.DynamicRange = album
+	for _, t := range tracks {
+		err := metadata.WriteTags(t.Path, map[string]string{
+			"DYNAMIC_RANGE":       strconv.Itoa(t.DR),
+			"ALBUM_DYNAMIC_RANGE": strconv.Itoa(album),
+		})
+		if err != nil {
+			a.Logf(fmt.Sprintf("Tagging dynamic range of %s: %v", filepath.Base(t.Path), err))
+		}
+	}
+	if err := writeDRReport(a.Result.Path, a.Result.Metadata, tracks, album); err != nil {
+		a.Logf(fmt.Sprintf("Writing %s: %v", drReportFile, err))
+	}
+	a.Logf(fmt.Sprintf("Album dynamic range: DR%d", album))
+}
@@ -0,0 +1,33 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// checkEditions runs after the autotagger when several editions of the
+// album (a CD and a vinyl with different tracklists, say) matched about as
+// well and PREFERRED_COUNTRIES / PREFERRED_MEDIA didn't settle it. The album
+// is tagged from the preferred one and warns; the editions are kept in the
+// album state for the web UI to offer, and with EDITION_REVIEW_FOLDER set
+// the album is moved there until one is picked.
+func checkEditions(a *AlbumRun, match *metadata.Match) error {
+	if match == nil || len(match.Editions) < 2 {
+		return nil
+	}
+	var names []string
+	for _, e := range match.Editions {
+		names = append(names, strings.TrimSpace(fmt.Sprintf("%s %s %s (%d tracks, %.1f%%)", e.Year, e.Country, e.Format, e.TrackCount, e.Similarity)))
+	}
+	a.Result.TagMetadata.Err = fmt.Errorf("%d editions match almost equally: %s", len(match.Editions), strings.Join(names, ", "))
+	a.Logf(a.Result.TagMetadata.Err.Error())
+	if st, err := LoadAlbumState(a.Result.Path); err == nil {
+		st.Editions = match.Editions
+		if err := SaveAlbumState(a.Result.Path, st); err != nil {
+			a.Logf(fmt.Sprintf("Could not save editions: %v", err))
+		}
+	}
+	return sendToReview(a, "EDITION_REVIEW_FOLDER", &a.Result.TagMetadata)
+}
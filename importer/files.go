@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// cleanupSourceDir removes the importer's own marker files from an album
+// folder whose contents have been moved, then removes the folder if it is
+// now empty.
+func cleanupSourceDir(albumPath string) {
+	for _, name := range []string{priorityMarkerFile, albumStateFile, spectrogramFile} {
+		os.Remove(filepath.Join(albumPath, name))
+	}
+	os.RemoveAll(artCacheDir(albumPath))
+	os.RemoveAll(previewCacheDir(albumPath))
+	removeEmptyDirs(albumPath)
+	os.Remove(albumPath)
+}
+
+// fixTrackExtensions renames tracks whose contents are FLAC or MP3 under
+// the other's extension (or any other one) to the extension of what they
+// are, so every later stage and the library see the real format.
+func fixTrackExtensions(a *AlbumRun) {
+	for i, t := range a.Tracks {
+		format := metadata.SniffFormat(t)
+		ext := metadata.FormatExt(format)
+		if format == "" || strings.EqualFold(filepath.Ext(t), ext) {
+			continue
+		}
+		dst := strings.TrimSuffix(t, filepath.Ext(t)) + ext
+		if _, err := os.Stat(dst); err == nil {
+			a.Logf(fmt.Sprintf("%s is %s, but %s exists; leaving its name", filepath.Base(t), strings.ToUpper(format), filepath.Base(dst)))
+			continue
+		}
+		if err := os.Rename(t, dst); err != nil {
+			a.Logf(fmt.Sprintf("Could not rename %s: %v", filepath.Base(t), err))
+			continue
+		}
+		a.Logf(fmt.Sprintf("%s is %s; renamed to %s", filepath.Base(t), strings.ToUpper(format), filepath.Base(dst)))
+		a.Tracks[i] = dst
+	}
+}
+
+// cluster moves all top-level audio files in dir into subdirectories named
+// after their embedded album tag.
+func cluster(dir string) error {
+	files, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		tags, err := metadata.ReadTags(f)
+		if err != nil {
+			return err
+		}
+		albumDir := path.Join(dir, library.Sanitize(tags.Album))
+		if err = os.MkdirAll(albumDir, 0755); err != nil {
+			return err
+		}
+		if err = os.Rename(f, path.Join(albumDir, path.Base(f))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// confirmFolderMatch runs before the move. When the album's library folder
+// reuses existing folders spelled differently (see library.FolderMatches)
+// and FOLDER_MATCH_REVIEW_FOLDER is set, the album goes to that folder so
+// someone can confirm the merge; picked from there, it is moved into the
+// matched folders with a warning.
+func confirmFolderMatch(a *AlbumRun, md *metadata.MusicMetadata) error {
+	matches := library.FolderMatches(a.LibraryDir, md)
+	if len(matches) == 0 {
+		return nil
+	}
+	a.Logf("Reusing existing library folders: " + strings.Join(matches, ", "))
+	if _, ok := reviewFolder("FOLDER_MATCH_REVIEW_FOLDER"); !ok {
+		return nil
+	}
+	a.Result.Move.Err = fmt.Errorf("library folder matched onto existing %s", strings.Join(matches, ", "))
+	return sendToReview(a, "FOLDER_MATCH_REVIEW_FOLDER", &a.Result.Move)
+}
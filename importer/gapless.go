@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// gaplessCheckEnabled reports whether GAPLESS_CHECK is on (the default).
+func gaplessCheckEnabled() bool {
+	return os.Getenv("GAPLESS_CHECK") != "false"
+}
+
+// gaplessReleaseTypes are the release types whose tracks run into each
+// other, so a gap between them is audible.
+var gaplessReleaseTypes = []string{"live", "dj-mix", "mixtape"}
+
+// gaplessTitle catches live albums and mixes that carry no release type.
+var gaplessTitle = regexp.MustCompile(`(?i)\(live\b|\blive (at|in|from)\b|\bdj[- ]mix\b|\bcontinuous mix\b|\bmixed by\b`)
+
+// needsGapless reports whether an album is a live album or a mix.
+func needsGapless(md *metadata.MusicMetadata) bool {
+	return slices.Contains(gaplessReleaseTypes, md.ReleaseType) || gaplessTitle.MatchString(md.Album)
+}
+
+// snapshotGapless records the gapless information of the album's MP3 and
+// M4A tracks before any stage rewrites their tags.
+func snapshotGapless(a *AlbumRun) {
+	a.gapless = map[string]metadata.Gapless{}
+	for _, t := range a.Tracks {
+		if !metadata.GaplessFormat(t) {
+			continue
+		}
+		if g, err := metadata.ReadGapless(t); err == nil {
+			a.gapless[t] = g
+		}
+	}
+}
+
+// checkGapless runs before the move. It restores iTunSMPB comments the
+// tagging and art stages dropped, and warns about LAME tags lost with them
+// and about live albums and mixes whose tracks carry no gapless information
+// at all.
+func checkGapless(a *AlbumRun, md *metadata.MusicMetadata) {
+	if a.gapless == nil {
+		return
+	}
+	missing, lossy := 0, 0
+	for _, t := range a.Tracks {
+		if !metadata.GaplessFormat(t) {
+			continue
+		}
+		lossy++
+		g, err := metadata.ReadGapless(t)
+		if err != nil {
+			continue
+		}
+		before := a.gapless[t]
+		if before.ITunSMPB != "" && g.ITunSMPB == "" {
+			if err := metadata.RestoreITunSMPB(t, before.ITunSMPB); err != nil {
+				a.Result.Gapless = append(a.Result.Gapless, fmt.Sprintf("%s: iTunSMPB lost in tagging: %v", filepath.Base(t), err))
+			} else {
+				a.Logf("Restored iTunSMPB in " + filepath.Base(t))
+				g.ITunSMPB = before.ITunSMPB
+			}
+		}
+		if before.LAME && !g.LAME {
+			a.Result.Gapless = append(a.Result.Gapless, filepath.Base(t)+": LAME tag lost in tagging")
+		}
+		if !g.Present() {
+			missing++
+		}
+	}
+	if missing > 0 && needsGapless(md) {
+		a.Result.Gapless = append(a.Result.Gapless,
+			fmt.Sprintf("%d of %d tracks have no gapless info (LAME tag or iTunSMPB); players may gap between them", missing, lossy))
+	}
+	for _, w := range a.Result.Gapless {
+		a.Logf("Gapless: " + w)
+	}
+}
@@ -0,0 +1,137 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// groupByReleaseEnabled reports whether GROUP_BY_RELEASE=true: album folders
+// tagged with the same MusicBrainz release are merged before importing and
+// held back until the release is complete.
+func groupByReleaseEnabled() bool {
+	return strings.ToLower(os.Getenv("GROUP_BY_RELEASE")) == "true"
+}
+
+// groupWait returns GROUP_BY_RELEASE_WAIT (default 24h): how long an
+// incomplete release is held after its last tracks arrived before it is
+// imported anyway.
+func groupWait() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("GROUP_BY_RELEASE_WAIT")); err == nil && d >= 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// folderRelease returns the release MBID an album folder was pinned to in the
+// web UI or, failing that, the one its first track is tagged with.
+func folderRelease(albumPath string, tracks []string) string {
+	if st, err := LoadAlbumState(albumPath); err == nil && st.ReleaseMBID != "" {
+		return st.ReleaseMBID
+	}
+	if md, err := metadata.ReadTags(tracks[0]); err == nil {
+		return md.ReleaseMBID
+	}
+	return ""
+}
+
+// consolidateReleases merges album folders in importDir that hold parts of
+// the same release into the first of them, in entries order. It returns the
+// folders to hold back this run because their release is still missing
+// tracks and has received files within groupWait.
+func consolidateReleases(importDir string, entries []os.DirEntry, logf func(string)) map[string]bool {
+	var order []string
+	groups := map[string][]string{}
+	for _, e := range entries {
+		if !e.IsDir() || isHiddenEntry(e.Name()) {
+			continue
+		}
+		tracks, err := metadata.AudioFiles(filepath.Join(importDir, e.Name()))
+		if err != nil || len(tracks) == 0 {
+			continue
+		}
+		rel := folderRelease(filepath.Join(importDir, e.Name()), tracks)
+		if rel == "" {
+			continue
+		}
+		if groups[rel] == nil {
+			order = append(order, rel)
+		}
+		groups[rel] = append(groups[rel], e.Name())
+	}
+
+	held := map[string]bool{}
+	for _, rel := range order {
+		target := groups[rel][0]
+		targetPath := filepath.Join(importDir, target)
+		for _, part := range groups[rel][1:] {
+			logf(fmt.Sprintf("Merging %s into %s (release %s)", part, target, rel))
+			if err := mergeAlbumFolder(filepath.Join(importDir, part), targetPath); err != nil {
+				logf(fmt.Sprintf("Merging %s failed: %v", part, err))
+			}
+		}
+
+		r, err := metadata.GetMBRelease(rel)
+		if err != nil {
+			logf(fmt.Sprintf("Could not look up release %s, importing %s as is: %v", rel, target, err))
+			continue
+		}
+		want := metadata.ReleaseTrackCount(*r)
+		tracks, _ := metadata.AudioFiles(targetPath)
+		if want == 0 || len(tracks) >= want {
+			continue
+		}
+		if wait := groupWait() - time.Since(lastArrival(targetPath, len(tracks))); wait > 0 {
+			logf(fmt.Sprintf("Holding %s: %d of %d tracks of %q so far (imported anyway in %s)",
+				target, len(tracks), want, r.Title, wait.Round(time.Minute)))
+			held[target] = true
+		} else {
+			logf(fmt.Sprintf("Importing %s incomplete: %d of %d tracks", target, len(tracks), want))
+		}
+	}
+	return held
+}
+
+// mergeAlbumFolder moves everything in src into dst and removes src. Names
+// already taken in dst get the source folder's name as a prefix; the
+// importer's own marker files are dropped rather than duplicated.
+func mergeAlbumFolder(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		from := filepath.Join(src, e.Name())
+		if e.Name() == albumStateFile || e.Name() == priorityMarkerFile {
+			if _, err := os.Stat(filepath.Join(dst, e.Name())); err == nil {
+				os.Remove(from)
+				continue
+			}
+		}
+		if err := os.Rename(from, UniqueFile(dst, e.Name(), filepath.Base(src))); err != nil {
+			return err
+		}
+	}
+	return os.Remove(src)
+}
+
+// lastArrival returns when an incomplete release's folder was first seen
+// holding n tracks, recording it in the folder's state. File times cannot
+// tell: mirroring, rclone and unzip keep the source's modification times.
+func lastArrival(dir string, n int) time.Time {
+	st, err := LoadAlbumState(dir)
+	if err != nil {
+		return time.Now()
+	}
+	if st.GroupSeen.IsZero() || st.GroupTracks != n {
+		st.GroupSeen, st.GroupTracks = time.Now().UTC(), n
+		if err := SaveAlbumState(dir, st); err != nil {
+			fmt.Println("Could not record when tracks arrived:", err)
+		}
+	}
+	return st.GroupSeen
+}
@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Hook points and the environment variables that configure their commands.
+const (
+	hookPreAlbum  = "HOOK_PRE_ALBUM"
+	hookPostAlbum = "HOOK_POST_ALBUM"
+	hookPostRun   = "HOOK_POST_RUN"
+)
+
+// hookTimeout returns how long a hook may run (HOOK_TIMEOUT, default 10m).
+func hookTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("HOOK_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// runHook runs the command configured in the hook variable through sh, with
+// vars added to its environment. It is a no-op when the hook is unset.
+func runHook(hook string, vars map[string]string, logf func(string)) error {
+	command := os.Getenv(hook)
+	if command == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "IMPORTER_HOOK="+hook)
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, "IMPORTER_"+k+"="+v)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	logf("Running " + hook + " hook")
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s hook timed out after %s", hook, hookTimeout())
+		}
+		return fmt.Errorf("%s hook: %w", hook, err)
+	}
+	return nil
+}
+
+// albumStatus summarises an album's outcome as ok, warnings or failed.
+func albumStatus(a *AlbumResult) string {
+	switch {
+	case !a.Succeeded():
+		return "failed"
+	case a.HasWarnings():
+		return "warnings"
+	default:
+		return "ok"
+	}
+}
+
+// runAlbumHook runs a pre- or post-album hook for a. A pre-album hook's error
+// should make the caller skip the album; a post-album hook's is only logged.
+func runAlbumHook(hook string, a *AlbumResult, logf func(string)) error {
+	vars := map[string]string{
+		"ALBUM_NAME":   a.Name,
+		"SOURCE_PATH":  a.Path,
+		"LIBRARY_PATH": a.TargetDir,
+		"TRACK_COUNT":  strconv.Itoa(a.TrackCount),
+	}
+	if hook == hookPostAlbum {
+		vars["STATUS"] = albumStatus(a)
+		vars["FAILED_STEP"] = a.FatalStep
+		vars["METADATA_SOURCE"] = string(a.MetadataSource)
+	}
+	if md := a.Metadata; md != nil {
+		vars["ARTIST"] = md.Artist
+		vars["ALBUM_ARTIST"] = md.AlbumArtist
+		vars["ALBUM"] = md.Album
+		vars["DATE"] = metadata.FirstNonEmpty(md.Date, md.Year)
+		vars["QUALITY"] = md.Quality
+	}
+
+	err := runHook(hook, vars, logf)
+	if err != nil && hook == hookPostAlbum {
+		logf(err.Error())
+	}
+	return err
+}
+
+// runSessionHook runs the post-run hook with counts for the finished session.
+func runSessionHook(s *Session, logf func(string)) {
+	vars := map[string]string{
+		"ALBUMS":    strconv.Itoa(len(s.Albums)),
+		"FAILED":    strconv.Itoa(len(s.Failed())),
+		"WARNINGS":  strconv.Itoa(len(s.WithWarnings())),
+		"SUCCEEDED": strconv.Itoa(len(s.Albums) - len(s.Failed())),
+		"DURATION":  strconv.Itoa(int(s.FinishedAt.Sub(s.StartedAt).Seconds())),
+	}
+	if err := runHook(hookPostRun, vars, logf); err != nil {
+		logf(err.Error())
+	}
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// ImportFolder is a directory albums are imported from, with its own
+// pipeline settings. The default folder is IMPORT_DIR, named "".
+type ImportFolder struct {
+	Name       string
+	Dir        string
+	Stages     string // PIPELINE_STAGES override, comma-separated; empty uses the default
+	Review     bool   // albums are only imported when picked explicitly
+	LibraryDir string // destination override; empty uses LIBRARY_DIR
+}
+
+// importFolderEnv returns the prefix of an extra folder's variables, e.g.
+// IMPORT_DIR_BANDCAMP.
+func importFolderEnv(name string) string {
+	return "IMPORT_DIR_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// ImportFolders returns IMPORT_DIR followed by the extra folders named in
+// IMPORT_DIRS, each configured by IMPORT_DIR_<NAME> (its path),
+// IMPORT_DIR_<NAME>_STAGES, IMPORT_DIR_<NAME>_REVIEW and
+// IMPORT_DIR_<NAME>_LIBRARY. Extra folders without a path are skipped.
+func ImportFolders() []ImportFolder {
+	var out []ImportFolder
+	if d := library.LocalImportDir(); d != "" {
+		out = append(out, ImportFolder{Dir: d})
+	}
+	for _, name := range strings.Split(os.Getenv("IMPORT_DIRS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		env := importFolderEnv(name)
+		dir := os.Getenv(env)
+		if dir == "" {
+			continue
+		}
+		out = append(out, ImportFolder{
+			Name:       name,
+			Dir:        dir,
+			Stages:     os.Getenv(env + "_STAGES"),
+			Review:     os.Getenv(env+"_REVIEW") == "true",
+			LibraryDir: os.Getenv(env + "_LIBRARY"),
+		})
+	}
+	return out
+}
+
+// importFolderOf returns the import folder directly containing albumPath,
+// or false when it is in none of them.
+func importFolderOf(albumPath string) (ImportFolder, bool) {
+	parent := filepath.Clean(filepath.Dir(albumPath))
+	for _, f := range ImportFolders() {
+		if filepath.Clean(f.Dir) == parent {
+			return f, true
+		}
+	}
+	return ImportFolder{}, false
+}
+
+// FolderRef names an album folder the way picks in the web UI and
+// Config.Folders do: its name in IMPORT_DIR, or "<source>/<name>" in an
+// IMPORT_DIRS folder, so same-named albums in two folders stay apart.
+func FolderRef(source, name string) string {
+	if source == "" {
+		return name
+	}
+	return source + "/" + name
+}
+
+// ResolveFolderRef returns the album directory a FolderRef names, without
+// checking that it exists. It fails for an unknown source or a name that
+// would escape the folder.
+func ResolveFolderRef(ref string) (string, error) {
+	source, name, found := strings.Cut(ref, "/")
+	if !found {
+		source, name = "", ref
+	}
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid folder name: %s", ref)
+	}
+	for _, f := range ImportFolders() {
+		if f.Name == source {
+			return filepath.Join(f.Dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("no import folder %q", source)
+}
+
+// importRoot returns the import folder holding albumPath, falling back to
+// IMPORT_DIR.
+func importRoot(albumPath string) string {
+	if f, ok := importFolderOf(albumPath); ok {
+		return f.Dir
+	}
+	return library.LocalImportDir()
+}
+
+// stages returns the folder's pipeline stages.
+func (f ImportFolder) stages() ([]Stage, error) {
+	if f.Stages == "" {
+		return pipelineStages()
+	}
+	return parseStages(importFolderEnv(f.Name)+"_STAGES", f.Stages)
+}
+
+// reviewFolder returns the IMPORT_DIRS folder named by env, or false when
+// env is unset or names no folder.
+func reviewFolder(env string) (ImportFolder, bool) {
+	name := strings.ToLower(strings.TrimSpace(os.Getenv(env)))
+	if name == "" {
+		return ImportFolder{}, false
+	}
+	for _, f := range ImportFolders() {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return ImportFolder{}, false
+}
+
+// sendToReview moves an album a check flagged (its warning in st) into the
+// folder named by env and returns the error that stops it. It returns nil,
+// importing the album with the warning, when env is unset or the album was
+// picked from a review folder.
+func sendToReview(a *AlbumRun, env string, st *StepStatus) error {
+	albumPath := a.Result.Path
+	review, ok := reviewFolder(env)
+	if f, in := importFolderOf(albumPath); !ok || (in && f.Review) {
+		return nil
+	}
+	dst := filepath.Join(review.Dir, filepath.Base(albumPath))
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%w; %s already exists in review folder %q", st.Err, filepath.Base(albumPath), review.Name)
+	}
+	if err := os.MkdirAll(review.Dir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(albumPath, dst); err != nil {
+		return fmt.Errorf("moving to review folder %q: %w", review.Name, err)
+	}
+	st.Err = fmt.Errorf("%w; moved to review folder %q", st.Err, review.Name)
+	a.Logf(fmt.Sprintf("Moved to review folder %q", review.Name))
+	return st.Err
+}
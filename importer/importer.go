@@ -0,0 +1,514 @@
+// Package importer runs albums from the import directory through the tagging,
+// lyrics, ReplayGain and cover art pipeline and into the library.
+package importer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// StepStatus records the outcome of a single pipeline step for an album.
+type StepStatus struct {
+	Skipped bool
+	Err     error
+}
+
+func (s StepStatus) Failed() bool { return s.Err != nil }
+
+// LyricsStats summarises per-track lyric discovery for an album.
+type LyricsStats struct {
+	Total      int // total audio tracks examined
+	Synced     int // tracks with synced (timestamped) LRC lyrics downloaded
+	Plain      int // tracks with plain (un-timestamped) lyrics downloaded
+	AlreadyHad int // tracks that already had an .lrc file, skipped
+	NotFound   int // tracks for which no lyrics could be found
+	Failed     int // tracks whose lookup failed (network or server error), worth retrying
+
+	Instrumental int // tracks recognised as instrumental and not looked up (or marked)
+}
+
+func (l LyricsStats) Downloaded() int { return l.Synced + l.Plain }
+
+// add adds o's counts to l.
+func (l *LyricsStats) add(o LyricsStats) {
+	l.Total += o.Total
+	l.Synced += o.Synced
+	l.Plain += o.Plain
+	l.AlreadyHad += o.AlreadyHad
+	l.NotFound += o.NotFound
+	l.Failed += o.Failed
+	l.Instrumental += o.Instrumental
+}
+
+// CoverArtStats records what happened with cover art for an album.
+type CoverArtStats struct {
+	Found    bool   // a cover image file was found in the folder
+	Embedded bool   // cover was successfully embedded into tracks
+	Source   string // filename of the cover image, e.g. "cover.jpg"
+	Origin   string // where it came from: folder, coverartarchive or itunes
+	Width    int
+	Height   int
+}
+
+// StageTime is how long one pipeline stage took for an album.
+type StageTime struct {
+	Stage    string
+	Duration time.Duration
+}
+
+// AlbumResult holds the outcome of every pipeline step for one imported album.
+type AlbumResult struct {
+	Name      string
+	Path      string
+	TargetDir string // album folder in the library, once metadata is known
+	JournalID string // journal entry, once the album is recorded; keys /art/{id}
+	LogID     string // the album's import log, see runAlbumLogged
+	Metadata  *metadata.MusicMetadata
+
+	MetadataSource metadata.Source
+	Match          *metadata.Match // release applied by the autotagger, if one was
+	LyricsStats    LyricsStats
+	CoverArtStats  CoverArtStats
+	AnalysisStats  AnalysisStats
+	Palette        []string // dominant cover colours, see library.AlbumPalette
+	DynamicRange   int      // album DR14 value when DYNAMIC_RANGE is on, else 0
+	TrackCount     int
+
+	AccurateRipInfo *library.AccurateRip // CD rip verification, when the accuraterip stage ran
+
+	CleanTags   StepStatus
+	Junk        StepStatus
+	TagMetadata StepStatus
+	Lyrics      StepStatus
+	ReplayGain  StepStatus
+	CoverArt    StepStatus
+	Move        StepStatus
+	AccurateRip StepStatus
+	Spectral    StepStatus
+	Analysis    StepStatus
+	Strip       StepStatus
+
+	// Gapless lists gapless playback problems found before the move (see
+	// gapless.go).
+	Gapless []string
+
+	// Duplicates lists the second copies of tracks the junk stage dropped
+	// from the album folder (see trackdupes.go).
+	Duplicates []string
+
+	// Resumed lists the stages skipped because an earlier run on the same
+	// folder completed them (see resume.go).
+	Resumed []string
+
+	// Degraded lists optional features this album went without because a
+	// tool or setting was missing (see capabilities.go).
+	Degraded []string
+
+	// StageTimes records how long each stage that ran took, in order.
+	StageTimes []StageTime
+
+	// FatalStep is the name of the step that caused the album to be skipped
+	// entirely, or empty if the album completed the full pipeline.
+	FatalStep string
+}
+
+func (a *AlbumResult) skippedAt(step string) {
+	a.FatalStep = step
+}
+
+func (a *AlbumResult) Succeeded() bool { return a.FatalStep == "" }
+func (a *AlbumResult) HasWarnings() bool {
+	if a.CleanTags.Failed() ||
+		a.Junk.Failed() ||
+		a.TagMetadata.Failed() ||
+		a.Lyrics.Failed() ||
+		a.ReplayGain.Failed() ||
+		a.CoverArt.Failed() ||
+		a.Move.Failed() ||
+		a.AccurateRip.Failed() ||
+		a.Spectral.Failed() ||
+		a.Analysis.Failed() ||
+		a.Strip.Failed() ||
+		len(a.Gapless) > 0 {
+		return true
+	} else {
+		return false
+	}
+}
+
+// Session holds the results of a single importer run.
+type Session struct {
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Albums     []*AlbumResult
+
+	// Degradations is the end-of-run capability report.
+	Degradations []Degradation
+}
+
+func (s *Session) Failed() []*AlbumResult {
+	var out []*AlbumResult
+	for _, a := range s.Albums {
+		if !a.Succeeded() {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func (s *Session) WithWarnings() []*AlbumResult {
+	var out []*AlbumResult
+	for _, a := range s.Albums {
+		if a.Succeeded() && a.HasWarnings() {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+var (
+	importerMu      sync.Mutex
+	importerRunning bool
+	lastSession     *Session // populated at the end of each Run
+)
+
+// Running reports whether an import run is in progress.
+func Running() bool {
+	importerMu.Lock()
+	defer importerMu.Unlock()
+	return importerRunning
+}
+
+// reserveRun marks an import run as in progress, failing with ErrRunning
+// if one already is.
+func reserveRun() error {
+	importerMu.Lock()
+	defer importerMu.Unlock()
+	if importerRunning {
+		return ErrRunning
+	}
+	importerRunning = true
+	return nil
+}
+
+// releaseRun ends the run reserved by reserveRun.
+func releaseRun() {
+	importerMu.Lock()
+	importerRunning = false
+	importerMu.Unlock()
+}
+
+// LastSession returns the session of the most recent finished run, or nil.
+func LastSession() *Session {
+	importerMu.Lock()
+	defer importerMu.Unlock()
+	return lastSession
+}
+
+// ScannedAlbum is an album folder detected in IMPORT_DIR, with a preview of
+// the metadata currently in its first track's tags.
+type ScannedAlbum struct {
+	Name       string `json:"name"`
+	TrackCount int    `json:"track_count"`
+	Artist     string `json:"artist"`
+	Album      string `json:"album"`
+	Year       string `json:"year"`
+	Priority   bool   `json:"priority"`
+	Folder     string `json:"folder"`           // FolderRef naming it in requests and picks
+	Source     string `json:"source,omitempty"` // import folder name, empty for IMPORT_DIR
+	Review     bool   `json:"review,omitempty"` // only imported when picked
+
+	Palette []string `json:"palette,omitempty"` // dominant colours of the folder's cover
+
+	ReleaseMBID string `json:"release_mbid,omitempty"` // release picked in the web UI
+	Suspect     string `json:"suspect,omitempty"`      // why the spectral check flagged it, see spectral.go
+	Unverified  string `json:"unverified,omitempty"`   // why AccurateRip flagged it, see accuraterip.go
+	Editions    int    `json:"editions,omitempty"`     // equally good editions to pick from, see editions.go
+}
+
+// priorityMarkerFile is dropped into an album folder to import it first.
+const priorityMarkerFile = "!priority"
+
+// hasPriorityMarker reports whether an album folder has been flagged to jump
+// the queue, either with a "!priority" file inside it or an "@now" name prefix.
+func hasPriorityMarker(albumPath string) bool {
+	if strings.HasPrefix(filepath.Base(albumPath), "@now") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(albumPath, priorityMarkerFile))
+	return err == nil
+}
+
+// sortByPriority stably moves flagged album folders to the front of entries,
+// keeping the directory order within each group.
+func sortByPriority(dir string, entries []os.DirEntry) {
+	prio := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		prio[e.Name()] = e.IsDir() && hasPriorityMarker(filepath.Join(dir, e.Name()))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return prio[entries[i].Name()] && !prio[entries[j].Name()]
+	})
+}
+
+// ScanImportFolders scans every folder in ImportFolders, marking each album
+// with the folder it came from.
+func ScanImportFolders() ([]ScannedAlbum, error) {
+	albums := []ScannedAlbum{}
+	for _, f := range ImportFolders() {
+		found, err := ScanImportDir(f.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for i := range found {
+			found[i].Source, found[i].Review = f.Name, f.Review
+			found[i].Folder = FolderRef(f.Name, found[i].Name)
+		}
+		albums = append(albums, found...)
+	}
+	return albums, nil
+}
+
+// ScanImportDir clusters loose files in importDir (as an import would) and
+// returns every subdirectory containing audio files.
+func ScanImportDir(importDir string) ([]ScannedAlbum, error) {
+	if err := cluster(importDir); err != nil {
+		return nil, fmt.Errorf("clustering top-level audio files: %w", err)
+	}
+
+	entries, err := os.ReadDir(importDir)
+	if err != nil {
+		return nil, err
+	}
+	sortByPriority(importDir, entries)
+
+	albums := []ScannedAlbum{}
+	for _, e := range entries {
+		if !e.IsDir() || isHiddenEntry(e.Name()) {
+			continue
+		}
+		tracks, err := metadata.AudioFiles(filepath.Join(importDir, e.Name()))
+		if err != nil || len(tracks) == 0 {
+			continue
+		}
+		a := ScannedAlbum{
+			Name:       e.Name(),
+			Folder:     e.Name(),
+			TrackCount: len(tracks),
+			Priority:   hasPriorityMarker(filepath.Join(importDir, e.Name())),
+		}
+		if md, err := metadata.ReadTags(tracks[0]); err == nil {
+			a.Artist = metadata.FirstNonEmpty(md.AlbumArtist, md.Artist)
+			a.Album = md.Album
+			a.Year = md.Year
+		}
+		a.Palette = library.AlbumPalette(filepath.Join(importDir, e.Name()))
+		if st, err := LoadAlbumState(filepath.Join(importDir, e.Name())); err == nil {
+			a.ReleaseMBID = st.ReleaseMBID
+			if st.Spectral != nil {
+				a.Suspect = st.Spectral.Summary()
+			}
+			a.Unverified = st.AccurateRip
+			if st.ReleaseMBID == "" {
+				a.Editions = len(st.Editions)
+			}
+		}
+		albums = append(albums, a)
+	}
+	return albums, nil
+}
+
+// Config selects what Run imports. An empty ImportDir imports from every
+// folder in ImportFolders; an empty LibraryDir falls back to each folder's
+// library and then LIBRARY_DIR. All other settings still come from the
+// environment.
+type Config struct {
+	ImportDir  string
+	LibraryDir string
+	Folders    []string // album folders to import, as FolderRefs; empty imports all
+}
+
+// Run runs the pipeline over the album folders in the import directories,
+// stopping between albums once ctx is done. The session is returned even when
+// the run ends early; it is nil only if the importer did not start.
+func Run(ctx context.Context, cfg Config) (*Session, error) {
+	if err := reserveRun(); err != nil {
+		return nil, err
+	}
+	return runReserved(ctx, cfg)
+}
+
+// runReserved is Run once reserveRun has succeeded; it releases the run when
+// done.
+func runReserved(ctx context.Context, cfg Config) (*Session, error) {
+	defer releaseRun()
+	sources := ImportFolders()
+	if cfg.ImportDir != "" {
+		sources = []ImportFolder{{Dir: cfg.ImportDir}}
+	}
+	libraryDir := cmp.Or(cfg.LibraryDir, library.LocalLibraryDir())
+
+	if len(sources) == 0 || libraryDir == "" {
+		return nil, errors.New("IMPORT_DIR and LIBRARY_DIR must be set")
+	}
+
+	session := &Session{StartedAt: time.Now()}
+	caps := probeCapabilities()
+	defer func() {
+		session.FinishedAt = time.Now()
+		session.Degradations = degradationReport(caps, session.Albums)
+		if len(session.Degradations) > 0 {
+			fmt.Println("\n=== Capability Report ===")
+			for _, d := range session.Degradations {
+				fmt.Println("→", d)
+			}
+		}
+		importerMu.Lock()
+		lastSession = session
+		importerMu.Unlock()
+		if len(session.Albums) > 0 {
+			if err := saveRunReport(session); err != nil {
+				fmt.Println("Could not save run report:", err)
+			}
+		}
+		library.ExportRecent()
+		library.UpdateLibraryViews()
+		writeRunPlaylist(session)
+		runSessionHook(session, func(msg string) { fmt.Println("→", msg) })
+		notifyMediaServers(session.Albums)
+	}()
+
+	fmt.Println("=== Starting Import ===")
+
+	if _, err := library.PurgeTrash(); err != nil {
+		fmt.Println("Could not purge trash:", err)
+	}
+	if _, err := metadata.PruneCache(); err != nil {
+		fmt.Println("Could not prune API cache:", err)
+	}
+
+	logf := func(msg string) { fmt.Println("→", msg) }
+
+	if _, offline := caps.missing[featureNetwork]; !offline {
+		if _, err := RunDeferred(false, logf); err != nil {
+			fmt.Println("Could not run queued enrichment tasks:", err)
+		}
+	}
+
+	only := make(map[string]bool, len(cfg.Folders))
+	for _, f := range cfg.Folders {
+		only[f] = true
+	}
+
+	for _, src := range sources {
+		stages, err := src.stages()
+		if err != nil {
+			return session, err
+		}
+		if src.Review && len(only) == 0 {
+			fmt.Printf("Skipping import folder %q: its albums wait to be picked in the web UI\n", src.Name)
+			continue
+		}
+		if src.Name != "" {
+			fmt.Printf("\n=== Import folder %q (%s) ===\n", src.Name, src.Dir)
+		}
+		// Remote sources are pulled into the main import folder.
+		if cfg.ImportDir == "" && src.Name == "" {
+			PullSources(src.Dir, logf)
+		}
+		if err := runImportFolder(ctx, session, src, stages, cmp.Or(src.LibraryDir, libraryDir), only, caps, logf); err != nil {
+			return session, err
+		}
+	}
+
+	fmt.Println("\n=== Import Complete ===")
+	return session, nil
+}
+
+// runImportFolder imports the album folders in src.Dir into libraryDir,
+// appending their results to session. only, when not empty, limits it to
+// the album folders with those FolderRefs.
+func runImportFolder(ctx context.Context, session *Session, src ImportFolder, stages []Stage, libraryDir string, only map[string]bool, caps capabilities, logf func(string)) error {
+	importDir := src.Dir
+	if err := cluster(importDir); err != nil {
+		return fmt.Errorf("clustering top-level audio files: %w", err)
+	}
+
+	entries, err := os.ReadDir(importDir)
+	if err != nil {
+		return fmt.Errorf("reading import dir: %w", err)
+	}
+	sortByPriority(importDir, entries)
+
+	// Folders picked explicitly are imported as they are.
+	held := map[string]bool{}
+	if groupByReleaseEnabled() && len(only) == 0 {
+		held = consolidateReleases(importDir, entries, logf)
+		if entries, err = os.ReadDir(importDir); err != nil {
+			return fmt.Errorf("reading import dir: %w", err)
+		}
+		sortByPriority(importDir, entries)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || isHiddenEntry(e.Name()) {
+			continue
+		}
+		if len(only) > 0 && !only[FolderRef(src.Name, e.Name())] {
+			continue
+		}
+		if held[e.Name()] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			fmt.Println("\n=== Import Cancelled ===")
+			return err
+		}
+
+		albumPath := filepath.Join(importDir, e.Name())
+
+		tracks, err := metadata.AudioFiles(albumPath)
+		if err != nil {
+			fmt.Println("Skipping (error scanning):", albumPath, err)
+			continue
+		}
+		albumStages, albumLibrary := stages, libraryDir
+		if books := audiobookTracks(albumPath); books != nil {
+			tracks, albumStages, albumLibrary = books, audiobookStages, audiobookDir()
+		}
+		if len(tracks) == 0 {
+			continue
+		}
+
+		fmt.Println("\n===== Album:", e.Name(), "=====")
+
+		result := &AlbumResult{Name: e.Name(), Path: albumPath}
+		session.Albums = append(session.Albums, result)
+		result.TrackCount = len(tracks)
+
+		runAlbumLogged(result, func() {
+			if err := runAlbumHook(hookPreAlbum, result, logf); err != nil {
+				fmt.Println("Pre-album hook failed, skipping album:", err)
+				result.skippedAt("PreAlbumHook")
+			} else {
+				a := &AlbumRun{Result: result, Tracks: tracks, LibraryDir: albumLibrary, Caps: caps, Logf: logf}
+				if err := runPipeline(a, albumStages); err != nil {
+					fmt.Println("Skipping album:", err)
+				}
+			}
+			runAlbumHook(hookPostAlbum, result, logf)
+		})
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Job is one import run started through the web UI or the API.
+type Job struct {
+	ID         string     `json:"id"`
+	Folders    []string   `json:"folders"` // empty means everything in IMPORT_DIR
+	State      string     `json:"state"`   // queued, running, done, failed
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Albums     []JobAlbum `json:"albums"`
+
+	Degradations []Degradation `json:"degradations,omitempty"` // capability report, once done
+}
+
+// JobAlbum summarises one album's AlbumResult for the API.
+type JobAlbum struct {
+	Name      string          `json:"name"`
+	Artist    string          `json:"artist,omitempty"`
+	Album     string          `json:"album,omitempty"`
+	Source    metadata.Source `json:"source,omitempty"`
+	Succeeded bool            `json:"succeeded"`
+	FailedAt  string          `json:"failed_at,omitempty"`
+	Warnings  bool            `json:"warnings"`
+	Degraded  []string        `json:"degraded,omitempty"`
+	Palette   []string        `json:"palette,omitempty"`
+	JournalID string          `json:"journal_id,omitempty"` // cover thumbnail at /art/{journal_id}
+	Match     *metadata.Match `json:"match,omitempty"`
+}
+
+// maxJobs is how many finished jobs are remembered.
+const maxJobs = 50
+
+var (
+	jobsMu    sync.Mutex
+	jobs      = map[string]*Job{}
+	jobsOrder []string // oldest first
+)
+
+var ErrRunning = errors.New("importer already running")
+
+// StartJob registers a job and runs the importer for it in the
+// background. It fails, without registering a job, if an import is already
+// running; the run is reserved here so concurrent calls cannot both start.
+func StartJob(folders []string) (*Job, error) {
+	if err := reserveRun(); err != nil {
+		return nil, err
+	}
+
+	if folders == nil {
+		folders = []string{}
+	}
+	job := &Job{
+		ID:        library.NewJournalID(),
+		Folders:   folders,
+		State:     "queued",
+		CreatedAt: time.Now(),
+		Albums:    []JobAlbum{},
+	}
+
+	jobsMu.Lock()
+	jobs[job.ID] = job
+	jobsOrder = append(jobsOrder, job.ID)
+	for len(jobsOrder) > maxJobs {
+		delete(jobs, jobsOrder[0])
+		jobsOrder = jobsOrder[1:]
+	}
+	jobsMu.Unlock()
+
+	go runImportJob(job)
+	return job, nil
+}
+
+func runImportJob(job *Job) {
+	now := time.Now()
+	jobsMu.Lock()
+	job.State = "running"
+	job.StartedAt = &now
+	jobsMu.Unlock()
+
+	session, err := runReserved(context.Background(), Config{Folders: job.Folders})
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	done := time.Now()
+	job.FinishedAt = &done
+	if session == nil {
+		job.State = "failed"
+		job.Error = err.Error()
+		return
+	}
+	job.State = "done"
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.Degradations = session.Degradations
+	for _, a := range session.Albums {
+		ja := JobAlbum{
+			Name:      a.Name,
+			Source:    a.MetadataSource,
+			Succeeded: a.Succeeded(),
+			FailedAt:  a.FatalStep,
+			Warnings:  a.HasWarnings(),
+			Degraded:  a.Degraded,
+			Palette:   a.Palette,
+			JournalID: a.JournalID,
+			Match:     a.Match,
+		}
+		if a.Metadata != nil {
+			ja.Artist, ja.Album = a.Metadata.Artist, a.Metadata.Album
+		}
+		job.Albums = append(job.Albums, ja)
+	}
+}
+
+// JobSnapshot returns a copy of a job that is safe to encode.
+func JobSnapshot(id string) (Job, bool) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	cp := *job
+	cp.Albums = append([]JobAlbum(nil), job.Albums...)
+	return cp, true
+}
+
+// JobList returns a snapshot of every remembered job, newest first.
+func JobList() []Job {
+	jobsMu.Lock()
+	ids := append([]string(nil), jobsOrder...)
+	jobsMu.Unlock()
+
+	list := []Job{}
+	for i := len(ids) - 1; i >= 0; i-- {
+		if job, ok := JobSnapshot(ids[i]); ok {
+			list = append(list, job)
+		}
+	}
+	return list
+}
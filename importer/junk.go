@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// defaultJunkPatterns are the scene and ripper leftovers deleted when
+// JUNK_DELETE is unset.
+const defaultJunkPatterns = "*.nfo,*.sfv,*.md5,*.url,*.lnk,*.torrent,Thumbs.db,.DS_Store,desktop.ini,._*,*screenshot*,*screen shot*"
+
+// globList parses a comma-separated list of glob patterns, lower-cased.
+func globList(raw string) []string {
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			out = append(out, filepath.ToSlash(p))
+		}
+	}
+	return out
+}
+
+// junkDeletePatterns returns JUNK_DELETE, the files the junk stage deletes
+// from album folders. "none" deletes nothing.
+func junkDeletePatterns() []string {
+	raw := os.Getenv("JUNK_DELETE")
+	if raw == "" {
+		raw = defaultJunkPatterns
+	}
+	if strings.EqualFold(raw, "none") {
+		return nil
+	}
+	return globList(raw)
+}
+
+// junkMovePatterns returns JUNK_MOVE, the extra files (rip logs, cue sheets,
+// booklets, …) moved into the library with the album. Unset, none are.
+func junkMovePatterns() []string {
+	return globList(os.Getenv("JUNK_MOVE"))
+}
+
+// junkExcludePatterns returns JUNK_EXCLUDE, files left alone even when they
+// match JUNK_DELETE or JUNK_MOVE.
+func junkExcludePatterns() []string {
+	return globList(os.Getenv("JUNK_EXCLUDE"))
+}
+
+// matchGlobs reports whether rel (slash-separated, relative to the album
+// folder) matches one of patterns, case-insensitively. Patterns without a
+// "/" match the file name in any subfolder.
+func matchGlobs(patterns []string, rel string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, p := range patterns {
+		target := base
+		if strings.Contains(p, "/") {
+			target = rel
+		}
+		if ok, _ := filepath.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// albumOwnFile reports whether name is something the pipeline itself handles
+// (audio, lyrics, the cover, the importer's own markers), which the junk
+// rules never touch. Audio counts in any common format, not just
+// AUDIO_EXTENSIONS, so a glob like "*" never deletes music the importer
+// does not take.
+func albumOwnFile(name string) bool {
+	lower := strings.ToLower(name)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".flac", ".mp3", ".m4a", ".m4b", ".ogg", ".opus", ".wav", ".aiff", ".wv", ".ape", ".lrc":
+		return true
+	}
+	return metadata.IsAudioFile(name) || name == albumStateFile || name == priorityMarkerFile || name == drReportFile || name == spectrogramFile || slices.Contains(metadata.CoverNames, lower)
+}
+
+// junkFiles walks an album folder and returns the files the junk rules
+// delete and those they move with the album, as absolute paths.
+func junkFiles(albumPath string) (del, move []string, err error) {
+	delPats, movePats, exclude := junkDeletePatterns(), junkMovePatterns(), junkExcludePatterns()
+	err = filepath.WalkDir(albumPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || albumOwnFile(d.Name()) {
+			return err
+		}
+		rel, _ := filepath.Rel(albumPath, path)
+		switch {
+		case matchGlobs(exclude, rel):
+		case matchGlobs(delPats, rel):
+			del = append(del, path)
+		case matchGlobs(movePats, rel):
+			move = append(move, path)
+		}
+		return nil
+	})
+	return del, move, err
+}
+
+// removeEmptyDirs removes the empty subfolders of dir, deepest first.
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != dir {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
+// dataTracks returns the album's data track remnants (see
+// metadata.IsDataTrack) not matching JUNK_EXCLUDE. An album that is
+// nothing but such files keeps them.
+func dataTracks(a *AlbumRun) []string {
+	exclude := junkExcludePatterns()
+	var out []string
+	for _, t := range a.Tracks {
+		rel, _ := filepath.Rel(a.Result.Path, t)
+		if !matchGlobs(exclude, rel) && metadata.IsDataTrack(t) {
+			out = append(out, t)
+		}
+	}
+	if len(out) == len(a.Tracks) {
+		return nil
+	}
+	return out
+}
+
+// junkStage deletes the files matching JUNK_DELETE (and not JUNK_EXCLUDE)
+// from the album folder, so they are neither left behind after the move nor
+// offered as cover art. Files matching JUNK_MOVE are moved by moveStage.
+// Data track remnants go too, so they don't count as tracks of the album,
+// and so do second copies of a track (see dedupeTracks).
+func junkStage(a *AlbumRun) error {
+	del, _, err := junkFiles(a.Result.Path)
+	if err != nil {
+		a.Result.Junk.Err = err
+		return nil
+	}
+	if data := dataTracks(a); len(data) > 0 {
+		a.Logf(fmt.Sprintf("Deleting %d data track(s)", len(data)))
+		a.Tracks = slices.DeleteFunc(a.Tracks, func(t string) bool { return slices.Contains(data, t) })
+		a.Result.TrackCount = len(a.Tracks)
+		del = append(del, data...)
+	}
+	var errs []error
+	if trackDedupeEnabled() {
+		if err := dedupeTracks(a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(del) == 0 {
+		a.Result.Junk.Err = errors.Join(errs...)
+		return nil
+	}
+	a.Logf(fmt.Sprintf("Deleting %d junk file(s)", len(del)))
+	for _, f := range del {
+		fmt.Println("→ Deleting junk:", f)
+		if _, err := library.MoveToTrash(f, "junk", nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	removeEmptyDirs(a.Result.Path)
+	a.Result.Junk.Err = errors.Join(errs...)
+	if a.Result.Junk.Failed() {
+		a.Logf(fmt.Sprintf("Deleting junk files failed: %v", a.Result.Junk.Err))
+	}
+	return nil
+}
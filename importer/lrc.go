@@ -0,0 +1,384 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+type LRCLibResponse struct {
+	SyncedLyrics string  `json:"syncedLyrics"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	Instrumental bool    `json:"instrumental"`
+	Duration     float64 `json:"duration"` // seconds
+}
+
+// instrumentalMarker is the .lrc written for instrumental tracks with
+// LYRICS_INSTRUMENTAL=marker.
+const instrumentalMarker = "[00:00.00]♪ Instrumental ♪\n"
+
+// instrumentalTitle matches track titles that are almost never sung:
+// "Intro", "Interlude", "Outro", "Prelude", "Instrumental", on their own or
+// numbered, and any title marked "(Instrumental)" or "- Instrumental".
+var instrumentalTitle = regexp.MustCompile(`(?i)^(?:(?:intro|outro|interlude|prelude|instrumental)(?:\s*(?:\d+|[ivx]+))?|.*[(\[\-]\s*instrumental(?:\s+(?:version|mix))?\s*[)\]]?)$`)
+
+// instrumentalMode returns LYRICS_INSTRUMENTAL: "skip" (default) leaves
+// instrumental tracks without lyrics, "marker" writes instrumentalMarker as
+// their .lrc so players and later lookups know, and "off" looks them up
+// like any other track.
+func instrumentalMode() string {
+	switch m := strings.ToLower(os.Getenv("LYRICS_INSTRUMENTAL")); m {
+	case "marker", "off":
+		return m
+	}
+	return "skip"
+}
+
+// errInstrumental means LRCLIB knows the track as instrumental.
+var errInstrumental = errors.New("instrumental")
+
+func TrackDuration(path string) (int, error) {
+	out, err := tools.Output(
+		"ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe error: %w", err)
+	}
+
+	raw := strings.TrimSpace(string(out))
+	if raw == "" {
+		return 0, fmt.Errorf("empty duration output from ffprobe")
+	}
+
+	flt, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse duration: %w (raw=%q)", err, raw)
+	}
+
+	return int(flt + 0.5), nil // round to nearest second
+}
+
+// lyricsWorkers returns LYRICS_WORKERS, how many tracks of an album look up
+// lyrics at once (default 4). LRCLIB requests stay within HTTP_RATE_LIMITS
+// however many run.
+func lyricsWorkers() int {
+	if n, err := strconv.Atoi(os.Getenv("LYRICS_WORKERS")); err == nil && n >= 1 {
+		return n
+	}
+	return 4
+}
+
+// lyricsProgressEvery is how many finished tracks pass between progress
+// lines.
+const lyricsProgressEvery = 10
+
+// DownloadAlbumLyrics downloads synced lyrics (LRC format) for each track in
+// the album directory, LYRICS_WORKERS tracks at a time, reporting progress
+// to logf (which may be nil). Assumes metadata is already final (tags
+// complete).
+func DownloadAlbumLyrics(albumDir string, logf func(string)) (LyricsStats, error) {
+	var paths []string
+	err := filepath.Walk(albumDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && metadata.IsAudioFile(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return LyricsStats{}, err
+	}
+
+	var (
+		mu    sync.Mutex
+		stats LyricsStats
+		errs  []error
+		done  int
+		wg    sync.WaitGroup
+	)
+	jobs := make(chan string)
+	for range min(lyricsWorkers(), max(len(paths), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				var track LyricsStats
+				_, err := downloadTrackLyrics(path, false, &track)
+
+				mu.Lock()
+				stats.add(track)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				done++
+				if logf != nil && done%lyricsProgressEvery == 0 && done < len(paths) {
+					logf(fmt.Sprintf("Lyrics: %d/%d tracks", done, len(paths)))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, p := range paths {
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+
+	if logf != nil && len(paths) >= lyricsProgressEvery {
+		logf(fmt.Sprintf("Lyrics: %d/%d tracks, %d downloaded", done, len(paths), stats.Downloaded()))
+	}
+	return stats, errors.Join(errs...)
+}
+
+// downloadTrackLyrics fetches an .lrc file for one track unless it already
+// has one (or, with skipEmbedded, lyrics in its tags), counting the outcome
+// in stats. It reports whether LRCLIB was queried, so callers can pace
+// themselves. Non-audio files are ignored.
+func downloadTrackLyrics(path string, skipEmbedded bool, stats *LyricsStats) (bool, error) {
+	if !metadata.IsAudioFile(path) {
+		return false, nil
+	}
+	ext := filepath.Ext(path)
+	stats.Total++
+
+	// Skip if LRC already exists next to the file
+	lrcPath := strings.TrimSuffix(path, ext) + ".lrc"
+	if _, err := os.Stat(lrcPath); err == nil {
+		stats.AlreadyHad++
+		fmt.Println("→ Skipping (already has lyrics):", filepath.Base(path))
+		return false, nil
+	}
+	if skipEmbedded && metadata.HasEmbeddedLyrics(path) {
+		stats.AlreadyHad++
+		fmt.Println("→ Skipping (embedded lyrics):", filepath.Base(path))
+		return false, nil
+	}
+
+	// Read metadata
+	md, err := metadata.ReadTags(path)
+	if err != nil {
+		stats.NotFound++
+		fmt.Println("Skipping (unable to read tags):", path, "error:", err)
+		return false, nil
+	}
+	if md.Title == "" || md.Artist == "" || md.Album == "" {
+		stats.NotFound++
+		fmt.Println("Skipping (missing metadata):", path)
+		return false, nil
+	}
+
+	mode := instrumentalMode()
+	if mode != "off" && (instrumentalTitle.MatchString(strings.TrimSpace(md.Title)) || metadata.TaggedInstrumental(path)) {
+		return false, instrumentalTrack(path, lrcPath, mode, stats)
+	}
+
+	duration, _ := TrackDuration(path)
+
+	var lyrics string
+	var synced bool
+	for i, q := range lyricsQueries(md) {
+		if i > 0 {
+			fmt.Printf("→ Retrying lyrics as %s - %s\n", q.Artist, q.Title)
+		}
+		lyrics, synced, err = fetchLRCLibLyrics(q.Artist, q.Title, q.Album, duration)
+		if !errors.Is(err, errLyricsNotFound) {
+			break
+		}
+	}
+	if errors.Is(err, errInstrumental) && mode != "off" {
+		return true, instrumentalTrack(path, lrcPath, mode, stats)
+	}
+	if errors.Is(err, errLyricsNotFound) || errors.Is(err, errInstrumental) {
+		stats.NotFound++
+		fmt.Println("No lyrics found:", md.Artist, "-", md.Title)
+		return true, nil
+	} else if err != nil {
+		stats.Failed++
+		fmt.Println("Lyrics lookup failed:", md.Artist, "-", md.Title, "error:", err)
+		return true, nil
+	}
+
+	// Write .lrc file
+	if err := os.WriteFile(lrcPath, []byte(formatLRC(lyrics, synced)), 0644); err != nil {
+		return true, fmt.Errorf("writing lrc file for %s: %w", path, err)
+	}
+
+	if synced {
+		stats.Synced++
+	} else {
+		stats.Plain++
+	}
+	fmt.Println("→ Downloaded lyrics:", filepath.Base(lrcPath))
+	return true, nil
+}
+
+// instrumentalTrack counts an instrumental track and, in marker mode, writes
+// its marker .lrc.
+func instrumentalTrack(path, lrcPath, mode string, stats *LyricsStats) error {
+	stats.Instrumental++
+	if mode != "marker" {
+		fmt.Println("→ Skipping (instrumental):", filepath.Base(path))
+		return nil
+	}
+	if err := os.WriteFile(lrcPath, []byte(instrumentalMarker), 0644); err != nil {
+		return fmt.Errorf("writing lrc file for %s: %w", path, err)
+	}
+	fmt.Println("→ Marked instrumental:", filepath.Base(lrcPath))
+	return nil
+}
+
+// errLyricsNotFound means LRCLIB has no lyrics for a query, as opposed to the
+// request failing; only then are alternate queries tried.
+var errLyricsNotFound = errors.New("no lyrics found")
+
+var (
+	// Bracketed title suffixes naming a version rather than a song, e.g.
+	// "(2011 Remaster)", "[Live at Wembley]", "(feat. X)".
+	lyricsVersionSuffix = regexp.MustCompile(`(?i)\s*[(\[][^)\]]*\b(?:remaster(?:ed)?|live|feat\.?|ft\.|featuring|mono|stereo|version|edit|mix|deluxe|bonus)\b[^)\]]*[)\]]`)
+	// Dash suffixes doing the same, e.g. "Song - Remastered 2009", "Song - Live".
+	lyricsDashSuffix = regexp.MustCompile(`(?i)\s+-\s+[^-]*\b(?:remaster(?:ed)?|live|mono|stereo|version|edit|mix)\b.*$`)
+	// Unbracketed featuring credits, in titles and artists.
+	lyricsFeaturing = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.|featuring)\s+.*$`)
+)
+
+// cleanLyricsTitle strips version and featuring suffixes from a track or
+// album title.
+func cleanLyricsTitle(s string) string {
+	s = lyricsVersionSuffix.ReplaceAllString(s, "")
+	s = lyricsDashSuffix.ReplaceAllString(s, "")
+	s = lyricsFeaturing.ReplaceAllString(s, "")
+	return strings.TrimSpace(s)
+}
+
+type lyricsQuery struct {
+	Artist, Title, Album string
+}
+
+// lyricsQueries returns the LRCLIB queries to try for a track, most specific
+// first: the tags as they are, then with cleaned titles, with the track
+// artist's main credit, and with the album artist.
+func lyricsQueries(md *metadata.MusicMetadata) []lyricsQuery {
+	title, album := cleanLyricsTitle(md.Title), cleanLyricsTitle(md.Album)
+	mainArtist := strings.TrimSpace(lyricsFeaturing.ReplaceAllString(md.Artist, ""))
+	candidates := []lyricsQuery{
+		{md.Artist, md.Title, md.Album},
+		{md.Artist, title, album},
+		{mainArtist, title, album},
+		{md.AlbumArtist, title, album},
+	}
+	var out []lyricsQuery
+	seen := map[lyricsQuery]bool{}
+	for _, q := range candidates {
+		if q.Artist == "" || q.Title == "" || seen[q] {
+			continue
+		}
+		seen[q] = true
+		out = append(out, q)
+	}
+	return out
+}
+
+// fetchLRCLibLyrics calls the LRCLIB API and returns synced lyrics if available.
+// With a lyrics script preference or filter set, it searches instead and
+// picks among the results (see lrcscript.go).
+func fetchLRCLibLyrics(artist, title, album string, duration int) (string, bool, error) {
+	if lyricsScriptPreference() != "" || len(allowedLyricsScripts()) > 0 {
+		return searchLRCLibLyrics(artist, title, album, duration)
+	}
+
+	url := fmt.Sprintf(
+		"https://lrclib.net/api/get?artist_name=%s&track_name=%s&album_name=%s&duration=%d",
+		urlEncode(artist), urlEncode(title), urlEncode(album), duration,
+	)
+
+	status, bodyBytes, err := lrclibGet(url)
+	if err != nil {
+		return "", false, err
+	}
+
+	if status == http.StatusNotFound {
+		return "", false, errLyricsNotFound
+	}
+	if status != http.StatusOK {
+		return "", false, fmt.Errorf("lrclib returned status %d", status)
+	}
+
+	var out LRCLibResponse
+	if err := json.Unmarshal(bodyBytes, &out); err != nil {
+		return "", false, fmt.Errorf("parsing lrclib json: %w", err)
+	}
+	return out.lyrics()
+}
+
+// lyrics returns a record's synced lyrics, or its plain lyrics wrapped as
+// LRC, or errInstrumental / errLyricsNotFound.
+func (out LRCLibResponse) lyrics() (string, bool, error) {
+	if out.Instrumental {
+		return "", false, errInstrumental
+	}
+	if out.SyncedLyrics != "" {
+		return out.SyncedLyrics, true, nil
+	}
+
+	// If no syncedLyrics, fallback to plain
+	if out.PlainLyrics != "" {
+		// Convert plain text to a fake LRC wrapper
+		return plainToLRC(out.PlainLyrics), false, nil
+	}
+
+	return "", false, errLyricsNotFound
+}
+
+// lrclibGet fetches an LRCLIB API URL through the API cache.
+func lrclibGet(url string) (int, []byte, error) {
+	return metadata.CachedFetch(url, func() (int, []byte, error) {
+		resp, err := metadata.HTTPGet(url)
+		if err != nil {
+			return 0, nil, fmt.Errorf("lrclib fetch error: %w", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("reading lrclib response: %w", err)
+		}
+		return resp.StatusCode, body, nil
+	})
+}
+
+// URL escape helper
+func urlEncode(s string) string {
+	r := strings.ReplaceAll(s, " ", "+")
+	return r
+}
+
+// Convert plaintext lyrics to a basic unsynced LRC (fallback)
+func plainToLRC(plain string) string {
+	lines := strings.Split(plain, "\n")
+	var out strings.Builder
+
+	for _, line := range lines {
+		// LRC format with [00:00.00] prefix when no timing exists
+		out.WriteString("[00:00.00] ")
+		out.WriteString(strings.TrimSpace(line))
+		out.WriteByte('\n')
+	}
+
+	return out.String()
+}
@@ -0,0 +1,91 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// lyricsOffset returns LYRICS_OFFSET_MS, the milliseconds added to every
+// timestamp of synced lyrics (negative shows lines earlier).
+func lyricsOffset() int {
+	n, _ := strconv.Atoi(strings.TrimSpace(os.Getenv("LYRICS_OFFSET_MS")))
+	return n
+}
+
+// lrcTimestamp matches a line ("[01:02.34]") or word ("<01:02.345>")
+// timestamp.
+var lrcTimestamp = regexp.MustCompile(`([\[<])(\d+):(\d{2})(?:[.:](\d{1,3}))?([\]>])`)
+
+// lrcHeader matches an ID tag line such as "[ar:Artist]" or "[offset:+200]".
+var lrcHeader = regexp.MustCompile(`^\[(?i:ar|ti|al|au|by|re|ve|length|offset|la|#):[^\]]*\]$`)
+
+// shiftLRCTimestamps adds ms to every timestamp in lyrics, keeping each
+// one's precision and stopping at zero.
+func shiftLRCTimestamps(lyrics string, ms int) string {
+	return lrcTimestamp.ReplaceAllStringFunc(lyrics, func(ts string) string {
+		m := lrcTimestamp.FindStringSubmatch(ts)
+		mins, _ := strconv.Atoi(m[2])
+		sec, _ := strconv.Atoi(m[3])
+		frac, digits := 0, len(m[4])
+		if digits > 0 {
+			frac, _ = strconv.Atoi(m[4])
+			for i := digits; i < 3; i++ {
+				frac *= 10
+			}
+		}
+		t := max((mins*60+sec)*1000+frac+ms, 0)
+		out := fmt.Sprintf("%s%02d:%02d", m[1], t/60000, t/1000%60)
+		switch digits {
+		case 0:
+		case 3:
+			out += fmt.Sprintf(".%03d", t%1000)
+		default:
+			out += fmt.Sprintf(".%02d", t%1000/10)
+		}
+		return out + m[5]
+	})
+}
+
+// formatLRC applies the lyrics formatting options before an .lrc file is
+// written: LYRICS_OFFSET_MS (synced lyrics only), LYRICS_STRIP_HEADERS=true
+// to drop ID tag lines like "[ar:...]" and "[offset:...]", and
+// LYRICS_LINE_ENDINGS=lf or crlf to normalise line endings, trimming
+// trailing spaces and ending with one newline.
+func formatLRC(lyrics string, synced bool) string {
+	if ms := lyricsOffset(); synced && ms != 0 {
+		lyrics = shiftLRCTimestamps(lyrics, ms)
+	}
+	strip := strings.ToLower(os.Getenv("LYRICS_STRIP_HEADERS")) == "true"
+	ending := ""
+	switch strings.ToLower(os.Getenv("LYRICS_LINE_ENDINGS")) {
+	case "lf":
+		ending = "\n"
+	case "crlf":
+		ending = "\r\n"
+	}
+	if !strip && ending == "" {
+		return lyrics
+	}
+
+	lines := strings.Split(strings.ReplaceAll(lyrics, "\r\n", "\n"), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if strip && lrcHeader.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		if ending != "" {
+			line = strings.TrimRight(line, " \t\r")
+		}
+		out = append(out, line)
+	}
+	if ending == "" {
+		return strings.Join(out, "\n")
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, ending) + ending
+}
@@ -0,0 +1,183 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// lyricsScriptPreference returns LYRICS_SCRIPT: "original" prefers lyrics in
+// a non-Latin script when LRCLIB has both, "romanized" prefers Latin ones,
+// and "" (unset) takes LRCLIB's best match.
+func lyricsScriptPreference() string {
+	switch p := strings.ToLower(os.Getenv("LYRICS_SCRIPT")); p {
+	case "original", "romanized":
+		return p
+	}
+	return ""
+}
+
+// allowedLyricsScripts returns LYRICS_SCRIPTS, the scripts lyrics may be
+// written in (e.g. "latin,japanese"); lyrics in any other are not saved.
+// Empty allows all.
+func allowedLyricsScripts() []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv("LYRICS_SCRIPTS"), ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// lrcTimestamps matches LRC time and metadata tags, e.g. "[01:02.34]".
+var lrcTimestamps = regexp.MustCompile(`\[[^\]]*\]`)
+
+// lyricsScript returns the script most of the letters in lyrics are
+// written in: latin, cyrillic, greek, arabic, hebrew, japanese (any kana),
+// chinese (Han without kana), korean, thai, devanagari, or "" when there
+// are no letters.
+func lyricsScript(lyrics string) string {
+	counts := map[string]int{}
+	kana := false
+	for _, r := range lrcTimestamps.ReplaceAllString(lyrics, "") {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["cyrillic"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["greek"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["arabic"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["hebrew"]++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana = true
+			counts["japanese"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["korean"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["thai"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["devanagari"]++
+		default:
+			counts["other"]++
+		}
+	}
+	// Kanji count towards Japanese once there is any kana, else Chinese.
+	if n := counts["han"]; n > 0 {
+		delete(counts, "han")
+		if kana {
+			counts["japanese"] += n
+		} else {
+			counts["chinese"] += n
+		}
+	}
+	best, most := "", 0
+	for s, n := range counts {
+		if n > most || (n == most && s < best) {
+			best, most = s, n
+		}
+	}
+	return best
+}
+
+// searchLRCLibLyrics looks a track up with LRCLIB's search endpoint and
+// picks the result that suits LYRICS_SCRIPT and LYRICS_SCRIPTS: results
+// more than 3 seconds off the track's duration (when known) or in a script
+// not allowed are dropped, then the preferred script wins, then synced
+// lyrics, then the closest duration.
+func searchLRCLibLyrics(artist, title, album string, duration int) (string, bool, error) {
+	q := url.Values{"artist_name": {artist}, "track_name": {title}}
+	if album != "" {
+		q.Set("album_name", album)
+	}
+	status, body, err := lrclibGet("https://lrclib.net/api/search?" + q.Encode())
+	if err != nil {
+		return "", false, err
+	}
+	if status != http.StatusOK {
+		return "", false, fmt.Errorf("lrclib search returned status %d", status)
+	}
+	var results []LRCLibResponse
+	if err := json.Unmarshal(body, &results); err != nil {
+		return "", false, fmt.Errorf("parsing lrclib json: %w", err)
+	}
+
+	type candidate struct {
+		rec    LRCLibResponse
+		script string
+		off    float64
+	}
+	allowed := allowedLyricsScripts()
+	var cands []candidate
+	instrumental, filtered := false, ""
+	for _, r := range results {
+		off := 0.0
+		if duration > 0 && r.Duration > 0 {
+			if off = math.Abs(r.Duration - float64(duration)); off > 3 {
+				continue
+			}
+		}
+		if r.Instrumental {
+			instrumental = true
+			continue
+		}
+		text := r.SyncedLyrics
+		if text == "" {
+			text = r.PlainLyrics
+		}
+		if text == "" {
+			continue
+		}
+		script := lyricsScript(text)
+		if len(allowed) > 0 && !slices.Contains(allowed, script) {
+			filtered = script
+			continue
+		}
+		cands = append(cands, candidate{r, script, off})
+	}
+	if len(cands) == 0 {
+		if instrumental {
+			return "", false, errInstrumental
+		}
+		if filtered != "" {
+			fmt.Printf("→ Skipping lyrics in %s (LYRICS_SCRIPTS)\n", filtered)
+		}
+		return "", false, errLyricsNotFound
+	}
+
+	pref := lyricsScriptPreference()
+	rank := func(c candidate) int {
+		switch {
+		case pref == "original" && c.script != "latin", pref == "romanized" && c.script == "latin":
+			return 0
+		}
+		return 1
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		if sa, sb := a.rec.SyncedLyrics != "", b.rec.SyncedLyrics != ""; sa != sb {
+			return sa
+		}
+		return a.off < b.off
+	})
+	return cands[0].rec.lyrics()
+}
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// lyricsBackfillDelay returns LYRICS_BACKFILL_DELAY (default 1s), the pause
+// after each track looked up on LRCLIB.
+func lyricsBackfillDelay() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("LYRICS_BACKFILL_DELAY")); err == nil && d >= 0 {
+		return d
+	}
+	return time.Second
+}
+
+// BackfillLyrics fetches lyrics for every track in the library that has
+// neither an .lrc file nor embedded lyrics, pausing LYRICS_BACKFILL_DELAY
+// after each LRCLIB lookup. Progress is checkpointed in
+// DATA_DIR/lyrics-backfill.json after every album, so a cancelled or
+// crashed run resumes where it stopped; restart discards the checkpoint.
+// The checkpoint is removed once the whole library has been walked.
+func BackfillLyrics(ctx context.Context, libraryDir string, restart bool, logf func(string)) (LyricsStats, error) {
+	cp := loadBackfillCheckpoint[LyricsStats]("lyrics", restart)
+	if len(cp.Done) > 0 {
+		logf(fmt.Sprintf("Resuming lyrics backfill started %s (%d albums done)", cp.StartedAt.Format(time.DateTime), len(cp.Done)))
+	}
+
+	dirs, err := libraryAlbumDirs(libraryDir)
+	if err != nil {
+		return cp.Stats, err
+	}
+	delay := lyricsBackfillDelay()
+	for i, rel := range dirs {
+		if cp.Done[rel] {
+			continue
+		}
+		logf(fmt.Sprintf("[%d/%d] %s", i+1, len(dirs), rel))
+		tracks, err := metadata.AudioFiles(filepath.Join(libraryDir, rel))
+		if err != nil {
+			logf(fmt.Sprintf("Skipping %s: %v", rel, err))
+			continue
+		}
+		for _, t := range tracks {
+			if err := ctx.Err(); err != nil {
+				return cp.Stats, errors.Join(err, cp.save())
+			}
+			queried, err := downloadTrackLyrics(t, true, &cp.Stats)
+			if err != nil {
+				logf(err.Error())
+			}
+			if queried {
+				time.Sleep(delay)
+			}
+		}
+		cp.Done[rel] = true
+		if err := cp.save(); err != nil {
+			logf(fmt.Sprintf("Could not save lyrics backfill checkpoint: %v", err))
+		}
+	}
+	cp.finish()
+	return cp.Stats, nil
+}
@@ -1,30 +1,24 @@
-package main
+package importer
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"slices"
 	"strings"
 
-	id3v2 "github.com/bogem/id3v2" // optional alternative
+	"github.com/bogem/id3v2"
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
 )
 
-var coverNames = []string{
-	"cover.jpg", "cover.jpeg", "cover.png",
-	"folder.jpg", "folder.jpeg", "folder.png",
-	"album.jpg", "album.jpeg", "album.png",
-}
-
 // EmbedAlbumArtIntoFolder scans one album folder and embeds cover art.
 func EmbedAlbumArtIntoFolder(albumDir string) error {
-	coverFile, err := FindCoverImage(albumDir)
+	coverFile, err := metadata.FindCoverImage(albumDir)
 	if err != nil {
 		fmt.Println("Could not find cover image. Skipping embed...")
 		return nil
@@ -43,11 +37,13 @@ func EmbedAlbumArtIntoFolder(albumDir string) error {
 			return nil
 		}
 
-		lower := strings.ToLower(info.Name())
-		switch {
-		case strings.HasSuffix(lower, ".mp3"):
+		if !metadata.IsAudioFile(path) {
+			return nil
+		}
+		switch metadata.AudioFormat(path) {
+		case metadata.FormatMP3:
 			return embedCoverMP3(path, coverData)
-		case strings.HasSuffix(lower, ".flac"):
+		case metadata.FormatFLAC:
 			return embedCoverFLAC(path, coverData)
 		default:
 			return nil
@@ -61,7 +57,7 @@ func EmbedAlbumArtIntoFolder(albumDir string) error {
 // saves it as cover.jpg/cover.png inside albumDir.
 // If mbid is non-empty it is used directly, bypassing the MusicBrainz search.
 // Otherwise, a search is performed using md's artist and album.
-func DownloadCoverArt(albumDir string, md *MusicMetadata, mbid string) error {
+func DownloadCoverArt(albumDir string, md *metadata.MusicMetadata, mbid string) error {
 	if mbid == "" {
 		var err error
 		mbid, err = searchMusicBrainzRelease(md.Artist, md.Album)
@@ -91,30 +87,12 @@ func searchMusicBrainzRelease(artist, album string) (string, error) {
 		strings.ReplaceAll(album, `"`, `\"`),
 		strings.ReplaceAll(artist, `"`, `\"`),
 	)
-	apiURL := "https://musicbrainz.org/ws/2/release/?query=" + url.QueryEscape(q) + "&fmt=json&limit=1"
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "music-importer/1.0 (https://github.com/example/music-importer)")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("MusicBrainz returned status %d", resp.StatusCode)
-	}
-
 	var result struct {
 		Releases []struct {
 			ID string `json:"id"`
 		} `json:"releases"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := metadata.MBGet("/ws/2/release/?query="+url.QueryEscape(q)+"&fmt=json&limit=1", &result); err != nil {
 		return "", err
 	}
 	if len(result.Releases) == 0 {
@@ -130,7 +108,7 @@ func searchMusicBrainzRelease(artist, album string) (string, error) {
 func fetchCoverArtArchiveFront(mbid string) ([]byte, string, error) {
 	apiURL := "https://coverartarchive.org/release/" + mbid + "/front"
 
-	resp, err := http.Get(apiURL)
+	resp, err := metadata.HTTPGet(apiURL)
 	if err != nil {
 		return nil, "", err
 	}
@@ -165,7 +143,7 @@ const coverMaxBytes = 5 * 1024 * 1024 // 5 MB
 // The function is a no-op when no cover is found, the cover is already JPEG,
 // or the file is ≤5 MB.
 func NormalizeCoverArt(albumDir string) error {
-	cover, err := FindCoverImage(albumDir)
+	cover, err := metadata.FindCoverImage(albumDir)
 	if err != nil {
 		return nil // no cover present, nothing to do
 	}
@@ -190,17 +168,16 @@ func NormalizeCoverArt(albumDir string) error {
 
 	// scale=2000:2000:force_original_aspect_ratio=decrease fits the image within
 	// 2000×2000 while preserving aspect ratio, and never upscales smaller images.
-	cmd := exec.Command("ffmpeg", "-y", "-i", cover,
+	if _, err := tools.Output("ffmpeg", "-y", "-i", cover,
 		"-vf", "scale=2000:2000:force_original_aspect_ratio=decrease",
 		"-q:v", "2",
 		dest,
-	)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("ffmpeg cover conversion failed: %w\n%s", err, out)
+	); err != nil {
+		return fmt.Errorf("ffmpeg cover conversion failed: %w", err)
 	}
 
 	if cover != dest {
-		if err := os.Remove(cover); err != nil {
+		if _, err := library.MoveToTrash(cover, "converted cover", nil); err != nil {
 			fmt.Println("Warning: could not remove original cover:", err)
 		}
 	}
@@ -209,44 +186,52 @@ func NormalizeCoverArt(albumDir string) error {
 	return nil
 }
 
-// -------------------------
-// Find cover image
-// -------------------------
-func FindCoverImage(dir string) (string, error) {
-	entries, _ := os.ReadDir(dir)
-	for _, e := range entries {
-		if e.IsDir() {
-			continue
-		}
-		l := strings.ToLower(e.Name())
-		if slices.Contains(coverNames, l) {
-			return filepath.Join(dir, e.Name()), nil
-		}
-	}
-	return "", fmt.Errorf("no cover image found in %s", dir)
-}
-
 // -------------------------
 // Embed into MP3
 // -------------------------
+
+// embedCoverMP3 makes cover the MP3's only front cover. Existing front (or
+// untyped) pictures are replaced, other pictures such as a back cover are
+// kept, and a file whose single front cover already is this image is left
+// untouched.
 func embedCoverMP3(path string, cover []byte) error {
-	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	tag, err := metadata.OpenID3(path)
 	if err != nil {
 		return fmt.Errorf("mp3 open: %w", err)
 	}
 	defer tag.Close()
 
-	mime := guessMimeType(cover)
+	pictureID := tag.CommonID("Attached picture")
+	var keep []id3v2.PictureFrame
+	fronts, same := 0, false
+	for _, f := range tag.GetFrames(pictureID) {
+		pic, ok := f.(id3v2.PictureFrame)
+		if !ok {
+			continue
+		}
+		if pic.PictureType != id3v2.PTFrontCover && pic.PictureType != id3v2.PTOther {
+			keep = append(keep, pic)
+			continue
+		}
+		fronts++
+		same = bytes.Equal(pic.Picture, cover)
+	}
+	if fronts == 1 && same {
+		fmt.Println("→ Art already embedded in MP3:", filepath.Base(path))
+		return nil
+	}
 
-	pic := id3v2.PictureFrame{
-		Encoding:    id3v2.EncodingUTF8,
-		MimeType:    mime,
+	tag.DeleteFrames(pictureID)
+	for _, pic := range keep {
+		tag.AddAttachedPicture(pic)
+	}
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    tag.DefaultEncoding(),
+		MimeType:    GuessMimeType(cover),
 		PictureType: id3v2.PTFrontCover,
 		Description: "Cover",
 		Picture:     cover,
-	}
-
-	tag.AddAttachedPicture(pic)
+	})
 
 	if err := tag.Save(); err != nil {
 		return fmt.Errorf("mp3 save: %w", err)
@@ -260,10 +245,15 @@ func embedCoverMP3(path string, cover []byte) error {
 // Requires `metaflac` (from the flac package) to be installed and in PATH.
 func embedCoverFLAC(path string, cover []byte) error {
 	// Ensure metaflac exists
-	if _, err := exec.LookPath("metaflac"); err != nil {
+	if _, err := tools.LookPath("metaflac"); err != nil {
 		return fmt.Errorf("metaflac not found in PATH; please install package 'flac' (provides metaflac): %w", err)
 	}
 
+	if flacHasOnlyPicture(path, cover) {
+		fmt.Println("→ Art already embedded in FLAC:", filepath.Base(path))
+		return nil
+	}
+
 	// Create a temp file for the cover image
 	tmp, err := os.CreateTemp("", "cover-*.img")
 	if err != nil {
@@ -286,30 +276,37 @@ func embedCoverFLAC(path string, cover []byte) error {
 	}
 
 	// Remove existing PICTURE blocks (ignore non-zero exit -> continue, but report)
-	removeCmd := exec.Command("metaflac", "--remove", "--block-type=PICTURE", path)
-	removeOut, removeErr := removeCmd.CombinedOutput()
-	if removeErr != nil {
+	if _, removeErr := tools.Output("metaflac", "--remove", "--block-type=PICTURE", path); removeErr != nil {
 		// metaflac returns non-zero if there were no picture blocks — that's OK.
 		// Only fail if it's some unexpected error.
 		// We'll print the output for debugging and continue.
-		fmt.Printf("metaflac --remove output (may be fine): %s\n", string(removeOut))
+		fmt.Printf("metaflac --remove output (may be fine): %v\n", removeErr)
 	}
 
 	// Import the new picture. metaflac will auto-detect mime type from the file.
-	importCmd := exec.Command("metaflac", "--import-picture-from="+tmpPath, path)
-	importOut, importErr := importCmd.CombinedOutput()
-	if importErr != nil {
-		return fmt.Errorf("metaflac --import-picture-from failed: %v; output: %s", importErr, string(importOut))
+	if _, importErr := tools.Output("metaflac", "--import-picture-from="+tmpPath, path); importErr != nil {
+		return fmt.Errorf("metaflac --import-picture-from failed: %w", importErr)
 	}
 
 	fmt.Println("→ Embedded art into FLAC:", filepath.Base(path))
 	return nil
 }
 
+// flacHasOnlyPicture reports whether a FLAC file's single PICTURE block
+// holds exactly cover, so embedding it again would change nothing.
+func flacHasOnlyPicture(path string, cover []byte) bool {
+	out, err := tools.Output("metaflac", "--list", "--block-type=PICTURE", path)
+	if err != nil || strings.Count(string(out), "(PICTURE)") != 1 {
+		return false
+	}
+	embedded, err := extractEmbeddedArt(path)
+	return err == nil && bytes.Equal(embedded, cover)
+}
+
 // -------------------------
 // Helpers
 // -------------------------
-func guessMimeType(data []byte) string {
+func GuessMimeType(data []byte) string {
 	if bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}) {
 		return "image/jpeg"
 	}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// mediaServerThrottleEnabled reports whether heavy pipeline steps should wait
+// for Jellyfin/Plex to have no active playback sessions.
+func mediaServerThrottleEnabled() bool {
+	return strings.ToLower(os.Getenv("MEDIA_SERVER_THROTTLE")) == "true"
+}
+
+var mediaServerClient = &http.Client{Timeout: 10 * time.Second}
+
+// jellyfinActiveStreams returns the number of Jellyfin sessions currently
+// playing something. It returns 0 when JELLYFIN_URL is not configured.
+func jellyfinActiveStreams() (int, error) {
+	base := strings.TrimRight(os.Getenv("JELLYFIN_URL"), "/")
+	if base == "" {
+		return 0, nil
+	}
+
+	req, err := http.NewRequest("GET", base+"/Sessions?activeWithinSeconds=60", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Emby-Token", os.Getenv("JELLYFIN_API_KEY"))
+
+	resp, err := mediaServerClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Jellyfin returned status %d", resp.StatusCode)
+	}
+
+	var sessions []struct {
+		NowPlayingItem *struct{} `json:"NowPlayingItem"`
+		PlayState      struct {
+			IsPaused bool `json:"IsPaused"`
+		} `json:"PlayState"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range sessions {
+		if s.NowPlayingItem != nil && !s.PlayState.IsPaused {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// plexActiveStreams returns the number of Plex sessions currently playing. It
+// returns 0 when PLEX_URL is not configured.
+func plexActiveStreams() (int, error) {
+	base := strings.TrimRight(os.Getenv("PLEX_URL"), "/")
+	if base == "" {
+		return 0, nil
+	}
+
+	req, err := http.NewRequest("GET", base+"/status/sessions", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Plex-Token", os.Getenv("PLEX_TOKEN"))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := mediaServerClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Plex returned status %d", resp.StatusCode)
+	}
+
+	var data struct {
+		MediaContainer struct {
+			Size int `json:"size"`
+		} `json:"MediaContainer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return 0, err
+	}
+	return data.MediaContainer.Size, nil
+}
+
+// waitForMediaServerIdle blocks while Jellyfin or Plex report active playback,
+// polling every 30 s. It gives up after MEDIA_SERVER_THROTTLE_MAX_WAIT
+// (default 2h) so an always-on stream can't stall imports forever. Query
+// errors are treated as idle so a down media server never blocks an import.
+func waitForMediaServerIdle(logf func(string)) {
+	if !mediaServerThrottleEnabled() {
+		return
+	}
+
+	maxWait := 2 * time.Hour
+	if raw := os.Getenv("MEDIA_SERVER_THROTTLE_MAX_WAIT"); raw != "" {
+		if d, err := time.ParseDuration(raw); err == nil {
+			maxWait = d
+		}
+	}
+	deadline := time.Now().Add(maxWait)
+
+	for {
+		jf, err := jellyfinActiveStreams()
+		if err != nil {
+			logf(fmt.Sprintf("Jellyfin session check failed: %v", err))
+		}
+		px, err := plexActiveStreams()
+		if err != nil {
+			logf(fmt.Sprintf("Plex session check failed: %v", err))
+		}
+
+		active := jf + px
+		if active == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			logf(fmt.Sprintf("Still %d active stream(s) after %s; continuing anyway", active, maxWait))
+			return
+		}
+		logf(fmt.Sprintf("%d active stream(s) on the media server; deferring heavy work", active))
+		time.Sleep(30 * time.Second)
+	}
+}
@@ -0,0 +1,282 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// hookMediaServerMissing runs for each album a media server still doesn't
+// list once verification gives up.
+const hookMediaServerMissing = "HOOK_MEDIA_SERVER_MISSING"
+
+// mediaServer is a library server the importer can ask to rescan and then
+// check for newly imported albums.
+type mediaServer interface {
+	Name() string
+	Refresh() error
+	HasAlbum(artist, album string) (bool, error)
+}
+
+// configuredMediaServers returns the servers with a URL configured.
+func configuredMediaServers() []mediaServer {
+	var out []mediaServer
+	if base := strings.TrimRight(os.Getenv("JELLYFIN_URL"), "/"); base != "" {
+		out = append(out, jellyfinServer{base: base, key: os.Getenv("JELLYFIN_API_KEY")})
+	}
+	if base := strings.TrimRight(os.Getenv("PLEX_URL"), "/"); base != "" {
+		out = append(out, plexServer{base: base, token: os.Getenv("PLEX_TOKEN")})
+	}
+	return out
+}
+
+func mediaServerRefreshEnabled() bool {
+	return strings.ToLower(os.Getenv("MEDIA_SERVER_REFRESH")) == "true"
+}
+
+func mediaServerVerifyEnabled() bool {
+	return strings.ToLower(os.Getenv("MEDIA_SERVER_VERIFY")) == "true"
+}
+
+// mediaServerVerifyTimeout returns MEDIA_SERVER_VERIFY_TIMEOUT (default 10m):
+// how long an album may take to show up before it is reported missing.
+func mediaServerVerifyTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("MEDIA_SERVER_VERIFY_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// mediaServerRequest sends an authenticated request and decodes a JSON reply
+// into out, which may be nil.
+func mediaServerRequest(method, u string, header http.Header, out any) error {
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+	resp, err := mediaServerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sameName compares album and artist names ignoring case and spacing.
+func sameName(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+type jellyfinServer struct{ base, key string }
+
+func (j jellyfinServer) Name() string { return "Jellyfin" }
+
+func (j jellyfinServer) header() http.Header {
+	return http.Header{"X-Emby-Token": {j.key}}
+}
+
+func (j jellyfinServer) Refresh() error {
+	return mediaServerRequest("POST", j.base+"/Library/Refresh", j.header(), nil)
+}
+
+func (j jellyfinServer) HasAlbum(artist, album string) (bool, error) {
+	q := url.Values{
+		"Recursive":        {"true"},
+		"IncludeItemTypes": {"MusicAlbum"},
+		"searchTerm":       {album},
+	}
+	var data struct {
+		Items []struct {
+			Name         string                  `json:"Name"`
+			AlbumArtist  string                  `json:"AlbumArtist"`
+			AlbumArtists []struct{ Name string } `json:"AlbumArtists"`
+		} `json:"Items"`
+	}
+	if err := mediaServerRequest("GET", j.base+"/Items?"+q.Encode(), j.header(), &data); err != nil {
+		return false, err
+	}
+	for _, it := range data.Items {
+		if !sameName(it.Name, album) {
+			continue
+		}
+		if sameName(it.AlbumArtist, artist) {
+			return true, nil
+		}
+		for _, a := range it.AlbumArtists {
+			if sameName(a.Name, artist) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+type plexServer struct{ base, token string }
+
+func (p plexServer) Name() string { return "Plex" }
+
+func (p plexServer) header() http.Header {
+	return http.Header{"X-Plex-Token": {p.token}}
+}
+
+// musicSections returns the keys of Plex's music libraries.
+func (p plexServer) musicSections() ([]string, error) {
+	var data struct {
+		MediaContainer struct {
+			Directory []struct {
+				Key  string `json:"key"`
+				Type string `json:"type"`
+			} `json:"Directory"`
+		} `json:"MediaContainer"`
+	}
+	if err := mediaServerRequest("GET", p.base+"/library/sections", p.header(), &data); err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, d := range data.MediaContainer.Directory {
+		if d.Type == "artist" {
+			keys = append(keys, d.Key)
+		}
+	}
+	return keys, nil
+}
+
+func (p plexServer) Refresh() error {
+	keys, err := p.musicSections()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := mediaServerRequest("GET", p.base+"/library/sections/"+k+"/refresh", p.header(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p plexServer) HasAlbum(artist, album string) (bool, error) {
+	keys, err := p.musicSections()
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		// type=9 lists albums; parentTitle is the album artist.
+		q := url.Values{"type": {"9"}, "title": {album}}
+		var data struct {
+			MediaContainer struct {
+				Metadata []struct {
+					Title       string `json:"title"`
+					ParentTitle string `json:"parentTitle"`
+				} `json:"Metadata"`
+			} `json:"MediaContainer"`
+		}
+		if err := mediaServerRequest("GET", p.base+"/library/sections/"+k+"/all?"+q.Encode(), p.header(), &data); err != nil {
+			return false, err
+		}
+		for _, m := range data.MediaContainer.Metadata {
+			if sameName(m.Title, album) && sameName(m.ParentTitle, artist) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// notifyMediaServers asks the configured media servers to rescan after
+// albums were imported (MEDIA_SERVER_REFRESH=true) and, with
+// MEDIA_SERVER_VERIFY=true, checks in the background that each imported album
+// shows up. An album still missing after MEDIA_SERVER_VERIFY_TIMEOUT is
+// logged and handed to HOOK_MEDIA_SERVER_MISSING; that usually means the
+// server can't read the library path (permissions, container path mapping).
+func notifyMediaServers(albums []*AlbumResult) {
+	var imported []*AlbumResult
+	for _, a := range albums {
+		if a.Succeeded() && a.Move.Err == nil && a.Metadata != nil {
+			imported = append(imported, a)
+		}
+	}
+	servers := configuredMediaServers()
+	if len(imported) == 0 || len(servers) == 0 {
+		return
+	}
+	if mediaServerRefreshEnabled() {
+		for _, s := range servers {
+			if err := s.Refresh(); err != nil {
+				fmt.Printf("→ %s library refresh failed: %v\n", s.Name(), err)
+			} else {
+				fmt.Printf("→ Asked %s to refresh its library\n", s.Name())
+			}
+		}
+	}
+	if mediaServerVerifyEnabled() {
+		go verifyMediaServers(servers, imported, mediaServerVerifyTimeout())
+	}
+}
+
+// verifyMediaServers polls every 30 s until each server lists every album or
+// timeout passes, then reports what is still missing.
+func verifyMediaServers(servers []mediaServer, albums []*AlbumResult, timeout time.Duration) {
+	type check struct {
+		server mediaServer
+		album  *AlbumResult
+	}
+	var pending []check
+	for _, s := range servers {
+		for _, a := range albums {
+			pending = append(pending, check{s, a})
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var still []check
+		for _, c := range pending {
+			md := c.album.Metadata
+			found, err := c.server.HasAlbum(metadata.FirstNonEmpty(md.AlbumArtist, md.Artist), md.Album)
+			if err != nil {
+				log.Printf("[mediaserver] %s lookup for %s failed: %v", c.server.Name(), c.album.Name, err)
+			}
+			if !found {
+				still = append(still, c)
+			}
+		}
+		pending = still
+		if len(pending) == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(30 * time.Second)
+	}
+
+	logf := func(msg string) { log.Printf("[mediaserver] %s", msg) }
+	for _, c := range pending {
+		md := c.album.Metadata
+		log.Printf("[mediaserver] %s does not list %s — %s after %s; check that it can read %s",
+			c.server.Name(), metadata.FirstNonEmpty(md.AlbumArtist, md.Artist), md.Album, timeout, c.album.TargetDir)
+		vars := map[string]string{
+			"MEDIA_SERVER": c.server.Name(),
+			"ALBUM_NAME":   c.album.Name,
+			"LIBRARY_PATH": c.album.TargetDir,
+			"ARTIST":       md.Artist,
+			"ALBUM_ARTIST": md.AlbumArtist,
+			"ALBUM":        md.Album,
+		}
+		if err := runHook(hookMediaServerMissing, vars, logf); err != nil {
+			logf(err.Error())
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// errWrongRelease means a tagger wrote the tags of a release other than the
+// pinned one, so the files' tags can no longer be trusted.
+var errWrongRelease = errors.New("wrong release applied")
+
+// Use beets to fetch metadata and tag all files in a directory, returning the
+// match beets reports having applied.
+// A temp log file is passed to beets via -l so that skipped albums
+// (which exit 0 but produce a "skip" log entry) are detected and
+// returned as errors, triggering the MusicBrainz fallback. Output that shows
+// no applied match is treated the same way.
+// If mbid is non-empty it is passed as --search-id to pin beets to a specific
+// MusicBrainz release. In that case, quiet mode is skipped and newlines are
+// piped to stdin so beets auto-accepts the pinned release regardless of
+// confidence score; a different release being applied is errWrongRelease,
+// which fails the album unless a later provider tags it correctly.
+// Otherwise BEETS_MIN_SIMILARITY, when set, raises the similarity quiet mode
+// requires before it applies a match.
+func tagWithBeets(path, mbid string) (*metadata.Match, error) {
+	fmt.Println("→ Tagging with beets:", path)
+
+	logFile, err := os.CreateTemp("", "beets-log-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("beets: could not create temp log file: %w", err)
+	}
+	logPath := logFile.Name()
+	logFile.Close()
+	defer os.Remove(logPath)
+
+	var args, overlays []string
+	var stdin io.Reader
+	if mbid != "" {
+		// Drop -q so beets doesn't skip on low confidence. Pipe newlines to
+		// auto-accept the interactive prompt for the MBID-pinned release.
+		args = []string{"-C", "-l", logPath, "--search-id", mbid, path}
+		stdin = strings.NewReader(strings.Repeat("A\n", 20))
+	} else {
+		if min := beetsMinSimilarity(); min > 0 {
+			conf, err := beetsThresholdConfig(min)
+			if err != nil {
+				return nil, fmt.Errorf("beets: could not write config overlay: %w", err)
+			}
+			defer os.Remove(conf)
+			overlays = append(overlays, conf)
+		}
+		args = []string{"-C", "-l", logPath, "-q", path}
+	}
+	cmd, err := beetsCommand("import", overlays, args...)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = stdin
+	res, err := tools.Default.Run(context.Background(), cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// Even on exit 0, beets may have skipped the album in quiet mode.
+	// The log format is one entry per line: "<action> <path>"
+	// We treat any "skip" line as a failure so the caller falls through
+	// to the MusicBrainz lookup.
+	skipped, err := beetsLogHasSkip(logPath)
+	if err != nil {
+		// If we can't read the log, fall back to the output alone.
+		fmt.Println("beets: could not read log file:", err)
+	}
+	if skipped {
+		return nil, errors.New("beets skipped album (no confident match found)")
+	}
+
+	out := string(res.Stdout)
+	match := parseBeetsOutput(out)
+	if match == nil {
+		for _, marker := range []string{"Skipping.", "Importing as-is.", "No matching release found"} {
+			if strings.Contains(out, marker) {
+				return nil, fmt.Errorf("beets applied no match (%s)", strings.TrimSuffix(marker, "."))
+			}
+		}
+		fmt.Println("beets: could not find the applied match in its output")
+		return nil, nil
+	}
+	fmt.Printf("→ beets matched %s — %s (%.1f%%)\n", match.Artist, match.Album, match.Similarity)
+	if mbid != "" && match.ReleaseMBID != "" && match.ReleaseMBID != mbid {
+		return match, fmt.Errorf("beets applied release %s instead of pinned %s: %w", match.ReleaseMBID, mbid, errWrongRelease)
+	}
+	return match, nil
+}
+
+// metadataProviders returns METADATA_PROVIDERS, the autotaggers tried in
+// order until one succeeds: "beets", "musicbrainz" (the native tagger, which
+// needs neither beets nor Python) and "discogs". Unset, it is just the one
+// AUTOTAGGER picks: beets, or musicbrainz with AUTOTAGGER=native.
+func metadataProviders() []string {
+	var out []string
+	for _, p := range strings.Split(os.Getenv("METADATA_PROVIDERS"), ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			out = append(out, p)
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("AUTOTAGGER")), "native") {
+		return []string{"musicbrainz"}
+	}
+	return []string{"beets"}
+}
+
+// usesBeets reports whether beets is one of the metadata providers.
+func usesBeets() bool {
+	for _, p := range metadataProviders() {
+		if p == "beets" {
+			return true
+		}
+	}
+	return false
+}
+
+// autotagMinSimilarity returns AUTOTAG_MIN_SIMILARITY, the lowest similarity
+// in percent the native autotagger applies unattended (default 80).
+func autotagMinSimilarity() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("AUTOTAG_MIN_SIMILARITY"), 64)
+	if err != nil || v < 0 || v > 100 {
+		return 80
+	}
+	return v
+}
+
+// autotag tags the album with one metadata provider and returns the match it
+// applied, if known. mbid pins a MusicBrainz release and is ignored by
+// Discogs.
+func autotag(provider, path, mbid string) (*metadata.Match, error) {
+	switch provider {
+	case "beets":
+		return tagWithBeets(path, mbid)
+	case "musicbrainz":
+		return metadata.Autotag(path, mbid, autotagMinSimilarity())
+	case "discogs":
+		return metadata.AutotagDiscogs(path, "", autotagMinSimilarity())
+	}
+	return nil, fmt.Errorf("unknown metadata provider %q", provider)
+}
+
+// providerSource returns what a successful provider run is credited to.
+// pinned is the source of a MusicBrainz pin (override or disc_id), if any.
+func providerSource(provider string, pinned metadata.Source) metadata.Source {
+	switch {
+	case provider == "discogs":
+		return metadata.SourceDiscogs
+	case pinned != metadata.SourceUnknown:
+		return pinned
+	case provider == "musicbrainz":
+		return metadata.SourceAutotag
+	}
+	return metadata.SourceBeets
+}
+
+// beetsLogHasSkip reads a beets import log file and reports whether any
+// entry has the action "skip". The log format is:
+//
+//	# beets import log
+//	<action> <path>
+//	...
+func beetsLogHasSkip(logPath string) (bool, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip blank lines and the header comment.
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		action, _, found := strings.Cut(line, " ")
+		if found && strings.EqualFold(action, "skip") {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// getAlbumMetadata autotags the album directory with the metadata providers
+// in priority order, reads tags back from the first track, and falls back to
+// MusicBrainz if tags are missing, then to the folder and file names. If mbid is non-empty the MusicBrainz
+// autotaggers are pinned to that release.
+//
+// Albums with metadata edits from the web UI skip autotagging entirely: the edits
+// were already written into the tags and are taken as authoritative. A release
+// picked in the web UI is used as the mbid when none was given. The applied
+// match is returned when the metadata came from an autotagger.
+func getAlbumMetadata(albumPath, trackPath, mbid string) (*metadata.MusicMetadata, metadata.Source, *metadata.Match, error) {
+	// pinned is the source credited when the release was pinned for us.
+	pinned := metadata.SourceUnknown
+	if st, err := LoadAlbumState(albumPath); err == nil {
+		if st.Edits != nil {
+			fmt.Println("→ Using manually edited tags:", albumPath)
+			md, err := metadata.ReadTags(trackPath)
+			if err != nil {
+				return nil, metadata.SourceUnknown, nil, fmt.Errorf("reading edited tags: %w", err)
+			}
+			metadata.AttachQuality(md, trackPath)
+			recordProviderAttempt(metadata.SourceManual, true)
+			return md, metadata.SourceManual, nil, nil
+		}
+		if mbid == "" && st.ReleaseMBID != "" {
+			fmt.Println("→ Using release picked in the web UI:", st.ReleaseMBID)
+			mbid = st.ReleaseMBID
+			pinned = metadata.SourceOverride
+		}
+		if mbid == "" {
+			if mbid = releaseFromDiscID(albumPath, st); mbid != "" {
+				pinned = metadata.SourceDiscID
+			}
+		}
+	}
+
+	var match *metadata.Match
+	var tagSource metadata.Source
+	tagErr := errors.New("no metadata provider configured")
+	for _, provider := range metadataProviders() {
+		preserved := metadata.SnapshotPreservedTags(albumPath)
+		match, tagErr = autotag(provider, albumPath, mbid)
+		metadata.RestorePreservedTags(preserved)
+		tagSource = providerSource(provider, pinned)
+		recordProviderAttempt(tagSource, tagErr == nil)
+		if tagErr == nil {
+			break
+		}
+		fmt.Printf("Tagging with %s failed: %v\n", provider, tagErr)
+	}
+	if errors.Is(tagErr, errWrongRelease) {
+		// The files now carry the wrong release's tags; importing them as
+		// file tags would file the album under it.
+		return nil, metadata.SourceUnknown, nil, fmt.Errorf("tagging failed: %w", tagErr)
+	}
+	if tagErr != nil {
+		fmt.Println("Autotagging failed; fallback to manual MusicBrainz lookup")
+	}
+
+	md, err := metadata.ReadTags(trackPath)
+	if err == nil && md.Artist != "" && md.Album != "" {
+		metadata.AttachQuality(md, trackPath)
+		if tagErr == nil {
+			return md, tagSource, match, nil
+		}
+		recordProviderAttempt(metadata.SourceFileTags, true)
+		return md, metadata.SourceFileTags, nil, nil
+	}
+
+	fmt.Println("→ Missing tags, attempting MusicBrainz manual lookup...")
+
+	md, err = metadata.FetchMusicBrainzInfo(trackPath)
+	recordProviderAttempt(metadata.SourceMusicBrainz, err == nil)
+	if err != nil {
+		if !filenameMetadataEnabled() {
+			return nil, metadata.SourceUnknown, nil, fmt.Errorf("metadata lookup failed: %w", err)
+		}
+		fmt.Println("MusicBrainz lookup failed:", err)
+		fmd, ferr := metadata.TagFromFilenames(albumPath, importRoot(albumPath))
+		recordProviderAttempt(metadata.SourceFilename, ferr == nil)
+		if ferr != nil {
+			return nil, metadata.SourceUnknown, nil, fmt.Errorf("metadata lookup failed: %w", errors.Join(err, ferr))
+		}
+		metadata.AttachQuality(fmd, trackPath)
+		return fmd, metadata.SourceFilename, nil, nil
+	}
+
+	metadata.AttachQuality(md, trackPath)
+	return md, metadata.SourceMusicBrainz, nil, nil
+}
+
+// filenameMetadataEnabled reports whether albums nothing else could tag get
+// metadata inferred from their folder and file names (FILENAME_METADATA,
+// default on).
+func filenameMetadataEnabled() bool {
+	return os.Getenv("FILENAME_METADATA") != "false"
+}
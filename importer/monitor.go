@@ -1,4 +1,4 @@
-package main
+package importer
 
 import (
 	"fmt"
@@ -8,20 +8,23 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
 )
 
 // pendingDownload tracks a queued slskd download that should be auto-imported
 // once all files have transferred successfully.
 type pendingDownload struct {
-	ID        string      // dedup key (release MBID for single fetches; release group MBID for artist fetches)
-	BeetsMBID string      // release MBID passed to beets --search-id (may differ from ID)
-	Artist    string
-	Album     string
-	Username  string      // slskd peer username
-	Dir       string      // remote directory path on the peer
-	Files     []slskdFile // files that were queued for download
-	Entry     *fetchEntry // fetch card to update with import progress
-	TrackCount int        // expected number of audio tracks (0 = unknown, skip check)
+	ID         string // dedup key (release MBID for single fetches; release group MBID for artist fetches)
+	BeetsMBID  string // release MBID passed to beets --search-id (may differ from ID)
+	Artist     string
+	Album      string
+	Username   string      // slskd peer username
+	Dir        string      // remote directory path on the peer
+	Files      []slskdFile // files that were queued for download
+	Entry      *fetchEntry // fetch card to update with import progress
+	TrackCount int         // expected number of audio tracks (0 = unknown, skip check)
 }
 
 var (
@@ -29,14 +32,14 @@ var (
 	pendingDownloads = make(map[string]*pendingDownload) // keyed by MBID
 )
 
-// registerDownload records a queued slskd download for monitoring and eventual
+// RegisterDownload records a queued slskd download for monitoring and eventual
 // auto-import. id is used as the dedup key; beetsMBID is the release MBID
 // forwarded to beets --search-id (may be empty or differ from id).
 // trackCount is the expected number of audio tracks from MusicBrainz; 0 means
 // unknown and the sanity check will be skipped at import time.
 // If entry is nil a new fetchEntry is created so the frontend can discover it
 // via /discover/fetch/list.
-func registerDownload(id, beetsMBID, artist, album string, trackCount int, folder *albumFolder, entry *fetchEntry) {
+func RegisterDownload(id, beetsMBID, artist, album string, trackCount int, folder *albumFolder, entry *fetchEntry) {
 	pd := &pendingDownload{
 		ID:         id,
 		BeetsMBID:  beetsMBID,
@@ -50,8 +53,8 @@ func registerDownload(id, beetsMBID, artist, album string, trackCount int, folde
 	}
 
 	if entry == nil {
-		e := newFetchEntry(id, artist, album)
-		e.appendLog(fmt.Sprintf("Queued %d files from %s — waiting for download",
+		e := NewFetchEntry(id, artist, album)
+		e.AppendLog(fmt.Sprintf("Queued %d files from %s — waiting for download",
 			len(folder.Files), folder.Username))
 		pd.Entry = e
 	}
@@ -64,9 +67,9 @@ func registerDownload(id, beetsMBID, artist, album string, trackCount int, folde
 		album, artist, id, beetsMBID, folder.Username, len(folder.Files), trackCount)
 }
 
-// startMonitor launches a background goroutine that periodically checks whether
+// StartMonitor launches a background goroutine that periodically checks whether
 // pending downloads have completed and triggers import when they have.
-func startMonitor() {
+func StartMonitor() {
 	go func() {
 		for {
 			time.Sleep(15 * time.Second)
@@ -128,7 +131,7 @@ func checkPendingDownloads() {
 			localDir := localDirForDownload(pd, files)
 			if localDir == "" {
 				log.Printf("[monitor] cannot determine local dir for %q by %s", pd.Album, pd.Artist)
-				pd.Entry.appendLog("Error: could not determine local download path from transfer info")
+				pd.Entry.AppendLog("Error: could not determine local download path from transfer info")
 				continue
 			}
 
@@ -192,113 +195,77 @@ func localDirForDownload(pd *pendingDownload, files []slskdTransferFile) string
 }
 
 // importPendingRelease runs the full import pipeline on a completed download.
-// It mirrors RunImporter's per-album logic but uses the MBID for beets tagging.
+// It mirrors Run's per-album logic but uses the MBID for beets tagging.
 func importPendingRelease(pd *pendingDownload, localDir string) {
 	entry := pd.Entry
 	logf := func(msg string) {
-		entry.appendLog("[import] " + msg)
+		entry.AppendLog("[import] " + msg)
 		log.Printf("[monitor/import %s] %s", pd.ID, msg)
 	}
 
 	logf(fmt.Sprintf("Starting import from %s", localDir))
 
-	libraryDir := os.Getenv("LIBRARY_DIR")
+	libraryDir := library.LocalLibraryDir()
 	if libraryDir == "" {
-		entry.finish(fmt.Errorf("LIBRARY_DIR is not set"))
+		entry.Finish(fmt.Errorf("LIBRARY_DIR is not set"))
 		return
 	}
 
-	tracks, err := getAudioFiles(localDir)
+	tracks, err := metadata.AudioFiles(localDir)
 	if err != nil {
-		entry.finish(fmt.Errorf("scanning audio files: %w", err))
+		entry.Finish(fmt.Errorf("scanning audio files: %w", err))
 		return
 	}
 	if len(tracks) == 0 {
-		entry.finish(fmt.Errorf("no audio files found in %s", localDir))
+		entry.Finish(fmt.Errorf("no audio files found in %s", localDir))
 		return
 	}
 	logf(fmt.Sprintf("Found %d tracks", len(tracks)))
 
 	if pd.TrackCount > 0 && len(tracks) != pd.TrackCount {
-		entry.finish(fmt.Errorf(
+		entry.Finish(fmt.Errorf(
 			"track count mismatch: downloaded %d tracks but release expects %d — aborting to avoid importing wrong edition",
 			len(tracks), pd.TrackCount,
 		))
 		return
 	}
 
-	if err := cleanAlbumTags(localDir); err != nil {
-		logf(fmt.Sprintf("Clean tags warning: %v", err))
-	}
-
-	md, src, err := getAlbumMetadata(localDir, tracks[0], pd.BeetsMBID)
+	stages, err := pipelineStages()
 	if err != nil {
-		entry.finish(fmt.Errorf("metadata failed: %w", err))
+		entry.Finish(err)
 		return
 	}
-	logf(fmt.Sprintf("Tagged via %s: %s — %s", src, md.Artist, md.Album))
 
-	if _, err := DownloadAlbumLyrics(localDir); err != nil {
-		logf(fmt.Sprintf("Lyrics warning: %v", err))
-	}
-
-	if err := applyReplayGain(localDir); err != nil {
-		entry.finish(fmt.Errorf("ReplayGain failed: %w", err))
+	result := &AlbumResult{Name: filepath.Base(localDir), Path: localDir, TrackCount: len(tracks)}
+	if err := runAlbumHook(hookPreAlbum, result, logf); err != nil {
+		entry.Finish(err)
 		return
 	}
-	logf("ReplayGain applied")
-
-	if _, err := FindCoverImage(localDir); err != nil {
-		if err := DownloadCoverArt(localDir, md, pd.BeetsMBID); err != nil {
-			logf(fmt.Sprintf("Cover art download warning: %v", err))
-		}
-	}
-
-	if err := NormalizeCoverArt(localDir); err != nil {
-		logf(fmt.Sprintf("Cover art normalization warning: %v", err))
+	defer runAlbumHook(hookPostAlbum, result, logf)
+
+	a := &AlbumRun{
+		Result:     result,
+		Tracks:     tracks,
+		LibraryDir: libraryDir,
+		MBID:       pd.BeetsMBID,
+		Caps:       probeCapabilities(),
+		Logf:       logf,
 	}
-
-	if err := EmbedAlbumArtIntoFolder(localDir); err != nil {
-		entry.finish(fmt.Errorf("cover embed failed: %w", err))
+	var pipelineErr error
+	runAlbumLogged(result, func() { pipelineErr = runPipeline(a, stages) })
+	if pipelineErr != nil {
+		entry.Finish(pipelineErr)
 		return
 	}
-	logf("Cover art embedded")
-
-	targetDir := albumTargetDir(libraryDir, md)
-	if _, err := os.Stat(targetDir); err == nil {
-		logf(fmt.Sprintf("Album already exists in library, skipping move: %s", targetDir))
-		entry.finish(nil)
-		return
-	}
-
-	var moveErr error
-	for _, track := range tracks {
-		if err := moveToLibrary(libraryDir, md, track); err != nil {
-			logf(fmt.Sprintf("Move warning: %v", err))
-			moveErr = err
-		}
-	}
-
-	lyrics, _ := getLyricFiles(localDir)
-	for _, file := range lyrics {
-		if err := moveToLibrary(libraryDir, md, file); err != nil {
-			logf(fmt.Sprintf("Move lyrics warning: %v", err))
-		}
-	}
-
-	if coverImg, err := FindCoverImage(localDir); err == nil {
-		if err := moveToLibrary(libraryDir, md, coverImg); err != nil {
-			logf(fmt.Sprintf("Move cover warning: %v", err))
-		}
-	}
-
-	os.Remove(localDir)
 
-	if moveErr != nil {
-		entry.finish(fmt.Errorf("import completed with move errors: %w", moveErr))
+	if result.Move.Err != nil {
+		entry.Finish(fmt.Errorf("import completed with move errors: %w", result.Move.Err))
 		return
 	}
 
 	logf("Import complete")
-	entry.finish(nil)
+	entry.Finish(nil)
+	library.ExportRecent()
+	library.UpdateLibraryViews()
+	notifyMediaServers([]*AlbumResult{result})
 }
@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// Kodi reads album.nfo from album folders and artist.nfo from artist
+// folders; Jellyfin reads both too.
+const (
+	albumNFOName  = "album.nfo"
+	artistNFOName = "artist.nfo"
+)
+
+// nfoEnabled reports whether NFO_FILES is on.
+func nfoEnabled() bool {
+	return os.Getenv("NFO_FILES") == "true"
+}
+
+type nfoAlbum struct {
+	XMLName             xml.Name          `xml:"album"`
+	Title               string            `xml:"title"`
+	ReleaseMBID         string            `xml:"musicbrainzalbumid,omitempty"`
+	ReleaseGroupMBID    string            `xml:"musicbrainzreleasegroupid,omitempty"`
+	ArtistDesc          string            `xml:"artistdesc"`
+	Credits             []nfoArtistCredit `xml:"albumArtistCredits"`
+	Genres              []string          `xml:"genre"`
+	Type                string            `xml:"type,omitempty"`
+	ReleaseType         string            `xml:"releasetype"` // "album" or "single"
+	Label               string            `xml:"label,omitempty"`
+	ReleaseDate         string            `xml:"releasedate,omitempty"`
+	OriginalReleaseDate string            `xml:"originalreleasedate,omitempty"`
+	Year                string            `xml:"year,omitempty"`
+	Tracks              []nfoTrack        `xml:"track"`
+}
+
+type nfoArtistCredit struct {
+	Artist string `xml:"artist"`
+	MBID   string `xml:"musicBrainzArtistID,omitempty"`
+}
+
+type nfoTrack struct {
+	Position      int    `xml:"position"`
+	Title         string `xml:"title"`
+	Duration      string `xml:"duration,omitempty"` // m:ss
+	RecordingMBID string `xml:"musicBrainzTrackID,omitempty"`
+}
+
+type nfoArtist struct {
+	XMLName        xml.Name `xml:"artist"`
+	Name           string   `xml:"name"`
+	MBID           string   `xml:"musicBrainzArtistID,omitempty"`
+	SortName       string   `xml:"sortname,omitempty"`
+	Type           string   `xml:"type,omitempty"`
+	Gender         string   `xml:"gender,omitempty"`
+	Disambiguation string   `xml:"disambiguation,omitempty"`
+	Genres         []string `xml:"genre"`
+	Born           string   `xml:"born,omitempty"`
+	Formed         string   `xml:"formed,omitempty"`
+	Died           string   `xml:"died,omitempty"`
+	Disbanded      string   `xml:"disbanded,omitempty"`
+	Biography      string   `xml:"biography,omitempty"`
+}
+
+// nfoDate turns a tag date (YYYY.MM.DD) into the YYYY-MM-DD Kodi expects.
+func nfoDate(d string) string {
+	return strings.ReplaceAll(d, ".", "-")
+}
+
+// writeNFO writes v as an XML document to path.
+func writeNFO(path string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"), data...)
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// albumNFO describes the album in dir. MusicBrainz IDs come from the first
+// track's tags, which the autotagger wrote.
+func albumNFO(dir string, md *metadata.MusicMetadata) (*nfoAlbum, error) {
+	tracks, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := &metadata.MusicMetadata{}
+	if len(tracks) > 0 {
+		if t, err := metadata.ReadTags(tracks[0]); err == nil {
+			ids = t
+		}
+	}
+	artist := metadata.FirstNonEmpty(md.AlbumArtist, md.Artist)
+	nfo := &nfoAlbum{
+		Title:               md.Album,
+		ReleaseMBID:         metadata.FirstNonEmpty(md.ReleaseMBID, ids.ReleaseMBID),
+		ReleaseGroupMBID:    metadata.FirstNonEmpty(md.ReleaseGroupMBID, ids.ReleaseGroupMBID),
+		ArtistDesc:          artist,
+		Credits:             []nfoArtistCredit{{artist, metadata.FirstNonEmpty(md.AlbumArtistMBID, ids.AlbumArtistMBID)}},
+		Genres:              metadata.Values(md.Genre),
+		Type:                md.ReleaseType,
+		ReleaseType:         "album",
+		Label:               metadata.FirstValue(md.Label),
+		ReleaseDate:         nfoDate(md.Date),
+		OriginalReleaseDate: nfoDate(md.OriginalDate),
+		Year:                md.Year,
+	}
+	if md.ReleaseType == "single" {
+		nfo.ReleaseType = "single"
+	}
+	entries, err := albumPlaylistEntries(dir, md)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		tags, _ := metadata.ReadTrackTags(e.path)
+		t := nfoTrack{Position: i + 1, Title: e.title, RecordingMBID: tags.RecordingMBID}
+		if tags.Track > 0 {
+			t.Position = tags.Track
+		}
+		if e.seconds >= 0 {
+			t.Duration = fmt.Sprintf("%d:%02d", e.seconds/60, e.seconds%60)
+		}
+		nfo.Tracks = append(nfo.Tracks, t)
+	}
+	return nfo, nil
+}
+
+// artistNFO describes an artist from MusicBrainz, when its ID is known,
+// with Last.fm's biography when LASTFM_API_KEY is set.
+func artistNFO(name, mbid string) *nfoArtist {
+	nfo := &nfoArtist{Name: name, MBID: mbid}
+	if mbid != "" {
+		if a, err := metadata.GetMBArtist(mbid); err == nil {
+			nfo.SortName, nfo.Type, nfo.Gender, nfo.Disambiguation = a.SortName, a.Type, a.Gender, a.Disambiguation
+			for _, g := range a.Genres {
+				nfo.Genres = append(nfo.Genres, g.Name)
+			}
+			if a.Type == "Person" {
+				nfo.Born, nfo.Died = a.LifeSpan.Begin, a.LifeSpan.End
+			} else {
+				nfo.Formed, nfo.Disbanded = a.LifeSpan.Begin, a.LifeSpan.End
+			}
+		}
+	}
+	if os.Getenv("LASTFM_API_KEY") != "" {
+		if bio, err := metadata.ArtistBiography(name); err == nil {
+			nfo.Biography = bio
+		}
+	}
+	return nfo
+}
+
+// writeNFOs writes album.nfo into an album folder of the library, and
+// artist.nfo into its artist folder if that has none yet.
+func writeNFOs(libDir, dir string, md *metadata.MusicMetadata) error {
+	album, err := albumNFO(dir, md)
+	if err != nil {
+		return err
+	}
+	if err := writeNFO(filepath.Join(dir, albumNFOName), album); err != nil {
+		return err
+	}
+	artistDir := library.ArtistDir(libDir, dir, md)
+	if artistDir == "" {
+		return nil
+	}
+	path := filepath.Join(artistDir, artistNFOName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return writeNFO(path, artistNFO(album.ArtistDesc, album.Credits[0].MBID))
+}
+
+// refreshNFOs rewrites an album's album.nfo, if it has one, after it was
+// retagged.
+func refreshNFOs(libDir, dir string, md *metadata.MusicMetadata) error {
+	if _, err := os.Stat(filepath.Join(dir, albumNFOName)); err != nil {
+		return nil
+	}
+	return writeNFOs(libDir, dir, md)
+}
+
+// WriteLibraryNFOs writes album.nfo and artist.nfo for every library album
+// without an album.nfo (every album with force), from their tags. Existing
+// artist.nfo files are kept. It returns the number of albums written.
+func WriteLibraryNFOs(ctx context.Context, libraryDir string, force bool, logf func(string)) (int, error) {
+	dirs, err := libraryAlbumDirs(libraryDir)
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, rel := range dirs {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		dir := filepath.Join(libraryDir, rel)
+		if _, err := os.Stat(filepath.Join(dir, albumNFOName)); err == nil && !force {
+			continue
+		}
+		tracks, _ := metadata.AudioFiles(dir)
+		md, err := metadata.ReadTags(tracks[0])
+		if err != nil || md.Album == "" {
+			logf(fmt.Sprintf("%s: no album tags, skipped", rel))
+			continue
+		}
+		if err := writeNFOs(libraryDir, dir, md); err != nil {
+			logf(fmt.Sprintf("%s: %v", rel, err))
+			continue
+		}
+		if err := library.RefreshJournalFiles(libraryDir, rel); err != nil {
+			logf(fmt.Sprintf("Could not update journal for %s: %v", rel, err))
+		}
+		written++
+		logf(rel)
+	}
+	return written, nil
+}
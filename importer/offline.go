@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// featureNetwork is lost when the importer is offline: autotagging,
+// MusicBrainz lookups, lyrics and cover downloads.
+const featureNetwork = "network enrichment"
+
+// networkProbeURL is requested to decide whether the importer is online.
+const networkProbeURL = "https://musicbrainz.org/"
+
+// offlineReason returns why the importer should run offline, or "" when it
+// is online. OFFLINE=true forces offline mode and OFFLINE=false never
+// enters it; otherwise (OFFLINE=auto, the default) MusicBrainz is probed.
+func offlineReason() string {
+	switch strings.ToLower(os.Getenv("OFFLINE")) {
+	case "true":
+		return "OFFLINE=true"
+	case "false":
+		return ""
+	}
+	if !metadata.Reachable(networkProbeURL, 5*time.Second) {
+		return "network unreachable"
+	}
+	return ""
+}
+
+// offline reports whether the album is being imported offline, noting the
+// degradation on it the first time.
+func (a *AlbumRun) offline() bool {
+	if _, ok := a.Caps.missing[featureNetwork]; !ok {
+		return false
+	}
+	if !slices.Contains(a.Result.Degraded, featureNetwork) {
+		a.Result.Degraded = append(a.Result.Degraded, featureNetwork)
+	}
+	return true
+}
+
+// offlineAlbumMetadata is getAlbumMetadata without the network: the tags
+// already in the files, or failing that the folder and file names.
+func offlineAlbumMetadata(albumPath, trackPath string) (*metadata.MusicMetadata, metadata.Source, error) {
+	md, err := metadata.ReadTags(trackPath)
+	if err == nil && md.Artist != "" && md.Album != "" {
+		metadata.AttachQuality(md, trackPath)
+		recordProviderAttempt(metadata.SourceFileTags, true)
+		return md, metadata.SourceFileTags, nil
+	}
+	if !filenameMetadataEnabled() {
+		return nil, metadata.SourceUnknown, errors.New("offline and the tracks have no artist and album tags")
+	}
+	md, err = metadata.TagFromFilenames(albumPath, importRoot(albumPath))
+	recordProviderAttempt(metadata.SourceFilename, err == nil)
+	if err != nil {
+		return nil, metadata.SourceUnknown, fmt.Errorf("offline and no usable tags: %w", err)
+	}
+	metadata.AttachQuality(md, trackPath)
+	return md, metadata.SourceFilename, nil
+}
+
+// offlineMetadataStage tags the album from what is already in its files and
+// defers the MusicBrainz enrichment.
+func offlineMetadataStage(a *AlbumRun) error {
+	a.Logf("Offline: using the tags already in the files")
+	md, src, err := offlineAlbumMetadata(a.Result.Path, a.Tracks[0])
+	a.Result.TagMetadata.Err = err
+	a.Result.MetadataSource = src
+	if err != nil {
+		return err
+	}
+	a.Result.Metadata = md
+	a.Logf(fmt.Sprintf("Tagged via %s: %s — %s", src, md.Artist, md.Album))
+	a.deferTask(deferMetadata)
+	if len(metadata.GenreSources()) > 0 {
+		a.deferTask(deferGenre)
+	}
+	writeTagRules(a.Result.Path, a.Tracks, md, nil, a.Logf)
+	return nil
+}
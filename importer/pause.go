@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"log"
+	"sync"
+)
+
+// The import queue can be paused between pipeline stages: the stage that is
+// running when a pause is requested finishes, then the importer (and any
+// auto-import from the download monitor) holds until it is resumed.
+var (
+	pauseMu     sync.Mutex
+	pauseCond   = sync.NewCond(&pauseMu)
+	paused      bool
+	pauseReason string
+)
+
+// PauseImports holds the import queue at the next stage boundary.
+func PauseImports(reason string) {
+	pauseMu.Lock()
+	paused = true
+	pauseReason = reason
+	pauseMu.Unlock()
+	log.Println("[queue] paused:", reason)
+}
+
+// ResumeImports releases every pipeline waiting in waitIfPaused.
+func ResumeImports() {
+	pauseMu.Lock()
+	paused = false
+	pauseReason = ""
+	pauseCond.Broadcast()
+	pauseMu.Unlock()
+	log.Println("[queue] resumed")
+}
+
+// ImportsPaused reports whether the queue is paused and why.
+func ImportsPaused() (bool, string) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return paused, pauseReason
+}
+
+// waitIfPaused blocks until the queue is resumed. Call it between pipeline
+// stages; it returns immediately when the queue is running.
+func waitIfPaused(logf func(string)) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if !paused {
+		return
+	}
+	logf("Import queue paused (" + pauseReason + "); waiting for resume")
+	for paused {
+		pauseCond.Wait()
+	}
+	logf("Import queue resumed")
+}
@@ -0,0 +1,552 @@
+package importer
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// AlbumRun carries one album through the pipeline stages.
+type AlbumRun struct {
+	Result     *AlbumResult
+	Tracks     []string
+	LibraryDir string
+	MBID       string // release to pin beets to, when the caller already knows it
+	Caps       capabilities
+	Logf       func(string)
+	Deferred   []string // enrichment tasks to retry once the album is in the library (see deferred.go)
+
+	gapless map[string]metadata.Gapless // MP3/M4A gapless info before any stage ran, see gapless.go
+}
+
+// Stage is one step of the import pipeline. Run records its outcome in
+// a.Result; a returned error is fatal and stops the pipeline for the album.
+type Stage interface {
+	Name() string
+	Run(a *AlbumRun) error
+}
+
+type stageFunc struct {
+	name string
+	run  func(a *AlbumRun) error
+}
+
+func (s stageFunc) Name() string          { return s.name }
+func (s stageFunc) Run(a *AlbumRun) error { return s.run(a) }
+
+// NewStage wraps a function as a Stage.
+func NewStage(name string, run func(a *AlbumRun) error) Stage {
+	return stageFunc{name: name, run: run}
+}
+
+// stageRegistry holds every stage PIPELINE_STAGES can name. Custom stages
+// are added with RegisterStage from an init function.
+var stageRegistry = map[string]Stage{}
+
+func RegisterStage(s Stage) {
+	stageRegistry[s.Name()] = s
+}
+
+// defaultStages is the pipeline order used when PIPELINE_STAGES is unset.
+var defaultStages = []string{"clean", "junk", "metadata", "lyrics", "replaygain", "cover", "move"}
+
+// optionalStages are built-in stages that only run when PIPELINE_STAGES
+// names them.
+var optionalStages = []string{"accuraterip", "spectral", "analysis", "strip"}
+
+// builtinStages returns every built-in stage name, default ones first.
+func builtinStages() []string {
+	return append(append([]string{}, defaultStages...), optionalStages...)
+}
+
+func init() {
+	RegisterStage(NewStage("clean", cleanStage))
+	RegisterStage(NewStage("junk", junkStage))
+	RegisterStage(NewStage("metadata", metadataStage))
+	RegisterStage(NewStage("lyrics", lyricsStage))
+	RegisterStage(NewStage("replaygain", replayGainStage))
+	RegisterStage(NewStage("cover", coverStage))
+	RegisterStage(NewStage("move", moveStage))
+	RegisterStage(NewStage("accuraterip", accurateRipStage))
+	RegisterStage(NewStage("spectral", spectralStage))
+	RegisterStage(NewStage("analysis", analysisStage))
+	RegisterStage(NewStage("strip", stripStage))
+}
+
+// pipelineStages returns the configured stages in order: PIPELINE_STAGES as a
+// comma-separated list of stage names, or defaultStages.
+func pipelineStages() ([]Stage, error) {
+	return parseStages("PIPELINE_STAGES", os.Getenv("PIPELINE_STAGES"))
+}
+
+// parseStages looks up a comma-separated list of stage names read from env,
+// returning defaultStages when raw is empty.
+func parseStages(env, raw string) ([]Stage, error) {
+	names := defaultStages
+	if raw != "" {
+		names = nil
+		for _, n := range strings.Split(raw, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+	stages := make([]Stage, 0, len(names))
+	for _, n := range names {
+		s, ok := stageRegistry[n]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown stage %q", env, n)
+		}
+		stages = append(stages, s)
+	}
+	return stages, nil
+}
+
+// stepStatus returns the result field for a built-in stage, or nil for a
+// custom one.
+func (r *AlbumResult) stepStatus(stage string) *StepStatus {
+	switch stage {
+	case "clean":
+		return &r.CleanTags
+	case "junk":
+		return &r.Junk
+	case "metadata":
+		return &r.TagMetadata
+	case "lyrics":
+		return &r.Lyrics
+	case "replaygain":
+		return &r.ReplayGain
+	case "cover":
+		return &r.CoverArt
+	case "move":
+		return &r.Move
+	case "accuraterip":
+		return &r.AccurateRip
+	case "spectral":
+		return &r.Spectral
+	case "analysis":
+		return &r.Analysis
+	case "strip":
+		return &r.Strip
+	}
+	return nil
+}
+
+// runPipeline runs stages over one album, pausing between them while the
+// queue is paused, and times each one. Built-in stages left out of the
+// pipeline, or completed by an earlier run (see resume.go), are marked
+// skipped. It returns the first fatal stage error.
+func runPipeline(a *AlbumRun, stages []Stage) error {
+	configured := map[string]bool{}
+	for _, s := range stages {
+		configured[s.Name()] = true
+	}
+	for _, name := range builtinStages() {
+		if !configured[name] {
+			a.Result.stepStatus(name).Skipped = true
+		}
+	}
+
+	fixTrackExtensions(a)
+	if gaplessCheckEnabled() {
+		snapshotGapless(a)
+	}
+	for _, s := range stages {
+		waitIfPaused(a.Logf)
+		if a.stageDone(s.Name()) {
+			a.Logf(fmt.Sprintf("Skipping %s: already done by an earlier run", s.Name()))
+			a.Result.stepStatus(s.Name()).Skipped = true
+			a.Result.Resumed = append(a.Result.Resumed, s.Name())
+			continue
+		}
+		deferred := len(a.Deferred)
+		start := time.Now()
+		err := s.Run(a)
+		a.Result.StageTimes = append(a.Result.StageTimes, StageTime{s.Name(), time.Since(start)})
+		if err != nil {
+			a.Result.skippedAt(s.Name())
+			return fmt.Errorf("%s failed: %w", s.Name(), err)
+		}
+		a.markStageDone(s.Name(), deferred)
+	}
+	return nil
+}
+
+func cleanStage(a *AlbumRun) error {
+	if hasFLAC(a.Tracks) && a.Caps.degrade(&a.Result.Degraded, featureTagCleanup) {
+		a.Logf("Skipping tag cleanup: " + a.Caps.missing[featureTagCleanup])
+		a.Result.CleanTags.Skipped = true
+		return nil
+	}
+	a.Logf("Cleaning album tags")
+	a.Result.CleanTags.Err = cleanAlbumTags(a.Result.Path)
+	if a.Result.CleanTags.Failed() {
+		a.Logf(fmt.Sprintf("Cleaning album tags failed: %v", a.Result.CleanTags.Err))
+	}
+	return nil
+}
+
+func metadataStage(a *AlbumRun) error {
+	if a.offline() {
+		return offlineMetadataStage(a)
+	}
+	a.Logf("Tagging album metadata")
+	md, src, match, err := getAlbumMetadata(a.Result.Path, a.Tracks[0], a.MBID)
+	a.Result.TagMetadata.Err = err
+	a.Result.MetadataSource = src
+	a.Result.Match = match
+	if err != nil {
+		return err
+	}
+	a.Result.Metadata = md
+	if match != nil {
+		a.Logf(fmt.Sprintf("Tagged via %s (%.1f%% match): %s — %s", src, match.Similarity, md.Artist, md.Album))
+	} else {
+		a.Logf(fmt.Sprintf("Tagged via %s: %s — %s", src, md.Artist, md.Album))
+	}
+	if src != metadata.SourceManual && a.Caps.degrade(&a.Result.Degraded, featureBeets) {
+		a.Logf("Tagged without beets: " + a.Caps.missing[featureBeets])
+	}
+	if sources := metadata.GenreSources(); len(sources) > 0 {
+		lookupGenre(a, md, sources)
+	}
+	if metadata.SpotifyEnabled() {
+		enrichFromSpotify(a, md)
+	}
+	writeTagRules(a.Result.Path, a.Tracks, md, match, a.Logf)
+	return checkEditions(a, match)
+}
+
+// writeTagRules applies the tag rewrites that follow metadata resolution:
+// featuring credits, MusicBrainz release and classical tags, and preserved
+// transliterations. Failures are logged and otherwise ignored.
+func writeTagRules(albumPath string, tracks []string, md *metadata.MusicMetadata, match *metadata.Match, logf func(string)) {
+	if n, err := metadata.NormalizeFeaturing(tracks, md, metadata.FeaturingMode()); err != nil {
+		logf(fmt.Sprintf("Could not rewrite featuring credits: %v", err))
+	} else if n > 0 {
+		logf(fmt.Sprintf("Moved featuring credits out of the artist on %d files", n))
+	}
+	if id := musicBrainzReleaseID(md, match); id != "" {
+		if n, err := metadata.WriteReleaseTags(albumPath, md, id, writeMBIDsEnabled()); err != nil {
+			logf(fmt.Sprintf("Could not write release tags: %v", err))
+		} else if n > 0 {
+			logf(fmt.Sprintf("Filled in release tags on %d files", n))
+		}
+		if metadata.IsClassical(md) {
+			if n, err := metadata.WriteClassicalTags(albumPath, md, id); err != nil {
+				logf(fmt.Sprintf("Could not write composer and work tags: %v", err))
+			} else if n > 0 {
+				logf(fmt.Sprintf("Filled in composer and work tags on %d files", n))
+			}
+		}
+	}
+	metadata.PreserveTransliteration(albumPath, md, library.ASCIIPaths(), logf)
+}
+
+// lookupGenre replaces a missing or junk genre (one GENRE_MAP drops) with the
+// first the genre sources know, writing it into every track. With
+// GENRE_OVERWRITE=true every album's genre is looked up.
+func lookupGenre(a *AlbumRun, md *metadata.MusicMetadata, sources []string) {
+	overwrite := strings.ToLower(os.Getenv("GENRE_OVERWRITE")) == "true"
+	if md.Genre != "" && metadata.NormalizeGenre(md.Genre) != "" && !overwrite {
+		return
+	}
+	genre, err := metadata.LookupGenre(md, sources)
+	if genre == "" {
+		if err != nil {
+			a.Logf(fmt.Sprintf("Genre lookup failed: %v; will retry later", err))
+			a.deferTask(deferGenre)
+		}
+		return
+	}
+	for _, t := range a.Tracks {
+		if err := metadata.WriteTags(t, map[string]string{"GENRE": genre}); err != nil {
+			a.Logf(fmt.Sprintf("Could not write genre: %v", err))
+			return
+		}
+	}
+	md.Genre = genre
+	a.Logf("Genre: " + genre)
+}
+
+// enrichFromSpotify looks the album up on Spotify and fills in a missing
+// release type and date. With SPOTIFY_CANONICAL_ARTIST=true the album artist
+// also takes Spotify's spelling when it differs only slightly ("Beyonce" →
+// "Beyoncé").
+func enrichFromSpotify(a *AlbumRun, md *metadata.MusicMetadata) {
+	artist := metadata.FirstNonEmpty(md.AlbumArtist, md.Artist)
+	sp, err := metadata.LookupSpotifyAlbum(artist, md.Album)
+	if err != nil {
+		a.Logf(fmt.Sprintf("Spotify lookup failed: %v", err))
+		return
+	}
+	tags := map[string]string{"SPOTIFY_ALBUMID": sp.ID}
+	if md.ReleaseType == "" {
+		md.ReleaseType = sp.ReleaseType
+		tags["RELEASETYPE"] = sp.ReleaseType
+	}
+	if md.Date == "" && sp.ReleaseDate != "" {
+		md.Date = strings.ReplaceAll(sp.ReleaseDate, "-", ".")
+		md.Year = md.Date[:min(4, len(md.Date))]
+		tags["DATE"] = sp.ReleaseDate
+	}
+	if strings.ToLower(os.Getenv("SPOTIFY_CANONICAL_ARTIST")) == "true" && sp.Artist != artist {
+		a.Logf(fmt.Sprintf("Using Spotify's artist name %q for %q", sp.Artist, artist))
+		if md.Artist == artist {
+			md.Artist = sp.Artist
+		}
+		md.AlbumArtist = sp.Artist
+		tags["ALBUMARTIST"] = sp.Artist
+	}
+	for _, t := range a.Tracks {
+		if err := metadata.WriteTags(t, tags); err != nil {
+			a.Logf(fmt.Sprintf("Could not write Spotify tags: %v", err))
+			return
+		}
+	}
+	a.Logf(fmt.Sprintf("Spotify: %s — %s (%s, %s)", sp.Artist, sp.Name, sp.ReleaseType, sp.ReleaseDate))
+}
+
+// writeMBIDsEnabled reports whether MusicBrainz ID tags are filled in at
+// import time; WRITE_MB_IDS=false turns it off.
+func writeMBIDsEnabled() bool {
+	return strings.ToLower(os.Getenv("WRITE_MB_IDS")) != "false"
+}
+
+// musicBrainzReleaseID returns the release the album was tagged from, if known.
+func musicBrainzReleaseID(md *metadata.MusicMetadata, match *metadata.Match) string {
+	if md.ReleaseMBID != "" {
+		return md.ReleaseMBID
+	}
+	if match != nil {
+		return match.ReleaseMBID
+	}
+	return ""
+}
+
+func lyricsStage(a *AlbumRun) error {
+	if a.offline() {
+		a.Logf("Offline: lyrics will be fetched when the network is back")
+		a.Result.Lyrics.Skipped = true
+		a.deferTask(deferLyrics)
+		return nil
+	}
+	a.Logf("Fetching synced lyrics from LRCLIB")
+	stats, err := DownloadAlbumLyrics(a.Result.Path, a.Logf)
+	a.Result.Lyrics.Err = err
+	a.Result.LyricsStats = stats
+	if err != nil {
+		a.Logf(fmt.Sprintf("Lyrics warning: %v", err))
+	}
+	if stats.Failed > 0 {
+		a.Logf(fmt.Sprintf("Lyrics lookup failed for %d track(s); will retry later", stats.Failed))
+		a.deferTask(deferLyrics)
+	}
+	return nil
+}
+
+func replayGainStage(a *AlbumRun) error {
+	if dynamicRangeEnabled() {
+		measureDynamicRange(a)
+	}
+	if a.Caps.degrade(&a.Result.Degraded, featureReplayGain) {
+		a.Logf("Skipping ReplayGain: " + a.Caps.missing[featureReplayGain])
+		a.Result.ReplayGain.Skipped = true
+		return nil
+	}
+	a.Caps.degrade(&a.Result.Degraded, featurePlaybackThrottle)
+	waitForMediaServerIdle(a.Logf)
+
+	a.Logf("Applying ReplayGain")
+	a.Result.ReplayGain.Err = applyReplayGain(a.Result.Path)
+	return a.Result.ReplayGain.Err
+}
+
+func coverStage(a *AlbumRun) error {
+	albumPath := a.Result.Path
+	origin := coverFromFolder
+	if _, err := metadata.FindCoverImage(albumPath); err != nil && a.offline() {
+		a.Logf("Offline: cover art will be downloaded when the network is back")
+		a.deferTask(deferCover)
+	} else if err != nil && a.Result.Metadata != nil {
+		a.Logf("Downloading cover art")
+		if err := DownloadCoverArt(albumPath, a.Result.Metadata, a.MBID); err != nil {
+			a.Logf(fmt.Sprintf("Cover art download failed: %v; will retry later", err))
+			a.deferTask(deferCover)
+		}
+		origin = coverFromCAA
+	}
+	if coverImg, err := metadata.FindCoverImage(albumPath); err == nil {
+		origin = upgradeCover(a, coverImg, origin)
+	}
+
+	if err := NormalizeCoverArt(albumPath); err != nil {
+		a.Logf(fmt.Sprintf("Cover art normalization warning: %v", err))
+	}
+
+	a.Logf("Embedding cover art")
+	a.Result.CoverArt.Err = EmbedAlbumArtIntoFolder(albumPath)
+	if coverImg, err := metadata.FindCoverImage(albumPath); err == nil {
+		a.Result.CoverArtStats.Found = true
+		a.Result.CoverArtStats.Source = filepath.Base(coverImg)
+		a.Result.CoverArtStats.Embedded = a.Result.CoverArt.Err == nil
+		a.Result.CoverArtStats.Origin = origin
+		a.Result.CoverArtStats.Width, a.Result.CoverArtStats.Height, _ = imageSize(coverImg)
+		a.Result.Palette = library.AlbumPalette(albumPath)
+	}
+	return a.Result.CoverArt.Err
+}
+
+// moveStage moves the album into the library and records it in the journal.
+// Without a metadata stage the album's existing tags decide where it goes.
+func moveStage(a *AlbumRun) error {
+	albumPath := a.Result.Path
+	md := a.Result.Metadata
+	if md == nil {
+		var err error
+		if md, err = metadata.ReadTags(a.Tracks[0]); err != nil {
+			a.Result.Move.Err = err
+			return err
+		}
+	}
+
+	checkGapless(a, md)
+	convertID3Tags(a)
+	if err := confirmFolderMatch(a, md); err != nil {
+		return err
+	}
+
+	targetDir := library.AlbumTargetDir(a.LibraryDir, md)
+	a.Result.TargetDir = targetDir
+	if library.LibraryHasAlbum(a.LibraryDir, targetDir) {
+		a.Logf("Album already exists in library, skipping move: " + targetDir)
+		a.Result.Move.Skipped = true
+		return nil
+	}
+
+	ensureLibraryWritable(a.LibraryDir, a.Logf)
+
+	lyrics, _ := metadata.LyricFiles(albumPath)
+	coverImg, _ := metadata.FindCoverImage(albumPath)
+	artwork, _ := artworkFiles(albumPath)
+	_, extras, _ := junkFiles(albumPath)
+	extras = slices.DeleteFunc(extras, func(f string) bool { return artwork[f] != "" })
+	if _, err := os.Stat(filepath.Join(albumPath, drReportFile)); err == nil {
+		extras = append(extras, filepath.Join(albumPath, drReportFile))
+	}
+
+	files := append(append(append([]string{}, a.Tracks...), lyrics...), extras...)
+	if coverImg != "" {
+		files = append(files, coverImg)
+	}
+	for f := range artwork {
+		files = append(files, f)
+	}
+	if err := checkMoveSpace(a.LibraryDir, albumPath, files); err != nil {
+		a.Logf(fmt.Sprintf("Not moving album: %v", err))
+		a.Result.Move.Err = err
+		return err
+	}
+
+	names := library.TrackFileNames(md, a.Tracks, lyrics)
+	maps.Copy(names, artwork)
+	mv := newMoveVerifier(a.LibraryDir, md, names, a.Logf)
+
+	a.Logf("Moving tracks into library")
+	for _, track := range a.Tracks {
+		if err := mv.move(track); err != nil {
+			a.Logf(fmt.Sprintf("Failed to move track %s: %v", track, err))
+			a.Result.Move.Err = err // retains last error; all attempts are still made
+		}
+	}
+
+	for _, file := range lyrics {
+		if err := mv.move(file); err != nil {
+			a.Logf(fmt.Sprintf("Failed to move lyrics %s: %v", file, err))
+			a.Result.Move.Err = err
+		}
+	}
+
+	if coverImg != "" {
+		if err := mv.move(coverImg); err != nil {
+			a.Logf(fmt.Sprintf("Failed to move cover image %s: %v", coverImg, err))
+			a.Result.Move.Err = err
+		}
+	}
+
+	for _, file := range extras {
+		if err := mv.move(file); err != nil {
+			a.Logf(fmt.Sprintf("Failed to move %s: %v", file, err))
+			a.Result.Move.Err = err
+		}
+	}
+
+	if len(artwork) > 0 {
+		a.Logf(fmt.Sprintf("Moving %d artwork files into %s/", len(artwork), artworkDir()))
+	}
+	for _, file := range slices.Sorted(maps.Keys(artwork)) {
+		if err := mv.move(file); err != nil {
+			a.Logf(fmt.Sprintf("Failed to move artwork %s: %v", file, err))
+			a.Result.Move.Err = err
+		}
+	}
+
+	cleanupSourceDir(albumPath)
+
+	if albumPlaylistsEnabled() && !md.Audiobook {
+		if err := writeAlbumPlaylist(targetDir, md); err != nil {
+			a.Logf(fmt.Sprintf("Could not write album playlist: %v", err))
+		}
+	}
+	if nfoEnabled() && !md.Audiobook {
+		if err := writeNFOs(a.LibraryDir, targetDir, md); err != nil {
+			a.Logf(fmt.Sprintf("Could not write NFO files: %v", err))
+		}
+	}
+	if artistImagesEnabled() && !md.Audiobook {
+		if err := fetchArtistImages(a.LibraryDir, targetDir, md); err != nil {
+			a.Logf(fmt.Sprintf("Could not fetch artist images: %v", err))
+		}
+	}
+
+	if entry, err := library.RecordImport(a.LibraryDir, targetDir, md, a.Result.MetadataSource, mv.verification(), a.Result.Degraded); err != nil {
+		a.Logf(fmt.Sprintf("Failed to record import in journal: %v", err))
+	} else {
+		a.Result.JournalID = entry.ID
+		if st := a.Result.CoverArtStats; st.Found {
+			cover := &library.JournalCover{File: st.Source, Origin: st.Origin, Width: st.Width, Height: st.Height}
+			if err := library.SetJournalCover(entry.ID, cover); err != nil {
+				a.Logf(fmt.Sprintf("Failed to record cover in journal: %v", err))
+			}
+		}
+		if a.Result.AccurateRipInfo != nil {
+			if err := library.SetJournalAccurateRip(entry.ID, a.Result.AccurateRipInfo); err != nil {
+				a.Logf(fmt.Sprintf("Failed to record AccurateRip result in journal: %v", err))
+			}
+		}
+	}
+	if len(a.Deferred) > 0 {
+		if err := queueDeferred(targetDir, a.Deferred); err != nil {
+			a.Logf(fmt.Sprintf("Could not queue deferred tasks: %v", err))
+		} else {
+			a.Logf("Queued for retry: " + strings.Join(a.Deferred, ", "))
+		}
+	}
+
+	// AUDIOBOOK_DIR is always local; only music goes to a remote library.
+	if md.Audiobook {
+		return nil
+	}
+	if err := library.UploadAlbum(a.LibraryDir, targetDir, a.Logf); err != nil {
+		a.Logf(fmt.Sprintf("Failed to upload album to remote library: %v", err))
+		a.Result.Move.Err = err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package importer
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// albumPlaylistName is the playlist ALBUM_PLAYLISTS writes into each album
+// folder.
+const albumPlaylistName = "album.m3u8"
+
+// albumPlaylistsEnabled reports whether ALBUM_PLAYLISTS is on.
+func albumPlaylistsEnabled() bool {
+	return os.Getenv("ALBUM_PLAYLISTS") == "true"
+}
+
+// playlistEntry is one track of a playlist.
+type playlistEntry struct {
+	path    string
+	seconds int // -1 if unknown
+	artist  string
+	title   string
+	album   string
+}
+
+// albumPlaylistEntries lists the tracks of an album folder in disc and
+// track order.
+func albumPlaylistEntries(dir string, md *metadata.MusicMetadata) ([]playlistEntry, error) {
+	tracks, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	type numbered struct {
+		playlistEntry
+		disc, track int
+	}
+	var all []numbered
+	for _, t := range tracks {
+		tags, _ := metadata.ReadTrackTags(t)
+		secs, err := TrackDuration(t)
+		if err != nil {
+			secs = -1
+		}
+		all = append(all, numbered{playlistEntry{
+			path:    t,
+			seconds: secs,
+			artist:  metadata.FirstNonEmpty(tags.Artist, md.Artist),
+			title:   metadata.FirstNonEmpty(tags.Title, strings.TrimSuffix(filepath.Base(t), filepath.Ext(t))),
+			album:   md.Album,
+		}, tags.Disc, tags.Track})
+	}
+	slices.SortStableFunc(all, func(a, b numbered) int {
+		return cmp.Or(cmp.Compare(a.disc, b.disc), cmp.Compare(a.track, b.track), strings.Compare(a.path, b.path))
+	})
+	out := make([]playlistEntry, len(all))
+	for i, n := range all {
+		out[i] = n.playlistEntry
+	}
+	return out, nil
+}
+
+// writePlaylist writes an extended M3U8 playlist to path, with entries
+// relative to its folder so the playlist survives the library moving.
+func writePlaylist(path, title string, entries []playlistEntry) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#PLAYLIST:%s\n", title)
+	for _, e := range entries {
+		rel, err := filepath.Rel(filepath.Dir(path), e.path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s - %s\n", e.seconds, e.artist, e.title)
+		if e.album != "" {
+			fmt.Fprintf(&b, "#EXTALB:%s\n", e.album)
+		}
+		b.WriteString(filepath.ToSlash(rel) + "\n")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// writeAlbumPlaylist writes album.m3u8 into an album folder of the library.
+func writeAlbumPlaylist(dir string, md *metadata.MusicMetadata) error {
+	entries, err := albumPlaylistEntries(dir, md)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	title := metadata.FirstNonEmpty(md.AlbumArtist, md.Artist) + " - " + md.Album
+	return writePlaylist(filepath.Join(dir, albumPlaylistName), title, entries)
+}
+
+// refreshAlbumPlaylist rewrites an album's album.m3u8, if it has one, after
+// its tracks were renamed.
+func refreshAlbumPlaylist(dir string, md *metadata.MusicMetadata) error {
+	if _, err := os.Stat(filepath.Join(dir, albumPlaylistName)); err != nil {
+		return nil
+	}
+	return writeAlbumPlaylist(dir, md)
+}
+
+// writeRunPlaylist writes every album a run moved into the library, in
+// import order, to a playlist named after the run's start in PLAYLIST_DIR.
+// It is a no-op when the variable is unset, the library is remote or
+// nothing was imported.
+func writeRunPlaylist(s *Session) {
+	dir := os.Getenv("PLAYLIST_DIR")
+	if dir == "" || library.RemoteLibrary() != "" {
+		return
+	}
+	var entries []playlistEntry
+	for _, a := range s.Albums {
+		if !a.Succeeded() || a.Move.Skipped || a.TargetDir == "" || a.Metadata == nil {
+			continue
+		}
+		album, err := albumPlaylistEntries(a.TargetDir, a.Metadata)
+		if err != nil {
+			fmt.Println("Could not list tracks for playlist:", err)
+			continue
+		}
+		entries = append(entries, album...)
+	}
+	if len(entries) == 0 {
+		return
+	}
+	name := "Imported " + s.StartedAt.Format("2006-01-02 15.04")
+	path := filepath.Join(dir, library.SanitizeFilename(name+".m3u8"))
+	if err := writePlaylist(path, name, entries); err != nil {
+		fmt.Println("Could not write run playlist:", err)
+		return
+	}
+	fmt.Println("→ Wrote playlist", path)
+}
@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+	"github.com/gabehf/music-import/tools"
+)
+
+// previewFilters are the ffmpeg filters rendering each kind of track preview.
+var previewFilters = map[string]string{
+	"spectrogram": "showspectrumpic=s=800x300:legend=0",
+	"waveform":    "showwavespic=s=800x120:split_channels=1:colors=0x4a9eff|0x7ab8ff",
+}
+
+// previewClip is the length in seconds of a transcoded listening clip.
+const previewClip = 30
+
+// previewSlots limits how many previews render at once; the review panel
+// asks for every track's images together.
+var previewSlots = make(chan struct{}, 2)
+
+// TrackPreview lists one track of a pending album in the preview panel.
+type TrackPreview struct {
+	Track   string `json:"track"`
+	Quality string `json:"quality"`
+}
+
+// previewCacheDir holds the rendered previews of one pending album.
+func previewCacheDir(albumPath string) string {
+	return filepath.Join(library.DataDir(), "previews", hex.EncodeToString([]byte(filepath.Base(albumPath))))
+}
+
+// AlbumPreviews lists the tracks of a pending album whose previews can be
+// rendered with TrackPreviewImage.
+func AlbumPreviews(albumPath string) ([]TrackPreview, error) {
+	tracks, err := metadata.AudioFiles(albumPath)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TrackPreview, 0, len(tracks))
+	for _, t := range tracks {
+		q, _ := metadata.AudioQuality(t)
+		out = append(out, TrackPreview{Track: filepath.Base(t), Quality: q})
+	}
+	return out, nil
+}
+
+// PendingTrack returns the path of the named track in a pending album,
+// refusing anything that is not one of its audio files.
+func PendingTrack(albumPath, track string) (string, error) {
+	tracks, err := metadata.AudioFiles(albumPath)
+	if err != nil {
+		return "", err
+	}
+	src := filepath.Join(albumPath, track)
+	if track != filepath.Base(track) || !slices.Contains(tracks, src) {
+		return "", errors.New("track not found: " + track)
+	}
+	return src, nil
+}
+
+// TrackClip transcodes previewClip seconds from the middle of a track to
+// MP3, for browsers that cannot play the original.
+func TrackClip(path string) ([]byte, error) {
+	start := 0
+	if d, err := TrackDuration(path); err == nil && d > previewClip {
+		start = (d - previewClip) / 2
+	}
+	return tools.Output("ffmpeg", "-v", "error", "-ss", strconv.Itoa(start), "-t", strconv.Itoa(previewClip),
+		"-i", path, "-map", "0:a:0", "-c:a", "libmp3lame", "-b:a", "192k", "-f", "mp3", "-")
+}
+
+// TrackPreviewImage returns the path of a PNG spectrogram or waveform of a
+// track in a pending album, rendering it with ffmpeg the first time and
+// again whenever the track has changed since.
+func TrackPreviewImage(albumPath, track, kind string) (string, error) {
+	filter, ok := previewFilters[kind]
+	if !ok {
+		return "", errors.New("unknown preview kind: " + kind)
+	}
+	src, err := PendingTrack(albumPath, track)
+	if err != nil {
+		return "", err
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(previewCacheDir(albumPath), kind+"-"+hex.EncodeToString([]byte(track))+".png")
+	if info, err := os.Stat(dst); err == nil && info.ModTime().After(srcInfo.ModTime()) {
+		return dst, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+
+	previewSlots <- struct{}{}
+	defer func() { <-previewSlots }()
+	tmp := dst + ".tmp.png"
+	if _, err := tools.Output("ffmpeg", "-v", "error", "-y", "-i", src, "-map", "0:a:0",
+		"-lavfi", filter, "-frames:v", "1", tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return dst, os.Rename(tmp, dst)
+}
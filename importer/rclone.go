@@ -0,0 +1,76 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// rcloneSource pulls album folders from an rclone remote used as IMPORT_DIR.
+// Each folder is moved (copied with COPYMODE=true) into a hidden staging
+// folder and only published once the transfer completes.
+type rcloneSource struct {
+	Remote string
+}
+
+func (s *rcloneSource) Name() string { return s.Remote }
+
+func (s *rcloneSource) Pull(importDir string, logf func(string)) ([]string, error) {
+	if err := os.MkdirAll(importDir, 0755); err != nil {
+		return nil, err
+	}
+	out, err := library.Rclone("lsf", "--dirs-only", s.Remote)
+	if err != nil {
+		return nil, err
+	}
+	copyMode := strings.ToLower(os.Getenv("COPYMODE")) == "true"
+	pulled, err := loadPulled()
+	if err != nil {
+		return nil, err
+	}
+
+	staging := filepath.Join(importDir, ".remote-staging")
+	var albums []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name := path.Clean(strings.TrimSuffix(strings.TrimSpace(line), "/"))
+		if name == "." || name == "" || isHiddenEntry(name) {
+			continue
+		}
+		key := s.Name() + "/" + name
+		if copyMode && pulled[key] {
+			continue
+		}
+
+		op := "move"
+		if copyMode {
+			op = "copy"
+		}
+		logf(fmt.Sprintf("Pulling %s (%s)", name, op))
+		local := filepath.Join(staging, name)
+		args := []string{op, library.RemoteJoin(s.Remote, name), local}
+		if op == "move" {
+			args = append(args, "--delete-empty-src-dirs")
+		}
+		if _, err := library.Rclone(args...); err != nil {
+			// rclone skips files already transferred, so the next pull resumes.
+			return albums, err
+		}
+
+		dst := UniqueDir(filepath.Join(importDir, library.Sanitize(name)))
+		if err := os.Rename(local, dst); err != nil {
+			return albums, err
+		}
+		albums = append(albums, filepath.Base(dst))
+		if copyMode {
+			if err := markPulled(key); err != nil {
+				return albums, err
+			}
+		}
+	}
+	os.Remove(staging)
+	return albums, nil
+}
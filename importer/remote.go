@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// importSource is somewhere albums come from besides IMPORT_DIR itself. Pull
+// copies new album folders into importDir and returns their names; it is run
+// before every import.
+type importSource interface {
+	Name() string
+	Pull(importDir string, logf func(string)) ([]string, error)
+}
+
+// ConfiguredSources returns the sources set up through the environment.
+func ConfiguredSources() []importSource {
+	var sources []importSource
+	if d := os.Getenv("IMPORT_DIR"); library.IsRcloneRemote(d) {
+		sources = append(sources, &rcloneSource{Remote: d})
+	}
+	if u := os.Getenv("REMOTE_SOURCE"); u != "" {
+		sources = append(sources, &lftpSource{URL: u, RateLimit: os.Getenv("REMOTE_RATE_LIMIT")})
+	}
+	return sources
+}
+
+// PullSources pulls from every configured source. Failures are logged; what
+// was already pulled is still imported.
+func PullSources(importDir string, logf func(string)) {
+	for _, s := range ConfiguredSources() {
+		logf("Pulling from " + s.Name())
+		albums, err := s.Pull(importDir, logf)
+		if err != nil {
+			logf(fmt.Sprintf("Pull from %s failed: %v", s.Name(), err))
+		}
+		if len(albums) > 0 {
+			logf(fmt.Sprintf("Pulled %d album(s) from %s", len(albums), s.Name()))
+		}
+	}
+}
+
+// lftpSource mirrors album folders from an SFTP or FTP directory with lftp.
+// Each remote folder is mirrored into a hidden staging folder in IMPORT_DIR
+// with --continue, so an interrupted transfer resumes where it stopped, and
+// is only moved into place once complete. Pulled folder names are remembered
+// so albums left on the remote (e.g. still seeding) are not fetched twice.
+type lftpSource struct {
+	URL       string // sftp://user@host/path or ftp://…; password from REMOTE_PASSWORD
+	RateLimit string // lftp net:limit-rate, e.g. "2M" (bytes/s); empty for unlimited
+}
+
+func (s *lftpSource) Name() string {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return "remote"
+	}
+	u.User = nil
+	return u.String()
+}
+
+// lftpQuote quotes an argument for an lftp command script.
+func lftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// run executes an lftp script after connecting to the source.
+func (s *lftpSource) run(script string, capture bool) ([]byte, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REMOTE_SOURCE: %w", err)
+	}
+	dir := u.Path
+	u.Path = ""
+
+	open := "open"
+	if os.Getenv("REMOTE_PASSWORD") != "" && u.User != nil {
+		open += " --env-password -u " + lftpQuote(u.User.Username())
+		u.User = nil
+	}
+	pre := []string{
+		"set cmd:fail-exit yes",
+		"set net:max-retries 3",
+		"set sftp:auto-confirm yes",
+	}
+	if s.RateLimit != "" {
+		pre = append(pre, "set net:limit-rate "+lftpQuote(s.RateLimit))
+	}
+	pre = append(pre, open+" "+lftpQuote(u.String()))
+	if dir != "" {
+		pre = append(pre, "cd "+lftpQuote(dir))
+	}
+
+	cmd := exec.Command("lftp", "-c", strings.Join(append(pre, script), "; "))
+	cmd.Env = append(os.Environ(), "LFTP_PASSWORD="+os.Getenv("REMOTE_PASSWORD"))
+	if capture {
+		return cmd.Output()
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return nil, cmd.Run()
+}
+
+// Pull mirrors every remote folder not pulled before into importDir.
+func (s *lftpSource) Pull(importDir string, logf func(string)) ([]string, error) {
+	out, err := s.run("cls -1 --classify", true)
+	if err != nil {
+		return nil, fmt.Errorf("listing remote: %w", err)
+	}
+	pulled, err := loadPulled()
+	if err != nil {
+		return nil, err
+	}
+
+	staging := filepath.Join(importDir, ".remote-staging")
+	var albums []string
+	for _, line := range strings.Split(string(out), "\n") {
+		name, isDir := strings.CutSuffix(strings.TrimSpace(line), "/")
+		if !isDir || name == "" || name != filepath.Base(name) || isHiddenEntry(name) {
+			continue
+		}
+		key := s.Name() + "/" + name
+		if pulled[key] {
+			continue
+		}
+
+		logf("Mirroring " + name)
+		local := filepath.Join(staging, name)
+		if err := os.MkdirAll(local, 0755); err != nil {
+			return albums, err
+		}
+		if _, err := s.run(fmt.Sprintf("mirror --continue --parallel=2 %s %s",
+			lftpQuote(name), lftpQuote(local)), false); err != nil {
+			// Leave the partial copy in staging; the next pull resumes it.
+			return albums, fmt.Errorf("mirroring %s: %w", name, err)
+		}
+
+		dst := UniqueDir(filepath.Join(importDir, library.Sanitize(name)))
+		if err := os.Rename(local, dst); err != nil {
+			return albums, err
+		}
+		albums = append(albums, filepath.Base(dst))
+		if err := markPulled(key); err != nil {
+			return albums, err
+		}
+	}
+	os.Remove(staging)
+	return albums, nil
+}
+
+// ── Pulled-folder record ──────────────────────────────────────────────────────
+
+var pulledMu sync.Mutex
+
+func pulledPath() string {
+	return filepath.Join(library.DataDir(), "remote-pulled.json")
+}
+
+// loadPulled returns the set of "<source>/<folder>" keys pulled so far.
+func loadPulled() (map[string]bool, error) {
+	pulledMu.Lock()
+	defer pulledMu.Unlock()
+	return loadPulledLocked()
+}
+
+func loadPulledLocked() (map[string]bool, error) {
+	set := map[string]bool{}
+	data, err := os.ReadFile(pulledPath())
+	if os.IsNotExist(err) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return set, json.Unmarshal(data, &set)
+}
+
+func markPulled(key string) error {
+	pulledMu.Lock()
+	defer pulledMu.Unlock()
+	set, err := loadPulledLocked()
+	if err != nil {
+		return err
+	}
+	set[key] = true
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(library.DataDir(), 0755); err != nil {
+		return err
+	}
+	tmp := pulledPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pulledPath())
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// ReplayGainStats counts what a ReplayGain backfill did.
+type ReplayGainStats struct {
+	Albums    int `json:"albums"`    // albums checked
+	Tagged    int `json:"tagged"`    // already consistently tagged
+	Processed int `json:"processed"` // reprocessed (or would be, in a dry run)
+	Failed    int `json:"failed"`
+}
+
+// replayGainReference returns REPLAYGAIN_REFERENCE, the reference loudness
+// in LUFS every track is expected to be tagged with; ok is false when unset.
+func replayGainReference() (ref float64, ok bool) {
+	ref, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv("REPLAYGAIN_REFERENCE")), 64)
+	return ref, err == nil
+}
+
+// parseLoudness reads the number from a tag like "-18.00 LUFS".
+func parseLoudness(v string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.Fields(v + " ")[0], 64)
+	return f, err == nil
+}
+
+// replayGainProblem returns why the tracks of an album need their
+// ReplayGain recomputed, or "" when they are tagged consistently.
+func replayGainProblem(tracks []string) (string, error) {
+	want, checkRef := replayGainReference()
+	var first *metadata.ReplayGain
+	for _, t := range tracks {
+		rg, err := metadata.ReadReplayGain(t)
+		if err != nil {
+			return "", err
+		}
+		name := filepath.Base(t)
+		switch {
+		case rg.TrackGain == "":
+			return "no track gain on " + name, nil
+		case rg.AlbumGain == "":
+			return "no album gain on " + name, nil
+		}
+		if checkRef && rg.Reference != "" {
+			if ref, ok := parseLoudness(rg.Reference); !ok || ref != want {
+				return fmt.Sprintf("%s tagged for %s, want %g LUFS", name, rg.Reference, want), nil
+			}
+		}
+		if first == nil {
+			first = &rg
+			continue
+		}
+		if rg.AlbumGain != first.AlbumGain {
+			return "album gain differs between tracks", nil
+		}
+		if rg.Reference != first.Reference {
+			return "reference loudness differs between tracks", nil
+		}
+	}
+	return "", nil
+}
+
+// BackfillReplayGain walks the library and re-runs rsgain on every album
+// with missing or inconsistent ReplayGain tags (see replayGainProblem),
+// refreshing the journal checksums of the albums it changed. Progress is
+// checkpointed in DATA_DIR/replaygain-backfill.json after every album, so
+// a cancelled run resumes where it stopped; restart discards the
+// checkpoint. limit > 0 stops after that many albums were reprocessed,
+// leaving the checkpoint for the next batch. dryRun only reports and never
+// touches the checkpoint.
+func BackfillReplayGain(ctx context.Context, libraryDir string, restart, dryRun bool, limit int, logf func(string)) (ReplayGainStats, error) {
+	cp := loadBackfillCheckpoint[ReplayGainStats]("replaygain", restart && !dryRun)
+	if dryRun {
+		cp.Stats = ReplayGainStats{}
+		if restart {
+			cp.Done = map[string]bool{}
+		}
+	}
+	if len(cp.Done) > 0 {
+		logf(fmt.Sprintf("Resuming ReplayGain backfill started %s (%d albums done)", cp.StartedAt.Format(time.DateTime), len(cp.Done)))
+	}
+
+	dirs, err := libraryAlbumDirs(libraryDir)
+	if err != nil {
+		return cp.Stats, err
+	}
+	batch := 0
+	for i, rel := range dirs {
+		if cp.Done[rel] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return cp.Stats, errors.Join(err, saveUnlessDry(cp, dryRun))
+		}
+		if limit > 0 && batch >= limit {
+			logf(fmt.Sprintf("Batch of %d albums done; run again to continue", limit))
+			return cp.Stats, saveUnlessDry(cp, dryRun)
+		}
+		dir := filepath.Join(libraryDir, rel)
+		tracks, err := metadata.AudioFiles(dir)
+		if err != nil {
+			logf(fmt.Sprintf("Skipping %s: %v", rel, err))
+			continue
+		}
+		cp.Stats.Albums++
+		problem, err := replayGainProblem(tracks)
+		switch {
+		case err != nil:
+			logf(fmt.Sprintf("[%d/%d] %s: could not read tags: %v", i+1, len(dirs), rel, err))
+			cp.Stats.Failed++
+		case problem == "":
+			cp.Stats.Tagged++
+		case dryRun:
+			logf(fmt.Sprintf("[%d/%d] %s: would reprocess (%s)", i+1, len(dirs), rel, problem))
+			cp.Stats.Processed++
+			batch++
+		default:
+			logf(fmt.Sprintf("[%d/%d] %s: reprocessing (%s)", i+1, len(dirs), rel, problem))
+			batch++
+			if err := applyReplayGain(dir); err != nil {
+				logf(fmt.Sprintf("ReplayGain failed for %s: %v", rel, err))
+				cp.Stats.Failed++
+				break
+			}
+			cp.Stats.Processed++
+			if err := library.RefreshJournalFiles(libraryDir, rel); err != nil {
+				logf(fmt.Sprintf("Could not refresh journal for %s: %v", rel, err))
+			}
+		}
+		if dryRun {
+			continue
+		}
+		cp.Done[rel] = true
+		if err := cp.save(); err != nil {
+			logf(fmt.Sprintf("Could not save ReplayGain backfill checkpoint: %v", err))
+		}
+	}
+	if !dryRun {
+		cp.finish()
+	}
+	return cp.Stats, nil
+}
+
+func saveUnlessDry(cp *backfillCheckpoint[ReplayGainStats], dryRun bool) error {
+	if dryRun {
+		return nil
+	}
+	return cp.save()
+}
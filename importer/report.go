@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// RunReport is the machine-readable summary of an import run, written to
+// REPORTS_DIR after every run that found albums and served by /api/report.
+type RunReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Seconds    float64        `json:"seconds"`
+	Albums     []AlbumReport  `json:"albums"`
+	Degraded   []Degradation  `json:"degraded,omitempty"`
+	Totals     map[string]int `json:"totals"` // albums, succeeded, warnings, failed
+}
+
+// AlbumReport is one album of a RunReport.
+type AlbumReport struct {
+	Name        string             `json:"name"`
+	Source      string             `json:"source"`
+	Status      string             `json:"status"` // ok, warnings or failed
+	FatalStep   string             `json:"fatal_step,omitempty"`
+	Artist      string             `json:"artist,omitempty"`
+	Album       string             `json:"album,omitempty"`
+	Year        string             `json:"year,omitempty"`
+	Quality     string             `json:"quality,omitempty"`
+	Tracks      int                `json:"tracks"`
+	MetaSource  string             `json:"metadata_source,omitempty"`
+	ReleaseMBID string             `json:"release_mbid,omitempty"`
+	Similarity  float64            `json:"match_similarity,omitempty"`
+	Destination string             `json:"destination,omitempty"`
+	JournalID   string             `json:"journal_id,omitempty"`
+	LogID       string             `json:"log_id,omitempty"`
+	Errors      map[string]string  `json:"errors,omitempty"` // stage → error
+	Stages      map[string]float64 `json:"stages,omitempty"` // stage → seconds
+	Seconds     float64            `json:"seconds"`          // all stages
+	Degraded    []string           `json:"degraded,omitempty"`
+	Gapless     []string           `json:"gapless,omitempty"`
+	Duplicates  []string           `json:"duplicates,omitempty"`
+	Resumed     []string           `json:"resumed,omitempty"`
+}
+
+// NewRunReport summarises a finished session.
+func NewRunReport(s *Session) *RunReport {
+	r := &RunReport{
+		StartedAt:  s.StartedAt,
+		FinishedAt: s.FinishedAt,
+		Seconds:    s.FinishedAt.Sub(s.StartedAt).Seconds(),
+		Degraded:   s.Degradations,
+		Totals: map[string]int{
+			"albums":    len(s.Albums),
+			"succeeded": len(s.Albums) - len(s.Failed()),
+			"warnings":  len(s.WithWarnings()),
+			"failed":    len(s.Failed()),
+		},
+	}
+	for _, a := range s.Albums {
+		ar := AlbumReport{
+			Name:        a.Name,
+			Source:      a.Path,
+			Status:      "ok",
+			FatalStep:   a.FatalStep,
+			Tracks:      a.TrackCount,
+			MetaSource:  string(a.MetadataSource),
+			Destination: a.TargetDir,
+			JournalID:   a.JournalID,
+			LogID:       a.LogID,
+			Degraded:    a.Degraded,
+			Gapless:     a.Gapless,
+			Duplicates:  a.Duplicates,
+			Resumed:     a.Resumed,
+		}
+		switch {
+		case !a.Succeeded():
+			ar.Status = "failed"
+		case a.HasWarnings():
+			ar.Status = "warnings"
+		}
+		if md := a.Metadata; md != nil {
+			ar.Artist, ar.Album, ar.Year, ar.Quality = md.Artist, md.Album, md.Year, md.Quality
+			ar.ReleaseMBID = md.ReleaseMBID
+		}
+		if m := a.Match; m != nil {
+			ar.Similarity = m.Similarity
+			if ar.ReleaseMBID == "" {
+				ar.ReleaseMBID = m.ReleaseMBID
+			}
+		}
+		for _, name := range builtinStages() {
+			if st := a.stepStatus(name); st != nil && st.Err != nil {
+				if ar.Errors == nil {
+					ar.Errors = map[string]string{}
+				}
+				ar.Errors[name] = st.Err.Error()
+			}
+		}
+		for _, st := range a.StageTimes {
+			if ar.Stages == nil {
+				ar.Stages = map[string]float64{}
+			}
+			ar.Stages[st.Stage] += st.Duration.Seconds()
+			ar.Seconds += st.Duration.Seconds()
+		}
+		r.Albums = append(r.Albums, ar)
+	}
+	return r
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *RunReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one row per album, with a seconds column per built-in
+// stage and the stage errors joined into one column.
+func (r *RunReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"name", "status", "fatal_step", "artist", "album", "year", "quality", "tracks",
+		"metadata_source", "release_mbid", "match_similarity", "destination", "journal_id", "seconds"}
+	for _, s := range builtinStages() {
+		header = append(header, s+"_seconds")
+	}
+	header = append(header, "errors")
+	cw.Write(header)
+
+	secs := func(f float64) string { return strconv.FormatFloat(f, 'f', 1, 64) }
+	for _, a := range r.Albums {
+		row := []string{a.Name, a.Status, a.FatalStep, a.Artist, a.Album, a.Year, a.Quality, strconv.Itoa(a.Tracks),
+			a.MetaSource, a.ReleaseMBID, "", a.Destination, a.JournalID, secs(a.Seconds)}
+		if a.Similarity > 0 {
+			row[10] = strconv.FormatFloat(a.Similarity, 'f', 1, 64)
+		}
+		for _, s := range builtinStages() {
+			if d, ok := a.Stages[s]; ok {
+				row = append(row, secs(d))
+			} else {
+				row = append(row, "")
+			}
+		}
+		var errs []string
+		for _, s := range builtinStages() {
+			if e := a.Errors[s]; e != "" {
+				errs = append(errs, s+": "+e)
+			}
+		}
+		row = append(row, strings.Join(errs, "; "))
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// reportsDir returns REPORTS_DIR, where run reports are saved (default
+// DATA_DIR/reports).
+func reportsDir() string {
+	if d := os.Getenv("REPORTS_DIR"); d != "" {
+		return d
+	}
+	return filepath.Join(library.DataDir(), "reports")
+}
+
+// saveRunReport writes the session's report to REPORTS_DIR as
+// run-<start time>.json and .csv.
+func saveRunReport(s *Session) error {
+	r := NewRunReport(s)
+	dir := reportsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, "run-"+s.StartedAt.Format("20060102-150405"))
+	for ext, write := range map[string]func(io.Writer) error{".json": r.WriteJSON, ".csv": r.WriteCSV} {
+		f, err := os.Create(base + ext)
+		if err != nil {
+			return err
+		}
+		err = write(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", base+ext, err)
+		}
+	}
+	return nil
+}
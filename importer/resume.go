@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// resumableStages are the stages a re-run of a partly imported album skips
+// once they completed: each is slow and leaves its work in the folder
+// (lyrics files, ReplayGain and analysis tags). The other stages are cheap
+// or feed later ones, and always run; the cover stage does not re-embed art
+// a track already has.
+var resumableStages = []string{"lyrics", "replaygain", "analysis"}
+
+// stageResumeEnabled reports whether completed stages are skipped on
+// re-runs; STAGE_RESUME=false always runs every stage.
+func stageResumeEnabled() bool {
+	return os.Getenv("STAGE_RESUME") != "false"
+}
+
+// tracksFingerprint identifies the album's set of tracks, so a stage marker
+// stops counting once tracks are added, removed or renamed.
+func tracksFingerprint(tracks []string) string {
+	names := make([]string, len(tracks))
+	for i, t := range tracks {
+		names[i] = filepath.Base(t)
+	}
+	slices.Sort(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// stageDone reports whether an earlier run completed stage on this album
+// with the same tracks.
+func (a *AlbumRun) stageDone(stage string) bool {
+	if !stageResumeEnabled() || !slices.Contains(resumableStages, stage) {
+		return false
+	}
+	st, err := LoadAlbumState(a.Result.Path)
+	return err == nil && st.Stages[stage] != "" && st.Stages[stage] == tracksFingerprint(a.Tracks)
+}
+
+// markStageDone records in the album's state file that stage completed,
+// unless it was skipped, failed or left work for later (deferred).
+func (a *AlbumRun) markStageDone(stage string, deferred int) {
+	if !stageResumeEnabled() || !slices.Contains(resumableStages, stage) || len(a.Deferred) > deferred {
+		return
+	}
+	if s := a.Result.stepStatus(stage); s == nil || s.Skipped || s.Failed() {
+		return
+	}
+	st, err := LoadAlbumState(a.Result.Path)
+	if err != nil {
+		return
+	}
+	if st.Stages == nil {
+		st.Stages = map[string]string{}
+	}
+	st.Stages[stage] = tracksFingerprint(a.Tracks)
+	if err := SaveAlbumState(a.Result.Path, st); err != nil {
+		a.Logf(fmt.Sprintf("Could not record %s as done: %v", stage, err))
+	}
+}
@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// RetagMove is one file a retag moves or renames, relative to LIBRARY_DIR.
+type RetagMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RetagPlan is where a retag puts a library album's files.
+type RetagPlan struct {
+	Dir    string      `json:"dir"`     // current album directory
+	NewDir string      `json:"new_dir"` // rendered album directory
+	Moves  []RetagMove `json:"moves,omitempty"`
+}
+
+// PlanRetag renders the library paths of an album from the tags it carries
+// now, under the current templates, alias map and sanitizing rules, without
+// changing anything. A retag that resolves metadata again may move the
+// album further if the lookup changes its tags.
+func PlanRetag(libraryDir string, e *library.JournalEntry) (*RetagPlan, error) {
+	dir := filepath.Join(libraryDir, e.Dir)
+	tracks, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no audio files in %s", dir)
+	}
+	md, err := metadata.ReadTags(tracks[0])
+	if err != nil {
+		return nil, err
+	}
+	metadata.AttachQuality(md, tracks[0])
+	return planRetag(libraryDir, dir, tracks, md), nil
+}
+
+// planRetag lists the album's tracks, lyrics and cover with their rendered
+// library paths, leaving out files already in place.
+func planRetag(libraryDir, dir string, tracks []string, md *metadata.MusicMetadata) *RetagPlan {
+	rel := func(p string) string {
+		r, _ := filepath.Rel(libraryDir, p)
+		return r
+	}
+	plan := &RetagPlan{Dir: rel(dir), NewDir: rel(library.AlbumTargetDir(libraryDir, md))}
+	files := append([]string{}, tracks...)
+	lyrics, _ := metadata.LyricFiles(dir)
+	files = append(files, lyrics...)
+	if cover, err := metadata.FindCoverImage(dir); err == nil {
+		files = append(files, cover)
+	}
+	names := library.TrackFileNames(md, tracks, lyrics)
+	for _, f := range files {
+		if dst := library.LibraryFilePath(libraryDir, md, metadata.FirstNonEmpty(names[f], f)); dst != f {
+			plan.Moves = append(plan.Moves, RetagMove{From: rel(f), To: rel(dst)})
+		}
+	}
+	return plan
+}
+
+// RetagAlbum reapplies the metadata rules to a library album: unless
+// fileTags is set it resolves the album's metadata again, then rewrites the
+// derived tags (featuring credits, release and classical tags), moves and
+// renames its files to the paths the current templates and alias map render,
+// and replaces its journal entry. fileTags keeps the tags as they are and
+// only re-renders paths. It returns what was moved. When it fails after
+// touching files, the journal entry's checksums are refreshed so scrub does
+// not flag the rewritten tracks.
+func RetagAlbum(libraryDir string, e *library.JournalEntry, fileTags bool, logf func(string)) (plan *RetagPlan, err error) {
+	dir := filepath.Join(libraryDir, e.Dir)
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rerr := library.RefreshJournalFiles(libraryDir, e.Dir); rerr != nil && !os.IsNotExist(rerr) {
+			logf(fmt.Sprintf("Could not refresh journal checksums: %v", rerr))
+		}
+	}()
+	tracks, err := metadata.AudioFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no audio files in %s", dir)
+	}
+
+	var md *metadata.MusicMetadata
+	var match *metadata.Match
+	src := e.Source
+	if fileTags {
+		if md, err = metadata.ReadTags(tracks[0]); err != nil {
+			return nil, err
+		}
+		metadata.AttachQuality(md, tracks[0])
+	} else if md, src, match, err = getAlbumMetadata(dir, tracks[0], ""); err != nil {
+		return nil, err
+	}
+	writeTagRules(dir, tracks, md, match, logf)
+
+	plan = planRetag(libraryDir, dir, tracks, md)
+	// A taken target stops the retag before anything moves; other move
+	// errors leave the album partly moved, so its new place is recorded.
+	moveErr := applyRetagPlan(libraryDir, plan)
+	if errors.Is(moveErr, errRetagTargetTaken) {
+		return plan, moveErr
+	}
+
+	newDir := filepath.Join(libraryDir, plan.NewDir)
+	if err := refreshAlbumPlaylist(newDir, md); err != nil {
+		logf(fmt.Sprintf("Could not rewrite album playlist: %v", err))
+	}
+	if err := refreshNFOs(libraryDir, newDir, md); err != nil {
+		logf(fmt.Sprintf("Could not rewrite album.nfo: %v", err))
+	}
+	if _, err := library.RecordImport(libraryDir, newDir, md, src, nil, e.Degraded); err != nil {
+		return plan, errors.Join(moveErr, fmt.Errorf("recording retag: %w", err))
+	}
+	return plan, errors.Join(moveErr, library.RemoveJournalEntry(e.ID))
+}
+
+// errRetagTargetTaken means a retag's move target already exists.
+var errRetagTargetTaken = errors.New("already exists")
+
+// applyRetagPlan moves the planned files, refusing up front if any target is
+// taken, so an album is never left half-merged into another. Other files in
+// the old directory follow the album into the new one.
+func applyRetagPlan(libraryDir string, plan *RetagPlan) error {
+	for _, m := range plan.Moves {
+		dst, err := os.Stat(filepath.Join(libraryDir, m.To))
+		if err != nil {
+			continue
+		}
+		// A case-only rename on a case-insensitive filesystem finds itself.
+		if src, err := os.Stat(filepath.Join(libraryDir, m.From)); err != nil || !os.SameFile(src, dst) {
+			return fmt.Errorf("tags rewritten, but not moved: %s %w", m.To, errRetagTargetTaken)
+		}
+	}
+	var errs []error
+	for _, m := range plan.Moves {
+		dst := filepath.Join(libraryDir, m.To)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(libraryDir, m.From), dst); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := library.ApplyLibraryPermissions(libraryDir, dst); err != nil {
+			fmt.Println("Warning: could not set permissions:", err)
+		}
+	}
+	if plan.NewDir == plan.Dir {
+		return errors.Join(errs...)
+	}
+
+	oldDir := filepath.Join(libraryDir, plan.Dir)
+	rest, _ := os.ReadDir(oldDir)
+	newDir := filepath.Join(libraryDir, plan.NewDir)
+	for _, f := range rest {
+		src := filepath.Join(oldDir, f.Name())
+		if src == newDir || strings.HasPrefix(newDir, src+string(filepath.Separator)) {
+			continue
+		}
+		dst := filepath.Join(newDir, f.Name())
+		if _, err := os.Stat(dst); err == nil {
+			errs = append(errs, fmt.Errorf("left %s behind: %s already exists", f.Name(), dst))
+			continue
+		}
+		if err := os.Rename(src, dst); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	library.RemoveEmptyParents(oldDir, libraryDir)
+	return errors.Join(errs...)
+}
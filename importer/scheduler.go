@@ -0,0 +1,220 @@
+package importer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute, hour, day of
+// month, month, day of week), or a fixed interval for "@every".
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	domAny, dowAny                bool
+	every                         time.Duration
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a standard cron expression such as "*/30 * * * *", one of
+// the @hourly/@daily/... macros, or "@every 45m".
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("invalid interval %q (minimum 1m)", rest)
+		}
+		return &cronSchedule{every: d}, nil
+	}
+	if m, ok := cronMacros[expr]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	s := &cronSchedule{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if s.dow[7] {
+		s.dow[0] = true // 7 is Sunday too
+	}
+	return s, nil
+}
+
+// parseCronField expands a comma-separated list of "*", "n", "a-b" and their
+// "/step" forms into the set of matching values.
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var errA, errB error
+			lo, errA = strconv.Atoi(a)
+			hi, errB = strconv.Atoi(b)
+			if errA != nil || errB != nil || lo > hi {
+				return nil, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", rng)
+			}
+			lo, hi = n, n
+			if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max {
+			return nil, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time strictly after t that matches the schedule.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Four years covers every valid combination, including Feb 29.
+	for limit := t.AddDate(4, 0, 0); t.Before(limit); {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches applies cron's rule that when both day fields are restricted a
+// day matching either one is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+var (
+	scheduleMu  sync.Mutex
+	nextRunTime time.Time
+)
+
+// NextScheduledRun returns when the scheduler will next start an import, or
+// the zero time if IMPORT_SCHEDULE is unset.
+func NextScheduledRun() time.Time {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	return nextRunTime
+}
+
+// StartScheduler starts a background import job on the IMPORT_SCHEDULE cron
+// schedule. A tick is skipped when an import is already running or the queue
+// is paused.
+func StartScheduler() {
+	expr := os.Getenv("IMPORT_SCHEDULE")
+	if expr == "" {
+		return
+	}
+	sched, err := parseCron(expr)
+	if err != nil {
+		log.Printf("[scheduler] invalid IMPORT_SCHEDULE %q: %v; scheduled imports disabled", expr, err)
+		return
+	}
+
+	go func() {
+		for {
+			next := sched.next(time.Now())
+			if next.IsZero() {
+				log.Printf("[scheduler] %q never matches; scheduled imports disabled", expr)
+				return
+			}
+			scheduleMu.Lock()
+			nextRunTime = next
+			scheduleMu.Unlock()
+
+			time.Sleep(time.Until(next))
+
+			if paused, reason := ImportsPaused(); paused {
+				log.Printf("[scheduler] skipping run: queue paused (%s)", reason)
+				continue
+			}
+			job, err := StartJob(nil)
+			if err != nil {
+				log.Printf("[scheduler] skipping run: %v", err)
+				continue
+			}
+			log.Printf("[scheduler] started import job %s", job.ID)
+		}
+	}()
+	log.Printf("[scheduler] started with schedule %q", expr)
+}
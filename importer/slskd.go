@@ -1,4 +1,4 @@
-package main
+package importer
 
 import (
 	"bytes"
@@ -9,8 +9,11 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/gabehf/music-import/metadata"
 )
 
 // slskdAttr is a Soulseek file attribute (bitrate, sample rate, bit depth, etc.).
@@ -263,7 +266,7 @@ func groupAlbumFolders(responses []slskdPeerResponse) []albumFolder {
 			if ext == "." || ext == "" {
 				ext = strings.ToLower(path.Ext(strings.ReplaceAll(f.Filename, "\\", "/")))
 			}
-			if ext != ".flac" && ext != ".mp3" {
+			if !slices.Contains(metadata.AudioExtensions(), ext) {
 				continue
 			}
 
@@ -381,13 +384,13 @@ func getSlskdTransfers(username string) ([]slskdTransferDir, error) {
 	return ut.Directories, nil
 }
 
-// fetchRelease searches slskd for an album, queues the best-quality match for
+// FetchRelease searches slskd for an album, queues the best-quality match for
 // download, and returns the chosen folder so the caller can monitor completion.
 // mbid, if non-empty, will be stored for use during import (beets --search-id).
 // trackCount, if > 0, filters candidate folders to those whose audio file count
 // matches the expected number of tracks on the release, so alternate editions
 // with different track counts are not accidentally selected.
-func fetchRelease(artist, album, mbid string, trackCount int, logf func(string)) (*albumFolder, error) {
+func FetchRelease(artist, album, mbid string, trackCount int, logf func(string)) (*albumFolder, error) {
 	query := artist + " " + album
 	log.Printf("[discover] fetch started: %q by %s (expected tracks: %d)", album, artist, trackCount)
 	logf("Starting fetch for: " + query)
@@ -0,0 +1,274 @@
+package importer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/tools"
+)
+
+// spectrogramFile is the spectrogram of a suspected lossy-sourced FLAC,
+// saved in the album folder for review. It is never moved into the library.
+const spectrogramFile = ".spectrogram.png"
+
+const (
+	spectralExcerpt = 30   // seconds of each track analysed, from its middle
+	spectralFFTSize = 4096 // samples per FFT frame
+	spectralBand    = 250  // Hz per band of the smoothed spectrum
+)
+
+// spectralMinCutoff returns SPECTRAL_MIN_CUTOFF (Hz, default 19000): a FLAC
+// whose spectrum stops dead below it looks transcoded from a lossy file.
+// MP3 encoders cut at roughly 16 kHz at 128 kbps and 19–20 kHz at 320 kbps.
+func spectralMinCutoff() float64 {
+	if n, err := strconv.Atoi(os.Getenv("SPECTRAL_MIN_CUTOFF")); err == nil && n > 0 {
+		return float64(n)
+	}
+	return 19000
+}
+
+// SpectralResult is the spectral check of one FLAC track.
+type SpectralResult struct {
+	Track   string  `json:"track"`
+	Cutoff  float64 `json:"cutoff_hz"` // highest frequency with real content
+	Nyquist float64 `json:"nyquist_hz"`
+	Suspect bool    `json:"suspect"`
+}
+
+// SpectralVerdict is kept in the album state of a suspect album, so the
+// review queue can show why it is there.
+type SpectralVerdict struct {
+	Tracks []SpectralResult `json:"tracks"`
+}
+
+// Summary describes the verdict in one line, e.g. "8/10 tracks cut off at
+// ~16.0 kHz".
+func (v *SpectralVerdict) Summary() string {
+	n, lowest := 0, math.Inf(1)
+	for _, t := range v.Tracks {
+		if t.Suspect {
+			n++
+			lowest = math.Min(lowest, t.Cutoff)
+		}
+	}
+	return fmt.Sprintf("%d/%d tracks cut off at ~%.1f kHz", n, len(v.Tracks), lowest/1000)
+}
+
+// decodeExcerpt decodes spectralExcerpt seconds from the middle of a track
+// as mono float samples at its own sample rate.
+func decodeExcerpt(path string) ([]float64, error) {
+	start := 0
+	if d, err := TrackDuration(path); err == nil && d > spectralExcerpt {
+		start = (d - spectralExcerpt) / 2
+	}
+	out, err := tools.Output("ffmpeg", "-v", "error", "-ss", strconv.Itoa(start), "-t", strconv.Itoa(spectralExcerpt),
+		"-i", path, "-map", "0:a:0", "-ac", "1", "-f", "f32le", "-")
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]float64, len(out)/4)
+	for i := range samples {
+		samples[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(out[i*4:])))
+	}
+	return samples, nil
+}
+
+// fft transforms x in place; len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// bandLevels averages the power spectrum of samples over Hann-windowed
+// frames and returns it in dB per spectralBand-wide band.
+func bandLevels(samples []float64, rate int) []float64 {
+	power := make([]float64, spectralFFTSize/2)
+	frame := make([]complex128, spectralFFTSize)
+	frames := 0
+	for off := 0; off+spectralFFTSize <= len(samples); off += spectralFFTSize {
+		for i := range frame {
+			w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(spectralFFTSize-1))
+			frame[i] = complex(samples[off+i]*w, 0)
+		}
+		fft(frame)
+		for i := range power {
+			power[i] += real(frame[i])*real(frame[i]) + imag(frame[i])*imag(frame[i])
+		}
+		frames++
+	}
+	if frames == 0 {
+		return nil
+	}
+	binHz := float64(rate) / spectralFFTSize
+	bands := make([]float64, int(float64(rate)/2/spectralBand))
+	counts := make([]int, len(bands))
+	for i, p := range power {
+		if b := int(float64(i) * binHz / spectralBand); b < len(bands) {
+			bands[b] += p / float64(frames)
+			counts[b]++
+		}
+	}
+	for b := range bands {
+		bands[b] = 10 * math.Log10(bands[b]/float64(max(counts[b], 1))+1e-20)
+	}
+	return bands
+}
+
+// spectralCutoff finds where a spectrum stops: the highest band within 60 dB
+// of the 250 Hz–4 kHz level. It reports whether the spectrum falls off a
+// cliff there (at least 25 dB lower just above than just below), the mark
+// of an encoder's lowpass rather than a recording's natural roll-off.
+func spectralCutoff(bands []float64) (cutoff float64, cliff bool) {
+	lo, hi := 250/spectralBand, 4000/spectralBand
+	if len(bands) <= hi {
+		return 0, false
+	}
+	ref := 0.0
+	for _, l := range bands[lo:hi] {
+		ref += l
+	}
+	ref /= float64(hi - lo)
+
+	top := len(bands) - 1
+	for top > hi && bands[top] < ref-60 {
+		top--
+	}
+	cutoff = float64(top+1) * spectralBand
+	if top+3 >= len(bands) {
+		return cutoff, false // content up to Nyquist
+	}
+	below := (bands[top] + bands[top-1] + bands[top-2]) / 3
+	above := (bands[top+1] + bands[top+2] + bands[top+3]) / 3
+	return cutoff, below-above >= 25
+}
+
+// analyseSpectrum checks one FLAC track for a lossy encoder's lowpass.
+func analyseSpectrum(path string) (SpectralResult, error) {
+	rate, err := sampleRate(path)
+	if err != nil {
+		return SpectralResult{}, err
+	}
+	samples, err := decodeExcerpt(path)
+	if err != nil {
+		return SpectralResult{}, err
+	}
+	bands := bandLevels(samples, rate)
+	if bands == nil {
+		return SpectralResult{}, errors.New("too short to analyse")
+	}
+	cutoff, cliff := spectralCutoff(bands)
+	nyquist := float64(rate) / 2
+	return SpectralResult{
+		Track:   filepath.Base(path),
+		Cutoff:  cutoff,
+		Nyquist: nyquist,
+		Suspect: cliff && cutoff < math.Min(spectralMinCutoff(), 0.9*nyquist),
+	}, nil
+}
+
+// saveSpectrogram renders the analysed excerpt of a track with ffmpeg's
+// showspectrumpic into the album folder.
+func saveSpectrogram(albumPath, track string) error {
+	start := 0
+	if d, err := TrackDuration(track); err == nil && d > spectralExcerpt {
+		start = (d - spectralExcerpt) / 2
+	}
+	_, err := tools.Output("ffmpeg", "-v", "error", "-y", "-ss", strconv.Itoa(start), "-t", strconv.Itoa(spectralExcerpt),
+		"-i", track, "-map", "0:a:0", "-lavfi", "showspectrumpic=s=1200x600:legend=1", "-frames:v", "1",
+		filepath.Join(albumPath, spectrogramFile))
+	return err
+}
+
+// spectralStage flags FLAC albums that look transcoded from MP3 or another
+// lossy format: more than half of the FLAC tracks have a hard frequency
+// cutoff below SPECTRAL_MIN_CUTOFF. It is not in the default pipeline; add
+// "spectral" to PIPELINE_STAGES (first, so nothing is changed before the
+// check). A suspect album gets a spectrogram and, when
+// SPECTRAL_REVIEW_FOLDER names an import folder, is moved there to wait for
+// review; otherwise, or once picked from that folder, it is imported with a
+// warning.
+func spectralStage(a *AlbumRun) error {
+	var flacs []string
+	for _, t := range a.Tracks {
+		if strings.EqualFold(filepath.Ext(t), ".flac") {
+			flacs = append(flacs, t)
+		}
+	}
+	if len(flacs) == 0 {
+		a.Result.Spectral.Skipped = true
+		return nil
+	}
+
+	a.Logf("Checking FLAC spectra for lossy sources")
+	verdict := &SpectralVerdict{}
+	suspects := 0
+	var first string
+	for _, t := range flacs {
+		r, err := analyseSpectrum(t)
+		if err != nil {
+			a.Logf(fmt.Sprintf("Spectral check of %s: %v", filepath.Base(t), err))
+			continue
+		}
+		verdict.Tracks = append(verdict.Tracks, r)
+		if r.Suspect {
+			suspects++
+			if first == "" {
+				first = t
+			}
+		}
+	}
+	if suspects*2 <= len(verdict.Tracks) {
+		return nil
+	}
+
+	albumPath := a.Result.Path
+	a.Result.Spectral.Err = fmt.Errorf("suspected lossy source: %s", verdict.Summary())
+	a.Logf(a.Result.Spectral.Err.Error())
+	if err := saveSpectrogram(albumPath, first); err != nil {
+		a.Logf(fmt.Sprintf("Could not save spectrogram: %v", err))
+	}
+	if st, err := LoadAlbumState(albumPath); err == nil {
+		st.Spectral = verdict
+		if err := SaveAlbumState(albumPath, st); err != nil {
+			a.Logf(fmt.Sprintf("Could not save spectral verdict: %v", err))
+		}
+	}
+	return sendToReview(a, "SPECTRAL_REVIEW_FOLDER", &a.Result.Spectral)
+}
+
+// SpectrogramPath returns the spectrogram saved for a suspect album folder,
+// or "" when it has none.
+func SpectrogramPath(albumPath string) string {
+	p := filepath.Join(albumPath, spectrogramFile)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// ProviderStats counts how often a metadata provider was tried and how often
+// it produced the match.
+type ProviderStats struct {
+	Attempts int `json:"attempts"`
+	Hits     int `json:"hits"`
+}
+
+var providerStatsMu sync.Mutex
+
+func providerStatsPath() string {
+	return filepath.Join(library.DataDir(), "provider-stats.json")
+}
+
+// loadProviderStatsLocked reads the counters. providerStatsMu must be held.
+func loadProviderStatsLocked() (map[metadata.Source]*ProviderStats, error) {
+	stats := map[metadata.Source]*ProviderStats{}
+	data, err := os.ReadFile(providerStatsPath())
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stats, json.Unmarshal(data, &stats)
+}
+
+// recordProviderAttempt counts one attempt by a provider in the metadata
+// chain and whether it matched. Failures to persist are only logged.
+func recordProviderAttempt(src metadata.Source, hit bool) {
+	providerStatsMu.Lock()
+	defer providerStatsMu.Unlock()
+
+	stats, err := loadProviderStatsLocked()
+	if err != nil {
+		log.Println("[stats] could not read provider stats:", err)
+		return
+	}
+	s := stats[src]
+	if s == nil {
+		s = &ProviderStats{}
+		stats[src] = s
+	}
+	s.Attempts++
+	if hit {
+		s.Hits++
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(library.DataDir(), 0755)
+	}
+	if err == nil {
+		tmp := providerStatsPath() + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, providerStatsPath())
+		}
+	}
+	if err != nil {
+		log.Println("[stats] could not save provider stats:", err)
+	}
+}
+
+// importStats is the match-source breakdown served by /api/stats.
+type importStats struct {
+	Albums    int                                `json:"albums"`
+	BySource  map[metadata.Source]int            `json:"by_source"` // final match source of every album in the journal
+	Providers map[metadata.Source]*ProviderStats `json:"providers"` // attempts and hits per provider
+}
+
+func CollectImportStats() (*importStats, error) {
+	entries, err := library.JournalEntries()
+	if err != nil {
+		return nil, err
+	}
+	st := &importStats{Albums: len(entries), BySource: map[metadata.Source]int{}}
+	for _, e := range entries {
+		src := e.Source
+		if src == metadata.SourceUnknown {
+			src = "unknown"
+		}
+		st.BySource[src]++
+	}
+
+	providerStatsMu.Lock()
+	st.Providers, err = loadProviderStatsLocked()
+	providerStatsMu.Unlock()
+	return st, err
+}
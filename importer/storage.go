@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// storageProblem classifies err as a full or read-only filesystem and returns
+// the pause reason shown in the UI, or "" for any other error.
+func storageProblem(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, syscall.ENOSPC):
+		return "library filesystem full"
+	case errors.Is(err, syscall.EROFS):
+		return "library filesystem read-only"
+	}
+	return ""
+}
+
+// checkLibraryWritable probes libraryDir by creating and removing a small file.
+func checkLibraryWritable(libraryDir string) error {
+	if err := os.MkdirAll(libraryDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(libraryDir, ".write-probe-*")
+	if err != nil {
+		return err
+	}
+	_, werr := f.Write([]byte("probe"))
+	cerr := f.Close()
+	os.Remove(f.Name())
+	if werr != nil {
+		return werr
+	}
+	return cerr
+}
+
+// pauseForStorage pauses the import queue with reason and blocks until it is
+// resumed, either by the user or by watchStorage once the library is writable.
+func pauseForStorage(libraryDir, reason string, logf func(string)) {
+	if p, r := ImportsPaused(); !p || r != reason {
+		PauseImports(reason)
+		go watchStorage(libraryDir, reason)
+	}
+	waitIfPaused(logf)
+}
+
+// watchStorage probes the library every 30 s while the queue is paused for
+// reason, and resumes it as soon as a write succeeds. It exits early if the
+// queue is resumed manually or paused for a different reason.
+func watchStorage(libraryDir, reason string) {
+	for {
+		time.Sleep(30 * time.Second)
+		if p, r := ImportsPaused(); !p || r != reason {
+			return
+		}
+		if storageProblem(checkLibraryWritable(libraryDir)) == "" {
+			ResumeImports()
+			return
+		}
+	}
+}
+
+// ensureLibraryWritable is called before an album is moved. If the library
+// filesystem is full or read-only it pauses the queue until the condition
+// clears, instead of letting every remaining album fail in turn.
+func ensureLibraryWritable(libraryDir string, logf func(string)) {
+	for {
+		reason := storageProblem(checkLibraryWritable(libraryDir))
+		if reason == "" {
+			return
+		}
+		logf("Cannot write to library: " + reason)
+		pauseForStorage(libraryDir, reason, logf)
+	}
+}
+
+// checkMoveSpace fails an album's move up front when copying its files into
+// the library would not leave DISK_SPACE_MARGIN_MB free, rather than
+// leaving it half moved. Renames within one filesystem take no space and
+// are not checked.
+func checkMoveSpace(libraryDir, albumPath string, files []string) error {
+	copyMode := strings.ToLower(os.Getenv("COPYMODE")) == "true"
+	if !copyMode && library.SameFilesystem(albumPath, libraryDir) {
+		return nil
+	}
+	return library.CheckFreeSpace(libraryDir, library.FilesSize(files))
+}
+
+// moveToLibraryRetrying wraps moveToLibrary, pausing and retrying the file
+// when the move fails because the library filesystem is full or read-only.
+// Any other error is returned as-is.
+func moveToLibraryRetrying(libDir string, md *metadata.MusicMetadata, srcPath, name string, logf func(string)) error {
+	for {
+		err := library.MoveToLibrary(libDir, md, srcPath, name)
+		reason := storageProblem(err)
+		if reason == "" {
+			return err
+		}
+		logf(fmt.Sprintf("Move of %s failed (%s); pausing until the library is writable", srcPath, reason))
+		pauseForStorage(libDir, reason, logf)
+	}
+}
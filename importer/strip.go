@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// stripCategories returns STRIP_TAGS, the comma-separated kinds of tag the
+// strip stage removes (see metadata.StripCategories), or all of them when
+// unset. Unknown names are ignored.
+func stripCategories() []string {
+	raw := os.Getenv("STRIP_TAGS")
+	if raw == "" {
+		return metadata.StripCategories
+	}
+	var out []string
+	for _, c := range strings.Split(raw, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if slices.Contains(metadata.StripCategories, c) {
+			out = append(out, c)
+		} else if c != "" {
+			fmt.Println("→ STRIP_TAGS: unknown category", c)
+		}
+	}
+	return out
+}
+
+// stripStage scrubs tags that don't belong in the library from each track:
+// comments, encoder and ripper signatures, URLs, private ID3 frames, and
+// ID3v1 and APEv2 tags left on MP3s. It is not in the default pipeline; add
+// "strip" to PIPELINE_STAGES (after "clean", before "metadata"). STRIP_TAGS
+// narrows what is removed.
+func stripStage(a *AlbumRun) error {
+	categories := stripCategories()
+	if len(categories) == 0 {
+		a.Result.Strip.Skipped = true
+		return nil
+	}
+	if hasFLAC(a.Tracks) && a.Caps.degrade(&a.Result.Degraded, featureTagCleanup) {
+		a.Logf("Skipping tag stripping: " + a.Caps.missing[featureTagCleanup])
+		a.Result.Strip.Skipped = true
+		return nil
+	}
+
+	a.Logf("Stripping " + strings.Join(categories, ", ") + " tags")
+	var errs []error
+	for _, t := range a.Tracks {
+		removed, err := metadata.StripTags(t, categories)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", filepath.Base(t), err))
+		}
+		if len(removed) > 0 {
+			a.Logf(fmt.Sprintf("%s: removed %s", filepath.Base(t), strings.Join(removed, ", ")))
+		}
+	}
+	a.Result.Strip.Err = errors.Join(errs...)
+	if a.Result.Strip.Failed() {
+		a.Logf(fmt.Sprintf("Tag stripping failed: %v", a.Result.Strip.Err))
+	}
+	return nil
+}
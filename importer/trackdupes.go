@@ -0,0 +1,120 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// trackDedupeEnabled reports whether DEDUPE_TRACKS is on (the default).
+func trackDedupeEnabled() bool {
+	return os.Getenv("DEDUPE_TRACKS") != "false"
+}
+
+// copySuffix matches the suffix file managers and download clients add to
+// a second copy: "01 Track (1)", "01 Track - Copy", "01 Track copy 2".
+var copySuffix = regexp.MustCompile(`(?i)(\s*\(\d{1,2}\)|\s*-?\s*copy(\s*\d+)?)$`)
+
+// albumTrack is what in-album duplicate detection compares.
+type albumTrack struct {
+	path     string
+	disc     int
+	track    int
+	title    string
+	duration int
+	rank     int // qualityRank of the file
+	copy     bool
+	size     int64
+	sum      string
+}
+
+func readAlbumTrack(path string) albumTrack {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	t := albumTrack{path: path, copy: copySuffix.MatchString(stem)}
+	tags, _ := metadata.ReadTrackTags(path)
+	t.disc, t.track = tags.Disc, tags.Track
+	t.title = dupKey(metadata.FirstNonEmpty(tags.Title, strings.TrimLeft(copySuffix.ReplaceAllString(stem, ""), "0123456789 .-_")))
+	t.duration, _ = TrackDuration(path)
+	if q, err := metadata.AudioQuality(path); err == nil {
+		t.rank = qualityRank(q)
+	}
+	if info, err := os.Stat(path); err == nil {
+		t.size = info.Size()
+	}
+	t.sum, _ = library.FileSHA256(path)
+	return t
+}
+
+// sameTrack reports whether two files of an album are copies of one track:
+// byte-identical, or with the same disc, track number and title and
+// durations within a second.
+func sameTrack(a, b albumTrack) bool {
+	if a.sum != "" && a.sum == b.sum {
+		return true
+	}
+	d := a.duration - b.duration
+	return a.track > 0 && a.track == b.track && a.disc == b.disc && a.title != "" && a.title == b.title &&
+		a.duration > 0 && d >= -1 && d <= 1
+}
+
+// better reports whether a is the copy to keep over b: higher quality,
+// then not named as a copy, then the larger file.
+func (a albumTrack) better(b albumTrack) bool {
+	switch {
+	case a.rank != b.rank:
+		return a.rank > b.rank
+	case a.copy != b.copy:
+		return !a.copy
+	}
+	return a.size > b.size
+}
+
+// dedupeTracks finds tracks that are in the album folder twice ("01 Track.flac"
+// and "01 Track (1).flac"), trashes all but the best copy of each with its
+// lyrics, and drops them from a.Tracks. What it dropped is recorded in
+// a.Result.Duplicates.
+func dedupeTracks(a *AlbumRun) error {
+	tracks := make([]albumTrack, len(a.Tracks))
+	for i, p := range a.Tracks {
+		tracks[i] = readAlbumTrack(p)
+	}
+	var drop []string
+	for i := range tracks {
+		for j := i + 1; j < len(tracks); j++ {
+			if slices.Contains(drop, tracks[i].path) || slices.Contains(drop, tracks[j].path) || !sameTrack(tracks[i], tracks[j]) {
+				continue
+			}
+			keep, lose := tracks[i], tracks[j]
+			if lose.better(keep) {
+				keep, lose = lose, keep
+			}
+			drop = append(drop, lose.path)
+			a.Result.Duplicates = append(a.Result.Duplicates,
+				fmt.Sprintf("%s (copy of %s)", filepath.Base(lose.path), filepath.Base(keep.path)))
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	a.Logf(fmt.Sprintf("Dropping %d duplicate track(s)", len(drop)))
+	var err error
+	for _, p := range drop {
+		fmt.Println("→ Deleting duplicate track:", p)
+		if _, e := library.MoveToTrash(p, "duplicate track", nil); e != nil && err == nil {
+			err = e
+		}
+		library.MoveToTrash(strings.TrimSuffix(p, filepath.Ext(p))+".lrc", "duplicate track lyrics", nil)
+	}
+	a.Tracks = slices.DeleteFunc(a.Tracks, func(t string) bool { return slices.Contains(drop, t) })
+	a.Result.TrackCount = len(a.Tracks)
+	for _, d := range a.Result.Duplicates {
+		a.Logf("Dropped " + d)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// UploadExts are the file types besides audio (see UploadAccepts) accepted
+// by /api/upload.
+var UploadExts = map[string]bool{
+	".lrc": true, ".jpg": true, ".jpeg": true, ".png": true,
+}
+
+// UploadAccepts reports whether /api/upload takes a file named name, on its
+// own or inside a zip: tracks with one of AUDIO_EXTENSIONS and UploadExts.
+func UploadAccepts(name string) bool {
+	return metadata.IsAudioFile(name) || UploadExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// UploadStagingPrefix marks folders in IMPORT_DIR that are still being
+// uploaded; scans and imports skip them (see isHiddenEntry).
+const UploadStagingPrefix = ".upload-"
+
+// UploadMaxBytes returns the request size limit from UPLOAD_MAX_MB (default
+// 4096).
+func UploadMaxBytes() int64 {
+	mb := int64(4096)
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_MB"), 10, 64); err == nil && v > 0 {
+		mb = v
+	}
+	return mb << 20
+}
+
+// isHiddenEntry reports whether a name in IMPORT_DIR should be ignored, such
+// as an upload still in progress.
+func isHiddenEntry(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// UniqueDir returns dir, or dir with a " (n)" suffix if it already exists.
+func UniqueDir(dir string) string {
+	p := dir
+	for n := 2; ; n++ {
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p
+		}
+		p = fmt.Sprintf("%s (%d)", dir, n)
+	}
+}
+
+// UniqueFile returns a path for name within dir that does not exist yet,
+// trying "<prefix> - name" and then numbered names on collisions.
+func UniqueFile(dir, name, prefix string) string {
+	p := filepath.Join(dir, name)
+	if _, err := os.Stat(p); err != nil {
+		return p
+	}
+	if prefix != "" {
+		name = library.Sanitize(prefix) + " - " + name
+		p = filepath.Join(dir, name)
+	}
+	ext := filepath.Ext(name)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(p); err != nil {
+			return p
+		}
+		p = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+	}
+}
+
+// errZipTooLarge means a zip expands past the limits of zipLimits.
+var errZipTooLarge = errors.New("zip expands beyond the upload limit")
+
+// zipLimits returns how large one extracted entry and a whole extracted
+// zip may be: UploadMaxBytes per file and twice that in total, enough for
+// audio, which barely compresses, but not for a zip bomb.
+func zipLimits() (entry, total int64) {
+	return UploadMaxBytes(), 2 * UploadMaxBytes()
+}
+
+// ExtractZip writes the accepted files in a zip archive into dir, flattening
+// any folders inside it. Other entries are skipped and counted. An archive
+// expanding beyond zipLimits is rejected and the files already written are
+// removed.
+func ExtractZip(zipPath, dir string) (written, skipped int, err error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading zip: %w", err)
+	}
+	defer zr.Close()
+
+	var created []string
+	defer func() {
+		if err != nil {
+			for _, p := range created {
+				os.Remove(p)
+			}
+		}
+	}()
+	maxEntry, remaining := zipLimits()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := filepath.Base(filepath.FromSlash(f.Name))
+		if strings.HasPrefix(name, ".") || !UploadAccepts(name) {
+			skipped++
+			continue
+		}
+		if f.UncompressedSize64 > uint64(min(maxEntry, remaining)) {
+			return written, skipped, fmt.Errorf("%s: %w", name, errZipTooLarge)
+		}
+		parent := filepath.Base(filepath.Dir(filepath.FromSlash(f.Name)))
+		if parent == "." {
+			parent = ""
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return written, skipped, err
+		}
+		dst := UniqueFile(dir, library.Sanitize(name), parent)
+		out, err := os.Create(dst)
+		if err == nil {
+			created = append(created, dst)
+			// The header's size can lie; never copy more than the limits allow.
+			limit := min(maxEntry, remaining)
+			var n int64
+			n, err = io.Copy(out, io.LimitReader(rc, limit+1))
+			if err == nil && n > limit {
+				err = fmt.Errorf("%s: %w", name, errZipTooLarge)
+			}
+			remaining -= n
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		rc.Close()
+		if err != nil {
+			return written, skipped, err
+		}
+		written++
+	}
+	return written, skipped, nil
+}
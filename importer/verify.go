@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// moveVerifier moves an album's files into the library, checksumming each
+// one on both sides when VERIFY_MOVES is on.
+type moveVerifier struct {
+	libDir string
+	md     *metadata.MusicMetadata
+	names  map[string]string // source path → library file name
+	logf   func(string)
+	result *library.MoveVerification
+}
+
+func newMoveVerifier(libDir string, md *metadata.MusicMetadata, names map[string]string, logf func(string)) *moveVerifier {
+	v := &moveVerifier{libDir: libDir, md: md, names: names, logf: logf}
+	if library.VerifyMovesEnabled() {
+		v.result = &library.MoveVerification{OK: true}
+	}
+	return v
+}
+
+// move moves srcPath into the library under its rendered name. A checksum
+// mismatch is returned as an error after the move, so the caller reports it
+// like any other move failure.
+func (v *moveVerifier) move(srcPath string) error {
+	name := v.names[srcPath]
+	if v.result == nil {
+		return moveToLibraryRetrying(v.libDir, v.md, srcPath, name, v.logf)
+	}
+
+	srcSum, err := library.FileSHA256(srcPath)
+	if err != nil {
+		return fmt.Errorf("checksumming source: %w", err)
+	}
+	if err := moveToLibraryRetrying(v.libDir, v.md, srcPath, name, v.logf); err != nil {
+		return err
+	}
+
+	dst := library.LibraryFilePath(v.libDir, v.md, metadata.FirstNonEmpty(name, srcPath))
+	dstSum, err := library.FileSHA256(dst)
+	if err != nil {
+		dstSum = ""
+	}
+	rel, _ := filepath.Rel(v.libDir, dst)
+	f := library.VerifiedFile{Path: rel, SourceSHA256: srcSum, DestSHA256: dstSum, OK: srcSum == dstSum}
+	v.result.Files = append(v.result.Files, f)
+	v.result.VerifiedAt = time.Now()
+	if !f.OK {
+		v.result.OK = false
+		return fmt.Errorf("checksum mismatch after moving %s", filepath.Base(srcPath))
+	}
+	return nil
+}
+
+// verification returns the album's verification record, or nil when
+// VERIFY_MOVES is off or nothing was moved.
+func (v *moveVerifier) verification() *library.MoveVerification {
+	if v.result == nil || len(v.result.Files) == 0 {
+		return nil
+	}
+	return v.result
+}
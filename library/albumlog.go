@@ -0,0 +1,86 @@
+package library
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// validLogID matches the IDs NewJournalID hands out, so a log ID from a
+// request can't name a file outside the log directory.
+var validLogID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+func albumLogDir() string {
+	return filepath.Join(DataDir(), "logs")
+}
+
+// AlbumLogPath returns where the log with the given ID is kept.
+func AlbumLogPath(id string) (string, error) {
+	if !validLogID.MatchString(id) {
+		return "", fmt.Errorf("invalid log ID %q", id)
+	}
+	return filepath.Join(albumLogDir(), id+".log"), nil
+}
+
+// albumLogKeep returns ALBUM_LOG_KEEP (default 500), how many album logs
+// are kept; older ones are deleted as new ones are saved.
+func albumLogKeep() int {
+	if n, err := strconv.Atoi(os.Getenv("ALBUM_LOG_KEEP")); err == nil && n > 0 {
+		return n
+	}
+	return 500
+}
+
+// SaveAlbumLog writes an album's import log and prunes the oldest logs
+// beyond ALBUM_LOG_KEEP.
+func SaveAlbumLog(id string, data []byte) error {
+	path, err := AlbumLogPath(id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(albumLogDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	entries, _ := os.ReadDir(albumLogDir())
+	if len(entries) <= albumLogKeep() {
+		return nil
+	}
+	type logFile struct {
+		path string
+		mod  int64
+	}
+	var logs []logFile
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			logs = append(logs, logFile{filepath.Join(albumLogDir(), e.Name()), info.ModTime().UnixNano()})
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].mod < logs[j].mod })
+	for _, l := range logs[:max(0, len(logs)-albumLogKeep())] {
+		os.Remove(l.path)
+	}
+	return nil
+}
+
+// SetJournalLog links a journal entry to its import log.
+func SetJournalLog(journalID, logID string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	for _, e := range journal {
+		if e.ID == journalID {
+			e.Log = logID
+			return saveJournalLocked()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	artistAliasOnce sync.Once
+	artistAliases   map[string]string
+)
+
+// sortArticles are the leading articles a sort name moves to the end.
+var sortArticles = []string{"the", "a", "an"}
+
+// artistAliasPath returns ARTIST_ALIASES, defaulting to
+// DATA_DIR/artist-aliases.txt.
+func artistAliasPath() string {
+	if p := os.Getenv("ARTIST_ALIASES"); p != "" {
+		return p
+	}
+	return filepath.Join(DataDir(), "artist-aliases.txt")
+}
+
+// artistAliasMap loads the "variant = Canonical Name" lines of the alias
+// file, keyed by artistKey so one line covers case and article variants.
+func artistAliasMap() map[string]string {
+	artistAliasOnce.Do(func() {
+		artistAliases = readNameMap(artistAliasPath(), artistKey)
+	})
+	return artistAliases
+}
+
+// unsortArticle turns a sort-form name like "Beatles, The" back into
+// "The Beatles". Other names are returned unchanged.
+func unsortArticle(name string) string {
+	i := strings.LastIndex(name, ",")
+	if i < 0 {
+		return name
+	}
+	article := strings.TrimSpace(name[i+1:])
+	for _, a := range sortArticles {
+		if strings.EqualFold(article, a) {
+			return article + " " + strings.TrimSpace(name[:i])
+		}
+	}
+	return name
+}
+
+// artistKey folds an artist name for comparison: NFC, lower case, single
+// spaces, and without a leading or sort-form trailing article, so "The
+// Beatles", "Beatles, The" and "beatles" share a key.
+func artistKey(name string) string {
+	s := strings.ToLower(norm.NFC.String(unsortArticle(strings.TrimSpace(name))))
+	s = strings.Join(strings.Fields(s), " ")
+	for _, a := range sortArticles {
+		if rest, ok := strings.CutPrefix(s, a+" "); ok {
+			return rest
+		}
+	}
+	return s
+}
+
+// CanonicalArtist returns the name an artist's library folder is built
+// from: the ARTIST_ALIASES entry for name (or, failing that, for its
+// MusicBrainz sort name) if there is one, otherwise name with a sort-form
+// article ("Beatles, The") moved back to the front.
+func CanonicalArtist(name, sortName string) string {
+	if name == "" {
+		return name
+	}
+	aliases := artistAliasMap()
+	if v, ok := aliases[artistKey(name)]; ok {
+		return v
+	}
+	if v, ok := aliases[artistKey(sortName)]; ok && sortName != "" {
+		return v
+	}
+	return unsortArticle(name)
+}
+
+// artistFolderMatchEnabled reports whether new artist folders are matched
+// against existing ones (ARTIST_FOLDER_MATCH, on unless "false").
+func artistFolderMatchEnabled() bool {
+	return strings.ToLower(os.Getenv("ARTIST_FOLDER_MATCH")) != "false"
+}
+
+// foldName folds a folder name for fuzzy matching: lower case, "&" and "+"
+// read as "and", punctuation dropped and spaces collapsed, so "Simon &
+// Garfunkel" and "simon and garfunkel!" compare equal.
+func foldName(name string) string {
+	s := strings.ToLower(norm.NFC.String(name))
+	s = strings.NewReplacer("&", " and ", "+", " and ").Replace(s)
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// matchExistingDirs rewrites rel (relative to libDir) so each directory that
+// doesn't exist under that spelling reuses an existing sibling: one
+// differing only in case first, then one that differs only in punctuation
+// and "&" versus "and" (see foldName). Artist components (keys of artists,
+// mapped to the artist's sort name) also match existing folders by
+// artistKey or sort name, so "Beatles" lands in an existing "The Beatles"
+// and "John Lennon" in "Lennon, John". It also returns the reuses that
+// changed more than case, as "new → existing".
+func matchExistingDirs(libDir, rel string, artists map[string]string) (string, []string) {
+	if !artistFolderMatchEnabled() || rel == "" {
+		return rel, nil
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	var fuzzy []string
+	dir := libDir
+	for i, p := range parts {
+		if _, err := os.Stat(filepath.Join(dir, p)); err == nil {
+			dir = filepath.Join(dir, p)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			break // nothing below exists either
+		}
+		sortName, isArtist := artists[p]
+		key := foldName(p)
+		if isArtist {
+			key = foldName(artistKey(p))
+		}
+		match, rank := "", 0
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			n := e.Name()
+			switch {
+			case strings.EqualFold(n, p):
+				match, rank = n, 3
+			case rank < 2 && isArtist && (artistKey(n) == artistKey(p) || sortName != "" && strings.EqualFold(n, sortName)):
+				match, rank = n, 2
+			case rank < 1 && key != "" && (isArtist && foldName(artistKey(n)) == key || !isArtist && foldName(n) == key):
+				match, rank = n, 1
+			}
+			if rank == 3 {
+				break
+			}
+		}
+		if match != "" {
+			if rank < 3 {
+				fuzzy = append(fuzzy, p+" → "+match)
+			}
+			parts[i] = match
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return filepath.Join(parts...), fuzzy
+}
@@ -0,0 +1,165 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// ErrInsufficientSpace is returned by CheckFreeSpace when an album would not
+// fit on the destination filesystem.
+var ErrInsufficientSpace = errors.New("not enough free space")
+
+// envMB reads a size in MiB from env, returning def when it is unset or
+// invalid, in bytes.
+func envMB(env string, def int64) int64 {
+	mb := def
+	if v, err := strconv.ParseInt(os.Getenv(env), 10, 64); err == nil && v >= 0 {
+		mb = v
+	}
+	return mb << 20
+}
+
+// spaceMargin returns DISK_SPACE_MARGIN_MB (default 512), the free space an
+// album move must leave on the library filesystem.
+func spaceMargin() int64 {
+	return envMB("DISK_SPACE_MARGIN_MB", 512)
+}
+
+// lowSpaceThreshold returns DISK_LOW_SPACE_MB (default 5120), below which
+// the web UI warns that a filesystem is running out of space.
+func lowSpaceThreshold() int64 {
+	return envMB("DISK_LOW_SPACE_MB", 5120)
+}
+
+// existingDir returns dir, or its nearest ancestor that exists.
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// FreeSpace returns the bytes available to the importer on the filesystem
+// holding dir (or, before it is created, its nearest existing parent).
+func FreeSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(existingDir(dir), &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// SameFilesystem reports whether a and b (or their nearest existing
+// parents) are on the same filesystem, so a rename between them takes no
+// space.
+func SameFilesystem(a, b string) bool {
+	ia, err := os.Stat(existingDir(a))
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(existingDir(b))
+	if err != nil {
+		return false
+	}
+	sa, ok := ia.Sys().(*syscall.Stat_t)
+	sb, ok2 := ib.Sys().(*syscall.Stat_t)
+	return ok && ok2 && sa.Dev == sb.Dev
+}
+
+// FilesSize returns the total size of files, skipping any that are gone.
+func FilesSize(files []string) int64 {
+	var n int64
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			n += info.Size()
+		}
+	}
+	return n
+}
+
+// CheckFreeSpace returns an error wrapping ErrInsufficientSpace unless the
+// filesystem holding dir has room for need bytes plus DISK_SPACE_MARGIN_MB.
+// A filesystem that cannot be queried passes.
+func CheckFreeSpace(dir string, need int64) error {
+	free, err := FreeSpace(dir)
+	if err != nil {
+		return nil
+	}
+	margin := spaceMargin()
+	if free >= need+margin {
+		return nil
+	}
+	return fmt.Errorf("%w on %s: need %s (%s + %s margin), %s free",
+		ErrInsufficientSpace, existingDir(dir), FormatBytes(need+margin), FormatBytes(need), FormatBytes(margin), FormatBytes(free))
+}
+
+// FormatBytes formats a size for people, e.g. "3.2 GB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// DiskStatus is the free space of one of the importer's directories.
+type DiskStatus struct {
+	Name string `json:"name"` // the variable naming the directory, e.g. "LIBRARY_DIR"
+	Dir  string `json:"dir"`
+	Free int64  `json:"free_bytes"`
+	Low  bool   `json:"low"`
+}
+
+// FreeText is Free formatted by FormatBytes.
+func (d DiskStatus) FreeText() string { return FormatBytes(d.Free) }
+
+// DiskSpace reports the free space of the local library, import and data
+// directories, each marked low when under DISK_LOW_SPACE_MB. Directories on
+// a filesystem already listed are left out.
+func DiskSpace() []DiskStatus {
+	var out []DiskStatus
+	dirs := []struct{ name, dir string }{
+		{"LIBRARY_DIR", LocalLibraryDir()},
+		{"IMPORT_DIR", LocalImportDir()},
+		{"DATA_DIR", DataDir()},
+	}
+outer:
+	for _, d := range dirs {
+		if d.dir == "" {
+			continue
+		}
+		for _, seen := range out {
+			if SameFilesystem(seen.Dir, d.dir) {
+				continue outer
+			}
+		}
+		free, err := FreeSpace(d.dir)
+		if err != nil {
+			continue
+		}
+		out = append(out, DiskStatus{Name: d.name, Dir: d.dir, Free: free, Low: free < lowSpaceThreshold()})
+	}
+	return out
+}
+
+// LowDiskSpace returns the entries of DiskSpace that are low.
+func LowDiskSpace() []DiskStatus {
+	var low []DiskStatus
+	for _, d := range DiskSpace() {
+		if d.Low {
+			low = append(low, d)
+		}
+	}
+	return low
+}
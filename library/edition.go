@@ -0,0 +1,52 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// editionName names an album's edition: its MusicBrainz disambiguation
+// comment ("2011 remaster", "deluxe edition"), else its medium when that
+// is not a CD or a download ("12\" Vinyl", "Cassette").
+func editionName(md *metadata.MusicMetadata) string {
+	if md.Disambiguation != "" {
+		return md.Disambiguation
+	}
+	switch strings.ToLower(md.Media) {
+	case "", "cd", "digital media", "enhanced cd", "hdcd":
+		return ""
+	}
+	return md.Media
+}
+
+// disambiguateEnabled reports whether LIBRARY_DISAMBIGUATE=true.
+func disambiguateEnabled() bool {
+	return strings.ToLower(os.Getenv("LIBRARY_DISAMBIGUATE")) == "true"
+}
+
+// disambiguate keeps editions of an album apart: when the journal says rel
+// already holds a different MusicBrainz release, the album folder gets the
+// edition's year and name appended, e.g. "Album (2011 Deluxe Edition)", or
+// the start of its release ID when neither tells them apart.
+func disambiguate(rel string, md *metadata.MusicMetadata) string {
+	if md.ReleaseMBID == "" {
+		return rel
+	}
+	if other := journalRelease(rel); other == "" || other == md.ReleaseMBID {
+		return rel
+	}
+	var tokens []string
+	if y := md.Year; y != "" && !strings.Contains(filepath.Base(rel), y) {
+		tokens = append(tokens, y)
+	}
+	if e := editionName(md); e != "" {
+		tokens = append(tokens, e)
+	}
+	if len(tokens) == 0 {
+		tokens = append(tokens, md.ReleaseMBID[:min(8, len(md.ReleaseMBID))])
+	}
+	return rel + " (" + Sanitize(strings.Join(tokens, " ")) + ")"
+}
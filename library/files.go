@@ -0,0 +1,201 @@
+// Package library manages the music library on disk: where albums go, moving
+// them there, and the journal of everything imported.
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// AlbumTargetDir returns the destination directory for an album without
+// creating it. Use this to check for an existing import before moving files.
+// The layout is controlled by LIBRARY_TEMPLATE (see pathtemplate.go).
+func AlbumTargetDir(libDir string, md *metadata.MusicMetadata) string {
+	return filepath.Join(libDir, albumRelDir(libDir, md))
+}
+
+// albumRelDir renders the album directory relative to libDir, reusing the
+// spelling of matching folders already there (see matchExistingDirs).
+func albumRelDir(libDir string, md *metadata.MusicMetadata) string {
+	rel, _ := matchAlbumDirs(libDir, md)
+	if disambiguateEnabled() {
+		rel = disambiguate(rel, md)
+	}
+	return rel
+}
+
+func matchAlbumDirs(libDir string, md *metadata.MusicMetadata) (string, []string) {
+	artists := map[string]string{
+		artistDirName(md):      Sanitize(md.ArtistSort),
+		albumArtistDirName(md): Sanitize(metadata.FirstNonEmpty(md.AlbumArtistSort, md.ArtistSort)),
+	}
+	return matchExistingDirs(libDir, renderLibraryPath(md), artists)
+}
+
+// FolderMatches lists the existing library folders the album's directory
+// reuses under a spelling that differs beyond case ("Simon and Garfunkel →
+// Simon & Garfunkel"), for confirming before the move.
+func FolderMatches(libDir string, md *metadata.MusicMetadata) []string {
+	_, fuzzy := matchAlbumDirs(libDir, md)
+	return fuzzy
+}
+
+// ArtistDir returns the library folder of an album's artist: the nearest
+// folder above albumDir named after the album artist or artist, in any
+// spelling matchExistingDirs would reuse. It returns "" when the layout
+// has no artist folder.
+func ArtistDir(libDir, albumDir string, md *metadata.MusicMetadata) string {
+	names := map[string]bool{}
+	for _, n := range []string{albumArtistDirName(md), artistDirName(md), Sanitize(md.AlbumArtistSort), Sanitize(md.ArtistSort)} {
+		if n != "" {
+			names[foldName(n)] = true
+		}
+	}
+	for dir := filepath.Dir(albumDir); strings.HasPrefix(dir, libDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if names[foldName(filepath.Base(dir))] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// LibraryFilePath returns where MoveToLibrary puts srcPath: the album's
+// library directory plus the sanitized base name of srcPath, which may be
+// just the new file name (see TrackFileNames). A relative name with folders,
+// e.g. "Artwork/back.jpg", keeps them as subfolders of the album.
+// With SANITIZE_MAX_PATH set, a name that would push the path past the limit
+// loses the end of its stem.
+func LibraryFilePath(libDir string, md *metadata.MusicMetadata, srcPath string) string {
+	rel := albumRelDir(libDir, md)
+	if dir := filepath.Dir(srcPath); !filepath.IsAbs(srcPath) && dir != "." {
+		for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+			rel = filepath.Join(rel, Sanitize(part))
+		}
+	}
+	name := SanitizeFilename(filepath.Base(srcPath))
+	if limit := maxPathBytes(); limit > 0 && len(rel)+1+len(name) > limit {
+		ext := filepath.Ext(name)
+		keep := max(limit-len(rel)-1-len(ext), 8)
+		name = sanitizeComponent(truncateName(strings.TrimSuffix(name, ext), keep) + ext)
+	}
+	return filepath.Join(libDir, rel, name)
+}
+
+// MoveToLibrary moves a file into the album's library directory (see
+// albumTargetDir) as name, or under its own name when name is empty, and
+// applies the configured ownership and modes (see permissions.go).
+func MoveToLibrary(libDir string, md *metadata.MusicMetadata, srcPath, name string) error {
+	if name == "" {
+		name = srcPath
+	}
+	dst := LibraryFilePath(libDir, md, name)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	fmt.Println("→ Moving:", srcPath, "→", dst)
+	var err error
+	if strings.ToLower(os.Getenv("COPYMODE")) == "true" {
+		err = copy(srcPath, dst)
+	} else {
+		err = os.Rename(srcPath, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ApplyLibraryPermissions(libDir, dst); err != nil {
+		fmt.Println("Warning: could not set permissions:", err)
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CopyFile copies a file from src to dst. If src and dst files exist, and are
+// the same, then return success. Otherise, attempt to create a hard link
+// between the two files. If that fail, copy the file contents from src to dst.
+func copy(src, dst string) (err error) {
+	sfi, err := os.Stat(src)
+	if err != nil {
+		return
+	}
+	if !sfi.Mode().IsRegular() {
+		// cannot copy non-regular files (e.g., directories,
+		// symlinks, devices, etc.)
+		return fmt.Errorf("CopyFile: non-regular source file %s (%q)", sfi.Name(), sfi.Mode().String())
+	}
+	dfi, err := os.Stat(dst)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return
+		}
+	} else {
+		if !(dfi.Mode().IsRegular()) {
+			return fmt.Errorf("CopyFile: non-regular destination file %s (%q)", dfi.Name(), dfi.Mode().String())
+		}
+		if os.SameFile(sfi, dfi) {
+			return
+		}
+	}
+	if err = os.Link(src, dst); err == nil {
+		return
+	}
+	err = copyFileContents(src, dst)
+	return
+}
+
+// copyFileContents copies the contents of the file named src to the file named
+// by dst. The file will be created if it does not already exist. If the
+// destination file exists, all it's contents will be replaced by the contents
+// of the source file.
+func copyFileContents(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer func() {
+		cerr := out.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	if _, err = io.Copy(out, in); err != nil {
+		return
+	}
+	err = out.Sync()
+	return
+}
+
+// RemoveEmptyParents removes dir and its parents while they are empty,
+// stopping at root.
+func RemoveEmptyParents(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,167 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// IndexAlbum is one album of the library index served by /api/library/albums.
+type IndexAlbum struct {
+	ID         string    `json:"id,omitempty"` // journal ID; empty for albums found by a scan
+	Artist     string    `json:"artist"`
+	Album      string    `json:"album"`
+	Year       string    `json:"year,omitempty"`
+	Format     string    `json:"format,omitempty"` // e.g. "FLAC", "MP3"
+	Quality    string    `json:"quality,omitempty"`
+	TrackCount int       `json:"track_count"`
+	Dir        string    `json:"dir"` // relative to LIBRARY_DIR
+	ImportedAt time.Time `json:"imported_at,omitzero"`
+	CoverURL   string    `json:"cover_url,omitempty"`
+}
+
+// IndexArtist summarises one artist's albums for /api/library/artists.
+type IndexArtist struct {
+	Name       string `json:"name"`
+	AlbumCount int    `json:"album_count"`
+	TrackCount int    `json:"track_count"`
+}
+
+// formatOf returns the container format an album is in, from its quality
+// string ("FLAC-24bit-96kHz" → "FLAC") or else its first track.
+func formatOf(quality string, tracks []string) string {
+	if f, _, _ := strings.Cut(quality, "-"); f != "" {
+		return f
+	}
+	if len(tracks) > 0 {
+		return strings.ToUpper(strings.TrimPrefix(filepath.Ext(tracks[0]), "."))
+	}
+	return ""
+}
+
+// indexFromJournal builds the album index from the import journal, keeping
+// only albums still in the library when it is local.
+func indexFromJournal() ([]IndexAlbum, error) {
+	entries, err := JournalEntries()
+	if err != nil {
+		return nil, err
+	}
+	libDir := LocalLibraryDir()
+	var out []IndexAlbum
+	for _, e := range entries {
+		if RemoteLibrary() == "" {
+			if _, err := os.Stat(filepath.Join(libDir, e.Dir)); err != nil {
+				continue
+			}
+		}
+		var tracks []string
+		for _, f := range e.Files {
+			if metadata.IsLibraryTrack(f.Path) {
+				tracks = append(tracks, f.Path)
+			}
+		}
+		out = append(out, IndexAlbum{
+			ID:         e.ID,
+			Artist:     e.Artist,
+			Album:      e.Album,
+			Year:       e.Date[:min(4, len(e.Date))],
+			Format:     formatOf(e.Quality, tracks),
+			Quality:    e.Quality,
+			TrackCount: len(tracks),
+			Dir:        e.Dir,
+			ImportedAt: e.ImportedAt,
+			CoverURL:   "/art/" + e.ID,
+		})
+	}
+	return out, nil
+}
+
+// indexFromScan builds the album index by walking LIBRARY_DIR for
+// directories holding audio files and reading the first track's tags. It
+// skips the importer's own data directory.
+func indexFromScan() ([]IndexAlbum, error) {
+	libDir := LocalLibraryDir()
+	dataDir := DataDir()
+	var out []IndexAlbum
+	err := filepath.WalkDir(libDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if path == dataDir || path == TrashDir() || (path != libDir && strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		tracks, err := metadata.AudioFiles(path)
+		if err != nil || len(tracks) == 0 {
+			return nil
+		}
+		md, err := metadata.ReadTags(tracks[0])
+		if err != nil {
+			return nil
+		}
+		metadata.AttachQuality(md, tracks[0])
+		rel, _ := filepath.Rel(libDir, path)
+		out = append(out, IndexAlbum{
+			Artist:     metadata.FirstNonEmpty(md.AlbumArtist, md.Artist),
+			Album:      md.Album,
+			Year:       md.Year,
+			Format:     formatOf(md.Quality, tracks),
+			Quality:    md.Quality,
+			TrackCount: len(tracks),
+			Dir:        rel,
+		})
+		return nil
+	})
+	return out, err
+}
+
+// LibraryIndex returns every album in the library sorted by artist, year
+// and album. It reads the import journal, or scans LIBRARY_DIR when scan is
+// set or the journal is empty.
+func LibraryIndex(scan bool) ([]IndexAlbum, error) {
+	var albums []IndexAlbum
+	var err error
+	if !scan {
+		if albums, err = indexFromJournal(); err != nil {
+			return nil, err
+		}
+	}
+	if len(albums) == 0 && RemoteLibrary() == "" {
+		if albums, err = indexFromScan(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(albums, func(i, j int) bool {
+		a, b := albums[i], albums[j]
+		if !strings.EqualFold(a.Artist, b.Artist) {
+			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
+		}
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		return strings.ToLower(a.Album) < strings.ToLower(b.Album)
+	})
+	return albums, nil
+}
+
+// LibraryArtists groups albums by artist, ignoring case, in the order the
+// albums come in.
+func LibraryArtists(albums []IndexAlbum) []IndexArtist {
+	var out []IndexArtist
+	idx := map[string]int{}
+	for _, a := range albums {
+		key := strings.ToLower(a.Artist)
+		i, ok := idx[key]
+		if !ok {
+			i = len(out)
+			idx[key] = i
+			out = append(out, IndexArtist{Name: a.Artist})
+		}
+		out[i].AlbumCount++
+		out[i].TrackCount += a.TrackCount
+	}
+	return out
+}
@@ -0,0 +1,335 @@
+package library
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// JournalFile records one file written into the library by an import.
+type JournalFile struct {
+	Path   string `json:"path"` // relative to LIBRARY_DIR
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// JournalEntry records one album imported into the library.
+type JournalEntry struct {
+	ID         string          `json:"id"`
+	ImportedAt time.Time       `json:"imported_at"`
+	Artist     string          `json:"artist"`
+	Album      string          `json:"album"`
+	Date       string          `json:"date,omitempty"`
+	Quality    string          `json:"quality,omitempty"`
+	Source     metadata.Source `json:"source,omitempty"`
+	Dir        string          `json:"dir"` // relative to LIBRARY_DIR
+	Release    string          `json:"release_mbid,omitempty"`
+	Genres     []string        `json:"genres,omitempty"`
+	Label      string          `json:"label,omitempty"`
+	Files      []JournalFile   `json:"files"`
+
+	Verification *MoveVerification `json:"verification,omitempty"` // set when VERIFY_MOVES is on
+	Degraded     []string          `json:"degraded,omitempty"`     // optional features skipped for lack of a tool or key
+	Palette      []string          `json:"palette,omitempty"`      // dominant cover colours, "#rrggbb", most common first
+	Log          string            `json:"log,omitempty"`          // ID of the import's log, see AlbumLogPath
+	AccurateRip  *AccurateRip      `json:"accuraterip,omitempty"`  // CD rip verification, see SetJournalAccurateRip
+	Cover        *JournalCover     `json:"cover,omitempty"`        // the cover chosen at import, see SetJournalCover
+}
+
+// JournalCover is the cover an album was imported with.
+type JournalCover struct {
+	File   string `json:"file"`   // e.g. "cover.jpg"
+	Origin string `json:"origin"` // folder, coverartarchive or itunes
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// AccurateRip is the AccurateRip verification of a CD rip.
+type AccurateRip struct {
+	DiscID string             `json:"disc_id"` // e.g. "012-0012abcd-00a1b2c3-9b0c1a0c"
+	Found  bool               `json:"found"`   // false when the disc is not in the database
+	Tracks []AccurateRipTrack `json:"tracks,omitempty"`
+}
+
+// AccurateRipTrack is one track's result: how many database rips share its
+// checksum (0 when none do).
+type AccurateRipTrack struct {
+	Track      int    `json:"track"`
+	CRC        string `json:"crc"` // v2 checksum, hex
+	Confidence int    `json:"confidence"`
+}
+
+// SetJournalAccurateRip attaches a CD rip's verification to its journal
+// entry.
+func SetJournalAccurateRip(journalID string, ar *AccurateRip) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	for _, e := range journal {
+		if e.ID == journalID {
+			e.AccurateRip = ar
+			return saveJournalLocked()
+		}
+	}
+	return nil
+}
+
+// SetJournalCover records the cover an album was imported with in its
+// journal entry.
+func SetJournalCover(journalID string, c *JournalCover) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	for _, e := range journal {
+		if e.ID == journalID {
+			e.Cover = c
+			return saveJournalLocked()
+		}
+	}
+	return nil
+}
+
+var (
+	journalMu     sync.Mutex
+	journalLoaded bool
+	journal       []*JournalEntry
+)
+
+// DataDir returns the directory the importer keeps its own state in. It
+// defaults to LIBRARY_DIR/.music-importer and can be moved with DATA_DIR.
+// With an rclone library it defaults to the staging directory instead.
+func DataDir() string {
+	if d := os.Getenv("DATA_DIR"); d != "" {
+		return d
+	}
+	if RemoteLibrary() != "" {
+		return filepath.Join(rcloneStagingDir(), "data")
+	}
+	return filepath.Join(os.Getenv("LIBRARY_DIR"), ".music-importer")
+}
+
+// APICacheDir returns where MusicBrainz and LRCLIB responses are cached,
+// DATA_DIR/cache, or "" when API_CACHE=false turns the cache off.
+func APICacheDir() string {
+	if os.Getenv("API_CACHE") == "false" {
+		return ""
+	}
+	return filepath.Join(DataDir(), "cache")
+}
+
+func journalPath() string {
+	return filepath.Join(DataDir(), "journal.json")
+}
+
+// loadJournalLocked reads the journal from disk on first use. journalMu must be held.
+func loadJournalLocked() error {
+	if journalLoaded {
+		return nil
+	}
+	data, err := os.ReadFile(journalPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &journal); err != nil {
+			return fmt.Errorf("parsing journal: %w", err)
+		}
+	}
+	journalLoaded = true
+	return nil
+}
+
+// saveJournalLocked writes the journal atomically via a temp file. journalMu must be held.
+func saveJournalLocked() error {
+	if err := os.MkdirAll(DataDir(), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := journalPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, journalPath())
+}
+
+// addJournalEntry appends e to the journal and persists it.
+func addJournalEntry(e *JournalEntry) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	journal = append(journal, e)
+	return saveJournalLocked()
+}
+
+// RemoveJournalEntry drops the entry with the given ID and persists the
+// journal. It is a no-op if there is no such entry.
+func RemoveJournalEntry(id string) error {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	for i, e := range journal {
+		if e.ID == id {
+			journal = append(journal[:i], journal[i+1:]...)
+			return saveJournalLocked()
+		}
+	}
+	return nil
+}
+
+// JournalEntries returns a snapshot of every journal entry, oldest first.
+func JournalEntries() ([]*JournalEntry, error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return nil, err
+	}
+	return append([]*JournalEntry(nil), journal...), nil
+}
+
+// LookupJournalEntry returns the entry with the given ID, or nil if there is
+// none.
+func LookupJournalEntry(id string) (*JournalEntry, error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return nil, err
+	}
+	for _, e := range journal {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+// journalRelease returns the MusicBrainz release of the album most recently
+// recorded at relDir, or "" when none is known.
+func journalRelease(relDir string) string {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return ""
+	}
+	for i := len(journal) - 1; i >= 0; i-- {
+		if journal[i].Dir == relDir {
+			return journal[i].Release
+		}
+	}
+	return ""
+}
+
+// RecordImport checksums every file in targetDir and adds a journal entry for
+// the album, with the move verification record if there is one and the
+// features it was imported without. It is called once an album has been moved
+// into the library.
+func RecordImport(libraryDir, targetDir string, md *metadata.MusicMetadata, src metadata.Source, verification *MoveVerification, degraded []string) (*JournalEntry, error) {
+	relDir, err := filepath.Rel(libraryDir, targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &JournalEntry{
+		ID:         NewJournalID(),
+		ImportedAt: time.Now(),
+		Artist:     md.Artist,
+		Album:      md.Album,
+		Date:       metadata.FirstNonEmpty(md.Date, md.Year),
+		Quality:    md.Quality,
+		Source:     src,
+		Dir:        relDir,
+		Release:    md.ReleaseMBID,
+		Genres:     metadata.Values(md.Genre),
+		Label:      metadata.FirstValue(md.Label),
+
+		Verification: verification,
+		Degraded:     degraded,
+		Palette:      AlbumPalette(targetDir),
+	}
+
+	if entry.Files, err = checksumDir(libraryDir, targetDir); err != nil {
+		return nil, err
+	}
+
+	if err := addJournalEntry(entry); err != nil {
+		return entry, err
+	}
+	return entry, exportVerification(entry)
+}
+
+// checksumDir records every file under targetDir with paths relative to
+// libraryDir.
+func checksumDir(libraryDir, targetDir string) ([]JournalFile, error) {
+	var files []JournalFile
+	err := filepath.WalkDir(targetDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		sum, err := FileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(libraryDir, path)
+		files = append(files, JournalFile{Path: rel, Size: info.Size(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("checksumming %s: %w", targetDir, err)
+	}
+	return files, nil
+}
+
+// RefreshJournalFiles re-checksums the album in relDir (relative to
+// libraryDir) after its files were changed in place, so scrub doesn't flag
+// them, and updates its palette. Albums not in the journal are ignored.
+func RefreshJournalFiles(libraryDir, relDir string) error {
+	targetDir := filepath.Join(libraryDir, relDir)
+	files, err := checksumDir(libraryDir, targetDir)
+	if err != nil {
+		return err
+	}
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	if err := loadJournalLocked(); err != nil {
+		return err
+	}
+	for _, e := range journal {
+		if e.Dir == relDir {
+			e.Files = files
+			e.Palette = AlbumPalette(targetDir)
+			return saveJournalLocked()
+		}
+	}
+	return nil
+}
+
+func NewJournalID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,101 @@
+package library
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// paletteSize is how many colours are kept per cover.
+const paletteSize = 5
+
+// extractPalette returns up to n dominant colours of the image at path as
+// "#rrggbb", most common first. Pixels are sampled on a grid, bucketed by
+// their top four bits per channel, and buckets too close to a colour already
+// picked are skipped so the palette is not five shades of one colour.
+func extractPalette(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	type bucket struct{ count, r, g, b int }
+	buckets := map[int]*bucket{}
+
+	bounds := img.Bounds()
+	step := max(1, int(math.Sqrt(float64(bounds.Dx()*bounds.Dy())/10000)))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			r, g, b = r>>8, g>>8, b>>8
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(b>>4)
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += int(r)
+			bk.g += int(g)
+			bk.b += int(b)
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].count > sorted[j].count })
+
+	var picked [][3]int
+	for _, bk := range sorted {
+		c := [3]int{bk.r / bk.count, bk.g / bk.count, bk.b / bk.count}
+		distinct := true
+		for _, p := range picked {
+			dr, dg, db := c[0]-p[0], c[1]-p[1], c[2]-p[2]
+			if dr*dr+dg*dg+db*db < 48*48 {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			picked = append(picked, c)
+			if len(picked) == n {
+				break
+			}
+		}
+	}
+
+	out := make([]string, len(picked))
+	for i, c := range picked {
+		out[i] = fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+	}
+	return out, nil
+}
+
+// AlbumPalette returns the palette of the cover image in dir, or nil if there
+// is no readable cover.
+func AlbumPalette(dir string) []string {
+	cover, err := metadata.FindCoverImage(dir)
+	if err != nil {
+		return nil
+	}
+	palette, err := extractPalette(cover, paletteSize)
+	if err != nil {
+		fmt.Println("Palette extraction failed:", err)
+		return nil
+	}
+	return palette
+}
@@ -0,0 +1,249 @@
+package library
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// defaultClassicalTemplate lays classical albums out composer first.
+const defaultClassicalTemplate = `{{.Composer}}/{{.Work}}/{{.Performer}}{{if .Year}} ({{.Year}}){{end}}`
+
+// defaultAudiobookTemplate lays audiobooks out as author/book.
+const defaultAudiobookTemplate = `{{.Author}}/{{.Book}}`
+
+// defaultPathTemplate reproduces the original {Artist}/[{Date}] {Album} [{Quality}] layout.
+const defaultPathTemplate = `{{.Artist}}/[{{.Date}}] {{.Album}}{{if .Quality}} [{{.Quality}}]{{end}}`
+
+// pathTemplateData is the value LIBRARY_TEMPLATE is executed against. Every
+// field is sanitized before execution, so a "/" in the template is the only
+// way to introduce a directory level.
+type pathTemplateData struct {
+	Artist      string
+	AlbumArtist string // album artist tag, falling back to Artist
+	Album       string
+	Title       string
+	Date        string // YYYY.MM.DD when known, falling back to Year
+	Year        string
+	// The original release's date and year, for remasters and reissues;
+	// they fall back to Date and Year.
+	OriginalDate string
+	OriginalYear string
+	Quality      string
+
+	Genre         string
+	Label         string
+	CatalogNumber string
+	Country       string // release country code, e.g. "GB"
+	Media         string // e.g. "CD", "Digital Media"
+	ReleaseType   string // album, single, ep, compilation, …
+
+	// Editions: Disambiguation is the MusicBrainz release comment, Edition
+	// that or the medium when it is not a CD or a download (see editionName).
+	Disambiguation string
+	Edition        string
+
+	// Classical credits. Composer falls back to AlbumArtist, Work to Album
+	// and Performer (conductor, else album artist) to AlbumArtist.
+	Composer  string
+	Work      string
+	Performer string
+
+	// Audiobook names: Author is AlbumArtist, Book is Album and Narrator the
+	// composer tag, where audiobook tools usually put it.
+	Author   string
+	Book     string
+	Narrator string
+}
+
+var pathTemplateFuncs = template.FuncMap{
+	// firstLetter returns the bucket folder for a name, e.g. "The Beatles" → "B".
+	"firstLetter": sortBucket,
+}
+
+var (
+	pathTemplateOnce sync.Once
+	pathTemplate     *template.Template
+)
+
+// libraryPathTemplate returns the parsed LIBRARY_TEMPLATE, falling back to the
+// default layout (with a first-letter prefix when LIBRARY_SORT_FOLDERS is set)
+// if the variable is unset or fails to parse.
+func libraryPathTemplate() *template.Template {
+	pathTemplateOnce.Do(func() {
+		def := defaultPathTemplate
+		if sortFoldersEnabled() {
+			def = "{{firstLetter .Artist}}/" + def
+		}
+		pathTemplate = parsePathTemplate("LIBRARY_TEMPLATE", def)
+	})
+	return pathTemplate
+}
+
+var (
+	classicalTemplateOnce sync.Once
+	classicalTemplate     *template.Template
+
+	audiobookTemplateOnce sync.Once
+	audiobookTemplate     *template.Template
+)
+
+var (
+	typeTemplateMu sync.Mutex
+	typeTemplates  = map[string]*template.Template{}
+)
+
+// releaseTypeTemplate returns the parsed LIBRARY_TEMPLATE_<TYPE> for a
+// release type (e.g. LIBRARY_TEMPLATE_SOUNDTRACK), or nil when none is set.
+func releaseTypeTemplate(releaseType string) *template.Template {
+	if releaseType == "" {
+		return nil
+	}
+	env := "LIBRARY_TEMPLATE_" + strings.ToUpper(strings.ReplaceAll(releaseType, "-", "_"))
+	typeTemplateMu.Lock()
+	defer typeTemplateMu.Unlock()
+	if t, ok := typeTemplates[env]; ok {
+		return t
+	}
+	var t *template.Template
+	if os.Getenv(env) != "" {
+		t = parsePathTemplate(env, defaultPathTemplate)
+	}
+	typeTemplates[env] = t
+	return t
+}
+
+// parsePathTemplate parses the template in env, falling back to def when it
+// is unset or invalid.
+func parsePathTemplate(env, def string) *template.Template {
+	t := template.Must(template.New("path").Funcs(pathTemplateFuncs).Parse(def))
+	if raw := os.Getenv(env); raw != "" {
+		custom, err := template.New("path").Funcs(pathTemplateFuncs).Parse(raw)
+		if err != nil {
+			log.Printf("Invalid %s, using default layout: %v", env, err)
+			return t
+		}
+		t = custom
+	}
+	return t
+}
+
+// classicalPathTemplate returns the parsed CLASSICAL_TEMPLATE used for
+// classical albums (see metadata.IsClassical).
+func classicalPathTemplate() *template.Template {
+	classicalTemplateOnce.Do(func() {
+		classicalTemplate = parsePathTemplate("CLASSICAL_TEMPLATE", defaultClassicalTemplate)
+	})
+	return classicalTemplate
+}
+
+// audiobookPathTemplate returns the parsed AUDIOBOOK_TEMPLATE used for
+// audiobooks and podcasts, relative to AUDIOBOOK_DIR.
+func audiobookPathTemplate() *template.Template {
+	audiobookTemplateOnce.Do(func() {
+		audiobookTemplate = parsePathTemplate("AUDIOBOOK_TEMPLATE", defaultAudiobookTemplate)
+	})
+	return audiobookTemplate
+}
+
+// artistDirName is the sanitized canonical name used for .Artist.
+func artistDirName(md *metadata.MusicMetadata) string {
+	return artistFolder(md.Artist, md.ArtistSort, md.ArtistTransliteration)
+}
+
+// albumArtistDirName is the sanitized canonical name used for .AlbumArtist.
+func albumArtistDirName(md *metadata.MusicMetadata) string {
+	if md.AlbumArtist == "" {
+		return artistDirName(md)
+	}
+	return artistFolder(md.AlbumArtist, md.AlbumArtistSort, md.ArtistTransliteration)
+}
+
+// artistFolder turns an artist name into a folder name, dropping any
+// featuring credit unless FEATURING_MODE is "keep".
+func artistFolder(name, sortName, latin string) string {
+	if metadata.FeaturingMode() != "keep" {
+		name, _ = metadata.SplitFeaturing(name)
+	}
+	return Sanitize(pathName(CanonicalArtist(name, sortName), latin))
+}
+
+// renderLibraryPath executes the library path template for md and returns the
+// album directory relative to the library root.
+func renderLibraryPath(md *metadata.MusicMetadata) string {
+	data := pathTemplateData{
+		Artist:      artistDirName(md),
+		AlbumArtist: albumArtistDirName(md),
+		Album:       Sanitize(pathName(md.Album, md.AlbumTransliteration)),
+		Title:       Sanitize(md.Title),
+		Date:        Sanitize(metadata.FirstNonEmpty(md.Date, md.Year)),
+		Year:        Sanitize(md.Year),
+		Quality:     Sanitize(md.Quality),
+
+		OriginalDate: Sanitize(metadata.FirstNonEmpty(md.OriginalDate, md.Date, md.Year)),
+		OriginalYear: Sanitize(metadata.FirstNonEmpty(md.OriginalYear, md.Year)),
+
+		Genre:         Sanitize(md.Genre),
+		Label:         Sanitize(md.Label),
+		CatalogNumber: Sanitize(md.CatalogNumber),
+		Country:       Sanitize(md.Country),
+		Media:         Sanitize(md.Media),
+		ReleaseType:   Sanitize(md.ReleaseType),
+
+		Disambiguation: Sanitize(md.Disambiguation),
+		Edition:        Sanitize(editionName(md)),
+	}
+	data.Composer, data.Work, data.Performer = data.AlbumArtist, data.Album, data.AlbumArtist
+	if composer, _, _ := strings.Cut(md.Composer, ";"); composer != "" {
+		data.Composer = artistFolder(composer, "", "")
+	}
+	if md.Work != "" {
+		data.Work = Sanitize(md.Work)
+	}
+	if conductor, _, _ := strings.Cut(md.Conductor, ";"); conductor != "" {
+		data.Performer = artistFolder(conductor, "", "")
+	}
+
+	data.Author, data.Book, data.Narrator = data.AlbumArtist, data.Album, Sanitize(md.Composer)
+
+	tmpl := libraryPathTemplate()
+	switch {
+	case md.Audiobook:
+		tmpl = audiobookPathTemplate()
+	case metadata.IsClassical(md):
+		tmpl = classicalPathTemplate()
+	case releaseTypeTemplate(md.ReleaseType) != nil:
+		tmpl = releaseTypeTemplate(md.ReleaseType)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		log.Printf("LIBRARY_TEMPLATE failed for %q, using default layout: %v", md.Album, err)
+		b.Reset()
+		template.Must(template.New("path").Funcs(pathTemplateFuncs).Parse(defaultPathTemplate)).Execute(&b, data)
+	}
+
+	var parts []string
+	for _, p := range strings.Split(b.String(), "/") {
+		p = strings.TrimSpace(p)
+		switch p {
+		case "":
+			continue
+		case ".", "..":
+			p = "_"
+		}
+		if p = sanitizeComponent(p); p == "" {
+			p = "_"
+		}
+		parts = append(parts, p)
+	}
+	if limit := maxPathBytes(); limit > 0 {
+		// Leave room for the track file names under the album directory.
+		parts = fitPath(parts, limit-min(pathFileReserve, limit/3), 16)
+	}
+	return filepath.Join(parts...)
+}
@@ -0,0 +1,109 @@
+package library
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// libraryPerms is the ownership and modes given to files moved into the
+// library. A mode of 0 or an id of -1 leaves that attribute alone.
+type libraryPerms struct {
+	fileMode os.FileMode
+	dirMode  os.FileMode
+	uid, gid int
+}
+
+var (
+	permsOnce sync.Once
+	perms     libraryPerms
+)
+
+// parseEnvMode reads an octal permission mode such as "0644" from env.
+func parseEnvMode(env string) os.FileMode {
+	raw := strings.TrimSpace(os.Getenv(env))
+	if raw == "" {
+		return 0
+	}
+	m, err := strconv.ParseUint(raw, 8, 32)
+	if err != nil || m == 0 || m > 0o7777 {
+		log.Printf("Invalid %s %q, ignoring it", env, raw)
+		return 0
+	}
+	return os.FileMode(m)
+}
+
+// parseEnvID reads a numeric uid or gid from env, or -1 when unset.
+func parseEnvID(env string) int {
+	raw := strings.TrimSpace(os.Getenv(env))
+	if raw == "" {
+		return -1
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id < 0 {
+		log.Printf("Invalid %s %q, ignoring it", env, raw)
+		return -1
+	}
+	return id
+}
+
+// libraryPermissions returns LIBRARY_FILE_MODE, LIBRARY_DIR_MODE and
+// LIBRARY_UID/LIBRARY_GID, parsed once.
+func libraryPermissions() libraryPerms {
+	permsOnce.Do(func() {
+		perms = libraryPerms{
+			fileMode: parseEnvMode("LIBRARY_FILE_MODE"),
+			dirMode:  parseEnvMode("LIBRARY_DIR_MODE"),
+			uid:      parseEnvID("LIBRARY_UID"),
+			gid:      parseEnvID("LIBRARY_GID"),
+		}
+	})
+	return perms
+}
+
+// ApplyLibraryPermissions gives path, and the directories between it and
+// libDir, the configured modes and owner. Changing the owner needs root
+// (as in the Docker image); failures are returned but leave the file in
+// place.
+func ApplyLibraryPermissions(libDir, path string) error {
+	p := libraryPermissions()
+	if p.fileMode == 0 && p.dirMode == 0 && p.uid < 0 && p.gid < 0 {
+		return nil
+	}
+	apply := func(path string, mode os.FileMode) error {
+		if mode != 0 {
+			if err := os.Chmod(path, mode); err != nil {
+				return err
+			}
+		}
+		if p.uid >= 0 || p.gid >= 0 {
+			if err := os.Lchown(path, p.uid, p.gid); err != nil {
+				return fmt.Errorf("changing owner of %s: %w", path, err)
+			}
+		}
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	mode := p.fileMode
+	if info.IsDir() {
+		mode = p.dirMode
+	}
+	if err := apply(path, mode); err != nil {
+		return err
+	}
+	root := filepath.Clean(libDir)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := apply(dir, p.dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package library
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// libraryQueryFields are the fields a library query can name, and how each
+// is read from a journal entry.
+var libraryQueryFields = map[string]func(e *JournalEntry) string{
+	"artist":      func(e *JournalEntry) string { return e.Artist },
+	"albumartist": func(e *JournalEntry) string { return e.Artist },
+	"album":       func(e *JournalEntry) string { return e.Album },
+	"date":        func(e *JournalEntry) string { return e.Date },
+	"year":        func(e *JournalEntry) string { return e.Date },
+	"quality":     func(e *JournalEntry) string { return e.Quality },
+	"source":      func(e *JournalEntry) string { return string(e.Source) },
+	"path":        func(e *JournalEntry) string { return e.Dir },
+	"id":          func(e *JournalEntry) string { return e.ID },
+}
+
+// splitQuery splits a query into terms on whitespace, keeping double-quoted
+// parts together: `album:"OK Computer" 1997` → [album:OK Computer, 1997].
+func splitQuery(q string) []string {
+	var terms []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if cur.Len() > 0 {
+				terms = append(terms, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		terms = append(terms, cur.String())
+	}
+	return terms
+}
+
+// parseLibraryQuery compiles a beets-style query into a matcher over journal
+// entries. Terms are ANDed; "field:value" does a case-insensitive substring
+// match on that field ("field:=value" for an exact match), a bare term
+// matches the artist or album (or a year), and a leading "-" negates a term.
+func parseLibraryQuery(q string) (func(*JournalEntry) bool, error) {
+	var preds []func(*JournalEntry) bool
+	for _, term := range splitQuery(q) {
+		negate := false
+		if strings.HasPrefix(term, "-") && len(term) > 1 {
+			negate, term = true, term[1:]
+		}
+
+		var pred func(*JournalEntry) bool
+		if field, value, ok := strings.Cut(term, ":"); ok {
+			get, known := libraryQueryFields[strings.ToLower(field)]
+			if !known {
+				return nil, fmt.Errorf("unknown query field %q", field)
+			}
+			if exact, isExact := strings.CutPrefix(value, "="); isExact {
+				pred = func(e *JournalEntry) bool { return strings.EqualFold(get(e), exact) }
+			} else {
+				v := strings.ToLower(value)
+				pred = func(e *JournalEntry) bool { return strings.Contains(strings.ToLower(get(e)), v) }
+			}
+		} else {
+			v := strings.ToLower(term)
+			pred = func(e *JournalEntry) bool {
+				return strings.Contains(strings.ToLower(e.Artist), v) ||
+					strings.Contains(strings.ToLower(e.Album), v) ||
+					strings.HasPrefix(e.Date, v)
+			}
+		}
+		if negate {
+			p := pred
+			pred = func(e *JournalEntry) bool { return !p(e) }
+		}
+		preds = append(preds, pred)
+	}
+
+	return func(e *JournalEntry) bool {
+		for _, p := range preds {
+			if !p(e) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// QueryJournal returns the journal entries matching q, oldest first.
+func QueryJournal(q string) ([]*JournalEntry, error) {
+	match, err := parseLibraryQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := JournalEntries()
+	if err != nil {
+		return nil, err
+	}
+	var out []*JournalEntry
+	for _, e := range entries {
+		if match(e) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package library
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// IsRcloneRemote reports whether p names an rclone remote ("s3:bucket/music",
+// "gdrive:Music") rather than a local path.
+func IsRcloneRemote(p string) bool {
+	if p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, ".") {
+		return false
+	}
+	name, _, ok := strings.Cut(p, ":")
+	return ok && name != "" && !strings.ContainsAny(name, `/\`)
+}
+
+// rcloneStagingDir is the local directory remote imports and library albums
+// are staged in while the pipeline works on them, from RCLONE_STAGING_DIR.
+func rcloneStagingDir() string {
+	if d := os.Getenv("RCLONE_STAGING_DIR"); d != "" {
+		return d
+	}
+	return filepath.Join(os.TempDir(), "music-importer")
+}
+
+// LocalImportDir returns the local directory the pipeline imports from:
+// IMPORT_DIR itself, or a staging directory when IMPORT_DIR is an rclone
+// remote (which is then pulled by an rcloneSource before each run).
+func LocalImportDir() string {
+	d := os.Getenv("IMPORT_DIR")
+	if IsRcloneRemote(d) {
+		return filepath.Join(rcloneStagingDir(), "import")
+	}
+	return d
+}
+
+// LocalLibraryDir returns the local directory albums are moved into:
+// LIBRARY_DIR itself, or a staging directory when LIBRARY_DIR is an rclone
+// remote (albums are uploaded from there once complete).
+func LocalLibraryDir() string {
+	d := os.Getenv("LIBRARY_DIR")
+	if IsRcloneRemote(d) {
+		return filepath.Join(rcloneStagingDir(), "library")
+	}
+	return d
+}
+
+// RemoteLibrary returns LIBRARY_DIR if it is an rclone remote, else "".
+func RemoteLibrary() string {
+	if d := os.Getenv("LIBRARY_DIR"); IsRcloneRemote(d) {
+		return d
+	}
+	return ""
+}
+
+// Rclone runs an rclone command with any extra RCLONE_FLAGS (e.g.
+// "--bwlimit 4M --transfers 2").
+func Rclone(args ...string) ([]byte, error) {
+	args = append(args, strings.Fields(os.Getenv("RCLONE_FLAGS"))...)
+	out, err := exec.Command("rclone", args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("rclone %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// RemoteJoin joins a remote root and a slash-separated relative path.
+func RemoteJoin(remote, rel string) string {
+	if strings.HasSuffix(remote, ":") {
+		return remote + rel
+	}
+	return strings.TrimSuffix(remote, "/") + "/" + rel
+}
+
+// LibraryHasAlbum reports whether an album directory already exists in the
+// library, checking the remote when LIBRARY_DIR is one.
+func LibraryHasAlbum(libraryDir, targetDir string) bool {
+	if _, err := os.Stat(targetDir); err == nil {
+		return true
+	}
+	remote := RemoteLibrary()
+	if remote == "" {
+		return false
+	}
+	rel, err := filepath.Rel(libraryDir, targetDir)
+	if err != nil {
+		return false
+	}
+	out, err := Rclone("lsf", "--max-depth", "1", RemoteJoin(remote, filepath.ToSlash(rel)))
+	return err == nil && len(strings.TrimSpace(string(out))) > 0
+}
+
+// UploadAlbum moves a finished album from the local library staging
+// directory to the remote library. It is a no-op for a local library.
+func UploadAlbum(libraryDir, targetDir string, logf func(string)) error {
+	remote := RemoteLibrary()
+	if remote == "" {
+		return nil
+	}
+	rel, err := filepath.Rel(libraryDir, targetDir)
+	if err != nil {
+		return err
+	}
+	dst := RemoteJoin(remote, filepath.ToSlash(rel))
+	logf("Uploading to " + dst)
+	if _, err := Rclone("move", targetDir, dst, "--delete-empty-src-dirs"); err != nil {
+		return err
+	}
+	RemoveEmptyParents(targetDir, libraryDir)
+	return nil
+}
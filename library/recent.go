@@ -0,0 +1,160 @@
+package library
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// recentAlbum is one entry of the "recently added" export.
+type recentAlbum struct {
+	ID         string    `json:"id"`
+	Artist     string    `json:"artist"`
+	Album      string    `json:"album"`
+	Date       string    `json:"date,omitempty"`
+	Quality    string    `json:"quality,omitempty"`
+	ImportedAt time.Time `json:"imported_at"`
+	Cover      string    `json:"cover,omitempty"` // relative to the export directory
+	Palette    []string  `json:"palette,omitempty"`
+}
+
+// recentThumbSize is the edge length of exported cover thumbnails.
+const recentThumbSize = 300
+
+var recentTmpl = template.Must(template.New("recent").Parse(`<ul class="recently-added">
+{{- range .Albums}}
+	<li{{if .Palette}} style="--album-accent: {{index .Palette 0}}"{{end}}>
+		{{- if .Cover}}
+		<img src="{{.Cover}}" alt="" loading="lazy">
+		{{- end}}
+		<span class="album">{{.Album}}</span>
+		<span class="artist">{{.Artist}}</span>
+		{{- if .Date}}
+		<span class="date">{{.Date}}</span>
+		{{- end}}
+	</li>
+{{- end}}
+</ul>
+`))
+
+// recentExportCount returns how many albums to export (RECENT_EXPORT_COUNT,
+// default 20).
+func recentExportCount() int {
+	if n, err := strconv.Atoi(os.Getenv("RECENT_EXPORT_COUNT")); err == nil && n > 0 {
+		return n
+	}
+	return 20
+}
+
+// RecentEntries returns the last RECENT_EXPORT_COUNT journal entries,
+// newest first.
+func RecentEntries() ([]*JournalEntry, error) {
+	entries, err := JournalEntries()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ImportedAt.After(entries[j].ImportedAt)
+	})
+	if n := recentExportCount(); len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries, nil
+}
+
+// ExportRecent writes recent.json, recent.html and cover thumbnails for the
+// last imported albums into RECENT_EXPORT_DIR. It is a no-op when the
+// variable is unset; failures are logged, not returned, since the export is
+// a side effect of importing.
+func ExportRecent() {
+	dir := os.Getenv("RECENT_EXPORT_DIR")
+	if dir == "" {
+		return
+	}
+	entries, err := RecentEntries()
+	if err != nil {
+		log.Printf("[recent] reading journal: %v", err)
+		return
+	}
+
+	coversDir := filepath.Join(dir, "covers")
+	if err := os.MkdirAll(coversDir, 0755); err != nil {
+		log.Printf("[recent] %v", err)
+		return
+	}
+
+	albums := make([]recentAlbum, 0, len(entries))
+	keep := map[string]bool{}
+	for _, e := range entries {
+		a := recentAlbum{
+			ID:         e.ID,
+			Artist:     e.Artist,
+			Album:      e.Album,
+			Date:       e.Date,
+			Quality:    e.Quality,
+			ImportedAt: e.ImportedAt,
+			Palette:    e.Palette,
+		}
+		thumb := e.ID + ".jpg"
+		dst := filepath.Join(coversDir, thumb)
+		// Rewrite the thumbnail when the cover is newer, e.g. replaced art.
+		if cover, err := metadata.FindCoverImage(filepath.Join(LocalLibraryDir(), e.Dir)); err == nil {
+			src, serr := os.Stat(cover)
+			if st, err := os.Stat(dst); err != nil || serr == nil && st.ModTime().Before(src.ModTime()) {
+				if err := writeThumbnail(cover, dst, recentThumbSize); err != nil {
+					log.Printf("[recent] thumbnail for %s: %v", e.Dir, err)
+				}
+			}
+		}
+		if _, err := os.Stat(dst); err == nil {
+			a.Cover = "covers/" + thumb
+			keep[thumb] = true
+		}
+		albums = append(albums, a)
+	}
+
+	// Drop thumbnails of albums that have aged out of the list.
+	if old, err := os.ReadDir(coversDir); err == nil {
+		for _, f := range old {
+			if !keep[f.Name()] {
+				os.Remove(filepath.Join(coversDir, f.Name()))
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(albums, "", "  ")
+	if err != nil {
+		log.Printf("[recent] %v", err)
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "recent.json"), data); err != nil {
+		log.Printf("[recent] %v", err)
+	}
+
+	var html strings.Builder
+	if err := recentTmpl.Execute(&html, struct{ Albums []recentAlbum }{albums}); err != nil {
+		log.Printf("[recent] %v", err)
+		return
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "recent.html"), []byte(html.String())); err != nil {
+		log.Printf("[recent] %v", err)
+	}
+}
+
+// writeFileAtomic writes data to path via a temp file so readers never see a
+// partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
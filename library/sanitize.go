@@ -0,0 +1,266 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// defaultSanitizeMap replaces the characters that are unsafe in file names
+// on common file systems.
+var defaultSanitizeMap = map[string]string{
+	"/":  "_",
+	"\\": "_",
+	":":  "-",
+	"?":  "",
+	"*":  "",
+	"\"": "",
+	"<":  "",
+	">":  "",
+	"|":  "",
+}
+
+// posixSanitizeMap only replaces what POSIX file names cannot contain, plus
+// "\\" so a name never becomes a path anywhere.
+var posixSanitizeMap = map[string]string{
+	"/":    "_",
+	"\\":   "_",
+	"\x00": "",
+}
+
+// sanitizeProfile returns SANITIZE_PROFILE: "posix" replaces only what POSIX
+// forbids, "windows" also makes names valid on Windows/SMB (no control
+// characters, trailing dots or spaces, or reserved names like CON and NUL),
+// and "strict" is windows restricted to plain ASCII letters, digits and a
+// little punctuation. Anything else keeps the default table.
+func sanitizeProfile() string {
+	switch p := strings.ToLower(os.Getenv("SANITIZE_PROFILE")); p {
+	case "posix", "windows", "strict":
+		return p
+	}
+	return ""
+}
+
+// sanitizeReplacer builds the replacement table: the profile's table
+// (defaultSanitizeMap unless posix) overlaid with SANITIZE_MAP, a
+// comma-separated list of from=to pairs (`:=_,&=and`, an empty "to" removes
+// the character). "/" and "\\" always stay replaced so a name can never
+// become a path.
+func sanitizeReplacer(profile string) *strings.Replacer {
+	base := defaultSanitizeMap
+	if profile == "posix" {
+		base = posixSanitizeMap
+	}
+	m := make(map[string]string, len(base))
+	for k, v := range base {
+		m[k] = v
+	}
+	for _, pair := range strings.Split(os.Getenv("SANITIZE_MAP"), ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || strings.ContainsAny(to, `/\`) {
+			continue
+		}
+		if from == "/" || from == `\` {
+			continue
+		}
+		m[from] = to
+	}
+
+	// Longest keys first so multi-character entries win over their prefixes.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	oldnew := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		oldnew = append(oldnew, k, m[k])
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// asciiFold maps letters that have no ASCII decomposition.
+var asciiFold = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "Th", 'ł': "l",
+	'Ł': "L", 'ı': "i", '‘': "'", '’': "'", '“': "", '”': "", '–': "-", '—': "-",
+	'…': "...",
+}
+
+// toASCII strips accents (é → e), folds the letters in asciiFold and
+// replaces anything else outside printable ASCII with "_", collapsing runs.
+func toASCII(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(s) {
+		if f, ok := asciiFold[r]; ok {
+			b.WriteString(f)
+			continue
+		}
+		switch {
+		case r < 0x80 && unicode.IsPrint(r):
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// combining accent left over from decomposition
+		case !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// ASCIIPaths reports whether library names are restricted to printable
+// ASCII: SANITIZE_ASCII=true or the strict profile.
+func ASCIIPaths() bool {
+	return strings.ToLower(os.Getenv("SANITIZE_ASCII")) == "true" || sanitizeProfile() == "strict"
+}
+
+// sanitizeNFC reports whether SANITIZE_NFC=true, which composes names to
+// Unicode NFC so "é" typed as e plus an accent matches the single character.
+func sanitizeNFC() bool {
+	return strings.ToLower(os.Getenv("SANITIZE_NFC")) == "true"
+}
+
+// windowsReserved are device names Windows won't open as files, with or
+// without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// strictAllowed reports whether the strict profile keeps r.
+func strictAllowed(r rune) bool {
+	return r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" ._-()[]&,'+!#", r))
+}
+
+// maxNameBytes returns SANITIZE_MAX_NAME, the longest a single file or
+// directory name may be in bytes (default 255, the common file system limit).
+func maxNameBytes() int {
+	if n, err := strconv.Atoi(os.Getenv("SANITIZE_MAX_NAME")); err == nil && n > 0 {
+		return n
+	}
+	return 255
+}
+
+// maxPathBytes returns SANITIZE_MAX_PATH, the longest a library path may be
+// in bytes relative to the library root, or 0 for no limit.
+func maxPathBytes() int {
+	if n, err := strconv.Atoi(os.Getenv("SANITIZE_MAX_PATH")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// truncateName cuts s to at most n bytes on a rune boundary and drops the
+// spaces (and, for Windows, dots) the cut may leave at the end.
+func truncateName(s string, n int) string {
+	if len(s) > n {
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = strings.TrimRight(s[:n], " ")
+	}
+	return s
+}
+
+// finishName applies the profile's whole-name rules to one path component.
+func finishName(s, profile string) string {
+	if profile == "strict" {
+		s = strings.Map(func(r rune) rune {
+			if strictAllowed(r) {
+				return r
+			}
+			return '_'
+		}, s)
+	}
+	if profile == "windows" || profile == "strict" {
+		s = strings.Map(func(r rune) rune {
+			if r < 0x20 {
+				return -1
+			}
+			return r
+		}, s)
+		s = strings.TrimRight(s, ". ")
+		base, _, _ := strings.Cut(s, ".")
+		if windowsReserved[strings.ToUpper(strings.TrimSpace(base))] {
+			s = "_" + s
+		}
+	}
+	return s
+}
+
+// sanitizeComponent applies the profile's name rules and length limit to a
+// complete directory name.
+func sanitizeComponent(s string) string {
+	profile := sanitizeProfile()
+	s = truncateName(finishName(s, profile), maxNameBytes())
+	if profile == "windows" || profile == "strict" {
+		s = strings.TrimRight(s, ". ")
+	}
+	return s
+}
+
+// Sanitize removes or replaces characters that are unsafe in file system
+// paths, following SANITIZE_PROFILE, SANITIZE_MAP, SANITIZE_NFC and
+// SANITIZE_ASCII, and keeps the result within SANITIZE_MAX_NAME.
+func Sanitize(s string) string {
+	if sanitizeNFC() {
+		s = norm.NFC.String(s)
+	}
+	if ASCIIPaths() {
+		s = toASCII(s)
+	}
+	return sanitizeComponent(sanitizeReplacer(sanitizeProfile()).Replace(s))
+}
+
+// SanitizeFilename applies Sanitize to a file name, leaving its extension
+// alone so the file keeps its type; a name too long loses the end of its stem.
+func SanitizeFilename(name string) string {
+	ext := filepath.Ext(name)
+	stem := Sanitize(strings.TrimSuffix(name, ext))
+	return sanitizeComponent(truncateName(stem, maxNameBytes()-len(ext)) + ext)
+}
+
+// pathFileReserve is how much of SANITIZE_MAX_PATH the album directory leaves
+// for file names.
+const pathFileReserve = 64
+
+// fitPath shortens the longest components of a relative path until it is at
+// most limit bytes, keeping each at least minKeep bytes. It gives up rather
+// than cut further.
+func fitPath(parts []string, limit, minKeep int) []string {
+	total := func() int {
+		n := len(parts) - 1
+		for _, p := range parts {
+			n += len(p)
+		}
+		return n
+	}
+	for over := total() - limit; over > 0; over = total() - limit {
+		longest := 0
+		for i, p := range parts {
+			if len(p) > len(parts[longest]) {
+				longest = i
+			}
+		}
+		keep := max(len(parts[longest])-over, minKeep)
+		if keep >= len(parts[longest]) {
+			break
+		}
+		parts[longest] = sanitizeComponent(truncateName(parts[longest], keep))
+	}
+	return parts
+}
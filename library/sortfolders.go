@@ -0,0 +1,84 @@
+package library
+
+import (
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// sortFolderLetters are the buckets a name's first letter is collated against.
+var sortFolderLetters = strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ", "")
+
+// sortFoldersEnabled reports whether artist directories should be grouped
+// under a first-level bucket folder (A/, B/, … 0-9/, #/).
+func sortFoldersEnabled() bool {
+	return strings.ToLower(os.Getenv("LIBRARY_SORT_FOLDERS")) == "true"
+}
+
+// sortBucket returns the first-level library folder for name. It backs both
+// LIBRARY_SORT_FOLDERS and the firstLetter path template helper.
+//
+// A leading "The " is ignored, so "The Beatles" sorts under B. The first
+// letter is then collated against A–Z using the locale in LIBRARY_SORT_LOCALE
+// (e.g. "de", "sv"), ignoring case and diacritics. This means "Ärzte" lands in
+// A/ for German but in Ä/ for Swedish, where Ä is a letter of its own.
+//
+// Other alphabetic scripts (Cyrillic, Greek, …) bucket by their own upper-case
+// letter, Hangul by its leading consonant, and scripts without a small
+// alphabet (Han, kana) go to #/ along with punctuation-only names. Names
+// starting with a digit go to 0-9/.
+func sortBucket(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) > 4 && strings.EqualFold(name[:4], "the ") {
+		name = name[4:]
+	}
+
+	first := rune(-1)
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			first = r
+			break
+		}
+	}
+
+	switch {
+	case first < 0:
+		return "#"
+	case unicode.IsDigit(first):
+		return "0-9"
+	case unicode.Is(unicode.Hangul, first):
+		return hangulInitial(first)
+	}
+
+	col := collate.New(language.Make(os.Getenv("LIBRARY_SORT_LOCALE")),
+		collate.IgnoreCase, collate.IgnoreDiacritics, collate.IgnoreWidth)
+	s := string(first)
+	for _, l := range sortFolderLetters {
+		if col.CompareString(s, l) == 0 {
+			return l
+		}
+	}
+
+	// A letter the locale sorts separately (Å, Ø, Æ, …) or one from another
+	// cased alphabet gets its own bucket.
+	if unicode.Is(unicode.Latin, first) || unicode.IsUpper(first) || unicode.IsLower(first) {
+		return string(unicode.ToUpper(first))
+	}
+	return "#"
+}
+
+// hangulInitials are the compatibility jamo for the 19 Hangul leading consonants.
+var hangulInitials = []rune("ㄱㄲㄴㄷㄸㄹㅁㅂㅃㅅㅆㅇㅈㅉㅊㅋㅌㅍㅎ")
+
+// hangulInitial returns the leading consonant of a precomposed Hangul syllable,
+// which is how Korean indexes are conventionally grouped.
+func hangulInitial(r rune) string {
+	const base, perInitial = 0xAC00, 21 * 28
+	if r < base || r > 0xD7A3 {
+		return "#"
+	}
+	return string(hangulInitials[(r-base)/perInitial])
+}
@@ -0,0 +1,129 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // cover art may be PNG
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// writeThumbnail scales the image at src down to fit within size×size pixels
+// (never up) and writes it to dst as a JPEG. Each output pixel averages the
+// block of source pixels it covers.
+func writeThumbnail(src, dst string, size int) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", src, err)
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return fmt.Errorf("%s has no pixels", src)
+	}
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := b.Min.Y+ty*h/th, b.Min.Y+max((ty+1)*h/th, ty*h/th+1)
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := b.Min.X+tx*w/tw, b.Min.X+max((tx+1)*w/tw, tx*w/tw+1)
+			var r, g, bl, n uint32
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, _ := img.At(x, y).RGBA()
+					r, g, bl, n = r+pr, g+pg, bl+pb, n+1
+				}
+			}
+			out.Set(tx, ty, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), 0xff})
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	tf, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(tf, out, &jpeg.Options{Quality: 85}); err != nil {
+		tf.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Bounds and default for sizes requested from the thumbnail cache.
+const (
+	MinThumbnailSize     = 16
+	MaxThumbnailSize     = 1200
+	DefaultThumbnailSize = 300
+)
+
+// ErrNoCover is returned by Thumbnail when the album has no cover image.
+var ErrNoCover = errors.New("album has no cover image")
+
+// thumbMu serialises thumbnail generation so concurrent requests for the
+// same image do not write the same temp file.
+var thumbMu sync.Mutex
+
+// Thumbnail returns the path of a cached JPEG thumbnail, at most size pixels
+// on each edge, of the cover of the journalled album with the given ID.
+// Thumbnails live in DATA_DIR/thumbnails/<size>/<id>.jpg and are regenerated
+// when the cover is newer than the cached copy. It returns an error wrapping
+// fs.ErrNotExist for an unknown ID and ErrNoCover when there is no cover.
+func Thumbnail(id string, size int) (string, error) {
+	e, err := LookupJournalEntry(id)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", fmt.Errorf("album %s: %w", id, fs.ErrNotExist)
+	}
+	cover, err := metadata.FindCoverImage(filepath.Join(LocalLibraryDir(), e.Dir))
+	if err != nil {
+		return "", ErrNoCover
+	}
+	src, err := os.Stat(cover)
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(DataDir(), "thumbnails", strconv.Itoa(size), id+".jpg")
+	thumbMu.Lock()
+	defer thumbMu.Unlock()
+	if st, err := os.Stat(dst); err == nil && !st.ModTime().Before(src.ModTime()) {
+		return dst, nil
+	}
+	if err := writeThumbnail(cover, dst, size); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
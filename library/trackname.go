@@ -0,0 +1,107 @@
+package library
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// defaultTrackTemplate names tracks "01 - Title".
+const defaultTrackTemplate = `{{printf "%02d" .Track}} - {{.Title}}`
+
+// trackTemplateData is the value TRACK_TEMPLATE is executed against. The
+// extension is appended to the result, and string fields are sanitized.
+type trackTemplateData struct {
+	Track     int
+	Disc      int
+	DiscTotal int
+	Title     string
+	Artist    string
+	Album     string
+	Original  string // the file's current name without extension
+}
+
+var (
+	trackTemplateOnce sync.Once
+	trackTemplate     *template.Template
+)
+
+// trackNameTemplate returns the parsed TRACK_TEMPLATE, falling back to the
+// default when it is unset or invalid.
+func trackNameTemplate() *template.Template {
+	trackTemplateOnce.Do(func() {
+		trackTemplate = parsePathTemplate("TRACK_TEMPLATE", defaultTrackTemplate)
+	})
+	return trackTemplate
+}
+
+// TrackFileNames renders the library file name of each track from its tags,
+// keyed by the track's path. Lyrics files in extras whose stem matches a
+// track follow that track's new name. A track without a title or track
+// number keeps its name, as do audiobooks, whose chapter files are often
+// named deliberately. Names that collide within the album get " (2)", " (3)",
+// … before the extension.
+func TrackFileNames(md *metadata.MusicMetadata, tracks, extras []string) map[string]string {
+	names := map[string]string{}
+	if md.Audiobook {
+		return names
+	}
+	stems := map[string]string{} // old stem → new stem
+	taken := map[string]bool{}
+	for _, track := range tracks {
+		ext := filepath.Ext(track)
+		stem := strings.TrimSuffix(filepath.Base(track), ext)
+		name := renderTrackName(md, track, stem)
+		if name == "" {
+			name = stem
+		}
+		unique := name
+		for n := 2; taken[strings.ToLower(unique+ext)]; n++ {
+			unique = fmt.Sprintf("%s (%d)", name, n)
+		}
+		taken[strings.ToLower(unique+ext)] = true
+		names[track] = unique + ext
+		stems[filepath.Join(filepath.Dir(track), stem)] = unique
+	}
+	for _, f := range extras {
+		ext := filepath.Ext(f)
+		if stem, ok := stems[strings.TrimSuffix(f, ext)]; ok {
+			names[f] = stem + ext
+		}
+	}
+	return names
+}
+
+// renderTrackName executes TRACK_TEMPLATE for one track and returns the
+// sanitized stem, or "" when the track should keep its name.
+func renderTrackName(md *metadata.MusicMetadata, path, original string) string {
+	tags, err := metadata.ReadTrackTags(path)
+	if err != nil || tags.Title == "" || tags.Track == 0 {
+		return ""
+	}
+	data := trackTemplateData{
+		Track:     tags.Track,
+		Disc:      tags.Disc,
+		DiscTotal: tags.DiscTotal,
+		Title:     Sanitize(tags.Title),
+		Artist:    Sanitize(metadata.FirstNonEmpty(tags.Artist, md.Artist)),
+		Album:     Sanitize(md.Album),
+		Original:  original,
+	}
+	var b strings.Builder
+	if err := trackNameTemplate().Execute(&b, data); err != nil {
+		log.Printf("TRACK_TEMPLATE failed for %q, keeping its name: %v", filepath.Base(path), err)
+		return ""
+	}
+	// The name is one path component; a "/" from the template is replaced.
+	name := strings.TrimSpace(Sanitize(b.String()))
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,78 @@
+package library
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	transliterationOnce sync.Once
+	transliterations    map[string]string
+)
+
+// transliterationMapPath returns TRANSLITERATION_MAP, defaulting to
+// DATA_DIR/transliterations.txt.
+func transliterationMapPath() string {
+	if p := os.Getenv("TRANSLITERATION_MAP"); p != "" {
+		return p
+	}
+	return filepath.Join(DataDir(), "transliterations.txt")
+}
+
+// transliterationOverrides loads the per-artist ASCII names (see
+// readNameMap). Keys are matched NFC-normalized and case-insensitively.
+func transliterationOverrides() map[string]string {
+	transliterationOnce.Do(func() {
+		transliterations = readNameMap(transliterationMapPath(), transliterationKey)
+	})
+	return transliterations
+}
+
+// readNameMap loads a file of "original = replacement" lines, "#" starting a
+// comment, with keys folded by key. A missing file is an empty map.
+func readNameMap(path string, key func(string) string) map[string]string {
+	m := map[string]string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=")
+		if from, to = strings.TrimSpace(from), strings.TrimSpace(to); ok && from != "" && to != "" {
+			m[key(from)] = to
+		}
+	}
+	return m
+}
+
+func transliterationKey(s string) string {
+	return strings.ToLower(norm.NFC.String(s))
+}
+
+// pathName picks the name a path component is built from. With
+// SANITIZE_ASCII on, an override from the transliteration map wins, then
+// MusicBrainz's Latin-script name latin, before Sanitize folds whatever is
+// left to ASCII.
+func pathName(name, latin string) string {
+	if !ASCIIPaths() || name == "" {
+		return name
+	}
+	if v, ok := transliterationOverrides()[transliterationKey(name)]; ok {
+		return v
+	}
+	if latin != "" {
+		return latin
+	}
+	return name
+}
@@ -0,0 +1,214 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// TrashEntry is one file or folder the importer deleted, kept in TRASH_DIR
+// until it is restored or purged.
+type TrashEntry struct {
+	ID        string        `json:"id"`
+	Path      string        `json:"path"` // where it was, absolute
+	Reason    string        `json:"reason"`
+	TrashedAt time.Time     `json:"trashed_at"`
+	Dir       bool          `json:"dir,omitempty"`
+	Journal   *JournalEntry `json:"journal,omitempty"` // removed with a library album, re-added on restore
+}
+
+// trashMeta is the file beside each trashed item describing it.
+const trashMeta = "trash.json"
+
+// TrashDir returns TRASH_DIR, where deleted files are kept (default
+// DATA_DIR/trash).
+func TrashDir() string {
+	if d := os.Getenv("TRASH_DIR"); d != "" {
+		return d
+	}
+	return filepath.Join(DataDir(), "trash")
+}
+
+// trashEnabled reports whether deletes go to the trash (TRASH, default on).
+func trashEnabled() bool {
+	return os.Getenv("TRASH") != "false"
+}
+
+// trashRetention returns TRASH_RETENTION (default 720h, 30 days), how long
+// trashed files are kept before PurgeTrash deletes them.
+func trashRetention() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("TRASH_RETENTION")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// MoveToTrash moves path into the trash, recording why. journal, if not
+// nil, is the journal entry removed along with a library album, restored
+// with it. With TRASH=false the path is deleted outright and nil returned.
+func MoveToTrash(path, reason string, journal *JournalEntry) (*TrashEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !trashEnabled() {
+		return nil, os.RemoveAll(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &TrashEntry{
+		ID:        NewJournalID(),
+		Path:      abs,
+		Reason:    reason,
+		TrashedAt: time.Now().UTC(),
+		Dir:       info.IsDir(),
+		Journal:   journal,
+	}
+	dir := filepath.Join(TrashDir(), e.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	data, _ := json.MarshalIndent(e, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, trashMeta), data, 0644); err != nil {
+		return nil, err
+	}
+	if err := moveAcross(abs, filepath.Join(dir, filepath.Base(abs))); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return e, nil
+}
+
+// TrashEntries returns everything in the trash, most recently trashed first.
+func TrashEntries() ([]*TrashEntry, error) {
+	dirs, err := os.ReadDir(TrashDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var out []*TrashEntry
+	for _, d := range dirs {
+		if e, err := loadTrashEntry(d.Name()); err == nil {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TrashedAt.After(out[j].TrashedAt) })
+	return out, nil
+}
+
+func loadTrashEntry(id string) (*TrashEntry, error) {
+	if !validLogID.MatchString(id) {
+		return nil, fmt.Errorf("no trash item %q: %w", id, fs.ErrNotExist)
+	}
+	data, err := os.ReadFile(filepath.Join(TrashDir(), id, trashMeta))
+	if err != nil {
+		return nil, err
+	}
+	var e TrashEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// RestoreFromTrash moves a trashed item back to where it was, refusing with
+// fs.ErrExist if something has taken its place, and re-adds its journal
+// entry. A track restored into a library album refreshes that album's
+// checksums.
+func RestoreFromTrash(id string) (*TrashEntry, error) {
+	e, err := loadTrashEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(e.Path); err == nil {
+		return nil, fmt.Errorf("restoring %s: %w", e.Path, fs.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(TrashDir(), e.ID)
+	if err := moveAcross(filepath.Join(dir, filepath.Base(e.Path)), e.Path); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(dir)
+	fmt.Println("→ Restored from trash:", e.Path)
+
+	if e.Journal != nil {
+		return e, addJournalEntry(e.Journal)
+	}
+	libDir := LocalLibraryDir()
+	if rel, err := filepath.Rel(libDir, filepath.Dir(e.Path)); err == nil && libDir != "" && !strings.HasPrefix(rel, "..") {
+		return e, RefreshJournalFiles(libDir, rel)
+	}
+	return e, nil
+}
+
+// DeleteFromTrash deletes a trashed item for good.
+func DeleteFromTrash(id string) error {
+	if _, err := loadTrashEntry(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(TrashDir(), id))
+}
+
+// PurgeTrash deletes trashed items older than TRASH_RETENTION and returns
+// how many it removed.
+func PurgeTrash() (int, error) {
+	entries, err := TrashEntries()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-trashRetention())
+	n := 0
+	var errs []error
+	for _, e := range entries {
+		if e.TrashedAt.After(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(TrashDir(), e.ID)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("[trash] purged %d item(s) older than %s", n, trashRetention())
+	}
+	return n, errors.Join(errs...)
+}
+
+// moveAcross renames src to dst, copying and then deleting when they are on
+// different filesystems.
+func moveAcross(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFileContents(path, target)
+	})
+	if err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
@@ -0,0 +1,54 @@
+package library
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VerifyMovesEnabled reports whether VERIFY_MOVES=true, which checksums every
+// file before and after it is moved into the library.
+func VerifyMovesEnabled() bool {
+	return strings.ToLower(os.Getenv("VERIFY_MOVES")) == "true"
+}
+
+// VerifiedFile compares one file's checksum before and after its move.
+type VerifiedFile struct {
+	Path         string `json:"path"` // destination, relative to LIBRARY_DIR
+	SourceSHA256 string `json:"source_sha256"`
+	DestSHA256   string `json:"dest_sha256"`
+	OK           bool   `json:"ok"`
+}
+
+// MoveVerification is the per-album record proving the move altered no bits.
+type MoveVerification struct {
+	VerifiedAt time.Time      `json:"verified_at"`
+	OK         bool           `json:"ok"`
+	Files      []VerifiedFile `json:"files"`
+}
+
+// exportVerification writes an entry's verification record to
+// VERIFY_REPORT_DIR as <journal id>.json, if that variable is set.
+func exportVerification(e *JournalEntry) error {
+	dir := os.Getenv("VERIFY_REPORT_DIR")
+	if dir == "" || e.Verification == nil {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	report := struct {
+		ID     string `json:"id"`
+		Artist string `json:"artist"`
+		Album  string `json:"album"`
+		Dir    string `json:"dir"`
+		*MoveVerification
+	}{e.ID, e.Artist, e.Album, e.Dir, e.Verification}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, e.ID+".json"), data, 0644)
+}
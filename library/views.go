@@ -0,0 +1,163 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gabehf/music-import/metadata"
+)
+
+// viewKinds are the alternate layouts LIBRARY_VIEWS can name. Each is a
+// "by-<kind>" folder of symlinks to the albums, e.g.
+// by-genre/Jazz/Artist - Album → ../../Artist/Album.
+var viewKinds = []string{"genre", "year", "label"}
+
+// LibraryViews returns LIBRARY_VIEWS, the comma-separated views kept up to
+// date after each run. Unknown names are ignored.
+func LibraryViews() []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv("LIBRARY_VIEWS"), ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		switch {
+		case slices.Contains(out, v):
+		case slices.Contains(viewKinds, v):
+			out = append(out, v)
+		case v != "":
+			log.Printf("[views] unknown view %q", v)
+		}
+	}
+	return out
+}
+
+// libraryViewsDir returns LIBRARY_VIEWS_DIR, where the by-<kind> folders
+// are kept, defaulting to the library itself.
+func libraryViewsDir(libDir string) string {
+	return metadata.FirstNonEmpty(os.Getenv("LIBRARY_VIEWS_DIR"), libDir)
+}
+
+// viewFolders returns the folders an album is listed under in a view: each
+// of its genres, its year, or its label. Entries journalled before genres
+// and labels were recorded have them read from their first track.
+func viewFolders(kind string, e *JournalEntry, libDir string) []string {
+	genres, label := e.Genres, e.Label
+	if kind != "year" && len(genres) == 0 && label == "" {
+		for _, f := range e.Files {
+			if !metadata.IsLibraryTrack(f.Path) {
+				continue
+			}
+			if md, err := metadata.ReadTags(filepath.Join(libDir, f.Path)); err == nil {
+				genres, label = metadata.Values(md.Genre), metadata.FirstValue(md.Label)
+			}
+			break
+		}
+	}
+	switch kind {
+	case "genre":
+		return genres
+	case "year":
+		if len(e.Date) >= 4 {
+			return []string{e.Date[:4]}
+		}
+	case "label":
+		if label != "" {
+			return []string{label}
+		}
+	}
+	return nil
+}
+
+// BuildLibraryViews makes the by-<kind> symlink trees for views match the
+// journal: every album still in libDir gets an "Artist - Album" link in
+// each of its folders, and links to albums that are gone, or in views not
+// asked for, are removed. Only symlinks are ever deleted. It returns the
+// number of links in place.
+func BuildLibraryViews(libDir string, views []string) (int, error) {
+	entries, err := JournalEntries()
+	if err != nil {
+		return 0, err
+	}
+	root := libraryViewsDir(libDir)
+	want := map[string]string{} // link → album directory
+	for _, e := range entries {
+		album := filepath.Join(libDir, e.Dir)
+		if _, err := os.Stat(album); err != nil {
+			continue
+		}
+		name := Sanitize(e.Artist + " - " + e.Album)
+		for _, kind := range views {
+			for _, v := range viewFolders(kind, e, libDir) {
+				dir := filepath.Join(root, "by-"+kind, Sanitize(v))
+				link := filepath.Join(dir, name)
+				for n := 2; want[link] != "" && want[link] != album; n++ {
+					link = filepath.Join(dir, fmt.Sprintf("%s (%d)", name, n))
+				}
+				want[link] = album
+			}
+		}
+	}
+
+	target := func(link string) string {
+		rel, _ := filepath.Rel(filepath.Dir(link), want[link])
+		return rel
+	}
+	var errs []error
+	for _, kind := range viewKinds {
+		dir := filepath.Join(root, "by-"+kind)
+		var dirs []string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			switch {
+			case err != nil:
+			case d.IsDir():
+				dirs = append(dirs, path)
+			case d.Type()&fs.ModeSymlink != 0:
+				if t, err := os.Readlink(path); err != nil || want[path] == "" || t != target(path) {
+					if err := os.Remove(path); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			}
+			return nil
+		})
+		for i := len(dirs) - 1; i >= 0; i-- {
+			os.Remove(dirs[i]) // only succeeds when empty
+		}
+	}
+
+	links := 0
+	for link := range want {
+		if t, err := os.Readlink(link); err == nil && t == target(link) {
+			links++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Symlink(target(link), link); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		links++
+	}
+	return links, errors.Join(errs...)
+}
+
+// UpdateLibraryViews rebuilds the LIBRARY_VIEWS symlink trees after a run.
+// It is a no-op when the variable is unset or the library is remote;
+// failures are logged, not returned, since the views are a side effect of
+// importing.
+func UpdateLibraryViews() {
+	views := LibraryViews()
+	if len(views) == 0 || RemoteLibrary() != "" {
+		return
+	}
+	if _, err := BuildLibraryViews(LocalLibraryDir(), views); err != nil {
+		log.Printf("[views] %v", err)
+	}
+}
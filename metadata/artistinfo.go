@@ -0,0 +1,78 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MBArtistInfo is a MusicBrainz artist looked up by MBID, with its genres.
+type MBArtistInfo struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	SortName       string `json:"sort-name"`
+	Type           string `json:"type"`   // Person, Group, Orchestra, …
+	Gender         string `json:"gender"` // only for people
+	Country        string `json:"country"`
+	Disambiguation string `json:"disambiguation"`
+	LifeSpan       struct {
+		Begin string `json:"begin"`
+		End   string `json:"end"`
+	} `json:"life-span"`
+	Genres []MBGenre `json:"genres"`
+}
+
+// GetMBArtist fetches an artist by MBID.
+func GetMBArtist(mbid string) (*MBArtistInfo, error) {
+	var a MBArtistInfo
+	err := MBGet(fmt.Sprintf("/ws/2/artist/%s?fmt=json&inc=genres", url.QueryEscape(mbid)), &a)
+	return &a, err
+}
+
+var (
+	// lastfmReadMore is the link and licence notice Last.fm appends to bios.
+	lastfmReadMore = regexp.MustCompile(`(?s)<a href="https?://www\.last\.fm/.*$`)
+	htmlTag        = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ArtistBiography returns Last.fm's biography of an artist as plain text,
+// or "" when it has none. It needs LASTFM_API_KEY.
+func ArtistBiography(artist string) (string, error) {
+	key := os.Getenv("LASTFM_API_KEY")
+	if key == "" {
+		return "", errors.New("LASTFM_API_KEY is not set")
+	}
+	params := url.Values{
+		"method":      {"artist.getinfo"},
+		"artist":      {artist},
+		"autocorrect": {"1"},
+		"api_key":     {key},
+		"format":      {"json"},
+	}
+	resp, err := HTTPGet("https://ws.audioscrobbler.com/2.0/?" + params.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Last.fm returned %d", resp.StatusCode)
+	}
+	var data struct {
+		Artist struct {
+			Bio struct {
+				Content string `json:"content"`
+			} `json:"bio"`
+		} `json:"artist"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	bio := lastfmReadMore.ReplaceAllString(data.Artist.Bio.Content, "")
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(bio, ""))), nil
+}
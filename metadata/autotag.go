@@ -0,0 +1,511 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gabehf/music-import/tools"
+)
+
+// Match describes the release an autotagger applied to an album.
+type Match struct {
+	Similarity  float64 `json:"similarity"` // percent; 100 means a perfect match
+	ReleaseMBID string  `json:"release_mbid,omitempty"`
+	ReleaseURL  string  `json:"release_url,omitempty"`
+	Artist      string  `json:"artist,omitempty"`
+	Album       string  `json:"album,omitempty"`
+	// Editions are the equally good releases with different tracklists the
+	// match was picked from, when it was a guess (see pickEdition).
+	Editions []Edition `json:"editions,omitempty"`
+}
+
+// autotagCandidates is how many search results are fetched in full and
+// scored.
+const autotagCandidates = 5
+
+// localTrack is what the autotagger knows about a file before matching.
+type localTrack struct {
+	Path   string
+	Artist string
+	Album  string
+	Title  string
+	Disc   int
+	Track  int
+	Length time.Duration // 0 if unknown
+	Tags   map[string]string
+	Hidden bool // a pregap track, numbered 0 (see pregap.go)
+}
+
+// probeLocalTrack reads a file's tags and duration with ffprobe.
+func probeLocalTrack(path string) (localTrack, error) {
+	out, err := tools.Output("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", path)
+	if err != nil {
+		return localTrack{}, err
+	}
+	var data struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &data); err != nil {
+		return localTrack{}, err
+	}
+	tag := func(names ...string) string {
+		for k, v := range data.Format.Tags {
+			for _, n := range names {
+				if strings.EqualFold(k, n) && v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	// "3/12" style numbers carry the total after the slash.
+	number := func(s string) int {
+		n, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(s, "/", 2)[0]))
+		return n
+	}
+	t := localTrack{
+		Path:   path,
+		Tags:   data.Format.Tags,
+		Artist: FirstNonEmpty(tag("album_artist", "albumartist", "album artist"), tag("artist")),
+		Album:  tag("album"),
+		Title:  tag("title"),
+		Disc:   number(tag("disc", "discnumber")),
+		Track:  number(tag("track", "tracknumber")),
+	}
+	if secs, err := strconv.ParseFloat(data.Format.Duration, 64); err == nil {
+		t.Length = time.Duration(secs * float64(time.Second))
+	}
+	if t.Title == "" {
+		t.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if t.Track == 0 && tag("track", "tracknumber") != "" || IsHiddenTrack(path) {
+		t.Hidden, t.Track = true, 0
+	}
+	return t, nil
+}
+
+// probeAlbum probes every audio file in albumPath, ordered by disc and
+// track number, leaving out data track remnants.
+func probeAlbum(albumPath string) ([]localTrack, error) {
+	files, err := AudioFiles(albumPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no audio files")
+	}
+	local := make([]localTrack, 0, len(files))
+	for _, f := range files {
+		t, err := probeLocalTrack(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filepath.Base(f), err)
+		}
+		if isDataTrack(t) {
+			fmt.Println("→ Ignoring data track:", filepath.Base(f))
+			continue
+		}
+		local = append(local, t)
+	}
+	if len(local) == 0 {
+		return nil, errors.New("no audio files besides data tracks")
+	}
+	sort.SliceStable(local, func(i, j int) bool {
+		if local[i].Disc != local[j].Disc {
+			return local[i].Disc < local[j].Disc
+		}
+		return local[i].Track < local[j].Track
+	})
+	return local, nil
+}
+
+// releaseTrack is one track of a candidate release with its disc number.
+type releaseTrack struct {
+	MBTrack
+	Disc int
+}
+
+func releaseTracks(r *MBRelease) []releaseTrack {
+	var out []releaseTrack
+	for i, m := range r.Media {
+		disc := m.Position
+		if disc == 0 {
+			disc = i + 1
+		}
+		if m.Pregap != nil {
+			pregap := *m.Pregap
+			pregap.Position = 0
+			out = append(out, releaseTrack{MBTrack: pregap, Disc: disc})
+		}
+		for _, t := range m.Tracks {
+			out = append(out, releaseTrack{MBTrack: t, Disc: disc})
+		}
+	}
+	return out
+}
+
+// getMBReleaseWithTracks fetches a release with its tracklist, credits,
+// labels and genres.
+func getMBReleaseWithTracks(mbid string) (*MBRelease, error) {
+	var r MBRelease
+	err := MBGet(fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=recordings+artist-credits+release-groups+media+labels+genres", url.QueryEscape(mbid)), &r)
+	return &r, err
+}
+
+// pairTracks lines local files up with release tracks: by disc and track
+// number when every file has a track number, otherwise in order. Pregap
+// tracks pair with the release's pregap, if it lists one, and are otherwise
+// left out of the order. The result maps each local index to a release
+// index, or -1.
+func pairTracks(local []localTrack, remote []releaseTrack) []int {
+	pairs := make([]int, len(local))
+	numbered := true
+	for _, t := range local {
+		if t.Track == 0 && !t.Hidden {
+			numbered = false
+			break
+		}
+	}
+	var order []int
+	for j, r := range remote {
+		if r.Position > 0 {
+			order = append(order, j)
+		}
+	}
+	next := 0
+	for i := range local {
+		pairs[i] = -1
+		if local[i].Hidden {
+			pairs[i] = pregapIndex(remote, local[i].Disc)
+			continue
+		}
+		if !numbered {
+			if next < len(order) {
+				pairs[i] = order[next]
+			}
+			next++
+			continue
+		}
+		for j, r := range remote {
+			if r.Position == local[i].Track && (local[i].Disc == 0 || r.Disc == local[i].Disc) {
+				pairs[i] = j
+				break
+			}
+		}
+	}
+	return pairs
+}
+
+// releaseDistance scores how far the local album is from a candidate release:
+// 0 is a perfect match, 1 nothing in common. It weighs album title and
+// artist, track count, and per track the title and duration.
+func releaseDistance(local []localTrack, r *MBRelease, remote []releaseTrack, pairs []int) float64 {
+	var dist, weight float64
+	add := func(w, d float64) {
+		dist += w * d
+		weight += w
+	}
+
+	if local[0].Album != "" {
+		add(3, 1-stringSimilarity(local[0].Album, r.Title))
+	}
+	if local[0].Artist != "" {
+		add(3, 1-stringSimilarity(local[0].Artist, ArtistCreditString(r.ArtistCredit)))
+	}
+	remoteCount := 0
+	for _, t := range remote {
+		if t.Position > 0 {
+			remoteCount++
+		}
+	}
+	localCount := numberedTracks(local)
+	add(2, math.Min(1, math.Abs(float64(localCount-remoteCount))/float64(max(localCount, 1))))
+
+	var trackDist, trackWeight float64
+	for i, j := range pairs {
+		if j < 0 && local[i].Hidden {
+			// Few releases list their pregap; not finding it says nothing.
+			continue
+		}
+		if j < 0 {
+			trackDist += 3
+			trackWeight += 3
+			continue
+		}
+		trackDist += 1 - stringSimilarity(local[i].Title, remote[j].Title)
+		trackWeight++
+		if local[i].Length > 0 && remote[j].Length > 0 {
+			diff := math.Abs(local[i].Length.Seconds() - float64(remote[j].Length)/1000)
+			// Up to 10 s of difference is normal (gaps, encoder padding);
+			// 30 s or more is a different track.
+			trackDist += 2 * math.Min(1, math.Max(0, diff-10)/20)
+			trackWeight += 2
+		}
+	}
+	if trackWeight > 0 {
+		add(6, trackDist/trackWeight)
+	}
+	return dist / weight
+}
+
+// stringSimilarity compares two names ignoring case, punctuation and spacing,
+// returning 1 for equal and 0 for nothing in common.
+func stringSimilarity(a, b string) float64 {
+	norm := func(s string) []rune {
+		var out []rune
+		for _, r := range strings.ToLower(s) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+	ra, rb := norm(a), norm(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	// Levenshtein distance over two rows.
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+// releaseProvider is a release database the native autotagger matches
+// against. Releases come back in MusicBrainz's shape so scoring and tag
+// writing are shared.
+type releaseProvider interface {
+	name() string
+	// candidates returns the IDs of releases worth scoring for the album.
+	candidates(albumPath string, local []localTrack) ([]string, error)
+	release(id string) (*MBRelease, error)
+	releaseURL(id string) string
+	// extraTags returns provider-specific tags for a fetched release.
+	extraTags(id string) map[string]string
+}
+
+type musicBrainzProvider struct{}
+
+func (musicBrainzProvider) name() string { return "MusicBrainz" }
+
+func (musicBrainzProvider) candidates(albumPath string, local []localTrack) ([]string, error) {
+	results, err := SearchMBReleases(autotagQuery(albumPath, local))
+	if err != nil {
+		return nil, err
+	}
+	// Prefer releases with the same number of tracks, keeping search order.
+	tracks := numberedTracks(local)
+	sort.SliceStable(results, func(i, j int) bool {
+		return ReleaseTrackCount(results[i]) == tracks && ReleaseTrackCount(results[j]) != tracks
+	})
+	if len(results) > 0 && ReleaseTrackCount(results[0]) == tracks {
+		results = slices.Insert(results, 1, otherEditions(results, tracks)...)
+	}
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+// otherEditions browses the release group of the top search result for
+// releases with the same track count in formats the results don't have yet
+// (the vinyl and digital editions of a CD, say), most preferred first, so
+// they are scored alongside it.
+func otherEditions(results []MBRelease, tracks int) []MBRelease {
+	group := results[0].ReleaseGroup.ID
+	if group == "" {
+		return nil
+	}
+	time.Sleep(time.Second)
+	releases, err := GetMBGroupReleases(group)
+	if err != nil {
+		fmt.Println("Could not list editions:", err)
+		return nil
+	}
+	var formats []string
+	for _, r := range results {
+		if r.ReleaseGroup.ID == group {
+			formats = append(formats, strings.Join(releaseFormats(&r), "+"))
+		}
+	}
+	var out []MBRelease
+	for _, r := range releases {
+		f := strings.Join(releaseFormats(&r), "+")
+		if ReleaseTrackCount(r) == tracks && !slices.Contains(formats, f) {
+			formats = append(formats, f)
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return preferenceRank(&out[i]) < preferenceRank(&out[j]) })
+	return out
+}
+
+func (musicBrainzProvider) release(id string) (*MBRelease, error) { return getMBReleaseWithTracks(id) }
+
+func (musicBrainzProvider) releaseURL(id string) string {
+	return "https://musicbrainz.org/release/" + id
+}
+
+func (musicBrainzProvider) extraTags(string) map[string]string { return nil }
+
+// autotagQuery builds a MusicBrainz release search from the local tags,
+// falling back to the folder name when the files have no album tag.
+func autotagQuery(albumPath string, local []localTrack) string {
+	album := FirstNonEmpty(local[0].Album, filepath.Base(albumPath))
+	esc := func(s string) string { return strings.ReplaceAll(s, `"`, `\"`) }
+	q := fmt.Sprintf(`release:"%s"`, esc(album))
+	if local[0].Artist != "" {
+		q += fmt.Sprintf(` AND artist:"%s"`, esc(local[0].Artist))
+	}
+	return q
+}
+
+// Autotag matches the album in albumPath against MusicBrainz without beets
+// and writes the best release's tags into its files. Candidates come from a
+// search on the existing album and artist tags, or are just mbid when given;
+// each is scored on titles, track count and durations. A match below
+// minSimilarity percent is rejected unless it was pinned by mbid.
+func Autotag(albumPath, mbid string, minSimilarity float64) (*Match, error) {
+	return autotagWith(musicBrainzProvider{}, albumPath, mbid, minSimilarity)
+}
+
+// autotagWith runs the native autotagger against one provider; pinned, when
+// set, is the only candidate.
+func autotagWith(p releaseProvider, albumPath, pinned string, minSimilarity float64) (*Match, error) {
+	fmt.Printf("→ Autotagging with %s: %s\n", p.name(), albumPath)
+	local, err := probeAlbum(albumPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{pinned}
+	if pinned == "" {
+		ids, err = p.candidates(albumPath, local)
+		if err != nil {
+			return nil, fmt.Errorf("searching %s: %w", p.name(), err)
+		}
+		if len(ids) > autotagCandidates {
+			ids = ids[:autotagCandidates]
+		}
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no %s release found", p.name())
+		}
+	}
+
+	var scored []scoredRelease
+	for _, id := range ids {
+		// MusicBrainz and Discogs both allow about one request per second.
+		time.Sleep(time.Second)
+		r, err := p.release(id)
+		if err != nil {
+			fmt.Println("Could not fetch release", id+":", err)
+			continue
+		}
+		remote := releaseTracks(r)
+		pairs := pairTracks(local, remote)
+		scored = append(scored, scoredRelease{id, r, remote, pairs, releaseDistance(local, r, remote, pairs)})
+	}
+	if len(scored) == 0 {
+		return nil, fmt.Errorf("no %s release could be fetched", p.name())
+	}
+
+	chosen, editions := pickEdition(scored)
+	best, bestID, bestTracks, bestPairs := chosen.r, chosen.id, chosen.remote, chosen.pairs
+	match := &Match{
+		Similarity:  math.Round((1-chosen.dist)*1000) / 10,
+		ReleaseMBID: best.ID,
+		ReleaseURL:  p.releaseURL(bestID),
+		Artist:      ArtistCreditString(best.ArtistCredit),
+		Album:       best.Title,
+	}
+	if pinned == "" {
+		match.Editions = editions
+	}
+	fmt.Printf("→ Best match: %s — %s (%.1f%%)\n", match.Artist, match.Album, match.Similarity)
+	if len(match.Editions) > 1 {
+		fmt.Printf("→ %d editions match almost equally; picked %s %s\n", len(match.Editions), best.Country, match.Editions[0].Format)
+	}
+	if pinned == "" && match.Similarity < minSimilarity {
+		return match, fmt.Errorf("best match %.1f%% is below %.0f%%", match.Similarity, minSimilarity)
+	}
+
+	extra := p.extraTags(bestID)
+	for i, j := range bestPairs {
+		rt := releaseTrack{Disc: max(local[i].Disc, 1)}
+		switch {
+		case j >= 0:
+			rt = bestTracks[j]
+		case local[i].Hidden:
+			// An unlisted pregap track gets the album's tags and keeps its
+			// title, numbered 0 so the release's numbering stays intact.
+			fmt.Println("→ Keeping hidden track", filepath.Base(local[i].Path), "as track 0")
+		default:
+			fmt.Println("No release track for", filepath.Base(local[i].Path))
+			continue
+		}
+		tags := releaseTags(best, rt)
+		for k, v := range extra {
+			tags[k] = v
+		}
+		// Don't erase existing values with ones the provider doesn't have.
+		for k, v := range tags {
+			if v == "" {
+				delete(tags, k)
+			}
+		}
+		if err := WriteTags(local[i].Path, tags); err != nil {
+			return match, fmt.Errorf("writing tags to %s: %w", filepath.Base(local[i].Path), err)
+		}
+	}
+	return match, nil
+}
+
+// releaseTags returns the tags written for one track of a matched release.
+func releaseTags(r *MBRelease, t releaseTrack) map[string]string {
+	albumArtist := ArtistCreditString(r.ArtistCredit)
+	tags := releaseIDTags(r, t)
+	tags["ARTIST"] = FirstNonEmpty(ArtistCreditString(t.ArtistCredit), albumArtist)
+	tags["ALBUMARTIST"] = albumArtist
+	tags["ALBUMARTISTS"] = MultiValue(ArtistCreditNames(r.ArtistCredit)...)
+	tags["ALBUMARTISTSORT"] = ArtistCreditSortString(r.ArtistCredit)
+	credit := t.ArtistCredit
+	if len(credit) == 0 {
+		credit = r.ArtistCredit
+	}
+	tags["ARTISTS"] = MultiValue(ArtistCreditNames(credit)...)
+	tags["ARTISTSORT"] = ArtistCreditSortString(credit)
+	tags["ALBUM"] = r.Title
+	tags["TITLE"] = t.Title
+	tags["TRACKNUMBER"] = strconv.Itoa(t.Position)
+	tags["DISCNUMBER"] = strconv.Itoa(t.Disc)
+	for k, v := range albumReleaseTags(r) {
+		tags[k] = v
+	}
+	return tags
+}
@@ -0,0 +1,151 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedResponse is one API response kept on disk, keyed by its URL.
+type cachedResponse struct {
+	URL       string    `json:"url"`
+	Status    int       `json:"status"`
+	Body      []byte    `json:"body"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+var (
+	cacheMu  sync.Mutex
+	cacheDir string
+)
+
+// SetCacheDir enables the API response cache in dir. An empty dir disables
+// it, which is the default.
+func SetCacheDir(dir string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cacheDir = dir
+}
+
+func apiCacheDir() string {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	return cacheDir
+}
+
+// cacheTTL returns API_CACHE_TTL (default 168h), how long successful
+// responses are reused.
+func cacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("API_CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 7 * 24 * time.Hour
+}
+
+// cacheMissTTL returns API_CACHE_MISS_TTL (default 24h), how long "not
+// found" responses are reused, kept shorter so new lyrics and releases
+// show up.
+func cacheMissTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("API_CACHE_MISS_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// cachePath returns the file caching rawURL, under a folder per service
+// (the URL's host).
+func cachePath(dir, rawURL string) string {
+	host := "other"
+	if _, rest, ok := strings.Cut(rawURL, "://"); ok {
+		host, _, _ = strings.Cut(rest, "/")
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	return filepath.Join(dir, sanitizeHost(host), hex.EncodeToString(sum[:])+".json")
+}
+
+// sanitizeHost makes a host name safe to use as a folder name.
+func sanitizeHost(host string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(host))
+}
+
+// expired reports whether a cached response is past its TTL.
+func (c *cachedResponse) expired() bool {
+	ttl := cacheTTL()
+	if c.Status != http.StatusOK {
+		ttl = cacheMissTTL()
+	}
+	return time.Since(c.FetchedAt) > ttl
+}
+
+// CachedFetch returns the status and body of a GET of rawURL, reusing a
+// cached response while it is fresh. fetch performs the request; 200 and
+// 404 responses it returns are cached, anything else (and errors) are not.
+func CachedFetch(rawURL string, fetch func() (int, []byte, error)) (int, []byte, error) {
+	dir := apiCacheDir()
+	if dir == "" {
+		return fetch()
+	}
+	path := cachePath(dir, rawURL)
+	if data, err := os.ReadFile(path); err == nil {
+		var c cachedResponse
+		if json.Unmarshal(data, &c) == nil && c.URL == rawURL && !c.expired() {
+			return c.Status, c.Body, nil
+		}
+	}
+
+	status, body, err := fetch()
+	if err != nil || (status != http.StatusOK && status != http.StatusNotFound) {
+		return status, body, err
+	}
+	data, _ := json.Marshal(cachedResponse{URL: rawURL, Status: status, Body: body, FetchedAt: time.Now().UTC()})
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Printf("[cache] could not save response for %s: %v", rawURL, err)
+		}
+	}
+	return status, body, nil
+}
+
+// PruneCache deletes expired responses from the cache and returns how many
+// it removed.
+func PruneCache() (int, error) {
+	dir := apiCacheDir()
+	if dir == "" {
+		return 0, nil
+	}
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		var c cachedResponse
+		if json.Unmarshal(data, &c) != nil || c.expired() {
+			if os.Remove(path) == nil {
+				n++
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return n, err
+}
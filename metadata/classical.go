@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ClassicalMode returns CLASSICAL_MODE: "true" treats albums whose genre is
+// classical (or that carry both composer and work tags) as classical, "all"
+// treats every album that way, anything else turns classical handling off.
+func ClassicalMode() string {
+	switch m := strings.ToLower(os.Getenv("CLASSICAL_MODE")); m {
+	case "true", "all":
+		return m
+	}
+	return ""
+}
+
+// IsClassical reports whether md is handled as a classical album: composer
+// and work tags are fetched for it and CLASSICAL_TEMPLATE lays it out.
+func IsClassical(md *MusicMetadata) bool {
+	switch ClassicalMode() {
+	case "all":
+		return true
+	case "true":
+		return strings.Contains(strings.ToLower(md.Genre), "classical") || (md.Composer != "" && md.Work != "")
+	}
+	return false
+}
+
+// getMBReleaseWithWorks fetches a release with each recording's performed
+// work, the work's composer and the recording's conductor.
+func getMBReleaseWithWorks(mbid string) (*MBRelease, error) {
+	var r MBRelease
+	err := MBGet(fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=recordings+artist-credits+recording-level-rels+work-rels+work-level-rels+artist-rels", url.QueryEscape(mbid)), &r)
+	return &r, err
+}
+
+// classicalTags returns the composer, work and conductor tags of a release
+// track. Several composers or conductors are joined with "; ".
+func classicalTags(t releaseTrack) map[string]string {
+	var composers, composerSorts, conductors []string
+	tags := map[string]string{}
+	for _, rel := range t.Recording.Relations {
+		switch {
+		case rel.Type == "performance" && rel.Work != nil && tags["WORK"] == "":
+			tags["WORK"] = rel.Work.Title
+			tags["MUSICBRAINZ_WORKID"] = rel.Work.ID
+			for _, wr := range rel.Work.Relations {
+				if wr.Type == "composer" && wr.Artist != nil {
+					composers = append(composers, wr.Artist.Name)
+					composerSorts = append(composerSorts, wr.Artist.SortName)
+				}
+			}
+		case rel.Type == "conductor" && rel.Artist != nil:
+			conductors = append(conductors, rel.Artist.Name)
+		}
+	}
+	tags["COMPOSER"] = strings.Join(composers, "; ")
+	tags["COMPOSERSORT"] = strings.Join(composerSorts, "; ")
+	tags["CONDUCTOR"] = strings.Join(conductors, "; ")
+	return tags
+}
+
+// WriteClassicalTags fills in COMPOSER, COMPOSERSORT, WORK,
+// MUSICBRAINZ_WORKID and CONDUCTOR from release releaseMBID on the tracks of
+// albumPath that lack them, pairing files with release tracks as
+// WriteReleaseTags does. Empty classical fields of md are taken from the
+// first track. It returns the number of files updated.
+func WriteClassicalTags(albumPath string, md *MusicMetadata, releaseMBID string) (int, error) {
+	local, err := probeAlbum(albumPath)
+	if err != nil {
+		return 0, err
+	}
+	complete := true
+	for _, t := range local {
+		if !hasTag(t.Tags, "COMPOSER") || !hasTag(t.Tags, "WORK") {
+			complete = false
+		}
+	}
+	if complete {
+		return 0, nil
+	}
+
+	r, err := getMBReleaseWithWorks(releaseMBID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching release %s: %w", releaseMBID, err)
+	}
+	remote := releaseTracks(r)
+	pairs := pairTracks(local, remote)
+	updated := 0
+	for i, t := range local {
+		j := pairs[i]
+		if j < 0 {
+			continue
+		}
+		tags := classicalTags(remote[j])
+		if i == 0 {
+			md.Composer = FirstNonEmpty(md.Composer, tags["COMPOSER"])
+			md.Work = FirstNonEmpty(md.Work, tags["WORK"])
+			md.Conductor = FirstNonEmpty(md.Conductor, tags["CONDUCTOR"])
+		}
+		missing := map[string]string{}
+		for name, v := range tags {
+			if v != "" && !hasTag(t.Tags, name) {
+				missing[name] = v
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if err := WriteTags(t.Path, missing); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
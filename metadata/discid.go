@@ -0,0 +1,239 @@
+package metadata
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/tools"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// TOC is a CD table of contents in MusicBrainz terms: sector offsets of
+// each audio track and of the lead-out, including the 150-sector pregap.
+type TOC struct {
+	First, Last int
+	LeadOut     int
+	Offsets     []int // one per track, First..Last
+}
+
+// discIDEncoding is base64 with the URL-unsafe characters MusicBrainz
+// replaces: '+' → '.', '/' → '_', '=' → '-'.
+var discIDEncoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._").WithPadding('-')
+
+// DiscID computes the MusicBrainz disc ID of the TOC.
+func (t *TOC) DiscID() string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%02X%02X%08X", t.First, t.Last, t.LeadOut)
+	for i := 0; i < 99; i++ {
+		off := 0
+		if i < len(t.Offsets) {
+			off = t.Offsets[i]
+		}
+		fmt.Fprintf(h, "%08X", off)
+	}
+	return discIDEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Query returns the TOC in the form the MusicBrainz discid "toc" parameter
+// takes: first, last, lead-out and track offsets joined by "+".
+func (t *TOC) Query() string {
+	parts := []string{strconv.Itoa(t.First), strconv.Itoa(t.Last), strconv.Itoa(t.LeadOut)}
+	for _, o := range t.Offsets {
+		parts = append(parts, strconv.Itoa(o))
+	}
+	return strings.Join(parts, "+")
+}
+
+// tocFromSectors builds a TOC from zero-based start/end sectors per track,
+// as listed in rip logs.
+func tocFromSectors(starts, ends []int) *TOC {
+	if len(starts) == 0 || len(starts) != len(ends) {
+		return nil
+	}
+	t := &TOC{First: 1, Last: len(starts), LeadOut: ends[len(ends)-1] + 1 + 150}
+	for _, s := range starts {
+		t.Offsets = append(t.Offsets, s+150)
+	}
+	return t
+}
+
+// eacTOCRow matches a row of the TOC table in EAC and XLD logs:
+//
+//	1  |  0:00.00 |  4:07.45 |         0    |    18569
+var eacTOCRow = regexp.MustCompile(`^\s*(\d+)\s*\|\s*[\d:.]+\s*\|\s*[\d:.]+\s*\|\s*(\d+)\s*\|\s*(\d+)\s*$`)
+
+// whipperSector matches the "Start sector:" / "End sector:" lines in the TOC
+// section of a whipper log.
+var whipperSector = regexp.MustCompile(`^\s*(Start|End) sector:\s*(\d+)\s*$`)
+
+// decodeLog returns a UTF-8 reader for a rip log. EAC writes UTF-16LE with
+// a byte order mark; a log without one is UTF-16LE when its second byte is
+// NUL, else taken as UTF-8.
+func decodeLog(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	var fallback transform.Transformer = unicode.UTF8.NewDecoder()
+	if head, _ := br.Peek(2); len(head) == 2 && head[0] != 0 && head[1] == 0 {
+		fallback = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()
+	}
+	return transform.NewReader(br, unicode.BOMOverride(fallback))
+}
+
+// tocFromLog extracts the TOC from an EAC, XLD or whipper rip log.
+func tocFromLog(path string) *TOC {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var starts, ends []int
+	inWhipperTOC := false
+	sc := bufio.NewScanner(decodeLog(f))
+	for sc.Scan() {
+		line := sc.Text()
+		if m := eacTOCRow.FindStringSubmatch(line); m != nil {
+			s, _ := strconv.Atoi(m[2])
+			e, _ := strconv.Atoi(m[3])
+			starts, ends = append(starts, s), append(ends, e)
+			continue
+		}
+		if strings.TrimSpace(line) == "TOC:" {
+			inWhipperTOC = true
+			continue
+		}
+		if inWhipperTOC {
+			if line != "" && !strings.HasPrefix(line, " ") {
+				inWhipperTOC = false
+				continue
+			}
+			if m := whipperSector.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				if m[1] == "Start" {
+					starts = append(starts, n)
+				} else {
+					ends = append(ends, n)
+				}
+			}
+		}
+	}
+	return tocFromSectors(starts, ends)
+}
+
+// cueIndex matches "INDEX 01 mm:ss:ff" in a cue sheet.
+var cueIndex = regexp.MustCompile(`^\s*INDEX\s+01\s+(\d+):(\d+):(\d+)`)
+
+// cueFile matches a FILE line, capturing the quoted or bare file name.
+var cueFile = regexp.MustCompile(`^\s*FILE\s+(?:"([^"]+)"|(\S+))`)
+
+// tocFromCue computes the TOC from a cue sheet. Track positions come from
+// INDEX 01; file lengths, needed for multi-file sheets and the lead-out, are
+// read with ffprobe.
+func tocFromCue(path string) *TOC {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Dir(path)
+
+	var offsets []int
+	base, fileFrames := 0, 0
+	for _, line := range strings.Split(string(data), "\n") {
+		if m := cueFile.FindStringSubmatch(line); m != nil {
+			base += fileFrames
+			frames, err := audioFrames(filepath.Join(dir, FirstNonEmpty(m[1], m[2])))
+			if err != nil {
+				return nil
+			}
+			fileFrames = frames
+			continue
+		}
+		if m := cueIndex.FindStringSubmatch(line); m != nil {
+			mm, _ := strconv.Atoi(m[1])
+			ss, _ := strconv.Atoi(m[2])
+			ff, _ := strconv.Atoi(m[3])
+			offsets = append(offsets, base+(mm*60+ss)*75+ff+150)
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	return &TOC{First: 1, Last: len(offsets), LeadOut: base + fileFrames + 150, Offsets: offsets}
+}
+
+// audioFrames returns the length of an audio file in CD frames (1/75 s,
+// 588 samples at 44.1 kHz).
+func audioFrames(path string) (int, error) {
+	out, err := tools.Output("ffprobe", "-v", "quiet", "-print_format", "json",
+		"-show_streams", "-select_streams", "a:0", path)
+	if err != nil {
+		return 0, err
+	}
+	var data struct {
+		Streams []struct {
+			DurationTS int64  `json:"duration_ts"`
+			TimeBase   string `json:"time_base"`
+			SampleRate string `json:"sample_rate"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &data); err != nil || len(data.Streams) == 0 {
+		return 0, fmt.Errorf("no audio stream in %s", path)
+	}
+	s := data.Streams[0]
+	if s.TimeBase == "1/"+s.SampleRate && s.SampleRate == "44100" {
+		return int(s.DurationTS / 588), nil
+	}
+	num, den, ok := strings.Cut(s.TimeBase, "/")
+	n, _ := strconv.ParseFloat(num, 64)
+	d, _ := strconv.ParseFloat(den, 64)
+	if !ok || d == 0 {
+		return 0, fmt.Errorf("unexpected time base %q", s.TimeBase)
+	}
+	return int(float64(s.DurationTS) * n / d * 75), nil
+}
+
+// TOCFromTracks builds the TOC of a gapless rip with one file per track, in
+// disc order, from the files' lengths.
+func TOCFromTracks(tracks []string) (*TOC, error) {
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no tracks")
+	}
+	t := &TOC{First: 1, Last: len(tracks)}
+	pos := 150
+	for _, tr := range tracks {
+		frames, err := audioFrames(tr)
+		if err != nil {
+			return nil, err
+		}
+		t.Offsets = append(t.Offsets, pos)
+		pos += frames
+	}
+	t.LeadOut = pos
+	return t, nil
+}
+
+// AlbumTOC finds a TOC for an album folder in its rip logs or cue sheets.
+func AlbumTOC(albumPath string) *TOC {
+	logs, _ := filepath.Glob(filepath.Join(albumPath, "*.log"))
+	for _, l := range logs {
+		if t := tocFromLog(l); t != nil {
+			return t
+		}
+	}
+	cues, _ := filepath.Glob(filepath.Join(albumPath, "*.cue"))
+	for _, c := range cues {
+		if t := tocFromCue(c); t != nil {
+			return t
+		}
+	}
+	return nil
+}
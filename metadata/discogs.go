@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// discogsNumberSuffix is the " (2)" Discogs appends to tell same-named
+// artists apart.
+var discogsNumberSuffix = regexp.MustCompile(`\s+\(\d+\)$`)
+
+// discogsDiscPosition matches multi-disc positions like "2-05" or "CD2-05".
+var discogsDiscPosition = regexp.MustCompile(`^(?i:cd|disc|dvd)?(\d+)[-.](\d+)$`)
+
+type discogsArtist struct {
+	Name string `json:"name"`
+	ANV  string `json:"anv"` // artist name variation used on this release
+	Join string `json:"join"`
+}
+
+type discogsRelease struct {
+	ID       int             `json:"id"`
+	Title    string          `json:"title"`
+	Artists  []discogsArtist `json:"artists"`
+	Released string          `json:"released"` // "1997-05-21", "1997-00-00" or "1997"
+	Year     int             `json:"year"`
+	Country  string          `json:"country"`
+	Labels   []struct {
+		Name  string `json:"name"`
+		CatNo string `json:"catno"`
+	} `json:"labels"`
+	Formats []struct {
+		Name string `json:"name"`
+	} `json:"formats"`
+	Genres    []string `json:"genres"`
+	Styles    []string `json:"styles"`
+	Tracklist []struct {
+		Position string          `json:"position"`
+		Type     string          `json:"type_"`
+		Title    string          `json:"title"`
+		Duration string          `json:"duration"` // "4:44"
+		Artists  []discogsArtist `json:"artists"`
+	} `json:"tracklist"`
+}
+
+// discogsGet calls the Discogs API with DISCOGS_TOKEN.
+func discogsGet(path string, out any) error {
+	token := os.Getenv("DISCOGS_TOKEN")
+	if token == "" {
+		return errors.New("DISCOGS_TOKEN is not set")
+	}
+	req, err := http.NewRequest("GET", "https://api.discogs.com"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Discogs token="+token)
+
+	resp, err := HTTPDo(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Discogs returned %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// discogsCredits converts Discogs artists to MusicBrainz-style credits.
+func discogsCredits(artists []discogsArtist) []MBArtistCredit {
+	var out []MBArtistCredit
+	for i, a := range artists {
+		c := MBArtistCredit{Name: discogsNumberSuffix.ReplaceAllString(FirstNonEmpty(a.ANV, a.Name), "")}
+		if i < len(artists)-1 && a.Join != "" {
+			c.JoinPhrase = " " + strings.TrimSpace(a.Join) + " "
+			if a.Join == "," {
+				c.JoinPhrase = ", "
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// discogsDuration parses "m:ss" or "h:mm:ss" into milliseconds.
+func discogsDuration(s string) int {
+	ms := 0
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return 0
+		}
+		ms = ms*60 + n
+	}
+	return ms * 1000
+}
+
+// toMBRelease converts a Discogs release to MusicBrainz's shape. Discs are
+// taken from "2-05"-style positions; vinyl sides (A1, B2) stay one disc.
+// Styles rank ahead of the broader genres.
+func (d *discogsRelease) toMBRelease() *MBRelease {
+	r := &MBRelease{
+		Title:        d.Title,
+		Country:      d.Country,
+		ArtistCredit: discogsCredits(d.Artists),
+	}
+	r.Date = strings.TrimSuffix(strings.TrimSuffix(d.Released, "-00"), "-00")
+	if r.Date == "" && d.Year > 0 {
+		r.Date = strconv.Itoa(d.Year)
+	}
+	for _, l := range d.Labels {
+		li := MBLabelInfo{CatalogNumber: l.CatNo}
+		li.Label.Name = discogsNumberSuffix.ReplaceAllString(l.Name, "")
+		if l.CatNo == "none" {
+			li.CatalogNumber = "[none]"
+		}
+		r.LabelInfo = append(r.LabelInfo, li)
+	}
+	for i, g := range append(append([]string{}, d.Styles...), d.Genres...) {
+		r.Genres = append(r.Genres, MBGenre{Name: g, Count: len(d.Styles) + len(d.Genres) - i})
+	}
+	format := ""
+	if len(d.Formats) > 0 {
+		format = d.Formats[0].Name
+	}
+
+	discs := map[int]*MBMedia{}
+	var order []int
+	for _, t := range d.Tracklist {
+		if t.Type != "" && t.Type != "track" {
+			continue // headings and index tracks
+		}
+		disc := 1
+		if m := discogsDiscPosition.FindStringSubmatch(t.Position); m != nil {
+			disc, _ = strconv.Atoi(m[1])
+		}
+		m, ok := discs[disc]
+		if !ok {
+			m = &MBMedia{Format: format, Position: disc}
+			discs[disc] = m
+			order = append(order, disc)
+		}
+		m.Tracks = append(m.Tracks, MBTrack{
+			Position:     len(m.Tracks) + 1,
+			Title:        t.Title,
+			Length:       discogsDuration(t.Duration),
+			ArtistCredit: discogsCredits(t.Artists),
+		})
+		m.TrackCount = len(m.Tracks)
+	}
+	for _, disc := range order {
+		r.Media = append(r.Media, *discs[disc])
+	}
+	return r
+}
+
+// discogsProvider matches albums against Discogs, which has many vinyl and
+// small-label releases MusicBrainz lacks.
+type discogsProvider struct {
+	styles map[string][]string // release ID → styles, filled by release
+}
+
+func (discogsProvider) name() string { return "Discogs" }
+
+func (discogsProvider) candidates(albumPath string, local []localTrack) ([]string, error) {
+	q := url.Values{
+		"type":          {"release"},
+		"release_title": {FirstNonEmpty(local[0].Album, filepath.Base(albumPath))},
+		"per_page":      {strconv.Itoa(autotagCandidates)},
+	}
+	if local[0].Artist != "" {
+		q.Set("artist", local[0].Artist)
+	}
+	var data struct {
+		Results []struct {
+			ID int `json:"id"`
+		} `json:"results"`
+	}
+	if err := discogsGet("/database/search?"+q.Encode(), &data); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, r := range data.Results {
+		ids = append(ids, strconv.Itoa(r.ID))
+	}
+	return ids, nil
+}
+
+func (p discogsProvider) release(id string) (*MBRelease, error) {
+	var d discogsRelease
+	if err := discogsGet("/releases/"+url.PathEscape(id), &d); err != nil {
+		return nil, err
+	}
+	p.styles[id] = d.Styles
+	return d.toMBRelease(), nil
+}
+
+func (discogsProvider) releaseURL(id string) string {
+	return "https://www.discogs.com/release/" + id
+}
+
+func (p discogsProvider) extraTags(id string) map[string]string {
+	return map[string]string{
+		"DISCOGS_RELEASE_ID": id,
+		"STYLE":              strings.Join(p.styles[id], "; "),
+	}
+}
+
+// AutotagDiscogs matches the album in albumPath against Discogs (needs
+// DISCOGS_TOKEN) the way Autotag does against MusicBrainz, writing the best
+// release's tags, including its catalog number, genre and styles. releaseID
+// pins a Discogs release.
+func AutotagDiscogs(albumPath, releaseID string, minSimilarity float64) (*Match, error) {
+	return autotagWith(discogsProvider{styles: map[string][]string{}}, albumPath, releaseID, minSimilarity)
+}
@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"cmp"
+	"math"
+	"os"
+	"slices"
+	"strings"
+)
+
+// editionMargin is how close (in release distance) another release of the
+// same release group must score to the best one to count as an equally good
+// edition.
+const editionMargin = 0.02
+
+// Edition is one release of the matched release group that scored about as
+// well as the chosen one.
+type Edition struct {
+	ReleaseMBID    string  `json:"release_mbid"`
+	Title          string  `json:"title"`
+	Artist         string  `json:"artist"`
+	Disambiguation string  `json:"disambiguation,omitempty"`
+	Country        string  `json:"country,omitempty"`
+	Year           string  `json:"year,omitempty"`
+	Format         string  `json:"format,omitempty"`
+	TrackCount     int     `json:"track_count"`
+	Similarity     float64 `json:"similarity"`
+}
+
+// scoredRelease is a candidate release the autotagger fetched and scored.
+type scoredRelease struct {
+	id     string
+	r      *MBRelease
+	remote []releaseTrack
+	pairs  []int
+	dist   float64
+}
+
+func (s scoredRelease) edition() Edition {
+	return Edition{
+		ReleaseMBID:    s.r.ID,
+		Title:          s.r.Title,
+		Artist:         ArtistCreditString(s.r.ArtistCredit),
+		Disambiguation: s.r.Disambiguation,
+		Country:        s.r.Country,
+		Year:           s.r.Date[:min(4, len(s.r.Date))],
+		Format:         strings.Join(releaseFormats(s.r), "+"),
+		TrackCount:     len(s.remote),
+		Similarity:     math.Round((1-s.dist)*1000) / 10,
+	}
+}
+
+// tracklist identifies what a release's discs hold, so editions that only
+// differ in country or label compare equal.
+func (s scoredRelease) tracklist() string {
+	var b strings.Builder
+	for _, t := range s.remote {
+		b.WriteString(strings.ToLower(t.Title))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// releaseFormats returns the distinct medium formats of a release.
+func releaseFormats(r *MBRelease) []string {
+	var out []string
+	for _, m := range r.Media {
+		if m.Format != "" && !slices.Contains(out, m.Format) {
+			out = append(out, m.Format)
+		}
+	}
+	return out
+}
+
+// preferredList reads a comma-separated preference list, most preferred
+// first, from env.
+func preferredList(env string) []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv(env), ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// preferenceRank ranks a release by PREFERRED_COUNTRIES (e.g. "XW,US,GB")
+// and PREFERRED_MEDIA (e.g. "digital,cd,vinyl", matched against any part of
+// a format so "vinyl" covers `12" Vinyl`): the sum of its position in each
+// list, unlisted values counting as last. Lower is better.
+func preferenceRank(r *MBRelease) int {
+	rank := 0
+	if countries := preferredList("PREFERRED_COUNTRIES"); len(countries) > 0 {
+		i := slices.Index(countries, strings.ToLower(r.Country))
+		if i < 0 {
+			i = len(countries)
+		}
+		rank += i
+	}
+	if media := preferredList("PREFERRED_MEDIA"); len(media) > 0 {
+		best := len(media)
+		for _, f := range releaseFormats(r) {
+			for i, m := range media[:best] {
+				if strings.Contains(strings.ToLower(f), m) {
+					best = i
+					break
+				}
+			}
+		}
+		rank += best
+	}
+	return rank
+}
+
+// pickEdition chooses among the scored candidates. Releases of the best
+// one's release group within editionMargin of it are equally good matches;
+// of those the one preferenceRank likes best wins, then the closer one.
+// When the equally good editions with the winner's rank have different
+// tracklists, the choice is a guess and they are returned, the winner first.
+func pickEdition(scored []scoredRelease) (scoredRelease, []Edition) {
+	best := slices.MinFunc(scored, func(a, b scoredRelease) int { return cmp.Compare(a.dist, b.dist) })
+	if best.r.ReleaseGroup.ID == "" {
+		return best, nil
+	}
+	var near []scoredRelease
+	for _, s := range scored {
+		if s.r.ReleaseGroup.ID == best.r.ReleaseGroup.ID && s.dist <= best.dist+editionMargin {
+			near = append(near, s)
+		}
+	}
+	slices.SortStableFunc(near, func(a, b scoredRelease) int {
+		return cmp.Or(cmp.Compare(preferenceRank(a.r), preferenceRank(b.r)), cmp.Compare(a.dist, b.dist))
+	})
+
+	var editions []Edition
+	var seen []string
+	for _, s := range near {
+		if preferenceRank(s.r) != preferenceRank(near[0].r) || slices.Contains(seen, s.tracklist()) {
+			continue
+		}
+		seen = append(seen, s.tracklist())
+		editions = append(editions, s.edition())
+	}
+	if len(editions) < 2 {
+		editions = nil
+	}
+	return near[0], editions
+}
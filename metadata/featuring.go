@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// featuringCredit matches a trailing featuring credit, bracketed or not:
+// "Artist feat. X", "Title (ft. X)", "Artist featuring X & Y".
+var featuringCredit = regexp.MustCompile(`(?i)\s+[(\[]?(?:feat\.?|ft\.|featuring)\s+([^)\]]+?)[)\]]?\s*$`)
+
+// SplitFeaturing splits "Artist feat. X" into "Artist" and "X". featured is
+// empty when s has no featuring credit.
+func SplitFeaturing(s string) (main, featured string) {
+	m := featuringCredit.FindStringSubmatchIndex(s)
+	if m == nil {
+		return s, ""
+	}
+	return strings.TrimSpace(s[:m[0]]), strings.TrimSpace(s[m[2]:m[3]])
+}
+
+// FeaturingMode returns FEATURING_MODE: "path" builds library folders from
+// the main artist only, "title" also moves featured artists from the artist
+// tags into the track title, "strip" drops them from the artist tags. Any
+// other value is "keep", which leaves names alone.
+func FeaturingMode() string {
+	switch m := strings.ToLower(os.Getenv("FEATURING_MODE")); m {
+	case "path", "title", "strip":
+		return m
+	}
+	return "keep"
+}
+
+// NormalizeFeaturing rewrites the artist tags of tracks for the "title" and
+// "strip" modes, updating md to match, and returns how many files changed.
+func NormalizeFeaturing(tracks []string, md *MusicMetadata, mode string) (int, error) {
+	if mode != "title" && mode != "strip" {
+		return 0, nil
+	}
+	changed := 0
+	for _, t := range tracks {
+		tmd, err := ReadTags(t)
+		if err != nil {
+			return changed, err
+		}
+		tags := map[string]string{}
+		if main, feat := SplitFeaturing(tmd.Artist); feat != "" {
+			tags["ARTIST"] = main
+			if _, inTitle := SplitFeaturing(tmd.Title); mode == "title" && inTitle == "" {
+				tags["TITLE"] = tmd.Title + " (feat. " + feat + ")"
+			}
+		}
+		if main, feat := SplitFeaturing(tmd.AlbumArtist); feat != "" {
+			tags["ALBUMARTIST"] = main
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		if err := WriteTags(t, tags); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	md.Artist, _ = SplitFeaturing(md.Artist)
+	md.AlbumArtist, _ = SplitFeaturing(md.AlbumArtist)
+	return changed, nil
+}
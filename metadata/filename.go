@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Folder names TagFromFilenames understands, tried in order after trailing
+// "[FLAC]"-style groups are dropped. A folder with no artist in its name
+// takes the artist from its parent folder, unless that is the import root.
+var folderPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?P<artist>.+?) - (?P<year>\d{4}) - (?P<album>.+)$`),          // Artist - 2020 - Album
+	regexp.MustCompile(`^(?P<artist>.+?) - (?P<album>.+?) [(\[](?P<year>\d{4})[)\]]$`), // Artist - Album (2020)
+	regexp.MustCompile(`^[(\[](?P<year>\d{4})[)\]] ?-? ?(?P<album>.+)$`),               // [2020] Album
+	regexp.MustCompile(`^(?P<year>\d{4}) - (?P<album>.+)$`),                            // 2020 - Album
+	regexp.MustCompile(`^(?P<album>.+?) [(\[](?P<year>\d{4})[)\]]$`),                   // Album (2020)
+	regexp.MustCompile(`^(?P<artist>.+?) - (?P<album>.+)$`),                            // Artist - Album
+}
+
+// File names TagFromFilenames understands, without their extension.
+var trackPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(?:(?:CD|Disc ?)?(?P<disc>\d)[-.])?(?P<track>\d{1,3})(?:\s*[-._)]\s*|\s+)(?P<title>.+)$`), // 03. Title, 1-03 Title
+	regexp.MustCompile(`^(?P<artist>.+?) - (?P<track>\d{1,3}) - (?P<title>.+)$`),                                   // Artist - 03 - Title
+}
+
+// trailingGroup matches a bracketed suffix such as " [FLAC 24-96]" or
+// " [WEB]", which folder names often carry after the album and year.
+var trailingGroup = regexp.MustCompile(`\s*\[[^\[\]]*\]$`)
+
+var yearOnly = regexp.MustCompile(`^\[\d{4}\]$`)
+
+// matchNamed returns the named groups of the first pattern matching s.
+func matchNamed(patterns []*regexp.Regexp, s string) map[string]string {
+	for _, re := range patterns {
+		m := re.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		out := map[string]string{}
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				out[name] = strings.TrimSpace(m[i])
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// cleanName turns underscores into spaces in names that have none.
+func cleanName(s string) string {
+	if !strings.Contains(s, " ") {
+		s = strings.ReplaceAll(s, "_", " ")
+	}
+	return strings.TrimSpace(s)
+}
+
+// inferFromFolder parses an album folder name such as
+// "Artist - Album (2020) [FLAC]", falling back to the parent folder for the
+// artist when it is not root.
+func inferFromFolder(albumPath, root string) *MusicMetadata {
+	name := cleanName(filepath.Base(albumPath))
+	for {
+		suffix := trailingGroup.FindString(name)
+		if suffix == "" || yearOnly.MatchString(strings.TrimSpace(suffix)) {
+			break
+		}
+		name = strings.TrimSpace(strings.TrimSuffix(name, suffix))
+	}
+	md := &MusicMetadata{Album: name}
+	if m := matchNamed(folderPatterns, name); m != nil {
+		md.Artist, md.Album, md.Year = m["artist"], m["album"], m["year"]
+	}
+	if parent := filepath.Dir(albumPath); md.Artist == "" && filepath.Clean(parent) != filepath.Clean(root) {
+		md.Artist = cleanName(filepath.Base(parent))
+	}
+	md.Date = md.Year
+	return md
+}
+
+// inferFromFilename parses a track file name such as "03. Title.flac" or
+// "1-03 - Artist - Title.mp3". Without a number the track is numbered by
+// its position; artist is the album artist when the name carries none.
+func inferFromFilename(path string, position int, artist string) TrackTags {
+	stem := cleanName(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	t := TrackTags{Track: position, Title: stem, Artist: artist}
+	if IsHiddenTrack(path) {
+		t.Track = 0 // a pregap track doesn't take track 1's number
+	}
+	m := matchNamed(trackPatterns, stem)
+	if m == nil {
+		return t
+	}
+	if n, err := strconv.Atoi(m["track"]); err == nil && n > 0 {
+		t.Track = n
+	}
+	t.Disc, _ = strconv.Atoi(m["disc"])
+	t.Title = cleanName(m["title"])
+	if m["artist"] != "" {
+		t.Artist = m["artist"]
+	}
+	// "03 - Artist - Title": drop the album artist from the title.
+	if prefix, rest, ok := strings.Cut(t.Title, " - "); ok && strings.EqualFold(prefix, artist) {
+		t.Title = rest
+	}
+	return t
+}
+
+// TagFromFilenames is the last-resort metadata source for albums without
+// usable tags: it infers artist, album, year, track and disc numbers and
+// titles from the folder and file names and writes whichever of those tags
+// each file lacks. root is the directory albums are imported from. It returns the album metadata read back from the first
+// track. Formats WriteTags cannot write keep their tags, so the result is
+// only as good as the first track's.
+func TagFromFilenames(albumPath, root string) (*MusicMetadata, error) {
+	fmt.Println("→ Inferring metadata from file names:", albumPath)
+	tracks, err := AudioFiles(albumPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return nil, errors.New("no audio files")
+	}
+	album := inferFromFolder(albumPath, root)
+	if album.Artist == "" || album.Album == "" {
+		return nil, fmt.Errorf("could not infer artist and album from %q", filepath.Base(albumPath))
+	}
+
+	hidden := 0
+	for i, track := range tracks {
+		have, err := ReadTags(track)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filepath.Base(track), err)
+		}
+		haveTrack, _ := ReadTrackTags(track)
+		t := inferFromFilename(track, i+1-hidden, album.Artist)
+		if t.Track == 0 {
+			hidden++
+		}
+
+		tags := map[string]string{}
+		set := func(name, have, value string) {
+			if have == "" && value != "" {
+				tags[name] = value
+			}
+		}
+		set("ARTIST", have.Artist, t.Artist)
+		set("ALBUMARTIST", have.AlbumArtist, album.Artist)
+		set("ALBUM", have.Album, album.Album)
+		set("DATE", have.Date, album.Year)
+		set("TITLE", have.Title, t.Title)
+		if haveTrack.Track == 0 {
+			set("TRACKNUMBER", "", strconv.Itoa(t.Track))
+		}
+		if haveTrack.Disc == 0 && t.Disc > 0 {
+			set("DISCNUMBER", "", strconv.Itoa(t.Disc))
+		}
+		if err := WriteTags(track, tags); err != nil {
+			return nil, fmt.Errorf("tagging %s: %w", filepath.Base(track), err)
+		}
+	}
+
+	md, err := ReadTags(tracks[0])
+	if err != nil {
+		return nil, err
+	}
+	md.Artist = FirstNonEmpty(md.Artist, album.Artist)
+	md.AlbumArtist = FirstNonEmpty(md.AlbumArtist, album.Artist)
+	md.Album = FirstNonEmpty(md.Album, album.Album)
+	md.Year = FirstNonEmpty(md.Year, album.Year)
+	md.Date = FirstNonEmpty(md.Date, album.Date)
+	return md, nil
+}
@@ -0,0 +1,94 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AudioFiles returns the tracks directly inside dir: files with one of
+// AudioExtensions (see format.go).
+func AudioFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if IsAudioFile(e.Name()) {
+			tracks = append(tracks, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return tracks, nil
+}
+
+// AudiobookFiles returns the files directly inside dir in the formats the
+// audiobook profile imports (see IsAudiobookFile).
+func AudiobookFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if IsAudiobookFile(e.Name()) {
+			tracks = append(tracks, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return tracks, nil
+}
+
+// LyricFiles returns all .lrc files directly inside dir.
+func LyricFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var lyrics []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.ToLower(filepath.Ext(e.Name())) == ".lrc" {
+			lyrics = append(lyrics, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	return lyrics, nil
+}
+
+var CoverNames = []string{
+	"cover.jpg", "cover.jpeg", "cover.png",
+	"folder.jpg", "folder.jpeg", "folder.png",
+	"album.jpg", "album.jpeg", "album.png",
+}
+
+// -------------------------
+// Find cover image
+// -------------------------
+func FindCoverImage(dir string) (string, error) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		l := strings.ToLower(e.Name())
+		if slices.Contains(CoverNames, l) {
+			return filepath.Join(dir, e.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("no cover image found in %s", dir)
+}
@@ -0,0 +1,125 @@
+package metadata
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Audio formats the importer can tag, as returned by AudioFormat.
+const (
+	FormatFLAC = "flac"
+	FormatMP3  = "mp3"
+)
+
+// defaultAudioExtensions are the track extensions used when
+// AUDIO_EXTENSIONS is unset.
+var defaultAudioExtensions = []string{".flac", ".mp3"}
+
+// AudioExtensions returns AUDIO_EXTENSIONS, the comma-separated file
+// extensions treated as album tracks (default ".flac,.mp3"), lower-case with
+// a leading dot. Tags of formats other than FLAC and MP3 are read but never
+// written.
+func AudioExtensions() []string {
+	var exts []string
+	for _, e := range strings.Split(os.Getenv("AUDIO_EXTENSIONS"), ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "." {
+			exts = append(exts, "."+strings.TrimPrefix(e, "."))
+		}
+	}
+	if len(exts) == 0 {
+		return defaultAudioExtensions
+	}
+	return exts
+}
+
+// IsAudioFile reports whether path has one of AudioExtensions.
+func IsAudioFile(path string) bool {
+	return slices.Contains(AudioExtensions(), strings.ToLower(filepath.Ext(path)))
+}
+
+// audiobookExtensions are the formats the audiobook profile imports.
+var audiobookExtensions = []string{".m4b", ".m4a", ".mp3"}
+
+// IsAudiobookFile reports whether path is in a format the audiobook profile
+// imports.
+func IsAudiobookFile(path string) bool {
+	return slices.Contains(audiobookExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// IsLibraryTrack reports whether a file in the library is a track: an album
+// track (IsAudioFile) or an audiobook's (IsAudiobookFile).
+func IsLibraryTrack(path string) bool {
+	return IsAudioFile(path) || IsAudiobookFile(path)
+}
+
+// AudioFormat returns the format of an audio file, FormatFLAC or FormatMP3,
+// from its contents (see SniffFormat) or, when they are not recognised, its
+// extension. It returns "" for other formats.
+func AudioFormat(path string) string {
+	if f := SniffFormat(path); f != "" {
+		return f
+	}
+	return extFormat(path)
+}
+
+// extFormat returns the format path's extension names.
+func extFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		return FormatFLAC
+	case ".mp3":
+		return FormatMP3
+	}
+	return ""
+}
+
+// FormatExt returns the extension files of format should have.
+func FormatExt(format string) string {
+	return "." + format
+}
+
+// SniffFormat reads the start of a file and returns FormatFLAC or FormatMP3
+// when it is one, whatever its name, or "" when it cannot tell. An ID3v2
+// tag is skipped and the stream behind it decides, as AAC and MPEG Layer II
+// files carry ID3 tags too.
+func SniffFormat(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return ""
+	}
+	if bytes.HasPrefix(head, []byte("ID3")) {
+		// Skip the tag: its size is syncsafe, plus a footer when flagged.
+		size := int64(head[6])<<21 | int64(head[7])<<14 | int64(head[8])<<7 | int64(head[9])
+		size += 10
+		if head[5]&0x10 != 0 {
+			size += 10
+		}
+		if _, err := f.ReadAt(head[:4], size); err != nil {
+			return ""
+		}
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return FormatFLAC
+	case mpegFrameHeader(head):
+		return FormatMP3
+	}
+	return ""
+}
+
+// mpegFrameHeader reports whether b starts with a valid MPEG audio Layer
+// III frame header: the sync bits, the layer, and a bitrate and sample rate
+// that are not reserved.
+func mpegFrameHeader(b []byte) bool {
+	return len(b) >= 4 && b[0] == 0xFF && b[1]&0xE0 == 0xE0 &&
+		b[1]>>1&0x03 == 0x01 && b[2]>>4 != 0x0F && b[2]>>2&0x03 != 0x03
+}
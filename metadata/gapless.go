@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// Gapless is the encoder delay and padding information players need to join
+// MP3 and AAC tracks without a gap: the LAME tag in an MP3's first frame
+// and the iTunSMPB comment iTunes writes to MP3 and M4A files.
+type Gapless struct {
+	LAME     bool // the MP3 has a LAME tag
+	Delay    int  // LAME encoder delay, in samples
+	Padding  int  // LAME end padding, in samples
+	ITunSMPB string
+}
+
+// Present reports whether any gapless information was found.
+func (g Gapless) Present() bool {
+	return g.LAME || g.ITunSMPB != ""
+}
+
+// GaplessFormat reports whether path is a lossy format that needs gapless
+// information (FLAC and other lossless formats don't).
+func GaplessFormat(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".m4a", ".m4b":
+		return true
+	}
+	return false
+}
+
+// ReadGapless returns the gapless information of an MP3 or M4A file.
+func ReadGapless(path string) (Gapless, error) {
+	var g Gapless
+	if strings.EqualFold(filepath.Ext(path), ".mp3") {
+		var err error
+		if g.LAME, g.Delay, g.Padding, err = readLAMETag(path); err != nil {
+			return g, err
+		}
+	}
+	t, err := readRawTags(path)
+	if err != nil {
+		return g, err
+	}
+	for k, v := range t {
+		if strings.EqualFold(k, "iTunSMPB") {
+			g.ITunSMPB = strings.TrimSpace(v)
+		}
+	}
+	return g, nil
+}
+
+// readLAMETag finds the Xing/Info frame at the start of an MP3's audio and
+// reads the encoder delay and padding from the LAME extension after it.
+func readLAMETag(path string) (found bool, delay, padding int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	defer f.Close()
+
+	var hdr [10]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return false, 0, 0, err
+	}
+	start := int64(0)
+	if string(hdr[:3]) == "ID3" {
+		size := int64(hdr[6])<<21 | int64(hdr[7])<<14 | int64(hdr[8])<<7 | int64(hdr[9])
+		start = 10 + size
+		if hdr[5]&0x10 != 0 {
+			start += 10 // footer
+		}
+	}
+	buf := make([]byte, 8192)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return false, 0, 0, err
+	}
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		h := binary.BigEndian.Uint32(buf[i:])
+		version, layer := h>>19&3, h>>17&3
+		if version == 1 || layer == 0 {
+			continue // reserved values: not a frame header
+		}
+		mono := h>>6&3 == 3
+		side := 32
+		switch {
+		case version == 3 && mono:
+			side = 17
+		case version != 3 && mono:
+			side = 9
+		case version != 3:
+			side = 17
+		}
+		x := i + 4 + side
+		if x+8 > len(buf) {
+			return false, 0, 0, nil
+		}
+		if tag := string(buf[x : x+4]); tag != "Xing" && tag != "Info" {
+			return false, 0, 0, nil // first frame is audio: no LAME tag
+		}
+		flags := binary.BigEndian.Uint32(buf[x+4:])
+		l := x + 8
+		for _, field := range []struct {
+			bit  uint32
+			size int
+		}{{1, 4}, {2, 4}, {4, 100}, {8, 4}} {
+			if flags&field.bit != 0 {
+				l += field.size
+			}
+		}
+		if l+24 > len(buf) || !bytes.HasPrefix(buf[l:], []byte("LAME")) && !bytes.HasPrefix(buf[l:], []byte("Lavc")) && !bytes.HasPrefix(buf[l:], []byte("Lavf")) {
+			return false, 0, 0, nil
+		}
+		d := buf[l+21:]
+		return true, int(d[0])<<4 | int(d[1])>>4, int(d[1]&0x0F)<<8 | int(d[2]), nil
+	}
+	return false, 0, 0, nil
+}
+
+// RestoreITunSMPB writes an iTunSMPB comment back into an MP3 that lost it.
+// Other formats are not supported.
+func RestoreITunSMPB(path, value string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".mp3") {
+		return fmt.Errorf("cannot write iTunSMPB to %s files", filepath.Ext(path))
+	}
+	tag, err := OpenID3(path)
+	if err != nil {
+		return fmt.Errorf("mp3 open: %w", err)
+	}
+	defer tag.Close()
+	tag.AddCommentFrame(id3v2.CommentFrame{
+		Encoding:    tag.DefaultEncoding(),
+		Language:    "eng",
+		Description: "iTunSMPB",
+		Text:        value,
+	})
+	return tag.Save()
+}
@@ -0,0 +1,247 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// defaultGenreMap drops common non-genre tags and fixes a few spellings.
+// GENRE_MAP entries are added on top.
+var defaultGenreMap = map[string]string{
+	"seen live":        "",
+	"favorites":        "",
+	"favourites":       "",
+	"albums i own":     "",
+	"favorite":         "",
+	"awesome":          "",
+	"owned":            "",
+	"vinyl":            "",
+	"hip hop":          "Hip-Hop",
+	"hiphop":           "Hip-Hop",
+	"rnb":              "R&B",
+	"r and b":          "R&B",
+	"rhythm and blues": "R&B",
+	"electronica":      "Electronic",
+	"idm":              "IDM",
+	"edm":              "EDM",
+	"uk garage":        "UK Garage",
+	"lo fi":            "Lo-Fi",
+	"lofi":             "Lo-Fi",
+	"post rock":        "Post-Rock",
+	"post punk":        "Post-Punk",
+}
+
+var (
+	genreMapOnce sync.Once
+	genreMap     map[string]string
+)
+
+// genreKey folds a genre for lookup: lower case, with "-", "_" and runs of
+// spaces turned into single spaces.
+func genreKey(s string) string {
+	s = strings.ToLower(strings.NewReplacer("-", " ", "_", " ").Replace(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// genreMapping returns the default mapping merged with GENRE_MAP, a
+// comma-separated list of from=to pairs such as "indie-rock=Indie Rock". An
+// empty "to" drops the tag.
+func genreMapping() map[string]string {
+	genreMapOnce.Do(func() {
+		genreMap = make(map[string]string, len(defaultGenreMap))
+		for k, v := range defaultGenreMap {
+			genreMap[k] = v
+		}
+		for _, pair := range strings.Split(os.Getenv("GENRE_MAP"), ",") {
+			from, to, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(from) == "" {
+				continue
+			}
+			genreMap[genreKey(from)] = strings.TrimSpace(to)
+		}
+	})
+	return genreMap
+}
+
+// NormalizeGenre maps a raw genre tag through the genre mapping, or title
+// cases it ("indie-rock" → "Indie Rock"). It returns "" for tags the mapping
+// drops.
+func NormalizeGenre(raw string) string {
+	key := genreKey(raw)
+	if key == "" {
+		return ""
+	}
+	if v, ok := genreMapping()[key]; ok {
+		return v
+	}
+	words := strings.Fields(key)
+	for i, w := range words {
+		r := []rune(w)
+		words[i] = string(unicode.ToUpper(r[0])) + string(r[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+// firstGenre returns the first of tags (most popular first) that normalizes
+// to a genre, skipping ones that merely repeat the artist's name.
+func firstGenre(tags []string, artist string) string {
+	if g := firstGenres(tags, artist, 1); len(g) > 0 {
+		return g[0]
+	}
+	return ""
+}
+
+// firstGenres is firstGenre for up to n distinct genres.
+func firstGenres(tags []string, artist string, n int) []string {
+	var out []string
+	for _, t := range tags {
+		if len(out) == n {
+			break
+		}
+		if genreKey(t) == genreKey(artist) {
+			continue
+		}
+		if g := NormalizeGenre(t); g != "" && !slices.Contains(out, g) {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// genreLimit returns GENRE_LIMIT, how many MusicBrainz genres are written to
+// the multi-value GENRE tag (default 1).
+func genreLimit() int {
+	if n, err := strconv.Atoi(os.Getenv("GENRE_LIMIT")); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// GenreSources returns GENRE_SOURCES, the comma-separated genre providers to
+// try in order ("lastfm", "musicbrainz"), or nil when genre lookup is off.
+func GenreSources() []string {
+	var out []string
+	for _, s := range strings.Split(os.Getenv("GENRE_SOURCES"), ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// LookupGenre asks each of sources in turn for md's genre and returns the
+// first normalized result.
+func LookupGenre(md *MusicMetadata, sources []string) (string, error) {
+	artist := FirstNonEmpty(md.AlbumArtist, md.Artist)
+	var errs []error
+	for _, src := range sources {
+		var tags []string
+		var err error
+		switch src {
+		case "lastfm":
+			tags, err = lastfmTopTags(artist, md.Album)
+		case "musicbrainz":
+			tags, err = musicBrainzGenres(md.ReleaseMBID)
+		default:
+			err = fmt.Errorf("unknown genre source %q", src)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src, err))
+			continue
+		}
+		if g := firstGenre(tags, artist); g != "" {
+			return g, nil
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// lastfmTopTags returns Last.fm's top tags for the album, or for the artist
+// when the album has none. It needs LASTFM_API_KEY.
+func lastfmTopTags(artist, album string) ([]string, error) {
+	key := os.Getenv("LASTFM_API_KEY")
+	if key == "" {
+		return nil, errors.New("LASTFM_API_KEY is not set")
+	}
+	get := func(params url.Values) ([]string, error) {
+		params.Set("api_key", key)
+		params.Set("format", "json")
+		params.Set("autocorrect", "1")
+		resp, err := HTTPGet("https://ws.audioscrobbler.com/2.0/?" + params.Encode())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Last.fm returned %d", resp.StatusCode)
+		}
+		var data struct {
+			TopTags struct {
+				Tag []struct {
+					Name string `json:"name"`
+				} `json:"tag"`
+			} `json:"toptags"`
+		}
+		// Unknown albums come back as {"error": 6, ...}, which decodes to no tags.
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return nil, err
+		}
+		var tags []string
+		for _, t := range data.TopTags.Tag {
+			tags = append(tags, t.Name)
+		}
+		return tags, nil
+	}
+
+	if album != "" {
+		tags, err := get(url.Values{"method": {"album.gettoptags"}, "artist": {artist}, "album": {album}})
+		if err != nil || len(tags) > 0 {
+			return tags, err
+		}
+	}
+	return get(url.Values{"method": {"artist.gettoptags"}, "artist": {artist}})
+}
+
+// musicBrainzGenres returns the genres of a release, or of its release group
+// when the release has none, most voted first.
+func musicBrainzGenres(releaseMBID string) ([]string, error) {
+	if releaseMBID == "" {
+		return nil, errors.New("no MusicBrainz release ID")
+	}
+	var r MBRelease
+	if err := MBGet(fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=genres+release-groups", url.QueryEscape(releaseMBID)), &r); err != nil {
+		return nil, err
+	}
+	genres := r.Genres
+	if len(genres) == 0 && r.ReleaseGroup.ID != "" {
+		var rg struct {
+			Genres []MBGenre `json:"genres"`
+		}
+		if err := MBGet(fmt.Sprintf("/ws/2/release-group/%s?fmt=json&inc=genres", url.QueryEscape(r.ReleaseGroup.ID)), &rg); err != nil {
+			return nil, err
+		}
+		genres = rg.Genres
+	}
+	return genreNames(genres), nil
+}
+
+// genreNames returns the names of genres, most voted first.
+func genreNames(genres []MBGenre) []string {
+	sorted := append([]MBGenre(nil), genres...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Count > sorted[j].Count })
+	names := make([]string, len(sorted))
+	for i, g := range sorted {
+		names[i] = g.Name
+	}
+	return names
+}
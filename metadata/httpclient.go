@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UserAgent identifies the importer to the APIs it calls.
+const UserAgent = "music-importer/1.0 (https://github.com/gabehf/music-importer)"
+
+// maxRetryWait caps how long one retry waits, even when the server asks for
+// longer with Retry-After.
+const maxRetryWait = 2 * time.Minute
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+	offline    atomic.Bool
+)
+
+// ErrOffline is returned by HTTPDo while offline mode is on.
+var ErrOffline = errors.New("offline")
+
+// SetOffline turns offline mode on or off. While it is on, HTTPDo fails
+// straight away with ErrOffline; cached responses are still served.
+func SetOffline(on bool) {
+	offline.Store(on)
+}
+
+// httpClient returns the client used for all outbound API requests: it
+// times out after HTTP_TIMEOUT (default 30s) and goes through HTTP_PROXY /
+// HTTPS_PROXY (minus NO_PROXY) when they are set.
+func httpClient() *http.Client {
+	clientOnce.Do(func() {
+		timeout := 30 * time.Second
+		if d, err := time.ParseDuration(os.Getenv("HTTP_TIMEOUT")); err == nil && d > 0 {
+			timeout = d
+		}
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = http.ProxyFromEnvironment
+		client = &http.Client{Timeout: timeout, Transport: t}
+	})
+	return client
+}
+
+// httpRetries returns HTTP_RETRIES (default 3), how many times a request
+// is retried after a network error, a 429 or a 5xx response.
+func httpRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("HTTP_RETRIES")); err == nil && n >= 0 {
+		return n
+	}
+	return 3
+}
+
+// retryAfter returns the wait a 429 or 503 response asks for in its
+// Retry-After header (seconds or an HTTP date), or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// HTTPDo sends req with the shared client, retrying GET and HEAD requests
+// with exponential backoff (1s, 2s, 4s, …) on network errors, 429 and 5xx
+// responses, honouring Retry-After. In offline mode it fails with
+// ErrOffline without sending anything. It sets the importer's User-Agent unless
+// req has one. Each attempt waits for the host's HTTP_RATE_LIMITS slot (see
+// ratelimit.go). The last response or error is returned once retries run out.
+func HTTPDo(req *http.Request) (*http.Response, error) {
+	if offline.Load() {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Host, ErrOffline)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	retries := httpRetries()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		retries = 0
+	}
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		if err := waitForHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		resp, err := httpClient().Do(req)
+		retry := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retry || attempt >= retries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait, reason := backoff, ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			if ra := retryAfter(resp); ra > wait {
+				wait = ra
+			}
+			resp.Body.Close()
+			reason = "status " + strconv.Itoa(resp.StatusCode)
+		}
+		if wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+		fmt.Printf("→ %s %s: %s, retrying in %s\n", req.Method, req.URL.Host, reason, wait)
+
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// HTTPGet is HTTPDo for a plain GET of u.
+func HTTPGet(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return HTTPDo(req)
+}
+
+// Reachable reports whether u answers a HEAD request within timeout, through
+// the same proxy settings as every other request and without retries.
+func Reachable(u string, timeout time.Duration) bool {
+	req, err := http.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	c := *httpClient()
+	c.Timeout = timeout
+	resp, err := c.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
@@ -0,0 +1,191 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// id3Version returns ID3_VERSION (3 or 4), the ID3v2 version MP3 tags are
+// written in, or 0 to keep each file's own version.
+func id3Version() byte {
+	switch strings.TrimPrefix(strings.ToLower(os.Getenv("ID3_VERSION")), "2.") {
+	case "3":
+		return 3
+	case "4":
+		return 4
+	}
+	return 0
+}
+
+// id3Encoding returns the text encoding for frames of a tag in the given
+// version, from ID3_ENCODING: "utf8", "utf16" or "latin1". UTF-8 is
+// ID3v2.4 only, so v2.3 tags get UTF-16 instead. ok is false when nothing
+// is configured and a v2.4 tag may keep whatever its frames use.
+func id3Encoding(version byte) (enc id3v2.Encoding, ok bool) {
+	switch strings.ToLower(os.Getenv("ID3_ENCODING")) {
+	case "latin1", "iso-8859-1":
+		return id3v2.EncodingISO, true
+	case "utf16", "utf-16":
+		return id3v2.EncodingUTF16, true
+	case "utf8", "utf-8":
+		if version == 4 {
+			return id3v2.EncodingUTF8, true
+		}
+	}
+	return id3v2.EncodingUTF16, version == 3
+}
+
+// frameEncoding picks the encoding for one frame's text: Latin-1 only
+// holds text without characters beyond U+00FF, so anything else falls back
+// to UTF-16.
+func frameEncoding(enc id3v2.Encoding, text string) id3v2.Encoding {
+	if !enc.Equals(id3v2.EncodingISO) {
+		return enc
+	}
+	for _, r := range text {
+		if r > 0xFF {
+			return id3v2.EncodingUTF16
+		}
+	}
+	return enc
+}
+
+// id3DateFrames pairs the ID3v2.3 year frames with their ID3v2.4
+// replacements, and id3v23DateFrames the other way round.
+var (
+	id3DateFrames    = map[string]string{"TYER": "TDRC", "TORY": "TDOR"}
+	id3v23DateFrames = map[string]string{"TDRC": "TYER", "TDOR": "TORY"}
+)
+
+// OpenID3 opens an MP3's ID3v2 tag for writing, converted to the
+// ID3_VERSION and ID3_ENCODING policy. Every MP3 tag writer goes through it,
+// so whatever the importer writes or rewrites follows the policy.
+func OpenID3(path string) (*id3v2.Tag, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, err
+	}
+	applyID3Policy(tag)
+	return tag, nil
+}
+
+// applyID3Policy converts tag to the configured version and encoding and
+// reports whether anything changed.
+func applyID3Policy(tag *id3v2.Tag) bool {
+	changed := false
+	if v := id3Version(); v != 0 && v != tag.Version() {
+		convertID3Dates(tag, v)
+		tag.SetVersion(v)
+		changed = true
+	}
+	enc, ok := id3Encoding(tag.Version())
+	if !ok {
+		return changed
+	}
+	tag.SetDefaultEncoding(enc)
+	for id, frames := range tag.AllFrames() {
+		recoded := make([]id3v2.Framer, 0, len(frames))
+		dirty := false
+		for _, f := range frames {
+			r, ok := recodeFrame(f, enc, tag.Version())
+			dirty = dirty || ok
+			recoded = append(recoded, r)
+		}
+		if !dirty {
+			continue
+		}
+		tag.DeleteFrames(id)
+		for _, f := range recoded {
+			tag.AddFrame(id, f)
+		}
+		changed = true
+	}
+	return changed
+}
+
+// recodeFrame returns f with its text in enc (see frameEncoding) and
+// whether that changed it. ID3v2.3 has no multi-value frames, so their
+// values are joined with "/" there.
+func recodeFrame(f id3v2.Framer, enc id3v2.Encoding, version byte) (id3v2.Framer, bool) {
+	changed := false
+	recode := func(e *id3v2.Encoding, text ...*string) {
+		all := ""
+		for _, t := range text {
+			if version == 3 && strings.Contains(*t, multiValueSep) {
+				*t = strings.ReplaceAll(*t, multiValueSep, "/")
+				changed = true
+			}
+			all += *t
+		}
+		if want := frameEncoding(enc, all); !e.Equals(want) {
+			*e = want
+			changed = true
+		}
+	}
+	switch fr := f.(type) {
+	case id3v2.TextFrame:
+		recode(&fr.Encoding, &fr.Text)
+		return fr, changed
+	case id3v2.UserDefinedTextFrame:
+		recode(&fr.Encoding, &fr.Description, &fr.Value)
+		return fr, changed
+	case id3v2.CommentFrame:
+		recode(&fr.Encoding, &fr.Description, &fr.Text)
+		return fr, changed
+	case id3v2.UnsynchronisedLyricsFrame:
+		recode(&fr.Encoding, &fr.ContentDescriptor, &fr.Lyrics)
+		return fr, changed
+	case id3v2.PictureFrame:
+		recode(&fr.Encoding, &fr.Description)
+		return fr, changed
+	}
+	return f, false
+}
+
+// convertID3Dates moves the year frames to the ones the target version
+// uses: TDRC "2020-05-17" becomes TYER "2020" in v2.3, and back.
+func convertID3Dates(tag *id3v2.Tag, version byte) {
+	for v3, v4 := range id3DateFrames {
+		from, to := v4, v3
+		if version == 4 {
+			from, to = v3, v4
+		}
+		tf := tag.GetTextFrame(from)
+		if tf.Text == "" {
+			continue
+		}
+		tag.DeleteFrames(from)
+		text := tf.Text
+		if version == 3 && len(text) > 4 {
+			text = text[:4]
+		}
+		if tag.GetTextFrame(to).Text == "" {
+			tag.AddTextFrame(to, tf.Encoding, text)
+		}
+	}
+}
+
+// ConvertID3 rewrites an MP3's tag in the ID3_VERSION and ID3_ENCODING
+// policy if it doesn't follow it already, and reports whether it did.
+// Without either setting, and for other files, it does nothing.
+func ConvertID3(path string) (bool, error) {
+	if os.Getenv("ID3_VERSION") == "" && os.Getenv("ID3_ENCODING") == "" || !strings.EqualFold(filepath.Ext(path), ".mp3") {
+		return false, nil
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return false, fmt.Errorf("mp3 open: %w", err)
+	}
+	defer tag.Close()
+	if !tag.HasFrames() || !applyID3Policy(tag) {
+		return false, nil
+	}
+	if err := tag.Save(); err != nil {
+		return false, fmt.Errorf("mp3 save: %w", err)
+	}
+	return true, nil
+}
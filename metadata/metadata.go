@@ -0,0 +1,489 @@
+// Package metadata reads and writes audio tags and looks releases up on
+// MusicBrainz.
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/tools"
+)
+
+// Source identifies which backend resolved the album metadata.
+type Source string
+
+const (
+	SourceBeets       Source = "beets"
+	SourceAutotag     Source = "autotag" // the native MusicBrainz autotagger
+	SourceDiscogs     Source = "discogs"
+	SourceMusicBrainz Source = "musicbrainz"
+	SourceFileTags    Source = "file_tags"
+	SourceFilename    Source = "filename" // inferred from folder and file names
+	SourceManual      Source = "manual"
+	SourceOverride    Source = "override" // autotagger pinned to a release picked in the web UI
+	SourceDiscID      Source = "disc_id"  // autotagger pinned to the release matching a CD's disc ID
+	SourceUnknown     Source = ""
+)
+
+type MusicMetadata struct {
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Title       string
+	Genre       string
+	Year        string // four-digit year, kept for backward compat
+	Date        string // normalised as YYYY.MM.DD (or YYYY.MM or YYYY)
+	// Date and year of the original release, when this one is a reissue or
+	// remaster (MusicBrainz's release group first-release-date).
+	OriginalDate string
+	OriginalYear string
+	Quality      string // e.g. "FLAC-24bit-96kHz" or "MP3-320kbps"
+
+	Label         string
+	CatalogNumber string
+	Country       string // release country, e.g. "GB" or "XW"
+	Media         string // e.g. "CD", "Digital Media", "12\" Vinyl"
+	ReleaseType   string // album, single, ep, compilation, …
+
+	// Classical credits: the composer and work of the (first) track, and
+	// the conductor.
+	Composer  string
+	Work      string
+	Conductor string
+
+	// Sort names, e.g. "Beatles, The", used to recognise artist folders.
+	ArtistSort      string
+	AlbumArtistSort string
+
+	// Latin-script names of a release in another script, from MusicBrainz.
+	ArtistTransliteration string
+	AlbumTransliteration  string
+
+	ReleaseMBID    string // MusicBrainz release ID, as written by the autotagger
+	Disambiguation string // MusicBrainz release comment, e.g. "2011 remaster"
+
+	// MusicBrainz release group and album artist IDs, read from the tags.
+	ReleaseGroupMBID string
+	AlbumArtistMBID  string
+
+	Audiobook bool // imported with the audiobook profile
+}
+
+// readRawTags returns the embedded tags of an audio file as ffprobe reports
+// them. Key case follows the file (Vorbis comments) or ffprobe's ID3 names.
+func readRawTags(path string) (map[string]string, error) {
+	out, err := tools.Output(
+		"ffprobe", "-v", "quiet", "-print_format", "json",
+		"-show_format", path,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+
+	json.Unmarshal(out, &data)
+	return data.Format.Tags, nil
+}
+
+// HasEmbeddedLyrics reports whether a file carries lyrics in its tags
+// (LYRICS or UNSYNCEDLYRICS comments, or an ID3 USLT frame, which ffprobe
+// reports as "lyrics-<lang>").
+func HasEmbeddedLyrics(path string) bool {
+	t, err := readRawTags(path)
+	if err != nil {
+		return false
+	}
+	for k, v := range t {
+		k = strings.ToLower(k)
+		if strings.TrimSpace(v) != "" && (strings.HasPrefix(k, "lyrics") || k == "unsyncedlyrics") {
+			return true
+		}
+	}
+	return false
+}
+
+// TaggedInstrumental reports whether a track's tags mark it as instrumental:
+// LANGUAGE "zxx" (no linguistic content, as Picard writes for instrumental
+// recordings) or an INSTRUMENTAL tag other than "0" or "false".
+func TaggedInstrumental(path string) bool {
+	t, err := readRawTags(path)
+	if err != nil {
+		return false
+	}
+	for k, v := range t {
+		k, v = strings.ToLower(k), strings.ToLower(strings.TrimSpace(v))
+		switch {
+		case k == "language" && v == "zxx":
+			return true
+		case k == "instrumental" && v != "" && v != "0" && v != "false":
+			return true
+		}
+	}
+	return false
+}
+
+// ReadBPMKey returns a track's BPM and INITIALKEY tags (TBPM and TKEY in
+// ID3), empty when unset.
+func ReadBPMKey(path string) (bpm, key string) {
+	t, _ := readRawTags(path)
+	for k, v := range t {
+		switch strings.ToLower(k) {
+		case "bpm", "tbpm":
+			bpm = strings.TrimSpace(v)
+		case "initialkey", "tkey":
+			key = strings.TrimSpace(v)
+		}
+	}
+	return bpm, key
+}
+
+// ReplayGain is the loudness information tagged on a track. Opus files
+// carry R128_* gains instead, which count as track and album gain.
+type ReplayGain struct {
+	TrackGain string
+	AlbumGain string
+	Reference string // REPLAYGAIN_REFERENCE_LOUDNESS, e.g. "-18.00 LUFS"
+}
+
+// ReadReplayGain returns the ReplayGain tags of a file.
+func ReadReplayGain(path string) (ReplayGain, error) {
+	t, err := readRawTags(path)
+	if err != nil {
+		return ReplayGain{}, err
+	}
+	var rg ReplayGain
+	for k, v := range t {
+		v = strings.TrimSpace(v)
+		switch strings.ToUpper(k) {
+		case "REPLAYGAIN_TRACK_GAIN", "R128_TRACK_GAIN":
+			rg.TrackGain = v
+		case "REPLAYGAIN_ALBUM_GAIN", "R128_ALBUM_GAIN":
+			rg.AlbumGain = v
+		case "REPLAYGAIN_REFERENCE_LOUDNESS":
+			rg.Reference = v
+		}
+	}
+	return rg, nil
+}
+
+// TrackTags are the per-track tags track file names are rendered from, and
+// the track's MusicBrainz recording ID.
+type TrackTags struct {
+	Track     int
+	Disc      int
+	DiscTotal int
+	Title     string
+	Artist    string
+
+	RecordingMBID string
+}
+
+// ReadTrackTags returns a file's track and disc numbers, title and artist.
+// "3/12" style numbers carry the total after the slash.
+func ReadTrackTags(path string) (TrackTags, error) {
+	t, err := readRawTags(path)
+	if err != nil {
+		return TrackTags{}, err
+	}
+	number := func(s string) (n, total int) {
+		num, tot, _ := strings.Cut(s, "/")
+		n, _ = strconv.Atoi(strings.TrimSpace(num))
+		total, _ = strconv.Atoi(strings.TrimSpace(tot))
+		return n, total
+	}
+	var tt TrackTags
+	var discTotal string
+	for k, v := range t {
+		v = strings.TrimSpace(v)
+		switch strings.ToUpper(k) {
+		case "TRACK", "TRACKNUMBER":
+			tt.Track, _ = number(v)
+		case "DISC", "DISCNUMBER":
+			tt.Disc, tt.DiscTotal = number(v)
+		case "DISCTOTAL", "TOTALDISCS":
+			discTotal = v
+		case "TITLE":
+			tt.Title = v
+		case "ARTIST":
+			tt.Artist = v
+		case "MUSICBRAINZ_TRACKID", "MUSICBRAINZ TRACK ID":
+			tt.RecordingMBID = v
+		}
+	}
+	if n, _ := number(discTotal); n > 0 {
+		tt.DiscTotal = n
+	}
+	return tt, nil
+}
+
+// Read embedded tags from an audio file using ffprobe.
+func ReadTags(path string) (*MusicMetadata, error) {
+	t, err := readRawTags(path)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return &MusicMetadata{}, nil
+	}
+
+	rawDate := FirstNonEmpty(t["date"], t["DATE"], t["year"], t["YEAR"], t["ORIGINALYEAR"])
+	date := parseDate(rawDate)
+	year := ""
+	if len(date) >= 4 {
+		year = date[:4]
+	}
+
+	originalDate := parseDate(FirstNonEmpty(t["ORIGINALDATE"], t["originaldate"], t["TDOR"], t["TORY"], t["ORIGINALYEAR"], t["originalyear"]))
+
+	return &MusicMetadata{
+		Artist:      FirstNonEmpty(t["artist"], t["ARTIST"]),
+		AlbumArtist: FirstNonEmpty(t["album_artist"], t["ALBUMARTIST"], t["ALBUM_ARTIST"], t["album artist"]),
+		Album:       FirstNonEmpty(t["album"], t["ALBUM"]),
+		Title:       FirstNonEmpty(t["title"], t["TITLE"]),
+		Genre:       FirstValue(FirstNonEmpty(t["genre"], t["GENRE"])),
+		Year:        year,
+		Date:        date,
+
+		OriginalDate: originalDate,
+		OriginalYear: originalDate[:min(4, len(originalDate))],
+		ReleaseMBID:  FirstNonEmpty(t["MUSICBRAINZ_ALBUMID"], t["musicbrainz_albumid"], t["MusicBrainz Album Id"]),
+
+		ReleaseGroupMBID: FirstNonEmpty(t["MUSICBRAINZ_RELEASEGROUPID"], t["musicbrainz_releasegroupid"], t["MusicBrainz Release Group Id"]),
+		AlbumArtistMBID:  FirstNonEmpty(t["MUSICBRAINZ_ALBUMARTISTID"], t["musicbrainz_albumartistid"], t["MusicBrainz Album Artist Id"]),
+
+		Disambiguation: FirstNonEmpty(t["MUSICBRAINZ_ALBUMCOMMENT"], t["musicbrainz_albumcomment"], t["MusicBrainz Album Comment"]),
+
+		Label:         FirstNonEmpty(t["LABEL"], t["label"], t["publisher"], t["ORGANIZATION"]),
+		CatalogNumber: FirstNonEmpty(t["CATALOGNUMBER"], t["catalognumber"]),
+		Country:       FirstNonEmpty(t["RELEASECOUNTRY"], t["releasecountry"], t["MusicBrainz Album Release Country"]),
+		Media:         FirstNonEmpty(t["MEDIA"], t["media"], t["TMED"]),
+		ReleaseType:   NormalizeReleaseType(FirstNonEmpty(t["RELEASETYPE"], t["releasetype"], t["MusicBrainz Album Type"])),
+
+		Composer:  FirstNonEmpty(t["COMPOSER"], t["composer"], t["TCOM"]),
+		Work:      FirstNonEmpty(t["WORK"], t["work"], t["Work"]),
+		Conductor: FirstNonEmpty(t["CONDUCTOR"], t["conductor"], t["TPE3"]),
+
+		ArtistSort:      FirstNonEmpty(t["ARTISTSORT"], t["artistsort"], t["artist-sort"], t["TSOP"]),
+		AlbumArtistSort: FirstNonEmpty(t["ALBUMARTISTSORT"], t["albumartistsort"], t["album_artist-sort"], t["TSO2"]),
+
+		ArtistTransliteration: FirstNonEmpty(t["ARTIST_TRANSLITERATION"], t["artist_transliteration"]),
+		AlbumTransliteration:  FirstNonEmpty(t["ALBUM_TRANSLITERATION"], t["album_transliteration"]),
+	}, nil
+}
+
+// parseDate normalises a raw DATE/date tag value into YYYY.MM.DD (or YYYY.MM
+// or YYYY) dot-separated format, or returns the input unchanged if it cannot
+// be recognised.
+//
+// Supported input formats:
+//   - YYYY
+//   - YYYY-MM
+//   - YYYY-MM-DD
+//   - YYYYMMDD
+func parseDate(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	// YYYYMMDD (exactly 8 digits, no separators)
+	if len(raw) == 8 && isAllDigits(raw) {
+		return raw[0:4] + "." + raw[4:6] + "." + raw[6:8]
+	}
+
+	// YYYY-MM-DD, YYYY-MM, or YYYY (with dashes)
+	parts := strings.Split(raw, "-")
+	switch len(parts) {
+	case 1:
+		if len(parts[0]) == 4 && isAllDigits(parts[0]) {
+			return parts[0]
+		}
+	case 2:
+		if len(parts[0]) == 4 && isAllDigits(parts[0]) && len(parts[1]) == 2 && isAllDigits(parts[1]) {
+			return parts[0] + "." + parts[1]
+		}
+	case 3:
+		if len(parts[0]) == 4 && isAllDigits(parts[0]) &&
+			len(parts[1]) == 2 && isAllDigits(parts[1]) &&
+			len(parts[2]) == 2 && isAllDigits(parts[2]) {
+			return parts[0] + "." + parts[1] + "." + parts[2]
+		}
+	}
+
+	// Unrecognised — return as-is so we don't silently drop it.
+	return raw
+}
+
+func isAllDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// readAudioQuality probes the first audio stream of path and returns a
+// quality label such as "FLAC-24bit-96kHz" or "MP3-320kbps".
+func readAudioQuality(path string) (string, error) {
+	out, err := tools.Output(
+		"ffprobe", "-v", "quiet", "-print_format", "json",
+		"-show_streams", "-select_streams", "a:0",
+		path,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var data struct {
+		Streams []struct {
+			CodecName        string `json:"codec_name"`
+			SampleRate       string `json:"sample_rate"`
+			BitRate          string `json:"bit_rate"`
+			BitsPerRawSample string `json:"bits_per_raw_sample"`
+		} `json:"streams"`
+	}
+
+	if err := json.Unmarshal(out, &data); err != nil {
+		return "", err
+	}
+	if len(data.Streams) == 0 {
+		return "", fmt.Errorf("no audio streams found in %s", path)
+	}
+
+	s := data.Streams[0]
+	codec := strings.ToUpper(s.CodecName) // e.g. "FLAC", "MP3"
+
+	switch strings.ToLower(s.CodecName) {
+	case "flac":
+		bits := s.BitsPerRawSample
+		if bits == "" || bits == "0" {
+			bits = "16" // safe fallback
+		}
+		khz := sampleRateToKHz(s.SampleRate)
+		return fmt.Sprintf("%s-%sbit-%s", codec, bits, khz), nil
+
+	case "mp3":
+		kbps := snapMP3Bitrate(s.BitRate)
+		return fmt.Sprintf("%s-%dkbps", codec, kbps), nil
+
+	default:
+		// Generic fallback: codec + bitrate if available.
+		if s.BitRate != "" && s.BitRate != "0" {
+			kbps := snapMP3Bitrate(s.BitRate)
+			return fmt.Sprintf("%s-%dkbps", codec, kbps), nil
+		}
+		return codec, nil
+	}
+}
+
+// sampleRateToKHz converts a sample-rate string in Hz (e.g. "44100") to a
+// human-friendly kHz string (e.g. "44.1kHz").
+func sampleRateToKHz(hz string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(hz))
+	if err != nil || n == 0 {
+		return "?kHz"
+	}
+	if n%1000 == 0 {
+		return fmt.Sprintf("%dkHz", n/1000)
+	}
+	return fmt.Sprintf("%.1fkHz", float64(n)/1000.0)
+}
+
+// commonMP3Bitrates lists the standard MPEG audio bitrates in kbps.
+var commonMP3Bitrates = []int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+
+// snapMP3Bitrate rounds a raw bitrate string (in bps) to the nearest standard
+// MP3 bitrate (in kbps). For example "318731" → 320.
+func snapMP3Bitrate(bpsStr string) int {
+	bps, err := strconv.Atoi(strings.TrimSpace(bpsStr))
+	if err != nil || bps <= 0 {
+		return 128 // safe fallback
+	}
+	kbps := float64(bps) / 1000.0
+	best := commonMP3Bitrates[0]
+	bestDiff := math.Abs(kbps - float64(best))
+	for _, candidate := range commonMP3Bitrates[1:] {
+		if d := math.Abs(kbps - float64(candidate)); d < bestDiff {
+			bestDiff = d
+			best = candidate
+		}
+	}
+	return best
+}
+
+// Fallback: query MusicBrainz API manually if beets fails.
+func FetchMusicBrainzInfo(filename string) (*MusicMetadata, error) {
+	fmt.Println("→ Fallback: querying MusicBrainz:", filename)
+
+	query := fmt.Sprintf("recording:%q", strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	var data struct {
+		Recordings []struct {
+			Title    string `json:"title"`
+			Releases []struct {
+				ID           string `json:"id"`
+				Title        string `json:"title"`
+				ArtistCredit []struct {
+					Name string `json:"name"`
+				} `json:"artist-credit"`
+			} `json:"releases"`
+			FirstReleaseDate string `json:"first-release-date"`
+		} `json:"recordings"`
+	}
+
+	if err := MBGet("/ws/2/recording/?query="+url.QueryEscape(query)+"&fmt=json", &data); err != nil {
+		return nil, err
+	}
+
+	if len(data.Recordings) == 0 || len(data.Recordings[0].Releases) == 0 || len(data.Recordings[0].Releases[0].ArtistCredit) == 0 {
+		return nil, errors.New("no MusicBrainz match")
+	}
+
+	r := data.Recordings[0]
+	rel := r.Releases[0]
+
+	return &MusicMetadata{
+		Artist: rel.ArtistCredit[0].Name,
+		Album:  rel.Title,
+		Title:  r.Title,
+		Year:   strings.Split(r.FirstReleaseDate, "-")[0],
+
+		ReleaseMBID: rel.ID,
+	}, nil
+}
+
+// AttachQuality probes trackPath for audio quality and sets md.Quality.
+// Errors are logged but not returned — a missing quality label is non-fatal.
+func AttachQuality(md *MusicMetadata, trackPath string) {
+	q, err := readAudioQuality(trackPath)
+	if err != nil {
+		fmt.Println("Could not determine audio quality:", err)
+		return
+	}
+	md.Quality = q
+}
+
+// AudioQuality returns a track's quality label, e.g. "FLAC-24bit-96kHz".
+func AudioQuality(trackPath string) (string, error) {
+	return readAudioQuality(trackPath)
+}
+
+func FirstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
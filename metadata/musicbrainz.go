@@ -0,0 +1,332 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ── MusicBrainz types ─────────────────────────────────────────────────────────
+
+type MBArtistCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+	Artist     struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		SortName string `json:"sort-name"`
+	} `json:"artist"`
+}
+
+type MBMedia struct {
+	Format     string    `json:"format"`
+	Position   int       `json:"position"`
+	TrackCount int       `json:"track-count"`
+	Tracks     []MBTrack `json:"tracks,omitempty"` // only with inc=recordings
+	Pregap     *MBTrack  `json:"pregap,omitempty"` // hidden track before track 1, if listed
+}
+
+type MBTrack struct {
+	ID        string `json:"id"`
+	Position  int    `json:"position"`
+	Title     string `json:"title"`
+	Length    int    `json:"length"` // milliseconds
+	Recording struct {
+		ID        string       `json:"id"`
+		Relations []MBRelation `json:"relations,omitempty"` // only with recording-level-rels
+	} `json:"recording"`
+	ArtistCredit []MBArtistCredit `json:"artist-credit"`
+}
+
+// MBRelation is an artist or work relationship, e.g. a recording's
+// "performance" of a work or a work's "composer".
+type MBRelation struct {
+	Type   string `json:"type"`
+	Artist *struct {
+		Name     string `json:"name"`
+		SortName string `json:"sort-name"`
+	} `json:"artist,omitempty"`
+	Work *MBWork `json:"work,omitempty"`
+}
+
+type MBWork struct {
+	ID        string       `json:"id"`
+	Title     string       `json:"title"`
+	Relations []MBRelation `json:"relations,omitempty"` // only with work-level-rels
+}
+
+type MBRelease struct {
+	ID                 string `json:"id"`
+	Title              string `json:"title"`
+	Date               string `json:"date"`
+	Country            string `json:"country"`
+	Disambiguation     string `json:"disambiguation"`
+	TextRepresentation struct {
+		Language string `json:"language"`
+		Script   string `json:"script"`
+	} `json:"text-representation"`
+	Media        []MBMedia        `json:"media"`
+	ArtistCredit []MBArtistCredit `json:"artist-credit"`
+	LabelInfo    []MBLabelInfo    `json:"label-info"` // only with inc=labels
+	Genres       []MBGenre        `json:"genres"`     // only with inc=genres
+	ReleaseGroup struct {
+		ID               string    `json:"id"`
+		PrimaryType      string    `json:"primary-type"`
+		SecondaryTypes   []string  `json:"secondary-types"`
+		Genres           []MBGenre `json:"genres"`
+		FirstReleaseDate string    `json:"first-release-date"` // of the original release, before any reissue
+	} `json:"release-group"`
+}
+
+type MBLabelInfo struct {
+	CatalogNumber string `json:"catalog-number"`
+	Label         struct {
+		Name string `json:"name"`
+	} `json:"label"`
+}
+
+type MBGenre struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type MBArtist struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Country        string `json:"country"`
+	Disambiguation string `json:"disambiguation"`
+}
+
+type MBReleaseGroup struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	PrimaryType      string `json:"primary-type"`
+	FirstReleaseDate string `json:"first-release-date"`
+}
+
+// ArtistCreditString joins an artist credit the way MusicBrainz displays it,
+// e.g. "Artist A feat. Artist B".
+func ArtistCreditString(credits []MBArtistCredit) string {
+	var b strings.Builder
+	for _, c := range credits {
+		b.WriteString(FirstNonEmpty(c.Name, c.Artist.Name))
+		b.WriteString(c.JoinPhrase)
+	}
+	return b.String()
+}
+
+// ArtistCreditSortString joins an artist credit by the artists' sort names,
+// e.g. "National, The & Bridgers, Phoebe".
+func ArtistCreditSortString(credits []MBArtistCredit) string {
+	var b strings.Builder
+	for _, c := range credits {
+		b.WriteString(FirstNonEmpty(c.Artist.SortName, c.Name, c.Artist.Name))
+		b.WriteString(c.JoinPhrase)
+	}
+	return b.String()
+}
+
+// ArtistCreditNames returns each credited artist's name, for the
+// multi-value ARTISTS and ALBUMARTISTS tags.
+func ArtistCreditNames(credits []MBArtistCredit) []string {
+	var out []string
+	for _, c := range credits {
+		out = append(out, FirstNonEmpty(c.Name, c.Artist.Name))
+	}
+	return out
+}
+
+// ReleaseTrackCount returns the total number of tracks across all media in a release.
+func ReleaseTrackCount(r MBRelease) int {
+	total := 0
+	for _, m := range r.Media {
+		total += m.TrackCount
+	}
+	return total
+}
+
+// GetMBRelease fetches a single release by MBID (with media/track-count and
+// release group included).
+func GetMBRelease(mbid string) (*MBRelease, error) {
+	var r MBRelease
+	err := MBGet(fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=media+release-groups", url.QueryEscape(mbid)), &r)
+	return &r, err
+}
+
+// MBGet fetches a MusicBrainz API path and decodes the JSON response into
+// out, through the API cache.
+func MBGet(path string, out interface{}) error {
+	u := "https://musicbrainz.org" + path
+	status, body, err := CachedFetch(u, func() (int, []byte, error) {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return 0, nil, err
+		}
+		resp, err := HTTPDo(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.StatusCode, body, err
+	})
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("MusicBrainz returned %d", status)
+	}
+	return json.Unmarshal(body, out)
+}
+
+func SearchMBReleases(query string) ([]MBRelease, error) {
+	var result struct {
+		Releases []MBRelease `json:"releases"`
+	}
+	err := MBGet("/ws/2/release/?query="+url.QueryEscape(query)+"&fmt=json&limit=20&inc=media", &result)
+	return result.Releases, err
+}
+
+func SearchMBArtists(query string) ([]MBArtist, error) {
+	var result struct {
+		Artists []MBArtist `json:"artists"`
+	}
+	err := MBGet("/ws/2/artist/?query="+url.QueryEscape(query)+"&fmt=json&limit=20", &result)
+	return result.Artists, err
+}
+
+// releaseFormatScore returns a preference score for a release's media format.
+// Higher is better. CD=2, Digital Media=1, anything else=0.
+func releaseFormatScore(r MBRelease) int {
+	for _, m := range r.Media {
+		switch m.Format {
+		case "Digital Media":
+			return 2
+		case "CD":
+			return 1
+		}
+	}
+	return 0
+}
+
+// releaseCountryScore returns a preference score for a release's country.
+// Higher is better. KR=3, JP=2, XW=1, anything else=0.
+func releaseCountryScore(r MBRelease) int {
+	switch r.Country {
+	case "XW":
+		return 2
+	case "KR":
+		return 1
+	}
+	return 0
+}
+
+// returns true if strings formatted 'YYYY-MM-DD" ts1 is before ts2
+func timeStringIsBefore(ts1, ts2 string) (bool, error) {
+	datefmt := "2006-02-01"
+	t1, err := time.Parse(datefmt, ts1)
+	if err != nil {
+		return false, err
+	}
+	t2, err := time.Parse(datefmt, ts2)
+	if err != nil {
+		return false, err
+	}
+	return t1.Unix() <= t2.Unix(), nil
+}
+
+// PickBestRelease selects the preferred release from a list.
+// No disambiguation (canonical release) is the primary sort key;
+// format (CD > Digital Media > *) is secondary; country (KR > XW > *) breaks ties.
+func PickBestRelease(releases []MBRelease) *MBRelease {
+	if len(releases) == 0 {
+		return nil
+	}
+	best := &releases[0]
+	for i := 1; i < len(releases); i++ {
+		r := &releases[i]
+
+		rNoDisamb := r.Disambiguation == ""
+		bestNoDisamb := best.Disambiguation == ""
+
+		// Prefer releases with no disambiguation — they are the canonical default.
+		if rNoDisamb && !bestNoDisamb {
+			best = r
+			continue
+		}
+		if !rNoDisamb && bestNoDisamb {
+			continue
+		}
+
+		// Both have the same disambiguation status; use date/format/country.
+		if before, err := timeStringIsBefore(r.Date, best.Date); before && err == nil {
+			rf, bf := releaseFormatScore(*r), releaseFormatScore(*best)
+			if rf > bf || (rf == bf && releaseCountryScore(*r) > releaseCountryScore(*best)) {
+				best = r
+			}
+		}
+	}
+	return best
+}
+
+// PickBestReleaseForGroup fetches all releases for a release group via the
+// MusicBrainz browse API (with media info) and returns the preferred release.
+// Returns nil on error or when the group has no releases.
+func PickBestReleaseForGroup(rgMBID string) *MBRelease {
+	releases, err := GetMBGroupReleases(rgMBID)
+	if err != nil || len(releases) == 0 {
+		return nil
+	}
+	return PickBestRelease(releases)
+}
+
+// GetMBGroupReleases returns the releases of a release group with their
+// media (formats and track counts, not tracklists).
+func GetMBGroupReleases(rgMBID string) ([]MBRelease, error) {
+	var result struct {
+		Releases []MBRelease `json:"releases"`
+	}
+	path := fmt.Sprintf("/ws/2/release?release-group=%s&fmt=json&inc=media&limit=100", url.QueryEscape(rgMBID))
+	err := MBGet(path, &result)
+	return result.Releases, err
+}
+
+// GetMBArtistReleaseGroups returns all Album and EP release groups for an artist,
+// paginating through the MusicBrainz browse API with the required 1 req/s rate limit.
+func GetMBArtistReleaseGroups(artistMBID string) ([]MBReleaseGroup, error) {
+	const limit = 100
+	var all []MBReleaseGroup
+
+	for offset := 0; ; offset += limit {
+		path := fmt.Sprintf(
+			"/ws/2/release-group?artist=%s&type=album%%7Cep&fmt=json&limit=%d&offset=%d",
+			url.QueryEscape(artistMBID), limit, offset,
+		)
+
+		var result struct {
+			ReleaseGroups []MBReleaseGroup `json:"release-groups"`
+			Count         int              `json:"release-group-count"`
+		}
+		if err := MBGet(path, &result); err != nil {
+			return all, err
+		}
+
+		for _, rg := range result.ReleaseGroups {
+			t := strings.ToLower(rg.PrimaryType)
+			if t == "album" || t == "ep" {
+				all = append(all, rg)
+			}
+		}
+
+		if offset+limit >= result.Count {
+			break
+		}
+		time.Sleep(time.Second) // MusicBrainz rate limit
+	}
+
+	return all, nil
+}
@@ -0,0 +1,69 @@
+package metadata
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hiddenTrackName matches the file names rippers give a disc's pregap
+// ("hidden track one audio"): "00 - Hidden Track.flac", "1-00 Intro.flac",
+// "Track 00.wav", "HTOA.flac".
+var hiddenTrackName = regexp.MustCompile(`(?i)^(\d+[-.])?(track\s*)?0+\b|\b(hidden\s*track|htoa|pregap)\b`)
+
+// dataTrackName matches the explicit names rippers give an enhanced CD's
+// data track: "Data Track.wav", "14 (data).flac". A file just called
+// "Data" may be a song of that name, so only its length can mark it.
+var dataTrackName = regexp.MustCompile(`(?i)\bdata\s*track\b|\(data\)`)
+
+// minTrackLength is the shortest file taken for music; anything shorter is
+// a data track remnant or a ripping glitch.
+const minTrackLength = time.Second
+
+func fileStem(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// IsHiddenTrack reports whether a file name marks a pregap track, which is
+// numbered 0 ahead of track 1 rather than shifting the disc's numbering.
+func IsHiddenTrack(path string) bool {
+	return hiddenTrackName.MatchString(fileStem(path))
+}
+
+// IsDataTrack reports whether an audio file is a data track remnant rather
+// than music: named as one, or shorter than a second (ffprobe measures it).
+func IsDataTrack(path string) bool {
+	if dataTrackName.MatchString(fileStem(path)) {
+		return true
+	}
+	t, err := probeLocalTrack(path)
+	return err == nil && isDataTrack(t)
+}
+
+func isDataTrack(t localTrack) bool {
+	return dataTrackName.MatchString(fileStem(t.Path)) || t.Length > 0 && t.Length < minTrackLength
+}
+
+// numberedTracks counts the local tracks that aren't pregap tracks, the
+// ones a release's track count is compared with.
+func numberedTracks(local []localTrack) int {
+	n := 0
+	for _, t := range local {
+		if !t.Hidden {
+			n++
+		}
+	}
+	return n
+}
+
+// pregapIndex returns the index of the pregap track of disc in remote, or
+// -1 when the release lists none.
+func pregapIndex(remote []releaseTrack, disc int) int {
+	for j, r := range remote {
+		if r.Position == 0 && (disc == 0 || r.Disc == disc) {
+			return j
+		}
+	}
+	return -1
+}
@@ -0,0 +1,140 @@
+package metadata
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// preserveTagsMode returns PRESERVE_TAGS: "matching" keeps existing values
+// that agree with the matched release apart from casing, spacing or
+// punctuation style; "all" keeps every existing value so tagging only fills
+// in missing fields. Anything else lets beets rewrite tags as usual.
+func preserveTagsMode() string {
+	switch m := strings.ToLower(os.Getenv("PRESERVE_TAGS")); m {
+	case "matching", "all":
+		return m
+	}
+	return ""
+}
+
+// preservedTagKeys maps the tag names writeTags understands to the ffprobe
+// tag names (lowercased) they are read from, in priority order. Only these
+// curated fields are preserved; IDs and other fields beets adds are always
+// kept.
+var preservedTagKeys = []struct {
+	key     string
+	sources []string
+}{
+	{"ARTIST", []string{"artist"}},
+	{"ALBUMARTIST", []string{"album_artist", "albumartist", "album artist"}},
+	{"ALBUM", []string{"album"}},
+	{"TITLE", []string{"title"}},
+	{"GENRE", []string{"genre"}},
+	{"DATE", []string{"date"}},
+	{"TRACKNUMBER", []string{"track", "tracknumber"}},
+	{"DISCNUMBER", []string{"disc", "discnumber"}},
+	{"COMPOSER", []string{"composer"}},
+}
+
+// preservedTags returns the non-blank preserved fields of raw ffprobe tags,
+// each taken from its first source name that has a value.
+func preservedTags(raw map[string]string) map[string]string {
+	lower := make(map[string]string, len(raw))
+	for k, v := range raw {
+		lower[strings.ToLower(k)] = v
+	}
+	tags := map[string]string{}
+	for _, p := range preservedTagKeys {
+		for _, src := range p.sources {
+			if v := lower[src]; strings.TrimSpace(v) != "" {
+				tags[p.key] = v
+				break
+			}
+		}
+	}
+	return tags
+}
+
+// tagSnapshot holds the preserved fields of each track before tagging.
+type tagSnapshot map[string]map[string]string // track path → tag → value
+
+// SnapshotPreservedTags records the existing values of the preserved fields
+// for every track in albumPath. It returns nil when PRESERVE_TAGS is off.
+func SnapshotPreservedTags(albumPath string) tagSnapshot {
+	if preserveTagsMode() == "" {
+		return nil
+	}
+	tracks, err := AudioFiles(albumPath)
+	if err != nil {
+		return nil
+	}
+	snap := tagSnapshot{}
+	for _, t := range tracks {
+		raw, err := readRawTags(t)
+		if err != nil {
+			continue
+		}
+		snap[t] = preservedTags(raw)
+	}
+	return snap
+}
+
+// RestorePreservedTags writes back the snapshotted values that tagging
+// replaced and PRESERVE_TAGS says to keep. Only changed fields are written.
+func RestorePreservedTags(snap tagSnapshot) {
+	mode := preserveTagsMode()
+	for track, before := range snap {
+		raw, err := readRawTags(track)
+		if err != nil {
+			continue
+		}
+		after := preservedTags(raw)
+
+		restore := map[string]string{}
+		for key, old := range before {
+			cur := after[key]
+			if cur == old {
+				continue
+			}
+			if mode == "all" || tagValuesEquivalent(key, old, cur) {
+				restore[key] = old
+			}
+		}
+		if len(restore) == 0 {
+			continue
+		}
+		if err := WriteTags(track, restore); err != nil {
+			fmt.Println("Restoring preserved tags failed:", track, err)
+			continue
+		}
+		fmt.Printf("→ Kept %d existing tag(s) in %s\n", len(restore), track)
+	}
+}
+
+// tagValuesEquivalent reports whether an existing value says the same thing
+// as the newly written one: numbers compare by value ("03" = "3/12"), dates
+// by the precision the old value has, and text ignoring case, runs of
+// whitespace and typographic quotes and dashes.
+func tagValuesEquivalent(key, old, cur string) bool {
+	switch key {
+	case "TRACKNUMBER", "DISCNUMBER":
+		a, errA := strconv.Atoi(strings.TrimSpace(strings.SplitN(old, "/", 2)[0]))
+		b, errB := strconv.Atoi(strings.TrimSpace(strings.SplitN(cur, "/", 2)[0]))
+		return errA == nil && errB == nil && a == b
+	case "DATE":
+		o, c := parseDate(old), parseDate(cur)
+		return o != "" && strings.HasPrefix(c, o)
+	}
+	return foldTagText(old) == foldTagText(cur)
+}
+
+var typographicReplacer = strings.NewReplacer(
+	"‘", "'", "’", "'", "“", `"`, "”", `"`,
+	"‐", "-", "–", "-", "—", "-", "…", "...",
+)
+
+func foldTagText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(typographicReplacer.Replace(s)), " "))
+}
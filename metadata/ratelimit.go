@@ -0,0 +1,84 @@
+package metadata
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRateLimits applies when HTTP_RATE_LIMITS is unset: LRCLIB asks
+// clients to be gentle, and lyrics are now fetched in parallel.
+const defaultRateLimits = "lrclib.net=5"
+
+// hostLimiter spaces out requests to one host.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time // earliest time the next request may go out
+}
+
+var (
+	rateOnce     sync.Once
+	rateLimiters map[string]*hostLimiter
+)
+
+// hostRateLimits parses HTTP_RATE_LIMITS, comma-separated host=requests per
+// second pairs such as "lrclib.net=5,musicbrainz.org=1" ("none" for no
+// limits). A host also covers its subdomains.
+func hostRateLimits() map[string]*hostLimiter {
+	rateOnce.Do(func() {
+		rateLimiters = map[string]*hostLimiter{}
+		raw, ok := os.LookupEnv("HTTP_RATE_LIMITS")
+		if !ok {
+			raw = defaultRateLimits
+		}
+		for _, pair := range strings.Split(raw, ",") {
+			host, rate, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			perSec, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+			if host == "" || err != nil || perSec <= 0 {
+				continue
+			}
+			rateLimiters[strings.ToLower(strings.TrimSpace(host))] = &hostLimiter{interval: time.Duration(float64(time.Second) / perSec)}
+		}
+	})
+	return rateLimiters
+}
+
+// limiterFor returns the limiter covering host, or nil.
+func limiterFor(host string) *hostLimiter {
+	limits := hostRateLimits()
+	host = strings.ToLower(host)
+	for h := host; h != ""; {
+		if l := limits[h]; l != nil {
+			return l
+		}
+		_, h, _ = strings.Cut(h, ".")
+	}
+	return nil
+}
+
+// waitForHost blocks until a request to host is allowed by its rate limit,
+// reserving the slot, or until ctx is done.
+func waitForHost(ctx context.Context, host string) error {
+	l := limiterFor(host)
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	at := l.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(at)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mbIDTags are the MusicBrainz identifiers written into imported files.
+var mbIDTags = []string{
+	"MUSICBRAINZ_ALBUMID",
+	"MUSICBRAINZ_RELEASEGROUPID",
+	"MUSICBRAINZ_ALBUMARTISTID",
+	"MUSICBRAINZ_ARTISTID",
+	"MUSICBRAINZ_TRACKID",
+	"MUSICBRAINZ_RELEASETRACKID",
+}
+
+// releaseIDTags returns the MusicBrainz ID tags for one track of a release.
+func releaseIDTags(r *MBRelease, t releaseTrack) map[string]string {
+	tags := map[string]string{
+		"MUSICBRAINZ_ALBUMID":        r.ID,
+		"MUSICBRAINZ_RELEASEGROUPID": r.ReleaseGroup.ID,
+		"MUSICBRAINZ_TRACKID":        t.Recording.ID,
+		"MUSICBRAINZ_RELEASETRACKID": t.ID,
+	}
+	if len(r.ArtistCredit) > 0 {
+		tags["MUSICBRAINZ_ALBUMARTISTID"] = r.ArtistCredit[0].Artist.ID
+	}
+	credits := t.ArtistCredit
+	if len(credits) == 0 {
+		credits = r.ArtistCredit
+	}
+	if len(credits) > 0 {
+		tags["MUSICBRAINZ_ARTISTID"] = credits[0].Artist.ID
+	}
+	return tags
+}
+
+// albumReleaseTags returns the release-wide tags beyond artist and title:
+// date and original date, genre, label, catalog number, country, media
+// format, release type and disambiguation comment.
+func albumReleaseTags(r *MBRelease) map[string]string {
+	types := append([]string{r.ReleaseGroup.PrimaryType}, r.ReleaseGroup.SecondaryTypes...)
+	original := r.ReleaseGroup.FirstReleaseDate
+	tags := map[string]string{
+		"DATE":           r.Date,
+		"ORIGINALDATE":   original,
+		"ORIGINALYEAR":   original[:min(4, len(original))],
+		"RELEASECOUNTRY": r.Country,
+		"RELEASETYPE":    NormalizeReleaseType(strings.Join(types, ";")),
+
+		"MUSICBRAINZ_ALBUMCOMMENT": r.Disambiguation,
+	}
+	for _, li := range r.LabelInfo {
+		if tags["LABEL"] == "" {
+			tags["LABEL"] = li.Label.Name
+		}
+		if tags["CATALOGNUMBER"] == "" && li.CatalogNumber != "[none]" {
+			tags["CATALOGNUMBER"] = li.CatalogNumber
+		}
+	}
+	if len(r.Media) > 0 {
+		tags["MEDIA"] = r.Media[0].Format
+	}
+	artist := ArtistCreditString(r.ArtistCredit)
+	genres := firstGenres(genreNames(r.Genres), artist, genreLimit())
+	if len(genres) == 0 {
+		genres = firstGenres(genreNames(r.ReleaseGroup.Genres), artist, genreLimit())
+	}
+	tags["GENRE"] = MultiValue(genres...)
+	return tags
+}
+
+// ffprobeTagNames lists other names ffprobe reports a tag under for MP3s.
+var ffprobeTagNames = map[string]string{
+	"LABEL":        "publisher",
+	"ORIGINALDATE": "TDOR",
+	"MEDIA":        "TMED",
+	"CONDUCTOR":    "TPE3",
+}
+
+// hasTag reports whether ffprobe tags contain name, either as a Vorbis
+// comment or under its ID3 name.
+func hasTag(tags map[string]string, name string) bool {
+	names := []string{name, id3UserTextNames[name], ffprobeTagNames[name]}
+	for k, v := range tags {
+		if v == "" {
+			continue
+		}
+		for _, n := range names {
+			if n != "" && strings.EqualFold(k, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteReleaseTags fills in tags from release releaseMBID on every track of
+// albumPath that lacks them: the release-wide date, genre, label, catalog
+// number, country, media format and release type, and with ids also the
+// MusicBrainz release, release group, artist, recording and track IDs,
+// matching files to release tracks by disc and track number. Values already present are left
+// alone, and MusicBrainz is only queried when something is missing. Empty
+// fields of md are filled from the release too. It returns the number of
+// files updated.
+func WriteReleaseTags(albumPath string, md *MusicMetadata, releaseMBID string, ids bool) (int, error) {
+	local, err := probeAlbum(albumPath)
+	if err != nil {
+		return 0, err
+	}
+	wanted := []string{"DATE", "ORIGINALDATE", "GENRE", "LABEL", "CATALOGNUMBER", "RELEASECOUNTRY", "MEDIA", "RELEASETYPE"}
+	if ids {
+		wanted = append(wanted, mbIDTags...)
+	}
+	complete := true
+	for _, t := range local {
+		for _, name := range wanted {
+			if !hasTag(t.Tags, name) {
+				complete = false
+			}
+		}
+	}
+	if complete {
+		return 0, nil
+	}
+
+	r, err := getMBReleaseWithTracks(releaseMBID)
+	if err != nil {
+		return 0, fmt.Errorf("fetching release %s: %w", releaseMBID, err)
+	}
+	album := albumReleaseTags(r)
+	md.Genre = FirstNonEmpty(md.Genre, FirstValue(album["GENRE"]))
+	md.Label = FirstNonEmpty(md.Label, album["LABEL"])
+	md.CatalogNumber = FirstNonEmpty(md.CatalogNumber, album["CATALOGNUMBER"])
+	md.Country = FirstNonEmpty(md.Country, album["RELEASECOUNTRY"])
+	md.Media = FirstNonEmpty(md.Media, album["MEDIA"])
+	md.Disambiguation = FirstNonEmpty(md.Disambiguation, album["MUSICBRAINZ_ALBUMCOMMENT"])
+	md.ReleaseType = FirstNonEmpty(md.ReleaseType, album["RELEASETYPE"])
+	if md.Date == "" && r.Date != "" {
+		md.Date = parseDate(r.Date)
+		md.Year = md.Date[:min(4, len(md.Date))]
+	}
+	if md.OriginalDate == "" && album["ORIGINALDATE"] != "" {
+		md.OriginalDate = parseDate(album["ORIGINALDATE"])
+		md.OriginalYear = album["ORIGINALYEAR"]
+	}
+
+	remote := releaseTracks(r)
+	pairs := pairTracks(local, remote)
+	updated := 0
+	for i, t := range local {
+		tags := map[string]string{}
+		for k, v := range album {
+			tags[k] = v
+		}
+		if j := pairs[i]; ids && j >= 0 {
+			for k, v := range releaseIDTags(r, remote[j]) {
+				tags[k] = v
+			}
+		}
+		missing := map[string]string{}
+		for name, v := range tags {
+			if v != "" && !hasTag(t.Tags, name) {
+				missing[name] = v
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if err := WriteTags(t.Path, missing); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
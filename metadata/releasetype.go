@@ -0,0 +1,41 @@
+package metadata
+
+import "strings"
+
+// releaseTypePrecedence orders MusicBrainz release-group types from most to
+// least specific: a live compilation files as live, a soundtrack album as
+// soundtrack.
+var releaseTypePrecedence = []string{
+	"soundtrack", "live", "compilation", "remix", "dj-mix", "mixtape", "demo",
+	"ep", "single", "album", "broadcast", "other",
+}
+
+// NormalizeReleaseType reduces a release type as taggers write it ("Album;
+// Soundtrack", "album, live", "Mixtape/Street") to the single most specific
+// lower-case type, e.g. "soundtrack". Unknown types are returned lower-cased.
+func NormalizeReleaseType(raw string) string {
+	var types []string
+	for _, t := range strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool { return r == ';' || r == ',' }) {
+		t = strings.TrimSpace(t)
+		switch t {
+		case "mixtape/street":
+			t = "mixtape"
+		case "dj mix":
+			t = "dj-mix"
+		}
+		if t != "" {
+			types = append(types, t)
+		}
+	}
+	for _, want := range releaseTypePrecedence {
+		for _, t := range types {
+			if t == want {
+				return t
+			}
+		}
+	}
+	if len(types) > 0 {
+		return types[0]
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpotifyAlbum is what Spotify knows about a matched album.
+type SpotifyAlbum struct {
+	ID          string
+	Artist      string // Spotify's spelling of the main artist
+	Name        string
+	ReleaseDate string // YYYY, YYYY-MM or YYYY-MM-DD
+	ReleaseType string // album, single, ep or compilation
+}
+
+// SpotifyEnabled reports whether Spotify credentials are configured.
+func SpotifyEnabled() bool {
+	return os.Getenv("SPOTIFY_CLIENT_ID") != "" && os.Getenv("SPOTIFY_CLIENT_SECRET") != ""
+}
+
+var spotifyToken struct {
+	sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// spotifyAccessToken returns a client-credentials token, reusing it until
+// shortly before it expires.
+func spotifyAccessToken() (string, error) {
+	spotifyToken.Lock()
+	defer spotifyToken.Unlock()
+	if spotifyToken.value != "" && time.Now().Before(spotifyToken.expires) {
+		return spotifyToken.value, nil
+	}
+
+	req, err := http.NewRequest("POST", "https://accounts.spotify.com/api/token",
+		strings.NewReader(url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"))
+	resp, err := HTTPDo(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Spotify token request returned %d", resp.StatusCode)
+	}
+	var data struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return "", err
+	}
+	spotifyToken.value = data.AccessToken
+	spotifyToken.expires = time.Now().Add(time.Duration(data.ExpiresIn)*time.Second - time.Minute)
+	return data.AccessToken, nil
+}
+
+// LookupSpotifyAlbum searches Spotify for the album and returns the closest
+// result, or an error when nothing is a close enough match on both artist
+// and album name.
+func LookupSpotifyAlbum(artist, album string) (*SpotifyAlbum, error) {
+	token, err := spotifyAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{
+		"q":     {fmt.Sprintf("album:%s artist:%s", album, artist)},
+		"type":  {"album"},
+		"limit": {"5"},
+	}
+	req, err := http.NewRequest("GET", "https://api.spotify.com/v1/search?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := HTTPDo(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Spotify returned %d", resp.StatusCode)
+	}
+	var data struct {
+		Albums struct {
+			Items []struct {
+				ID          string `json:"id"`
+				Name        string `json:"name"`
+				AlbumType   string `json:"album_type"`
+				ReleaseDate string `json:"release_date"`
+				TotalTracks int    `json:"total_tracks"`
+				Artists     []struct {
+					Name string `json:"name"`
+				} `json:"artists"`
+			} `json:"items"`
+		} `json:"albums"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	var best *SpotifyAlbum
+	bestScore := 0.0
+	for _, it := range data.Albums.Items {
+		if len(it.Artists) == 0 {
+			continue
+		}
+		artistSim := stringSimilarity(it.Artists[0].Name, artist)
+		albumSim := stringSimilarity(it.Name, album)
+		if artistSim < 0.8 || albumSim < 0.8 || artistSim+albumSim <= bestScore {
+			continue
+		}
+		bestScore = artistSim + albumSim
+		kind := it.AlbumType
+		// Spotify files EPs under "single"; by its own rules a single has at
+		// most three tracks.
+		if kind == "single" && it.TotalTracks >= 4 {
+			kind = "ep"
+		}
+		best = &SpotifyAlbum{
+			ID:          it.ID,
+			Artist:      it.Artists[0].Name,
+			Name:        it.Name,
+			ReleaseDate: it.ReleaseDate,
+			ReleaseType: kind,
+		}
+	}
+	if best == nil {
+		return nil, errors.New("no close Spotify match")
+	}
+	return best, nil
+}
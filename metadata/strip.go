@@ -0,0 +1,214 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/gabehf/music-import/tools"
+)
+
+// StripCategories are the kinds of tag StripTags can remove.
+var StripCategories = []string{"comments", "encoder", "urls", "private", "id3v1", "ape"}
+
+// stripKeys are the Vorbis comment names (and ID3 TXXX descriptions)
+// removed per category, compared by stripKey.
+var stripKeys = map[string][]string{
+	"comments": {"COMMENT", "DESCRIPTION"},
+	"encoder": {"ENCODER", "ENCODEDBY", "ENCODERSETTINGS", "ENCODING", "RIPPER", "RIPPINGTOOL",
+		"RIPDATE", "RETAILDATE", "LOG", "EACLOG", "CUESHEET"},
+	"urls": {"URL", "WWW", "WEBSITE", "PURCHASEURL"},
+}
+
+// stripFrames are the ID3v2 frames removed per category. "urls" also covers
+// every other W frame.
+var stripFrames = map[string][]string{
+	"comments": {"COMM"},
+	"encoder":  {"TENC", "TSSE"},
+	"private":  {"PRIV"},
+}
+
+// stripKey normalises a tag name for matching: "Encoded-By" → "ENCODEDBY".
+func stripKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(k))
+}
+
+// stripped reports whether the tag name k falls in one of categories.
+func stripped(k string, categories []string) bool {
+	k = stripKey(k)
+	for _, c := range categories {
+		if slices.Contains(stripKeys[c], k) || c == "urls" && strings.HasSuffix(k, "URL") {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTags removes the tags in categories (see StripCategories) from a FLAC
+// or MP3 file and returns what it removed. iTunes' own comments (iTunSMPB,
+// iTunNORM) are kept, as players rely on them. Other formats are skipped.
+func StripTags(path string, categories []string) ([]string, error) {
+	switch AudioFormat(path) {
+	case FormatFLAC:
+		return stripFLAC(path, categories)
+	case FormatMP3:
+		return stripMP3(path, categories)
+	}
+	return nil, nil
+}
+
+// stripFLAC removes matching Vorbis comments with metaflac.
+func stripFLAC(path string, categories []string) ([]string, error) {
+	out, err := tools.Output("metaflac", "--export-tags-to=-", path)
+	if err != nil {
+		return nil, fmt.Errorf("metaflac: %w", err)
+	}
+	var removed []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		k, _, ok := strings.Cut(sc.Text(), "=")
+		if ok && stripped(k, categories) && !slices.Contains(removed, k) {
+			removed = append(removed, k)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	args := make([]string, 0, len(removed)+1)
+	for _, k := range removed {
+		args = append(args, "--remove-tag="+k)
+	}
+	if err := tools.Run("metaflac", append(args, path)...); err != nil {
+		return nil, fmt.Errorf("metaflac: %w", err)
+	}
+	return removed, nil
+}
+
+// stripMP3 removes matching ID3v2 frames, then ID3v1 and APEv2 tags at the
+// end of the file.
+func stripMP3(path string, categories []string) ([]string, error) {
+	tag, err := OpenID3(path)
+	if err != nil {
+		return nil, fmt.Errorf("mp3 open: %w", err)
+	}
+	var removed []string
+	all := tag.AllFrames()
+	ids := slices.Sorted(maps.Keys(all))
+	for _, id := range ids {
+		frames := all[id]
+		drop := false
+		for _, c := range categories {
+			drop = drop || slices.Contains(stripFrames[c], id) || c == "urls" && strings.HasPrefix(id, "W")
+		}
+		switch {
+		case id == "COMM" && drop:
+			tag.DeleteFrames(id)
+			for _, f := range frames {
+				if cf, ok := f.(id3v2.CommentFrame); ok && strings.HasPrefix(cf.Description, "iTun") {
+					tag.AddCommentFrame(cf)
+				}
+			}
+			if len(tag.GetFrames(id)) < len(frames) {
+				removed = append(removed, id)
+			}
+		case drop:
+			tag.DeleteFrames(id)
+			removed = append(removed, id)
+		case id == "TXXX":
+			tag.DeleteFrames(id)
+			for _, f := range frames {
+				if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok && stripped(udtf.Description, categories) {
+					removed = append(removed, "TXXX:"+udtf.Description)
+				} else {
+					tag.AddFrame(id, f)
+				}
+			}
+		}
+	}
+	if len(removed) > 0 {
+		if err := tag.Save(); err != nil {
+			tag.Close()
+			return nil, fmt.Errorf("mp3 save: %w", err)
+		}
+	}
+	tag.Close()
+
+	trailers, err := stripTrailers(path, slices.Contains(categories, "id3v1"), slices.Contains(categories, "ape"))
+	return append(removed, trailers...), err
+}
+
+// stripTrailers cuts an ID3v1 tag (the last 128 bytes, starting "TAG")
+// and an APEv2 tag (which sits just before any ID3v1 tag) off the end of an
+// MP3.
+func stripTrailers(path string, id3v1, ape bool) ([]string, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	var v1 []byte
+	end := size
+	if size >= 128 {
+		buf := make([]byte, 128)
+		if _, err := f.ReadAt(buf, size-128); err != nil {
+			return nil, err
+		}
+		if string(buf[:3]) == "TAG" {
+			v1, end = buf, size-128
+		}
+	}
+	apeStart := end
+	if end >= 32 {
+		footer := make([]byte, 32)
+		if _, err := f.ReadAt(footer, end-32); err != nil {
+			return nil, err
+		}
+		if string(footer[:8]) == "APETAGEX" {
+			length := int64(binary.LittleEndian.Uint32(footer[12:]))
+			if binary.LittleEndian.Uint32(footer[20:])&0x80000000 != 0 {
+				length += 32 // header
+			}
+			if length <= end {
+				apeStart = end - length
+			}
+		}
+	}
+
+	var removed []string
+	cut := size
+	if ape && apeStart < end {
+		removed = append(removed, "APEv2")
+		cut = apeStart
+		if !id3v1 && v1 != nil {
+			if _, err := f.WriteAt(v1, cut); err != nil {
+				return nil, err
+			}
+			cut += 128
+		}
+	}
+	if id3v1 && v1 != nil {
+		removed = append(removed, "ID3v1")
+		cut = min(cut, end)
+	}
+	if cut == size {
+		return nil, nil
+	}
+	return removed, f.Truncate(cut)
+}
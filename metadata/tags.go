@@ -0,0 +1,190 @@
+package metadata
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bogem/id3v2"
+	"github.com/gabehf/music-import/tools"
+)
+
+// id3FrameIDs maps the Vorbis comment names used throughout the importer to
+// ID3v2.4 text frames. Names without an entry are written as TXXX frames.
+var id3FrameIDs = map[string]string{
+	"ARTIST":      "TPE1",
+	"ALBUMARTIST": "TPE2",
+	"ALBUM":       "TALB",
+	"TITLE":       "TIT2",
+	"DATE":        "TDRC",
+	"GENRE":       "TCON",
+	"TRACKNUMBER": "TRCK",
+	"DISCNUMBER":  "TPOS",
+	"COMPOSER":    "TCOM",
+	"CONDUCTOR":   "TPE3",
+	"LABEL":       "TPUB",
+	"MEDIA":       "TMED",
+	"BPM":         "TBPM",
+	"INITIALKEY":  "TKEY",
+
+	"ALBUMARTISTSORT": "TSO2",
+	"ALBUMSORT":       "TSOA",
+	"ARTISTSORT":      "TSOP",
+	"COMPOSERSORT":    "TSOC",
+	"TITLESORT":       "TSOT",
+	"ORIGINALDATE":    "TDOR",
+}
+
+// id3UserTextNames maps Vorbis comment names to the TXXX descriptions other
+// taggers (Picard, beets) use, so the values read back the same way.
+var id3UserTextNames = map[string]string{
+	"MUSICBRAINZ_ALBUMCOMMENT":   "MusicBrainz Album Comment",
+	"MUSICBRAINZ_ALBUMID":        "MusicBrainz Album Id",
+	"MUSICBRAINZ_ALBUMARTISTID":  "MusicBrainz Album Artist Id",
+	"MUSICBRAINZ_ARTISTID":       "MusicBrainz Artist Id",
+	"MUSICBRAINZ_RELEASEGROUPID": "MusicBrainz Release Group Id",
+	"MUSICBRAINZ_RELEASETRACKID": "MusicBrainz Release Track Id",
+	"MUSICBRAINZ_TRACKID":        "MusicBrainz Track Id",
+	"MUSICBRAINZ_WORKID":         "MusicBrainz Work Id",
+	"RELEASECOUNTRY":             "MusicBrainz Album Release Country",
+	"RELEASETYPE":                "MusicBrainz Album Type",
+}
+
+// multiValueSep separates the values packed by MultiValue. It is the
+// separator ID3v2.4 itself uses between the values of a text frame.
+const multiValueSep = "\x00"
+
+// MultiValue packs several values into one WriteTags value: FLAC files get a
+// Vorbis comment per value, MP3s a multi-value ID3v2.4 frame (ID3v2.3 has
+// none, so the values are joined with "/"). Empty and repeated values are
+// dropped.
+func MultiValue(values ...string) string {
+	var out []string
+	for _, v := range values {
+		if v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, multiValueSep)
+}
+
+// FirstValue returns the first value of a MultiValue or of a tag ffprobe
+// read from a multi-value field (joined with ";").
+func FirstValue(v string) string {
+	if i := strings.IndexAny(v, multiValueSep+";"); i >= 0 {
+		return strings.TrimSpace(v[:i])
+	}
+	return v
+}
+
+// Values splits a MultiValue, or a tag ffprobe read from a multi-value field,
+// into its non-empty values.
+func Values(v string) []string {
+	var out []string
+	for _, s := range strings.FieldsFunc(v, func(r rune) bool { return r == 0 || r == ';' }) {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// WriteTags sets the given tags (Vorbis comment names, e.g. "ALBUM") on a
+// FLAC or MP3 file (see AudioFormat), replacing any existing values. An
+// empty value removes the tag. Other formats are silently skipped.
+func WriteTags(path string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	switch AudioFormat(path) {
+	case FormatFLAC:
+		return writeTagsFLAC(path, tags)
+	case FormatMP3:
+		return writeTagsMP3(path, tags)
+	}
+	return nil
+}
+
+// writeTagsFLAC rewrites Vorbis comments with a single metaflac invocation.
+func writeTagsFLAC(path string, tags map[string]string) error {
+	var args []string
+	for k, v := range tags {
+		args = append(args, "--remove-tag="+k)
+		for _, v := range strings.Split(v, multiValueSep) {
+			if v != "" {
+				args = append(args, "--set-tag="+k+"="+v)
+			}
+		}
+	}
+	args = append(args, path)
+	if err := tools.Run("metaflac", args...); err != nil {
+		return fmt.Errorf("metaflac: %w", err)
+	}
+	return nil
+}
+
+// writeTagsMP3 rewrites ID3v2 frames, keeping the file's existing tag version.
+func writeTagsMP3(path string, tags map[string]string) error {
+	tag, err := OpenID3(path)
+	if err != nil {
+		return fmt.Errorf("mp3 open: %w", err)
+	}
+	defer tag.Close()
+
+	for k, v := range tags {
+		if tag.Version() == 3 {
+			v = strings.ReplaceAll(v, multiValueSep, "/")
+		}
+		id, ok := id3FrameIDs[k]
+		if !ok {
+			if name, ok := id3UserTextNames[k]; ok {
+				// Picard and beets read the recording ID from a UFID frame.
+				if k == "MUSICBRAINZ_TRACKID" && v != "" {
+					tag.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: "http://musicbrainz.org", Identifier: []byte(v)})
+				}
+				k = name
+			}
+			// TXXX frames are keyed by description, so adding one replaces
+			// any existing frame with the same name.
+			if v == "" {
+				deleteUserTextFrame(tag, k)
+				continue
+			}
+			tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+				Encoding:    frameEncoding(tag.DefaultEncoding(), k+v),
+				Description: k,
+				Value:       v,
+			})
+			continue
+		}
+
+		// ID3v2.3 has no TDRC or TDOR; it stores the years in TYER and TORY.
+		if v3, ok := id3v23DateFrames[id]; ok && tag.Version() == 3 {
+			id = v3
+			if len(v) > 4 {
+				v = v[:4]
+			}
+		}
+		tag.DeleteFrames(id)
+		if v != "" {
+			tag.AddTextFrame(id, frameEncoding(tag.DefaultEncoding(), v), v)
+		}
+	}
+
+	if err := tag.Save(); err != nil {
+		return fmt.Errorf("mp3 save: %w", err)
+	}
+	return nil
+}
+
+// deleteUserTextFrame removes the TXXX frame with the given description,
+// keeping all other TXXX frames.
+func deleteUserTextFrame(tag *id3v2.Tag, description string) {
+	frames := tag.GetFrames("TXXX")
+	tag.DeleteFrames("TXXX")
+	for _, f := range frames {
+		if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok && !strings.EqualFold(udtf.Description, description) {
+			tag.AddUserDefinedTextFrame(udtf)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// transliterationMode returns how transliterated names are written, from
+// TRANSLITERATION_TAGS: "sort" puts them in the *SORT tags, "custom" in
+// ARTIST_TRANSLITERATION / ALBUM_TRANSLITERATION, anything else disables it.
+func transliterationMode() string {
+	switch m := strings.ToLower(os.Getenv("TRANSLITERATION_TAGS")); m {
+	case "sort", "custom":
+		return m
+	}
+	return ""
+}
+
+// mbReleaseWithRels is a release lookup including release relationships,
+// which is where MusicBrainz links a release to its transliterated
+// pseudo-release.
+type mbReleaseWithRels struct {
+	MBRelease
+	Relations []struct {
+		Type      string    `json:"type"`
+		Direction string    `json:"direction"`
+		Release   MBRelease `json:"release"`
+	} `json:"relations"`
+}
+
+// fetchTransliteration returns the Latin-script artist and album names for a
+// release whose own text is in another script. It prefers the release's
+// "transliterated tracklisting" pseudo-release and falls back to the artist's
+// sort name. Empty strings mean no transliteration is needed or known.
+func fetchTransliteration(releaseMBID string) (artist, album string, err error) {
+	var rel mbReleaseWithRels
+	path := fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=artist-credits+release-rels", url.QueryEscape(releaseMBID))
+	if err := MBGet(path, &rel); err != nil {
+		return "", "", err
+	}
+	if rel.TextRepresentation.Script == "" || rel.TextRepresentation.Script == "Latn" {
+		return "", "", nil
+	}
+
+	for _, r := range rel.Relations {
+		if r.Type != "transl-tracklisting" || r.Direction != "forward" {
+			continue
+		}
+		pseudo, err := getMBReleaseCredits(r.Release.ID)
+		if err != nil {
+			return "", "", err
+		}
+		if pseudo.TextRepresentation.Script != "" && pseudo.TextRepresentation.Script != "Latn" {
+			continue
+		}
+		return ArtistCreditString(pseudo.ArtistCredit), pseudo.Title, nil
+	}
+
+	// No pseudo-release: the artist sort name is usually a romanisation.
+	if len(rel.ArtistCredit) == 1 {
+		return rel.ArtistCredit[0].Artist.SortName, "", nil
+	}
+	return "", "", nil
+}
+
+// getMBReleaseCredits fetches a release with its artist credits.
+func getMBReleaseCredits(mbid string) (*MBRelease, error) {
+	var r MBRelease
+	err := MBGet(fmt.Sprintf("/ws/2/release/%s?fmt=json&inc=artist-credits", url.QueryEscape(mbid)), &r)
+	return &r, err
+}
+
+// PreserveTransliteration keeps the original-script names in the main tags
+// and adds the transliteration alongside them, according to
+// TRANSLITERATION_TAGS. It also records the transliteration in md; forPaths
+// looks it up for library paths even when no tags are to be written.
+// Failures are logged and otherwise ignored.
+func PreserveTransliteration(albumPath string, md *MusicMetadata, forPaths bool, logf func(string)) {
+	mode := transliterationMode()
+	if (mode == "" && !forPaths) || md.ReleaseMBID == "" {
+		return
+	}
+
+	artist, album, err := fetchTransliteration(md.ReleaseMBID)
+	if err != nil {
+		logf(fmt.Sprintf("Transliteration lookup failed: %v", err))
+		return
+	}
+	if artist == "" && album == "" {
+		return
+	}
+	md.ArtistTransliteration = FirstNonEmpty(artist, md.ArtistTransliteration)
+	md.AlbumTransliteration = FirstNonEmpty(album, md.AlbumTransliteration)
+	if mode == "" {
+		logf(fmt.Sprintf("Transliteration for paths: %s — %s", artist, album))
+		return
+	}
+
+	tags := map[string]string{}
+	switch mode {
+	case "sort":
+		if artist != "" {
+			tags["ALBUMARTISTSORT"] = artist
+		}
+		if album != "" {
+			tags["ALBUMSORT"] = album
+		}
+	case "custom":
+		if artist != "" {
+			tags["ARTIST_TRANSLITERATION"] = artist
+		}
+		if album != "" {
+			tags["ALBUM_TRANSLITERATION"] = album
+		}
+	}
+
+	tracks, err := AudioFiles(albumPath)
+	if err != nil {
+		logf(fmt.Sprintf("Transliteration: %v", err))
+		return
+	}
+	for _, t := range tracks {
+		if err := WriteTags(t, tags); err != nil {
+			logf(fmt.Sprintf("Writing transliterated tags to %s failed: %v", t, err))
+		}
+	}
+	logf(fmt.Sprintf("Added transliteration: %s — %s", artist, album))
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Mock is a Runner that records commands instead of running them. Install
+// it with `tools.Default = &tools.Mock{...}` to exercise the pipeline without
+// the tools installed.
+type Mock struct {
+	// Handle returns the outcome of a command; when nil every command
+	// succeeds with no output.
+	Handle func(c Command) (Result, error)
+	// Missing lists tools LookPath reports as not installed.
+	Missing map[string]bool
+
+	mu    sync.Mutex
+	calls []Command
+}
+
+func (m *Mock) Run(ctx context.Context, c Command) (Result, error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, c)
+	m.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	if m.Handle == nil {
+		return Result{}, nil
+	}
+	res, err := m.Handle(c)
+	if c.Stdout != nil && len(res.Stdout) > 0 {
+		c.Stdout.Write(res.Stdout)
+		res.Stdout = nil
+	}
+	return res, err
+}
+
+func (m *Mock) LookPath(name string) (string, error) {
+	if m.Missing[name] {
+		return "", fmt.Errorf("%s: not installed (mock)", name)
+	}
+	return "/mock/bin/" + name, nil
+}
+
+// Calls returns the commands run so far, oldest first.
+func (m *Mock) Calls() []Command {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Command(nil), m.calls...)
+}
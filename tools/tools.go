@@ -0,0 +1,191 @@
+// Package tools runs the external programs the importer depends on (beet,
+// ffprobe, ffmpeg, rsgain, metaflac, flac, aubio, keyfinder-cli) through a
+// swappable Runner, so a hung tool is killed after its timeout and tests can
+// run without the tools.
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command is one invocation of an external tool.
+type Command struct {
+	Name  string
+	Args  []string
+	Stdin io.Reader
+	Env   []string // KEY=value entries added to the process environment
+	Echo  bool     // also copy output to the process's stdout/stderr as it arrives
+
+	// Stdout, when set, receives the tool's output as it arrives instead of
+	// Result.Stdout, for output too large to hold in memory.
+	Stdout io.Writer
+}
+
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Result holds the captured output of a finished command.
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Runner runs external tools.
+type Runner interface {
+	Run(ctx context.Context, c Command) (Result, error)
+	LookPath(name string) (string, error)
+}
+
+// Default is the Runner every tool call goes through. Tests replace it with
+// a *Mock.
+var Default Runner = Exec{}
+
+// Exec runs commands as child processes, killing any that outlive their
+// tool's Timeout.
+type Exec struct{}
+
+func (Exec) Run(ctx context.Context, c Command) (Result, error) {
+	timeout := Timeout(c.Name)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin = c.Stdin
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if c.Echo {
+		cmd.Stdout = io.MultiWriter(&stdout, os.Stdout)
+		cmd.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	}
+	if c.Stdout != nil {
+		cmd.Stdout = c.Stdout
+	}
+	// Don't wait forever on grandchildren that inherited the output pipes.
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	note(func(w io.Writer) { fmt.Fprintf(w, "$ %s\n", c) })
+	err := cmd.Run()
+	res := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s timed out after %s", c.Name, timeout)
+	}
+	if err != nil {
+		note(func(w io.Writer) {
+			if msg := strings.TrimSpace(string(res.Stderr)); msg != "" && !c.Echo {
+				fmt.Fprintln(w, msg)
+			}
+			fmt.Fprintf(w, "%s failed after %s: %v\n", c.Name, time.Since(start).Round(time.Millisecond), err)
+		})
+	}
+	return res, err
+}
+
+var (
+	transcriptMu sync.Mutex
+	transcript   io.Writer
+)
+
+// SetTranscript makes Exec note every command it runs in w, with the
+// stderr of failed commands whose output isn't echoed anyway; nil stops it.
+func SetTranscript(w io.Writer) {
+	transcriptMu.Lock()
+	transcript = w
+	transcriptMu.Unlock()
+}
+
+// note writes to the transcript, if one is set.
+func note(write func(w io.Writer)) {
+	transcriptMu.Lock()
+	defer transcriptMu.Unlock()
+	if transcript != nil {
+		write(transcript)
+	}
+}
+
+func (Exec) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// defaultTimeouts bounds each tool's run time unless TOOL_TIMEOUTS says
+// otherwise; tools not listed get fallbackTimeout.
+var defaultTimeouts = map[string]time.Duration{
+	"beet":     30 * time.Minute,
+	"rsgain":   30 * time.Minute,
+	"flac":     10 * time.Minute,
+	"ffmpeg":   5 * time.Minute,
+	"metaflac": 2 * time.Minute,
+	"ffprobe":  time.Minute,
+	"aubio":    5 * time.Minute,
+
+	"keyfinder-cli": 5 * time.Minute,
+}
+
+const fallbackTimeout = 10 * time.Minute
+
+// Timeout returns how long a run of the named tool may take: its entry in
+// TOOL_TIMEOUTS ("beet=1h,ffprobe=30s"), or the built-in default.
+func Timeout(name string) time.Duration {
+	for _, kv := range strings.Split(os.Getenv("TOOL_TIMEOUTS"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k != name {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	if d, ok := defaultTimeouts[name]; ok {
+		return d
+	}
+	return fallbackTimeout
+}
+
+// Output runs a tool through Default and returns its stdout. On failure the
+// error carries the tool's stderr.
+func Output(name string, args ...string) ([]byte, error) {
+	res, err := Default.Run(context.Background(), Command{Name: name, Args: args})
+	return res.Stdout, withStderr(err, res.Stderr)
+}
+
+// Stream runs a tool through Default, writing its stdout to w as it
+// arrives. On failure the error carries the tool's stderr.
+func Stream(w io.Writer, name string, args ...string) error {
+	res, err := Default.Run(context.Background(), Command{Name: name, Args: args, Stdout: w})
+	return withStderr(err, res.Stderr)
+}
+
+// Run runs a tool through Default, forwarding its output to the process
+// output.
+func Run(name string, args ...string) error {
+	_, err := Default.Run(context.Background(), Command{Name: name, Args: args, Echo: true})
+	return err
+}
+
+// LookPath reports where Default finds the named tool.
+func LookPath(name string) (string, error) {
+	return Default.LookPath(name)
+}
+
+func withStderr(err error, stderr []byte) error {
+	if err == nil {
+		return nil
+	}
+	if msg := strings.TrimSpace(string(stderr)); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
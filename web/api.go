@@ -0,0 +1,359 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError is the envelope every /api endpoint uses for failures:
+//
+//	{"error": {"status": 404, "code": "not_found", "message": "no such job"}}
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeAPIError writes an error envelope. The code is the snake_cased status
+// text, so clients can switch on it without parsing messages.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	writeJSON(w, status, map[string]apiError{
+		"error": {Status: status, Code: code, Message: message},
+	})
+}
+
+// importAlbumPath resolves a folder from a request, a FolderRef such as
+// "Album" or "bandcamp/Album", to an album directory directly inside that
+// import folder, rejecting anything that would escape it.
+func importAlbumPath(folder string) (string, error) {
+	if len(importer.ImportFolders()) == 0 {
+		return "", errors.New("IMPORT_DIR is not set")
+	}
+	p, err := importer.ResolveFolderRef(folder)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(p); err != nil || !info.IsDir() {
+		return "", errors.New("folder not found: " + folder)
+	}
+	return p, nil
+}
+
+// handleAPINotFound answers unknown /api paths with an error envelope rather
+// than the HTML page.
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+}
+
+// handleAPIScan handles GET /api/scan, listing the album folders an import
+// would process so the UI can offer a selection.
+func handleAPIScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	if len(importer.ImportFolders()) == 0 {
+		writeAPIError(w, http.StatusInternalServerError, "IMPORT_DIR is not set")
+		return
+	}
+
+	albums, err := importer.ScanImportFolders()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, albums)
+}
+
+// handleAPIImport handles POST /api/import
+// Body: {"folders":["Album A","Album B"]} — an empty list imports everything.
+// Responds 202 with the new job; poll it at /api/jobs/{id}.
+func handleAPIImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	var body struct {
+		Folders []string `json:"folders"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	for _, f := range body.Folders {
+		if _, err := importAlbumPath(f); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	job, err := importer.StartJob(body.Folders)
+	if err != nil {
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// handleAPIHistory handles GET /api/history?limit=N, returning journal
+// entries newest first (default 50, 0 for all).
+func handleAPIHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+
+	entries, err := library.JournalEntries()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	slices.Reverse(entries)
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// albumEditForm is the editable view of a pending album's tags.
+type albumEditForm struct {
+	Artist string          `json:"artist"`
+	Album  string          `json:"album"`
+	Year   string          `json:"year"`
+	Genre  string          `json:"genre"`
+	Tracks []trackEditForm `json:"tracks"`
+}
+
+type trackEditForm struct {
+	File  string `json:"file"`
+	Title string `json:"title"`
+}
+
+// handleAPIAlbumEdit handles /api/album/edit?folder=...
+// GET returns the album's current tags; POST takes AlbumEdits, writes them
+// into the files and records them so the pipeline skips beets for the album.
+func handleAPIAlbumEdit(w http.ResponseWriter, r *http.Request) {
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tracks, err := metadata.AudioFiles(albumPath)
+		if err != nil || len(tracks) == 0 {
+			writeAPIError(w, http.StatusNotFound, "no audio files in folder")
+			return
+		}
+		form := albumEditForm{Tracks: []trackEditForm{}}
+		for i, t := range tracks {
+			md, err := metadata.ReadTags(t)
+			if err != nil {
+				md = &metadata.MusicMetadata{}
+			}
+			if i == 0 {
+				form.Artist = metadata.FirstNonEmpty(md.AlbumArtist, md.Artist)
+				form.Album = md.Album
+				form.Year = md.Year
+				form.Genre = md.Genre
+			}
+			form.Tracks = append(form.Tracks, trackEditForm{File: filepath.Base(t), Title: md.Title})
+		}
+		writeJSON(w, http.StatusOK, form)
+
+	case http.MethodPost:
+		var edits importer.AlbumEdits
+		if err := json.NewDecoder(r.Body).Decode(&edits); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if edits.Artist == "" || edits.Album == "" {
+			writeAPIError(w, http.StatusBadRequest, "artist and album are required")
+			return
+		}
+		if err := importer.ApplyAlbumEdits(albumPath, &edits); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "writing tags: "+err.Error())
+			return
+		}
+
+		st, err := importer.LoadAlbumState(albumPath)
+		if err != nil {
+			st = &importer.AlbumState{}
+		}
+		st.Edits = &edits
+		st.ReleaseMBID = ""
+		if err := importer.SaveAlbumState(albumPath, st); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, edits)
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// releaseCandidate is a MusicBrainz release offered in the match picker.
+type releaseCandidate struct {
+	ID             string `json:"id"`
+	Title          string `json:"title"`
+	Artist         string `json:"artist"`
+	Disambiguation string `json:"disambiguation,omitempty"`
+	Country        string `json:"country"`
+	Year           string `json:"year"`
+	TrackCount     int    `json:"track_count"`
+	Format         string `json:"format"`
+}
+
+func newReleaseCandidate(r metadata.MBRelease) releaseCandidate {
+	var formats []string
+	for _, m := range r.Media {
+		if m.Format != "" && !slices.Contains(formats, m.Format) {
+			formats = append(formats, m.Format)
+		}
+	}
+	year := r.Date
+	if len(year) > 4 {
+		year = year[:4]
+	}
+	return releaseCandidate{
+		ID:             r.ID,
+		Title:          r.Title,
+		Artist:         metadata.ArtistCreditString(r.ArtistCredit),
+		Disambiguation: r.Disambiguation,
+		Country:        r.Country,
+		Year:           year,
+		TrackCount:     metadata.ReleaseTrackCount(r),
+		Format:         strings.Join(formats, "+"),
+	}
+}
+
+// defaultMatchQuery builds a MusicBrainz release search from an album's
+// current tags, falling back to the folder name.
+func defaultMatchQuery(albumPath string) string {
+	tracks, err := metadata.AudioFiles(albumPath)
+	if err == nil && len(tracks) > 0 {
+		if md, err := metadata.ReadTags(tracks[0]); err == nil && md.Album != "" {
+			q := fmt.Sprintf("release:%q", md.Album)
+			if artist := metadata.FirstNonEmpty(md.AlbumArtist, md.Artist); artist != "" {
+				q += fmt.Sprintf(" AND artist:%q", artist)
+			}
+			return q
+		}
+	}
+	return filepath.Base(albumPath)
+}
+
+// handleAPIAlbumMatch handles /api/album/match?folder=...
+// GET searches MusicBrainz for candidate releases (q overrides the query built
+// from the album's tags); POST {"mbid":"..."} pins the album to a release so
+// the import tags from it. An empty mbid clears the pick.
+func handleAPIAlbumMatch(w http.ResponseWriter, r *http.Request) {
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		st, _ := importer.LoadAlbumState(albumPath)
+		if st == nil {
+			st = &importer.AlbumState{}
+		}
+		q := r.URL.Query().Get("q")
+		if q == "" && len(st.Editions) > 0 {
+			// The autotagger couldn't choose between these; offer them first.
+			candidates := make([]releaseCandidate, 0, len(st.Editions))
+			for _, e := range st.Editions {
+				candidates = append(candidates, releaseCandidate{
+					ID: e.ReleaseMBID, Title: e.Title, Artist: e.Artist, Disambiguation: e.Disambiguation,
+					Country: e.Country, Year: e.Year, TrackCount: e.TrackCount, Format: e.Format,
+				})
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"query":      defaultMatchQuery(albumPath),
+				"selected":   st.ReleaseMBID,
+				"candidates": candidates,
+				"editions":   true,
+			})
+			return
+		}
+		if q == "" {
+			q = defaultMatchQuery(albumPath)
+		}
+		releases, err := metadata.SearchMBReleases(q)
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		candidates := make([]releaseCandidate, 0, len(releases))
+		for _, rel := range releases {
+			candidates = append(candidates, newReleaseCandidate(rel))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"query":      q,
+			"selected":   st.ReleaseMBID,
+			"candidates": candidates,
+		})
+
+	case http.MethodPost:
+		var body struct {
+			MBID string `json:"mbid"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		st, err := importer.LoadAlbumState(albumPath)
+		if err != nil {
+			st = &importer.AlbumState{}
+		}
+		st.ReleaseMBID = body.MBID
+		if body.MBID != "" {
+			// A picked release replaces any manual edits as the source of truth.
+			st.Edits = nil
+		}
+		if err := importer.SaveAlbumState(albumPath, st); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"mbid": body.MBID})
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
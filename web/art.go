@@ -0,0 +1,58 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+)
+
+// handleArt handles GET /art/{id}?size=N, serving a cached JPEG thumbnail of
+// a journalled album's cover (default 300 px).
+func handleArt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	size := library.DefaultThumbnailSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < library.MinThumbnailSize || n > library.MaxThumbnailSize {
+			http.Error(w, "size must be between "+strconv.Itoa(library.MinThumbnailSize)+
+				" and "+strconv.Itoa(library.MaxThumbnailSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	path, err := library.Thumbnail(r.PathValue("id"), size)
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, library.ErrNoCover):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, path)
+}
+
+var artBackfill = &backgroundTask{name: "art", what: "art backfill"}
+
+// handleAPIArtBackfill handles /api/art/backfill. POST starts an art
+// backfill in the background (?dry_run=true only reports), DELETE stops it,
+// GET reports progress and, once finished, the report.
+func handleAPIArtBackfill(w http.ResponseWriter, r *http.Request) {
+	artBackfill.handle(w, r, func(r *http.Request) taskFunc {
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		return func(ctx context.Context, libraryDir string, logf func(string)) (any, error) {
+			return importer.BackfillArt(ctx, libraryDir, dryRun, logf)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIAlbumArt handles /api/album/art?folder=...
+// GET lists art candidates with their size and format; POST {"id":"..."}
+// saves the chosen candidate as the album's cover.
+func handleAPIAlbumArt(w http.ResponseWriter, r *http.Request) {
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		candidates, err := importer.CollectArtCandidates(albumPath)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		st, _ := importer.LoadAlbumState(albumPath)
+		if st == nil {
+			st = &importer.AlbumState{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"selected":   st.Cover,
+			"candidates": candidates,
+		})
+
+	case http.MethodPost:
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if err := importer.SaveArtCandidate(albumPath, body.ID); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "saving cover: "+err.Error())
+			return
+		}
+		st, err := importer.LoadAlbumState(albumPath)
+		if err != nil {
+			st = &importer.AlbumState{}
+		}
+		st.Cover = body.ID
+		if err := importer.SaveAlbumState(albumPath, st); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": body.ID})
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
+
+// handleAPIAlbumArtImage handles GET /api/album/art/image?folder=...&id=...,
+// serving a candidate's image for the picker thumbnails.
+func handleAPIAlbumArtImage(w http.ResponseWriter, r *http.Request) {
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := importer.ArtCandidateData(albumPath, r.URL.Query().Get("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "candidate not found")
+		return
+	}
+	w.Header().Set("Content-Type", importer.GuessMimeType(data))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+)
+
+// cdStatus is the state of the background rip reported by /api/cd.
+type cdStatus struct {
+	Enabled  bool      `json:"enabled"`
+	Device   string    `json:"device"`
+	Ripping  bool      `json:"ripping"`
+	Albums   []string  `json:"albums,omitempty"` // folders from the last rip
+	Error    string    `json:"error,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+var (
+	cdMu   sync.Mutex
+	cdLast cdStatus
+)
+
+// handleAPICD handles /api/cd. GET reports the ripper status; POST starts a
+// rip in the background, with ?import=true to import the result afterwards.
+func handleAPICD(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cdMu.Lock()
+		st := cdLast
+		cdMu.Unlock()
+		st.Enabled, st.Device = importer.CDRipper() != "", importer.CDDevice()
+		writeJSON(w, http.StatusOK, st)
+
+	case http.MethodPost:
+		importDir := library.LocalImportDir()
+		if importer.CDRipper() == "" || importDir == "" {
+			writeAPIError(w, http.StatusServiceUnavailable, "CD import needs CD_RIPPER and IMPORT_DIR")
+			return
+		}
+		cdMu.Lock()
+		if cdLast.Ripping {
+			cdMu.Unlock()
+			writeAPIError(w, http.StatusConflict, "already ripping")
+			return
+		}
+		cdLast = cdStatus{Ripping: true}
+		cdMu.Unlock()
+
+		startNow := r.URL.Query().Get("import") == "true"
+		go func() {
+			logf := func(msg string) { log.Println("[cd]", msg) }
+			albums, err := importer.RipCD(importDir, logf)
+			cdMu.Lock()
+			cdLast = cdStatus{Albums: albums, Finished: time.Now()}
+			if err != nil {
+				cdLast.Error = err.Error()
+			}
+			cdMu.Unlock()
+			if err == nil && startNow {
+				if _, err := importer.StartJob(albums); err != nil {
+					logf(fmt.Sprintf("not importing rip: %v", err))
+				}
+			}
+		}()
+		writeJSON(w, http.StatusAccepted, map[string]bool{"ripping": true})
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET or POST only")
+	}
+}
@@ -0,0 +1,205 @@
+package web
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// configVars lists every environment variable the importer reads, for
+// /api/config.
+var configVars = []string{
+	"IMPORT_DIR",
+	"IMPORT_DIRS",
+	"LIBRARY_DIR",
+	"DATA_DIR",
+	"API_CACHE",
+	"API_CACHE_TTL",
+	"API_CACHE_MISS_TTL",
+	"OFFLINE",
+	"ENRICH_RETRY_MAX",
+	"ENRICH_RETRY_BACKOFF",
+	"HTTP_TIMEOUT",
+	"HTTP_RETRIES",
+	"HTTP_RATE_LIMITS",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"PUID",
+	"PGID",
+	"UMASK",
+	"COPYMODE",
+	"AUDIO_EXTENSIONS",
+	"LIBRARY_FILE_MODE",
+	"LIBRARY_DIR_MODE",
+	"LIBRARY_UID",
+	"LIBRARY_GID",
+	"IMPORT_SCHEDULE",
+	"GROUP_BY_RELEASE",
+	"GROUP_BY_RELEASE_WAIT",
+	"ALBUM_LOGS",
+	"ALBUM_LOG_KEEP",
+	"REPORTS_DIR",
+	"DISK_SPACE_MARGIN_MB",
+	"DISK_LOW_SPACE_MB",
+	"TRASH",
+	"TRASH_DIR",
+	"TRASH_RETENTION",
+	"PIPELINE_STAGES",
+	"STAGE_RESUME",
+	"JUNK_DELETE",
+	"JUNK_MOVE",
+	"JUNK_EXCLUDE",
+	"DEDUPE_TRACKS",
+	"HOOK_PRE_ALBUM",
+	"HOOK_POST_ALBUM",
+	"HOOK_POST_RUN",
+	"HOOK_TIMEOUT",
+	"TOOL_TIMEOUTS",
+	"LIBRARY_TEMPLATE",
+	"LIBRARY_DISAMBIGUATE",
+	"LIBRARY_TEMPLATE_SOUNDTRACK",
+	"LIBRARY_TEMPLATE_COMPILATION",
+	"LIBRARY_TEMPLATE_LIVE",
+	"LIBRARY_TEMPLATE_EP",
+	"LIBRARY_TEMPLATE_SINGLE",
+	"TRACK_TEMPLATE",
+	"CLASSICAL_MODE",
+	"CLASSICAL_TEMPLATE",
+	"AUDIOBOOK_DIR",
+	"AUDIOBOOK_GENRES",
+	"AUDIOBOOK_TEMPLATE",
+	"LIBRARY_SORT_FOLDERS",
+	"ARTIST_ALIASES",
+	"ARTIST_FOLDER_MATCH",
+	"FOLDER_MATCH_REVIEW_FOLDER",
+	"FEATURING_MODE",
+	"LIBRARY_SORT_LOCALE",
+	"SANITIZE_MAP",
+	"SANITIZE_ASCII",
+	"SANITIZE_NFC",
+	"SANITIZE_PROFILE",
+	"SANITIZE_MAX_NAME",
+	"SANITIZE_MAX_PATH",
+	"TRANSLITERATION_MAP",
+	"PRESERVE_TAGS",
+	"BEETS_MIN_SIMILARITY",
+	"BEETS_CONFIG",
+	"BEETS_LIBRARY",
+	"BEETS_FLAGS",
+	"BEETSDIR",
+	"AUTOTAGGER",
+	"AUTOTAG_MIN_SIMILARITY",
+	"PREFERRED_COUNTRIES",
+	"PREFERRED_MEDIA",
+	"EDITION_REVIEW_FOLDER",
+	"METADATA_PROVIDERS",
+	"FILENAME_METADATA",
+	"DISCOGS_TOKEN",
+	"WRITE_MB_IDS",
+	"LYRICS_BACKFILL_DELAY",
+	"LYRICS_WORKERS",
+	"LYRICS_INSTRUMENTAL",
+	"LYRICS_SCRIPT",
+	"LYRICS_SCRIPTS",
+	"LYRICS_OFFSET_MS",
+	"LYRICS_STRIP_HEADERS",
+	"LYRICS_LINE_ENDINGS",
+	"KEY_NOTATION",
+	"ANALYSIS_OVERWRITE",
+	"ACCURATERIP_REVIEW_FOLDER",
+	"SPECTRAL_MIN_CUTOFF",
+	"SPECTRAL_REVIEW_FOLDER",
+	"DYNAMIC_RANGE",
+	"GAPLESS_CHECK",
+	"STRIP_TAGS",
+	"ID3_VERSION",
+	"ID3_ENCODING",
+	"REPLAYGAIN_REFERENCE",
+	"GENRE_SOURCES",
+	"GENRE_MAP",
+	"GENRE_OVERWRITE",
+	"GENRE_LIMIT",
+	"LASTFM_API_KEY",
+	"SPOTIFY_CLIENT_ID",
+	"SPOTIFY_CLIENT_SECRET",
+	"SPOTIFY_CANONICAL_ARTIST",
+	"TRANSLITERATION_TAGS",
+	"VERIFY_MOVES",
+	"VERIFY_REPORT_DIR",
+	"MEDIA_SERVER_THROTTLE",
+	"MEDIA_SERVER_THROTTLE_MAX_WAIT",
+	"MEDIA_SERVER_REFRESH",
+	"MEDIA_SERVER_VERIFY",
+	"MEDIA_SERVER_VERIFY_TIMEOUT",
+	"HOOK_MEDIA_SERVER_MISSING",
+	"JELLYFIN_URL",
+	"JELLYFIN_API_KEY",
+	"PLEX_URL",
+	"PLEX_TOKEN",
+	"FANART_API_KEY",
+	"RECENT_EXPORT_DIR",
+	"RECENT_EXPORT_COUNT",
+	"LIBRARY_VIEWS",
+	"LIBRARY_VIEWS_DIR",
+	"ALBUM_PLAYLISTS",
+	"PLAYLIST_DIR",
+	"NFO_FILES",
+	"ARTIST_IMAGES",
+	"ARTWORK_DIR",
+	"COVER_MIN_SIZE",
+	"PUBLIC_URL",
+	"UPLOAD_MAX_MB",
+	"CD_RIPPER",
+	"CD_DEVICE",
+	"RCLONE_STAGING_DIR",
+	"RCLONE_FLAGS",
+	"REMOTE_SOURCE",
+	"REMOTE_PASSWORD",
+	"REMOTE_RATE_LIMIT",
+	"SLSKD_URL",
+	"SLSKD_API_KEY",
+	"SLSKD_DOWNLOAD_DIR",
+}
+
+// isSecretVar reports whether a variable holds a credential that must not be
+// echoed back by the API. Proxy URLs can carry a password.
+func isSecretVar(name string) bool {
+	for _, s := range []string{"KEY", "TOKEN", "PASSWORD", "SECRET", "PROXY"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAPIConfig handles GET /api/config, returning the effective
+// configuration with credentials redacted. Unset variables are null. The
+// per-folder IMPORT_DIR_<NAME>* variables are listed when set.
+func handleAPIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	cfg := make(map[string]*string, len(configVars))
+	for _, name := range configVars {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			cfg[name] = nil
+			continue
+		}
+		if isSecretVar(name) && v != "" {
+			v = "********"
+		}
+		cfg[name] = &v
+	}
+	for _, kv := range os.Environ() {
+		if name, v, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "IMPORT_DIR_") {
+			cfg[name] = &v
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version": Version,
+		"env":     cfg,
+	})
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIDeferred handles GET /api/deferred, the library albums with
+// lyrics, art, genre or MusicBrainz tasks queued for retry.
+func handleAPIDeferred(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	albums, err := importer.DeferredAlbums()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, albums)
+}
+
+var deferredRetry = &backgroundTask{name: "retry", what: "enrichment retry"}
+
+// handleAPIDeferredRetry handles /api/deferred/retry. POST retries every
+// queued task now in the background, regardless of its backoff; GET reports
+// progress and, once finished, how many albums were worked on.
+func handleAPIDeferredRetry(w http.ResponseWriter, r *http.Request) {
+	deferredRetry.handle(w, r, func(r *http.Request) taskFunc {
+		return func(ctx context.Context, libraryDir string, logf func(string)) (any, error) {
+			n, err := importer.RunDeferred(true, logf)
+			return map[string]int{"albums": n}, err
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// ── HTTP handlers ─────────────────────────────────────────────────────────────
+
+// handleDiscoverSearch handles GET /discover/search?q=...&type=release|artist
+func handleDiscoverSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	searchType := r.URL.Query().Get("type")
+	if searchType == "" {
+		searchType = "release"
+	}
+	log.Printf("[discover] search: type=%s q=%q", searchType, q)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch searchType {
+	case "artist":
+		artists, err := metadata.SearchMBArtists(q)
+		if err != nil {
+			log.Printf("[discover] artist search error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[discover] artist search returned %d results", len(artists))
+		json.NewEncoder(w).Encode(artists)
+
+	default: // "release"
+		releases, err := metadata.SearchMBReleases(q)
+		if err != nil {
+			log.Printf("[discover] release search error: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[discover] release search returned %d results", len(releases))
+		json.NewEncoder(w).Encode(releases)
+	}
+}
+
+// handleDiscoverFetch handles POST /discover/fetch
+// Body: {"id":"mbid","artist":"...","album":"..."}
+func handleDiscoverFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		ID     string `json:"id"`
+		Artist string `json:"artist"`
+		Album  string `json:"album"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" || body.Artist == "" || body.Album == "" {
+		http.Error(w, "id, artist and album are required", http.StatusBadRequest)
+		return
+	}
+
+	// If a fetch for this ID is already in progress, return its ID without starting a new one.
+	if existing := importer.LookupFetch(body.ID); existing != nil && !existing.Snapshot().Done {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": body.ID})
+		return
+	}
+
+	log.Printf("[discover] starting fetch: %q by %s (mbid: %s)", body.Album, body.Artist, body.ID)
+	entry := importer.NewFetchEntry(body.ID, body.Artist, body.Album)
+
+	// Look up the expected track count from MusicBrainz so the folder-selection
+	// logic can prefer results that match the release we intend to import.
+	trackCount := 0
+	if rel, err := metadata.GetMBRelease(body.ID); err == nil {
+		trackCount = metadata.ReleaseTrackCount(*rel)
+		log.Printf("[discover] release %s has %d tracks", body.ID, trackCount)
+	} else {
+		log.Printf("[discover] could not fetch release track count for %s: %v", body.ID, err)
+	}
+
+	go func() {
+		folder, err := importer.FetchRelease(body.Artist, body.Album, body.ID, trackCount, entry.AppendLog)
+		if err != nil {
+			log.Printf("[discover] fetch failed for %q by %s: %v", body.Album, body.Artist, err)
+			entry.Finish(err)
+			return
+		}
+		log.Printf("[discover] fetch complete for %q by %s, registering for import", body.Album, body.Artist)
+		importer.RegisterDownload(body.ID, body.ID, body.Artist, body.Album, trackCount, folder, entry)
+		// entry.finish is called by the monitor when import completes
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": body.ID})
+}
+
+// handleDiscoverFetchArtist handles POST /discover/fetch/artist
+// Body: {"id":"artist-mbid","name":"Artist Name"}
+func handleDiscoverFetchArtist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" || body.Name == "" {
+		http.Error(w, "id and name are required", http.StatusBadRequest)
+		return
+	}
+
+	if existing := importer.LookupFetch(body.ID); existing != nil && !existing.Snapshot().Done {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"id": body.ID})
+		return
+	}
+
+	log.Printf("[discover] starting artist fetch: %s (%s)", body.Name, body.ID)
+	entry := importer.NewFetchEntry(body.ID, body.Name, "")
+	go func() {
+		err := importer.FetchArtist(body.ID, body.Name, entry.AppendLog)
+		if err != nil {
+			log.Printf("[discover] artist fetch failed for %s: %v", body.Name, err)
+		} else {
+			log.Printf("[discover] artist fetch complete for %s", body.Name)
+		}
+		entry.Finish(err)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"id": body.ID})
+}
+
+// handleDiscoverFetchStatus handles GET /discover/fetch/status?id=...
+func handleDiscoverFetchStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	entry := importer.LookupFetch(id)
+	if entry == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	snap := entry.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snap)
+}
+
+// fetchListItem is a summary of a fetch entry for the list endpoint.
+type fetchListItem struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Done    bool   `json:"done"`
+	Success bool   `json:"success"`
+}
+
+// handleDiscoverFetchList handles GET /discover/fetch/list
+// Returns a summary of all known fetch entries so the frontend can discover
+// entries created server-side (e.g. per-album entries from an artist fetch).
+func handleDiscoverFetchList(w http.ResponseWriter, r *http.Request) {
+	snaps := importer.FetchSnapshots()
+	items := make([]fetchListItem, 0, len(snaps))
+	for _, e := range snaps {
+		title := e.Artist
+		if e.Album != "" {
+			title = e.Artist + " \u2014 " + e.Album
+		}
+		items = append(items, fetchListItem{
+			ID:      e.ID,
+			Title:   title,
+			Done:    e.Done,
+			Success: e.Success,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
@@ -0,0 +1,21 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// handleAPIDisk handles GET /api/disk, the free space of the library,
+// import and data filesystems.
+func handleAPIDisk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	disks := library.DiskSpace()
+	if disks == nil {
+		disks = []library.DiskStatus{}
+	}
+	writeJSON(w, http.StatusOK, disks)
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+)
+
+var duplicateScan = &backgroundTask{name: "duplicates", what: "duplicate scan"}
+
+// handleAPIDuplicates handles GET /api/library/duplicates, returning the
+// last duplicate report (null before the first scan).
+func handleAPIDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	report, err := importer.LoadDuplicateReport()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleAPIDuplicateScan handles /api/library/duplicates/scan. POST starts
+// a scan in the background (?fingerprint=true also compares tracks with
+// fpcalc), DELETE stops it, GET reports progress.
+func handleAPIDuplicateScan(w http.ResponseWriter, r *http.Request) {
+	duplicateScan.handle(w, r, func(r *http.Request) taskFunc {
+		fingerprint := r.URL.Query().Get("fingerprint") == "true"
+		return func(ctx context.Context, libraryDir string, logf func(string)) (any, error) {
+			report, err := importer.FindDuplicates(ctx, libraryDir, fingerprint, logf)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"albums": report.Albums, "groups": len(report.Groups)}, nil
+		}
+	})
+}
+
+// handleAPIDuplicateResolve handles POST /api/library/duplicates/resolve
+// with {"group", "action", "target"}; see importer.ResolveDuplicates.
+func handleAPIDuplicateResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	var body struct {
+		Group  string `json:"group"`
+		Action string `json:"action"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Group == "" || body.Target == "" {
+		writeAPIError(w, http.StatusBadRequest, `expected {"group": "...", "action": "keep|delete|merge", "target": "..."}`)
+		return
+	}
+	libraryDir := os.Getenv("LIBRARY_DIR")
+	if libraryDir == "" || library.RemoteLibrary() != "" {
+		writeAPIError(w, http.StatusInternalServerError, "resolving duplicates needs a local LIBRARY_DIR")
+		return
+	}
+	duplicateScan.mu.Lock()
+	running := duplicateScan.cancel != nil
+	duplicateScan.mu.Unlock()
+	if running {
+		writeAPIError(w, http.StatusConflict, "duplicate scan running")
+		return
+	}
+	if err := importer.ResolveDuplicates(libraryDir, body.Group, body.Action, body.Target); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	report, _ := importer.LoadDuplicateReport()
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// atomFeed is the subset of Atom (RFC 4287) /feed.xml uses.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Author  string     `xml:"author>name"`
+	Links   []atomLink `xml:"link"`
+	Content atomText   `xml:"content"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// publicURL returns the address the importer is reached at, for absolute
+// links: PUBLIC_URL, or else the scheme and host of the request.
+func publicURL(r *http.Request) string {
+	if u := os.Getenv("PUBLIC_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleFeed handles GET /feed.xml, an Atom feed of the last
+// RECENT_EXPORT_COUNT imported albums with their covers.
+func handleFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "GET only", http.StatusMethodNotAllowed)
+		return
+	}
+	entries, err := library.RecentEntries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	base := publicURL(r)
+	feed := atomFeed{
+		Title:   "Recently imported albums",
+		ID:      base + "/feed.xml",
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + "/feed.xml"},
+			{Rel: "alternate", Type: "text/html", Href: base + "/"},
+		},
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].ImportedAt.UTC().Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		title := e.Artist + " — " + e.Album
+		if e.Date != "" {
+			title += fmt.Sprintf(" (%s)", e.Date[:min(4, len(e.Date))])
+		}
+		var body strings.Builder
+		entry := atomEntry{
+			Title:   title,
+			ID:      "urn:music-importer:album:" + e.ID,
+			Updated: e.ImportedAt.UTC().Format(time.RFC3339),
+			Author:  e.Artist,
+		}
+		// Albums get a palette from their cover, so one means there is art.
+		if len(e.Palette) > 0 {
+			cover := base + "/art/" + e.ID + "?size=300"
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Type: "image/jpeg", Href: cover})
+			fmt.Fprintf(&body, `<p><img src="%s" alt="" width="300" height="300"></p>`, html.EscapeString(cover))
+		}
+		fmt.Fprintf(&body, "<p>%s — %s", html.EscapeString(e.Artist), html.EscapeString(e.Album))
+		if e.Quality != "" {
+			fmt.Fprintf(&body, " · %s", html.EscapeString(e.Quality))
+		}
+		body.WriteString("</p>")
+		entry.Content = atomText{Type: "html", Body: body.String()}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+}
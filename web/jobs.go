@@ -0,0 +1,30 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIJobs handles GET /api/jobs, listing remembered jobs newest first.
+func handleAPIJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	writeJSON(w, http.StatusOK, importer.JobList())
+}
+
+// handleAPIJob handles GET /api/jobs/{id}.
+func handleAPIJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	job, ok := importer.JobSnapshot(r.PathValue("id"))
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// libraryIndex loads the index for a library API request; ?scan=true reads
+// LIBRARY_DIR instead of the import journal.
+func libraryIndex(w http.ResponseWriter, r *http.Request) ([]library.IndexAlbum, bool) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return nil, false
+	}
+	albums, err := library.LibraryIndex(r.URL.Query().Get("scan") == "true")
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return albums, true
+}
+
+// handleAPILibraryArtists handles GET /api/library/artists.
+func handleAPILibraryArtists(w http.ResponseWriter, r *http.Request) {
+	albums, ok := libraryIndex(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, library.LibraryArtists(albums))
+}
+
+// handleAPILibraryAlbums handles GET /api/library/albums, optionally limited
+// to one artist with ?artist= (case-insensitive).
+func handleAPILibraryAlbums(w http.ResponseWriter, r *http.Request) {
+	albums, ok := libraryIndex(w, r)
+	if !ok {
+		return
+	}
+	if artist := r.URL.Query().Get("artist"); artist != "" {
+		var filtered []library.IndexAlbum
+		for _, a := range albums {
+			if strings.EqualFold(a.Artist, artist) {
+				filtered = append(filtered, a)
+			}
+		}
+		albums = filtered
+	}
+	if albums == nil {
+		albums = []library.IndexAlbum{}
+	}
+	writeJSON(w, http.StatusOK, albums)
+}
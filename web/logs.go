@@ -0,0 +1,38 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// handleAPILog handles GET /api/logs/{id}, serving an album's import log as
+// text; ?download=true serves it as an attachment.
+func handleAPILog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	id := r.PathValue("id")
+	path, err := library.AlbumLogPath(id)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		writeAPIError(w, http.StatusNotFound, "no log "+id)
+		return
+	} else if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", `attachment; filename="import-`+id+`.log"`)
+	}
+	http.ServeFile(w, r, path)
+}
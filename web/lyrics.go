@@ -0,0 +1,22 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+var lyricsBackfill = &backgroundTask{name: "lyrics", what: "lyrics backfill"}
+
+// handleAPILyricsBackfill handles /api/lyrics/backfill. POST starts a
+// backfill in the background (?restart=true ignores saved progress), DELETE
+// stops it (it resumes on the next POST), GET reports progress.
+func handleAPILyricsBackfill(w http.ResponseWriter, r *http.Request) {
+	lyricsBackfill.handle(w, r, func(r *http.Request) taskFunc {
+		restart := r.URL.Query().Get("restart") == "true"
+		return func(ctx context.Context, libraryDir string, logf func(string)) (any, error) {
+			return importer.BackfillLyrics(ctx, libraryDir, restart, logf)
+		}
+	})
+}
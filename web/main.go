@@ -0,0 +1,178 @@
+// Package web serves the importer's web UI and JSON API.
+package web
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+)
+
+// Version is set at build time via
+// -ldflags="-X github.com/gabehf/music-import/web.Version=..."
+var Version = "dev"
+
+//go:embed index.html.tmpl
+var tmplFS embed.FS
+
+//go:embed static
+var staticFS embed.FS
+var tmpl = template.Must(
+	template.New("index.html.tmpl").
+		Funcs(template.FuncMap{
+			// duration formats the elapsed time between two timestamps.
+			"duration": func(start, end time.Time) string {
+				if end.IsZero() {
+					return ""
+				}
+				d := end.Sub(start).Round(time.Second)
+				if d < time.Minute {
+					return d.String()
+				}
+				return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+			},
+			// not is needed because Go templates have no built-in boolean negation.
+			"not": func(b bool) bool { return !b },
+			// stepCell renders a uniform step status cell.
+			// fatalStep is AlbumResult.FatalStep; when it matches the step's key
+			// the cell is marked fatal rather than a warning.
+			"stepCell": func(label string, s importer.StepStatus, fatalStep string) template.HTML {
+				var statusClass, statusText, errHTML string
+				switch {
+				case s.Err != nil && fatalStep != "" && stepKey(label) == fatalStep:
+					statusClass = "step-fatal"
+					statusText = "✗ fatal"
+					errHTML = `<span class="step-err">` + template.HTMLEscapeString(s.Err.Error()) + `</span>`
+				case s.Err != nil:
+					statusClass = "step-warn"
+					statusText = "⚠ error"
+					errHTML = `<span class="step-err">` + template.HTMLEscapeString(s.Err.Error()) + `</span>`
+				case s.Skipped:
+					statusClass = "step-warn"
+					statusText = "– skipped"
+				default:
+					statusClass = "step-ok"
+					statusText = "✓ ok"
+				}
+				return template.HTML(`<div class="step">` +
+					`<span class="step-label">` + template.HTMLEscapeString(label) + `</span>` +
+					`<span class="` + statusClass + `">` + statusText + `</span>` +
+					errHTML +
+					`</div>`)
+			},
+		}).
+		ParseFS(tmplFS, "index.html.tmpl"),
+)
+
+// stepKey maps a human-readable step label to the pipeline stage name stored
+// in AlbumResult.FatalStep so the template can highlight the step that caused
+// the abort.
+func stepKey(label string) string {
+	switch label {
+	case "Clean Tags":
+		return "clean"
+	case "Cover Art":
+		return "cover"
+	default:
+		return strings.ToLower(label)
+	}
+}
+
+type templateData struct {
+	Running     bool
+	Paused      bool
+	PauseReason string
+	CDEnabled   bool
+	NextRun     time.Time
+	LowDisk     []library.DiskStatus
+	Version     string
+	Session     *importer.Session
+}
+
+func handleHome(w http.ResponseWriter, r *http.Request) {
+	paused, reason := importer.ImportsPaused()
+
+	if err := tmpl.Execute(w, templateData{
+		Running:     importer.Running(),
+		Paused:      paused,
+		PauseReason: reason,
+		CDEnabled:   importer.CDRipper() != "",
+		NextRun:     importer.NextScheduledRun(),
+		LowDisk:     library.LowDiskSpace(),
+		Version:     Version,
+		Session:     importer.LastSession(),
+	}); err != nil {
+		log.Println("Template error:", err)
+	}
+}
+
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Already running is fine: the page shows the run in progress.
+	importer.StartJob(nil)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Handler returns the web UI and JSON API routes.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/static/", http.FileServer(http.FS(staticFS)))
+	mux.HandleFunc("/", handleHome)
+	mux.HandleFunc("/run", handleRun)
+	mux.HandleFunc("/pause", handlePause)
+	mux.HandleFunc("/resume", handleResume)
+	mux.HandleFunc("/scrub", handleScrub)
+	mux.HandleFunc("/art/{id}", handleArt)
+	mux.HandleFunc("/feed.xml", handleFeed)
+	mux.HandleFunc("/api/", handleAPINotFound)
+	mux.HandleFunc("/api/scan", handleAPIScan)
+	mux.HandleFunc("/api/import", handleAPIImport)
+	mux.HandleFunc("/api/jobs", handleAPIJobs)
+	mux.HandleFunc("/api/jobs/{id}", handleAPIJob)
+	mux.HandleFunc("/api/history", handleAPIHistory)
+	mux.HandleFunc("/api/logs/{id}", handleAPILog)
+	mux.HandleFunc("/api/report", handleAPIReport)
+	mux.HandleFunc("/api/trash", handleAPITrash)
+	mux.HandleFunc("/api/trash/{rest...}", handleAPITrashItem)
+	mux.HandleFunc("/api/upload", handleAPIUpload)
+	mux.HandleFunc("/api/cd", handleAPICD)
+	mux.HandleFunc("/api/config", handleAPIConfig)
+	mux.HandleFunc("/api/disk", handleAPIDisk)
+	mux.HandleFunc("/api/deferred", handleAPIDeferred)
+	mux.HandleFunc("/api/deferred/retry", handleAPIDeferredRetry)
+	mux.HandleFunc("/api/stats", handleAPIStats)
+	mux.HandleFunc("/api/library/artists", handleAPILibraryArtists)
+	mux.HandleFunc("/api/library/albums", handleAPILibraryAlbums)
+	mux.HandleFunc("/api/library/duplicates", handleAPIDuplicates)
+	mux.HandleFunc("/api/library/duplicates/scan", handleAPIDuplicateScan)
+	mux.HandleFunc("/api/library/duplicates/resolve", handleAPIDuplicateResolve)
+	mux.HandleFunc("/api/lyrics/backfill", handleAPILyricsBackfill)
+	mux.HandleFunc("/api/art/backfill", handleAPIArtBackfill)
+	mux.HandleFunc("/api/replaygain/backfill", handleAPIReplayGainBackfill)
+	mux.HandleFunc("/api/album/edit", handleAPIAlbumEdit)
+	mux.HandleFunc("/api/album/match", handleAPIAlbumMatch)
+	mux.HandleFunc("/api/album/art", handleAPIAlbumArt)
+	mux.HandleFunc("/api/album/art/image", handleAPIAlbumArtImage)
+	mux.HandleFunc("/api/album/spectrogram", handleAPIAlbumSpectrogram)
+	mux.HandleFunc("/api/album/previews", handleAPIAlbumPreviews)
+	mux.HandleFunc("/api/album/previews/image", handleAPIAlbumPreviewImage)
+	mux.HandleFunc("/api/album/audio", handleAPIAlbumAudio)
+	mux.HandleFunc("/discover/search", handleDiscoverSearch)
+	mux.HandleFunc("/discover/fetch", handleDiscoverFetch)
+	mux.HandleFunc("/discover/fetch/artist", handleDiscoverFetchArtist)
+	mux.HandleFunc("/discover/fetch/status", handleDiscoverFetchStatus)
+	mux.HandleFunc("/discover/fetch/list", handleDiscoverFetchList)
+
+	return mux
+}
@@ -0,0 +1,27 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handlePause handles POST /pause.
+func handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	importer.PauseImports("paused by user")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleResume handles POST /resume.
+func handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	importer.ResumeImports()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/metadata"
+)
+
+// handleAPIAlbumPreviews handles GET /api/album/previews?folder=..., listing
+// the tracks of a pending album for the preview panel.
+func handleAPIAlbumPreviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tracks, err := importer.AlbumPreviews(albumPath)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tracks)
+}
+
+// handleAPIAlbumPreviewImage handles GET
+// /api/album/previews/image?folder=...&track=...&kind=spectrogram|waveform,
+// rendering the image on first request.
+func handleAPIAlbumPreviewImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	albumPath, err := importAlbumPath(q.Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := importer.TrackPreviewImage(albumPath, q.Get("track"), q.Get("kind"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, p)
+}
+
+// handleAPIAlbumAudio handles GET /api/album/audio?folder=...&track=...,
+// streaming a pending track for the review player with range support. With
+// clip=true it sends a 30-second MP3 excerpt from the middle instead, for
+// browsers that cannot play the original format.
+func handleAPIAlbumAudio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	q := r.URL.Query()
+	albumPath, err := importAlbumPath(q.Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := importer.PendingTrack(albumPath, q.Get("track"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if q.Get("clip") != "true" {
+		w.Header().Set("Content-Type", audioContentType(p))
+		http.ServeFile(w, r, p)
+		return
+	}
+	data, err := importer.TrackClip(p)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "transcoding clip: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Write(data)
+}
+
+// audioContentType returns the MIME type of a track: from its contents for
+// FLAC and MP3, else from its extension, else sniffed by net/http.
+func audioContentType(path string) string {
+	switch metadata.SniffFormat(path) {
+	case metadata.FormatFLAC:
+		return "audio/flac"
+	case metadata.FormatMP3:
+		return "audio/mpeg"
+	}
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return http.DetectContentType(head[:n])
+}
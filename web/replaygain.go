@@ -0,0 +1,27 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+var replayGainBackfill = &backgroundTask{name: "replaygain", what: "ReplayGain backfill"}
+
+// handleAPIReplayGainBackfill handles /api/replaygain/backfill. POST starts
+// a backfill in the background (?restart=true ignores saved progress,
+// ?dry_run=true only reports, ?limit=N stops after N albums), DELETE stops
+// it (it resumes on the next POST), GET reports progress.
+func handleAPIReplayGainBackfill(w http.ResponseWriter, r *http.Request) {
+	replayGainBackfill.handle(w, r, func(r *http.Request) taskFunc {
+		q := r.URL.Query()
+		restart := q.Get("restart") == "true"
+		dryRun := q.Get("dry_run") == "true"
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		return func(ctx context.Context, libraryDir string, logf func(string)) (any, error) {
+			return importer.BackfillReplayGain(ctx, libraryDir, restart, dryRun, limit, logf)
+		}
+	})
+}
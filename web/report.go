@@ -0,0 +1,35 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIReport handles GET /api/report?format=json|csv, serving the last
+// run's report as a download.
+func handleAPIReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	session := importer.LastSession()
+	if session == nil {
+		writeAPIError(w, http.StatusNotFound, "no import has run yet")
+		return
+	}
+	report := importer.NewRunReport(session)
+	name := "import-" + session.StartedAt.Format("20060102-150405")
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		report.WriteJSON(w)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+		report.WriteCSV(w)
+	default:
+		writeAPIError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/gabehf/music-import/library"
+)
+
+var (
+	scrubMu      sync.Mutex
+	scrubRunning bool
+	lastScrub    *library.ScrubReport
+)
+
+// handleScrub handles /scrub. POST starts a scrub in the background; GET
+// returns the most recent report.
+func handleScrub(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		scrubMu.Lock()
+		report, running := lastScrub, scrubRunning
+		scrubMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"running": running,
+			"report":  report,
+		})
+
+	case http.MethodPost:
+		libraryDir := os.Getenv("LIBRARY_DIR")
+		if libraryDir == "" || library.RemoteLibrary() != "" {
+			http.Error(w, "scrub needs a local LIBRARY_DIR", http.StatusInternalServerError)
+			return
+		}
+
+		scrubMu.Lock()
+		if scrubRunning {
+			scrubMu.Unlock()
+			http.Error(w, "scrub already running", http.StatusConflict)
+			return
+		}
+		scrubRunning = true
+		scrubMu.Unlock()
+
+		go func() {
+			log.Println("[scrub] started")
+			report, err := library.ScrubLibrary(libraryDir)
+			if err != nil {
+				log.Println("[scrub] failed:", err)
+			} else {
+				log.Printf("[scrub] checked %d files, %d issues", report.FilesChecked, len(report.Issues))
+			}
+			scrubMu.Lock()
+			lastScrub = report
+			scrubRunning = false
+			scrubMu.Unlock()
+		}()
+
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		http.Error(w, "GET or POST only", http.StatusMethodNotAllowed)
+	}
+}
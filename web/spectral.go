@@ -0,0 +1,29 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIAlbumSpectrogram handles GET /api/album/spectrogram?folder=...,
+// serving the spectrogram the spectral check saved for a suspect album.
+func handleAPIAlbumSpectrogram(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	albumPath, err := importAlbumPath(r.URL.Query().Get("folder"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p := importer.SpectrogramPath(albumPath)
+	if p == "" {
+		writeAPIError(w, http.StatusNotFound, "no spectrogram for this album")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, r, p)
+}
@@ -0,0 +1,1033 @@
+"use strict";
+
+// IDs of fetch cards we've already created, so we don't duplicate them.
+const knownFetchIds = new Set();
+
+document.addEventListener("DOMContentLoaded", () => {
+  initTabs();
+  initPending();
+  initSearch();
+  initFetchList();
+  initDuplicates();
+  initAlbumLogs();
+});
+
+// ── Tabs ───────────────────────────────────────────────────────────────────────
+
+function initTabs() {
+  document.querySelector(".tabs").addEventListener("click", (e) => {
+    const btn = e.target.closest(".tab-btn");
+    if (!btn) return;
+    showTab(btn.dataset.tab);
+  });
+}
+
+function showTab(name) {
+  document
+    .querySelectorAll(".tab-pane")
+    .forEach((p) => p.classList.remove("active"));
+  document
+    .querySelectorAll(".tab-btn")
+    .forEach((b) => b.classList.remove("active"));
+  document.getElementById("tab-" + name).classList.add("active");
+  document
+    .querySelector(`.tab-btn[data-tab="${name}"]`)
+    .classList.add("active");
+}
+
+// ── Album logs ─────────────────────────────────────────────────────────────────
+
+// Loads an album's import log the first time its panel is opened.
+function initAlbumLogs() {
+  document.querySelectorAll(".album-log").forEach((el) => {
+    el.addEventListener("toggle", () => {
+      const pre = el.querySelector("pre");
+      if (!el.open || pre.dataset.loaded) return;
+      pre.dataset.loaded = "1";
+      pre.textContent = "Loading\u2026";
+      fetch("/api/logs/" + encodeURIComponent(el.dataset.log))
+        .then((r) => (r.ok ? r.text() : Promise.reject(new Error(r.statusText))))
+        .then((text) => (pre.textContent = text))
+        .catch((err) => {
+          pre.textContent = "Could not load log: " + err.message;
+          delete pre.dataset.loaded;
+        });
+    });
+  });
+}
+
+// ── Pending albums ─────────────────────────────────────────────────────────────
+
+function initPending() {
+  initUpload();
+  initRip();
+  document.getElementById("scan-btn").addEventListener("click", doScan);
+  document.getElementById("pending-all").addEventListener("change", (e) => {
+    document
+      .querySelectorAll(".pending-check")
+      .forEach((c) => (c.checked = e.target.checked));
+  });
+  document
+    .getElementById("import-selected-btn")
+    .addEventListener("click", importSelected);
+
+  // Event delegation for per-album buttons and edit forms
+  document.getElementById("pending-list").addEventListener("click", (e) => {
+    const btn = e.target.closest("button");
+    if (!btn) return;
+    const folder = btn.dataset.folder;
+    if (btn.classList.contains("edit-btn")) toggleEditForm(folder);
+    else if (btn.classList.contains("edit-save")) saveEditForm(folder, btn);
+    else if (btn.classList.contains("edit-cancel"))
+      document.getElementById(editFormId(folder))?.remove();
+    else if (btn.classList.contains("match-btn")) toggleMatchPanel(folder);
+    else if (btn.classList.contains("match-search")) searchMatches(folder);
+    else if (btn.classList.contains("match-pick"))
+      pickMatch(folder, btn.dataset.mbid, btn);
+    else if (btn.classList.contains("art-btn")) toggleArtPanel(folder);
+    else if (btn.classList.contains("art-pick"))
+      pickArt(folder, btn.dataset.id, btn);
+    else if (btn.classList.contains("preview-btn")) togglePreviewPanel(folder);
+  });
+  document.getElementById("pending-list").addEventListener("keydown", (e) => {
+    if (e.key === "Enter" && e.target.classList.contains("match-q"))
+      searchMatches(e.target.dataset.folder);
+  });
+}
+
+function doScan() {
+  const btn = document.getElementById("scan-btn");
+  const listEl = document.getElementById("pending-list");
+  const actionsEl = document.getElementById("pending-actions");
+
+  btn.disabled = true;
+  btn.textContent = "Scanning\u2026";
+  listEl.innerHTML = '<p class="search-msg">Scanning import folder\u2026</p>';
+
+  fetch("/api/scan")
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((albums) => {
+      if (!albums || albums.length === 0) {
+        listEl.innerHTML = '<p class="search-msg">No albums found.</p>';
+        actionsEl.hidden = true;
+        return;
+      }
+      listEl.innerHTML = albums.map(renderPending).join("");
+      actionsEl.hidden = false;
+    })
+    .catch((err) => {
+      listEl.innerHTML = `<p class="search-msg error">Error: ${esc(err.message)}</p>`;
+    })
+    .finally(() => {
+      btn.disabled = false;
+      btn.textContent = "Scan Import Folder";
+    });
+}
+
+function renderPending(a) {
+  const title =
+    a.artist || a.album
+      ? `${a.artist || "Unknown Artist"} \u2014 ${a.album || "Unknown Album"}`
+      : "No tags";
+  const meta = [a.year, `${a.track_count} tracks`].filter(Boolean).join(" \u00b7 ");
+  // Palette entries are always "#rrggbb"; check anyway before putting one in a style attribute.
+  const accent = /^#[0-9a-f]{6}$/.test((a.palette || [])[0]) ? a.palette[0] : "";
+  return `
+    <div class="result-row pending-row${accent ? " themed" : ""}" id="${pendingRowId(a.folder)}"${accent ? ` style="--album-accent: ${accent}"` : ""}>
+      <input type="checkbox" class="pending-check" value="${esc(a.folder)}"${a.review ? "" : " checked"}>
+      <div class="result-info">
+        <span class="result-title">${esc(a.name)}${a.source ? ` <span class="badge badge-source">${esc(a.source)}</span>` : ""}${a.review ? ' <span class="badge badge-warn">review</span>' : ""}${a.priority ? ' <span class="badge badge-warn">priority</span>' : ""}${a.release_mbid ? ' <span class="badge badge-ok">matched</span>' : ""}${a.suspect ? ` <a class="badge badge-warn" href="/api/album/spectrogram?folder=${encodeURIComponent(a.folder)}" target="_blank" title="${esc(a.suspect)}">lossy?</a>` : ""}${a.unverified ? ` <span class="badge badge-warn" title="${esc(a.unverified)}">not verified</span>` : ""}${a.editions ? ` <span class="badge badge-warn" title="Pick an edition under Match">${a.editions} editions</span>` : ""}</span>
+        <span class="result-meta">${esc(title)} \u00b7 ${esc(meta)}</span>
+      </div>
+      <button class="fetch-btn match-btn" data-folder="${esc(a.folder)}">Match</button>
+      <button class="fetch-btn art-btn" data-folder="${esc(a.folder)}">Art</button>
+      <button class="fetch-btn preview-btn" data-folder="${esc(a.folder)}">Preview</button>
+      <button class="fetch-btn edit-btn" data-folder="${esc(a.folder)}">Edit</button>
+    </div>`;
+}
+
+// Folder names can contain any character, so derive DOM ids from a hex encoding.
+function folderKey(folder) {
+  return [...new TextEncoder().encode(folder)]
+    .map((b) => b.toString(16).padStart(2, "0"))
+    .join("");
+}
+function pendingRowId(folder) {
+  return "pending-" + folderKey(folder);
+}
+function editFormId(folder) {
+  return "edit-" + folderKey(folder);
+}
+function matchPanelId(folder) {
+  return "match-" + folderKey(folder);
+}
+function artPanelId(folder) {
+  return "art-" + folderKey(folder);
+}
+function previewPanelId(folder) {
+  return "preview-" + folderKey(folder);
+}
+
+function toggleEditForm(folder) {
+  const existing = document.getElementById(editFormId(folder));
+  if (existing) {
+    existing.remove();
+    return;
+  }
+
+  fetch(`/api/album/edit?folder=${encodeURIComponent(folder)}`)
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((form) => {
+      const row = document.getElementById(pendingRowId(folder));
+      row.insertAdjacentHTML("afterend", renderEditForm(folder, form));
+    })
+    .catch((err) => alert(`Could not load tags: ${err.message}`));
+}
+
+function renderEditForm(folder, f) {
+  const field = (label, name, value) =>
+    `<label>${label}</label><input name="${name}" value="${esc(value)}">`;
+  const tracks = f.tracks
+    .map(
+      (t) =>
+        `<span class="edit-file" title="${esc(t.file)}">${esc(t.file)}</span>` +
+        `<input class="edit-title" data-file="${esc(t.file)}" value="${esc(t.title)}">`,
+    )
+    .join("");
+  return `
+    <div class="edit-form" id="${editFormId(folder)}">
+      ${field("Artist", "artist", f.artist)}
+      ${field("Album", "album", f.album)}
+      ${field("Year", "year", f.year)}
+      ${field("Genre", "genre", f.genre)}
+      ${tracks}
+      <div class="edit-actions">
+        <button class="queue-btn edit-cancel" data-folder="${esc(folder)}">Cancel</button>
+        <button class="fetch-btn edit-save" data-folder="${esc(folder)}">Save Tags</button>
+      </div>
+    </div>`;
+}
+
+function saveEditForm(folder, btn) {
+  const form = document.getElementById(editFormId(folder));
+  const value = (name) => form.querySelector(`input[name="${name}"]`).value.trim();
+  const titles = {};
+  form.querySelectorAll(".edit-title").forEach((i) => {
+    titles[i.dataset.file] = i.value.trim();
+  });
+
+  btn.disabled = true;
+  btn.textContent = "Saving\u2026";
+
+  fetch(`/api/album/edit?folder=${encodeURIComponent(folder)}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({
+      artist: value("artist"),
+      album: value("album"),
+      year: value("year"),
+      genre: value("genre"),
+      titles,
+    }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      form.remove();
+      doScan();
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      btn.textContent = "Save Tags";
+      alert(`Could not save tags: ${err.message}`);
+    });
+}
+
+// ── Upload ─────────────────────────────────────────────────────────────────────
+
+function initUpload() {
+  const zone = document.getElementById("drop-zone");
+  const input = document.getElementById("upload-input");
+
+  input.addEventListener("change", () => {
+    if (input.files.length) uploadFiles(input.files);
+    input.value = "";
+  });
+  zone.addEventListener("dragover", (e) => {
+    e.preventDefault();
+    zone.classList.add("drop-active");
+  });
+  zone.addEventListener("dragleave", () => zone.classList.remove("drop-active"));
+  zone.addEventListener("drop", (e) => {
+    e.preventDefault();
+    zone.classList.remove("drop-active");
+    if (e.dataTransfer.files.length) uploadFiles(e.dataTransfer.files);
+  });
+}
+
+function uploadFiles(files) {
+  const msg = document.getElementById("drop-msg");
+  const startNow = document.getElementById("upload-import").checked;
+
+  // Text fields go first: the server streams the form and reads them before the files.
+  const form = new FormData();
+  form.append("folder", document.getElementById("upload-folder").value.trim());
+  form.append("import", startNow ? "true" : "false");
+  for (const f of files) form.append("files", f);
+
+  // XHR rather than fetch for upload progress.
+  const xhr = new XMLHttpRequest();
+  xhr.open("POST", "/api/upload");
+  xhr.upload.addEventListener("progress", (e) => {
+    if (e.lengthComputable)
+      msg.textContent = `Uploading\u2026 ${Math.round((e.loaded / e.total) * 100)}%`;
+  });
+  xhr.addEventListener("load", () => {
+    if (xhr.status >= 300) {
+      msg.textContent = `Upload failed: ${errorMessage(xhr.responseText) || xhr.statusText}`;
+      return;
+    }
+    const res = JSON.parse(xhr.responseText);
+    msg.textContent = `Uploaded ${res.files} file(s)${res.skipped ? `, skipped ${res.skipped.join(", ")}` : ""}`;
+    if (res.job) window.location.reload();
+    else doScan();
+  });
+  xhr.addEventListener("error", () => (msg.textContent = "Upload failed: network error"));
+  msg.textContent = "Uploading\u2026";
+  xhr.send(form);
+}
+
+// ── CD ripping ─────────────────────────────────────────────────────────────────
+
+function initRip() {
+  const btn = document.getElementById("rip-btn");
+  if (!btn) return;
+  btn.addEventListener("click", () => {
+    btn.disabled = true;
+    fetch("/api/cd?import=true", { method: "POST" })
+      .then((r) => {
+        if (!r.ok)
+          return r.text().then((t) => {
+            throw new Error(errorMessage(t) || r.statusText);
+          });
+        pollRip();
+      })
+      .catch((err) => {
+        btn.disabled = false;
+        document.getElementById("rip-status").textContent = err.message;
+      });
+  });
+  pollRip();
+}
+
+function pollRip() {
+  fetch("/api/cd")
+    .then((r) => r.json())
+    .then((st) => {
+      const btn = document.getElementById("rip-btn");
+      const status = document.getElementById("rip-status");
+      btn.disabled = st.ripping;
+      if (st.ripping) {
+        status.textContent = "Ripping\u2026";
+        setTimeout(pollRip, 5000);
+      } else if (st.error) {
+        status.textContent = `Rip failed: ${st.error}`;
+      } else if (st.albums) {
+        status.textContent = `Ripped ${st.albums.join(", ")}`;
+      }
+    })
+    .catch(() => {});
+}
+
+// ── Release matching ───────────────────────────────────────────────────────────
+
+function toggleMatchPanel(folder) {
+  const existing = document.getElementById(matchPanelId(folder));
+  if (existing) {
+    existing.remove();
+    return;
+  }
+  const row = document.getElementById(pendingRowId(folder));
+  row.insertAdjacentHTML(
+    "afterend",
+    `<div class="match-panel" id="${matchPanelId(folder)}">
+      <div class="search-form">
+        <input class="search-input match-q" type="search" data-folder="${esc(folder)}"
+          placeholder="Search MusicBrainz releases\u2026" autocomplete="off">
+        <button class="search-btn match-search" data-folder="${esc(folder)}">Search</button>
+      </div>
+      <div class="match-results"></div>
+    </div>`,
+  );
+  searchMatches(folder);
+}
+
+function searchMatches(folder) {
+  const panel = document.getElementById(matchPanelId(folder));
+  if (!panel) return;
+  const input = panel.querySelector(".match-q");
+  const resultsEl = panel.querySelector(".match-results");
+  const q = input.value.trim();
+
+  resultsEl.innerHTML = '<p class="search-msg">Searching MusicBrainz\u2026</p>';
+
+  let url = `/api/album/match?folder=${encodeURIComponent(folder)}`;
+  if (q) url += `&q=${encodeURIComponent(q)}`;
+  fetch(url)
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((data) => {
+      if (!q) input.value = data.query;
+      if (!data.candidates.length) {
+        resultsEl.innerHTML = '<p class="search-msg">No releases found.</p>';
+        return;
+      }
+      resultsEl.innerHTML =
+        (data.editions
+          ? '<p class="search-msg">These editions match almost equally \u2014 pick the one you have, or search for another.</p>'
+          : "") +
+        data.candidates
+          .map((c) => renderCandidate(folder, c, c.id === data.selected))
+          .join("");
+    })
+    .catch((err) => {
+      resultsEl.innerHTML = `<p class="search-msg error">Error: ${esc(err.message)}</p>`;
+    });
+}
+
+function renderCandidate(folder, c, selected) {
+  const meta = [c.year, c.country, c.format, c.track_count && `${c.track_count} tracks`]
+    .filter(Boolean)
+    .join(" \u00b7 ");
+  const dis = c.disambiguation ? ` (${esc(c.disambiguation)})` : "";
+  return `
+    <div class="result-row${selected ? " match-selected" : ""}">
+      <img class="result-cover" src="https://coverartarchive.org/release/${esc(c.id)}/front-250"
+        onerror="this.style.display='none'" loading="lazy" alt="">
+      <div class="result-info">
+        <span class="result-title">${esc(c.artist)} \u2014 ${esc(c.title)}<span class="result-dis">${dis}</span></span>
+        ${meta ? `<span class="result-meta">${esc(meta)}</span>` : ""}
+      </div>
+      <button class="fetch-btn match-pick" data-folder="${esc(folder)}"
+        data-mbid="${selected ? "" : esc(c.id)}">${selected ? "Unpick" : "Use This"}</button>
+    </div>`;
+}
+
+function pickMatch(folder, mbid, btn) {
+  btn.disabled = true;
+  fetch(`/api/album/match?folder=${encodeURIComponent(folder)}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ mbid }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      doScan();
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      alert(`Could not save release: ${err.message}`);
+    });
+}
+
+// ── Cover art picker ───────────────────────────────────────────────────────────
+
+function toggleArtPanel(folder) {
+  const existing = document.getElementById(artPanelId(folder));
+  if (existing) {
+    existing.remove();
+    return;
+  }
+  const row = document.getElementById(pendingRowId(folder));
+  row.insertAdjacentHTML(
+    "afterend",
+    `<div class="art-panel" id="${artPanelId(folder)}">
+      <p class="search-msg">Collecting cover art\u2026</p>
+    </div>`,
+  );
+  loadArtCandidates(folder);
+}
+
+function loadArtCandidates(folder) {
+  const panel = document.getElementById(artPanelId(folder));
+  fetch(`/api/album/art?folder=${encodeURIComponent(folder)}`)
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((data) => {
+      if (!data.candidates.length) {
+        panel.innerHTML = '<p class="search-msg">No cover art found.</p>';
+        return;
+      }
+      panel.innerHTML = data.candidates
+        .map((c) => renderArtCandidate(folder, c, c.id === data.selected))
+        .join("");
+    })
+    .catch((err) => {
+      panel.innerHTML = `<p class="search-msg error">Error: ${esc(err.message)}</p>`;
+    });
+}
+
+function renderArtCandidate(folder, c, selected) {
+  const src = `/api/album/art/image?folder=${encodeURIComponent(folder)}&id=${encodeURIComponent(c.id)}`;
+  const dims = c.width ? `${c.width}\u00d7${c.height}` : "unknown size";
+  const size = `${(c.bytes / 1024).toFixed(0)} KB`;
+  // Anything under 500px looks soft on most players.
+  const quality = c.width && Math.min(c.width, c.height) < 500 ? "info-warn" : "info-ok";
+  return `
+    <div class="art-card${selected ? " art-selected" : ""}">
+      <img src="${src}" loading="lazy" alt="">
+      <span class="art-label">${esc(c.label)}</span>
+      <span class="art-meta ${quality}">${dims} \u00b7 ${esc((c.format || "").toUpperCase())} \u00b7 ${size}</span>
+      <button class="fetch-btn art-pick" data-folder="${esc(folder)}" data-id="${esc(c.id)}"
+        ${selected ? "disabled" : ""}>${selected ? "Chosen" : "Use This"}</button>
+    </div>`;
+}
+
+// The preview panel has a player, a waveform and a spectrogram per track,
+// the images rendered by the server on first request, to judge a rip
+// before importing it.
+function togglePreviewPanel(folder) {
+  const existing = document.getElementById(previewPanelId(folder));
+  if (existing) {
+    existing.remove();
+    return;
+  }
+  const row = document.getElementById(pendingRowId(folder));
+  row.insertAdjacentHTML(
+    "afterend",
+    `<div class="preview-panel" id="${previewPanelId(folder)}">
+      <p class="search-msg">Listing tracks\u2026</p>
+    </div>`,
+  );
+  const panel = document.getElementById(previewPanelId(folder));
+  fetch(`/api/album/previews?folder=${encodeURIComponent(folder)}`)
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((tracks) => {
+      if (!tracks.length) {
+        panel.innerHTML = '<p class="search-msg">No tracks found.</p>';
+        return;
+      }
+      panel.innerHTML = tracks.map((t) => renderTrackPreview(folder, t)).join("");
+    })
+    .catch((err) => {
+      panel.innerHTML = `<p class="search-msg error">Error: ${esc(err.message)}</p>`;
+    });
+}
+
+function renderTrackPreview(folder, t) {
+  const src = (kind) =>
+    `/api/album/previews/image?folder=${encodeURIComponent(folder)}&track=${encodeURIComponent(t.track)}&kind=${kind}`;
+  // Browsers without FLAC support get a transcoded clip instead.
+  const flac = /\.flac$/i.test(t.track);
+  const clip = flac && !document.createElement("audio").canPlayType("audio/flac");
+  const audio = `/api/album/audio?folder=${encodeURIComponent(folder)}&track=${encodeURIComponent(t.track)}${clip ? "&clip=true" : ""}`;
+  return `
+    <div class="preview-track">
+      <span class="art-label">${esc(t.track)}${t.quality ? ` <span class="info-dim">${esc(t.quality)}</span>` : ""}</span>
+      <audio controls preload="none" src="${audio}"></audio>
+      <img class="preview-wave" src="${src("waveform")}" loading="lazy" alt="waveform">
+      <a href="${src("spectrogram")}" target="_blank"><img class="preview-spec" src="${src("spectrogram")}" loading="lazy" alt="spectrogram"></a>
+    </div>`;
+}
+
+function pickArt(folder, id, btn) {
+  btn.disabled = true;
+  fetch(`/api/album/art?folder=${encodeURIComponent(folder)}`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ id }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      loadArtCandidates(folder);
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      alert(`Could not save cover: ${err.message}`);
+    });
+}
+
+function importSelected() {
+  const folders = [...document.querySelectorAll(".pending-check:checked")].map(
+    (c) => c.value,
+  );
+  if (folders.length === 0) return;
+
+  const btn = document.getElementById("import-selected-btn");
+  btn.disabled = true;
+
+  fetch("/api/import", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ folders }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      window.location.reload();
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      document.getElementById("pending-list").insertAdjacentHTML(
+        "afterbegin",
+        `<p class="search-msg error">Error: ${esc(err.message)}</p>`,
+      );
+    });
+}
+
+// ── Search ─────────────────────────────────────────────────────────────────────
+
+let searchType = "release";
+
+function initSearch() {
+  document.querySelector(".type-toggle").addEventListener("click", (e) => {
+    const btn = e.target.closest(".type-btn");
+    if (btn) setSearchType(btn.dataset.type);
+  });
+
+  const searchBtn = document.getElementById("search-btn");
+  const searchInput = document.getElementById("search-q");
+  searchBtn.addEventListener("click", doSearch);
+  searchInput.addEventListener("keydown", (e) => {
+    if (e.key === "Enter") doSearch();
+  });
+
+  // Event delegation for dynamically rendered result buttons
+  document.getElementById("search-results").addEventListener("click", (e) => {
+    const btn = e.target.closest(".fetch-btn");
+    if (!btn || btn.disabled) return;
+    if (btn.dataset.fetchType === "artist") startArtistFetch(btn);
+    else startReleaseFetch(btn);
+  });
+}
+
+function setSearchType(type) {
+  searchType = type;
+  document.querySelectorAll(".type-btn").forEach((b) => {
+    b.classList.toggle("active", b.dataset.type === type);
+  });
+}
+
+function doSearch() {
+  const q = document.getElementById("search-q").value.trim();
+  if (!q) return;
+
+  const btn = document.getElementById("search-btn");
+  const resultsEl = document.getElementById("search-results");
+
+  btn.disabled = true;
+  btn.textContent = "Searching\u2026";
+  resultsEl.innerHTML = '<p class="search-msg">Searching MusicBrainz\u2026</p>';
+
+  fetch(`/discover/search?q=${encodeURIComponent(q)}&type=${searchType}`)
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then((data) => renderResults(data))
+    .catch((err) => {
+      resultsEl.innerHTML = `<p class="search-msg error">Error: ${esc(err.message)}</p>`;
+    })
+    .finally(() => {
+      btn.disabled = false;
+      btn.textContent = "Search";
+    });
+}
+
+// ── Results rendering ──────────────────────────────────────────────────────────
+
+function renderResults(data) {
+  const el = document.getElementById("search-results");
+  if (!data || data.length === 0) {
+    el.innerHTML = '<p class="search-msg">No results found.</p>';
+    return;
+  }
+  const renderer = searchType === "artist" ? renderArtist : renderRelease;
+  el.innerHTML = data.map(renderer).join("");
+}
+
+function renderRelease(r) {
+  const credits = r["artist-credit"] ?? [];
+  const artist =
+    credits.map((c) => c.name || c.artist?.name || "").join("") ||
+    "Unknown Artist";
+  const year = r.date?.substring(0, 4) ?? "";
+  const type = r["release-group"]?.["primary-type"] ?? "";
+  const country = r.country ?? "";
+  const formats = [
+    ...new Set((r.media ?? []).map((m) => m.format).filter(Boolean)),
+  ].join("+");
+  const lang = r["text-representation"]?.language ?? "";
+  const meta = [year, type, formats, country, lang]
+    .filter(Boolean)
+    .join(" \u00b7 ");
+  const dis = r.disambiguation ? ` (${esc(r.disambiguation)})` : "";
+  const coverUrl = `https://coverartarchive.org/release/${r.id}/front-250`;
+
+  return `
+    <div class="result-row">
+      <img class="result-cover" src="${coverUrl}" onerror="this.style.display='none'" loading="lazy" alt="">
+      <div class="result-info">
+        <span class="result-title">${esc(artist)} \u2014 ${esc(r.title)}<span class="result-dis">${dis}</span></span>
+        ${meta ? `<span class="result-meta">${esc(meta)}</span>` : ""}
+      </div>
+      <button class="fetch-btn"
+        data-fetch-type="release"
+        data-id="${esc(r.id)}"
+        data-artist="${esc(artist)}"
+        data-album="${esc(r.title)}">Fetch</button>
+    </div>`;
+}
+
+function renderArtist(a) {
+  const dis = a.disambiguation ? ` (${esc(a.disambiguation)})` : "";
+  return `
+    <div class="result-row">
+      <div class="result-info">
+        <span class="result-title">${esc(a.name)}${dis}</span>
+        ${a.country ? `<span class="result-meta">${esc(a.country)}</span>` : ""}
+      </div>
+      <button class="fetch-btn"
+        data-fetch-type="artist"
+        data-id="${esc(a.id)}"
+        data-name="${esc(a.name)}">Fetch All</button>
+    </div>`;
+}
+
+// ── Fetch operations ───────────────────────────────────────────────────────────
+
+function startReleaseFetch(btn) {
+  const { id, artist, album } = btn.dataset;
+  btn.disabled = true;
+  btn.textContent = "Fetching\u2026";
+
+  fetch("/discover/fetch", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ id, artist, album }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then(() => {
+      addFetchCard(id, `${artist} \u2014 ${album}`);
+      pollFetch(id);
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      btn.textContent = "Fetch";
+      showFetchError(err.message);
+    });
+}
+
+function startArtistFetch(btn) {
+  const { id, name } = btn.dataset;
+  btn.disabled = true;
+  btn.textContent = "Fetching\u2026";
+
+  fetch("/discover/fetch/artist", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ id, name }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then(() => {
+      addFetchCard(id, `${name} \u2014 full discography`);
+      pollFetch(id);
+    })
+    .catch((err) => {
+      btn.disabled = false;
+      btn.textContent = "Fetch All";
+      showFetchError(err.message);
+    });
+}
+
+// ── Fetch cards ────────────────────────────────────────────────────────────────
+
+function addFetchCard(id, title) {
+  knownFetchIds.add(id);
+  const list = document.getElementById("fetch-list");
+  const card = document.createElement("div");
+  card.className = "fetch-card";
+  card.id = `fetch-${id}`;
+  card.innerHTML = `
+    <div class="fetch-header">
+      <span class="fetch-title">${esc(title)}</span>
+      <span class="fetch-status" id="fstatus-${id}">In progress\u2026</span>
+    </div>
+    <div class="fetch-log" id="flog-${id}"></div>`;
+  list.prepend(card);
+}
+
+function pollFetch(id) {
+  fetch(`/discover/fetch/status?id=${encodeURIComponent(id)}`)
+    .then((r) => r.json())
+    .then((data) => {
+      const logEl = document.getElementById(`flog-${id}`);
+      const statusEl = document.getElementById(`fstatus-${id}`);
+      const card = document.getElementById(`fetch-${id}`);
+
+      if (logEl && data.log) {
+        logEl.innerHTML = data.log
+          .map((l) => `<div class="log-line">${esc(l)}</div>`)
+          .join("");
+        logEl.scrollTop = logEl.scrollHeight;
+      }
+
+      if (data.done) {
+        if (data.success) {
+          statusEl?.setAttribute("class", "fetch-status fetch-status-ok");
+          if (statusEl) statusEl.textContent = "\u2713 done";
+          card?.classList.add("fetch-card-ok");
+        } else {
+          statusEl?.setAttribute("class", "fetch-status fetch-status-err");
+          if (statusEl) statusEl.textContent = "\u2717 failed";
+          card?.classList.add("fetch-card-err");
+          if (data.error && logEl) {
+            logEl.innerHTML += `<div class="log-line log-line-err">${esc(data.error)}</div>`;
+            logEl.scrollTop = logEl.scrollHeight;
+          }
+        }
+      } else {
+        setTimeout(() => pollFetch(id), 2000);
+      }
+    })
+    .catch(() => setTimeout(() => pollFetch(id), 3000));
+}
+
+// ── Fetch list polling ─────────────────────────────────────────────────────────
+
+// Polls /discover/fetch/list every 5 s to discover server-created fetch entries
+// (e.g. per-album cards spawned during an artist fetch) and create cards for them.
+function initFetchList() {
+  pollFetchList();
+}
+
+function pollFetchList() {
+  fetch("/discover/fetch/list")
+    .then((r) => (r.ok ? r.json() : null))
+    .then((items) => {
+      if (!items) return;
+      for (const item of items) {
+        if (!knownFetchIds.has(item.id)) {
+          knownFetchIds.add(item.id);
+          addFetchCard(item.id, item.title);
+          if (!item.done) pollFetch(item.id);
+        }
+      }
+    })
+    .catch(() => {})
+    .finally(() => setTimeout(pollFetchList, 5000));
+}
+
+// ── Duplicates ─────────────────────────────────────────────────────────────────
+
+const dupReasons = {
+  mbid: "same MusicBrainz release",
+  tracks: "same album and track lengths",
+  fingerprint: "same audio",
+};
+
+function initDuplicates() {
+  document.getElementById("dup-scan-btn").addEventListener("click", startDuplicateScan);
+  document.getElementById("dup-list").addEventListener("click", (e) => {
+    const btn = e.target.closest("button");
+    if (btn) resolveDuplicate(btn);
+  });
+  loadDuplicates();
+  pollDuplicateScan();
+}
+
+function loadDuplicates() {
+  fetch("/api/library/duplicates")
+    .then((r) => (r.ok ? r.json() : null))
+    .then(renderDuplicates)
+    .catch(() => {});
+}
+
+function startDuplicateScan() {
+  const fp = document.getElementById("dup-fingerprint").checked;
+  fetch("/api/library/duplicates/scan" + (fp ? "?fingerprint=true" : ""), { method: "POST" })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      pollDuplicateScan();
+    })
+    .catch((err) => {
+      document.getElementById("dup-status").textContent = "Error: " + err.message;
+    });
+}
+
+function pollDuplicateScan() {
+  fetch("/api/library/duplicates/scan")
+    .then((r) => (r.ok ? r.json() : null))
+    .then((s) => {
+      if (!s) return;
+      const btn = document.getElementById("dup-scan-btn");
+      const status = document.getElementById("dup-status");
+      btn.disabled = s.running;
+      if (s.running) {
+        status.textContent = "Scanning\u2026 " + (s.status.current || "");
+        setTimeout(pollDuplicateScan, 2000);
+        return;
+      }
+      status.textContent = s.status.error ? "Scan failed: " + s.status.error : "";
+      if (s.status.finished_at) loadDuplicates();
+    })
+    .catch(() => {});
+}
+
+function renderDuplicates(report) {
+  const listEl = document.getElementById("dup-list");
+  if (!report) {
+    listEl.innerHTML = '<p class="search-msg">No scan yet.</p>';
+    return;
+  }
+  const when = new Date(report.scanned_at).toLocaleString();
+  if (!report.groups || report.groups.length === 0) {
+    listEl.innerHTML = `<p class="search-msg">No duplicates among ${report.albums} albums (scanned ${esc(when)}).</p>`;
+    return;
+  }
+  listEl.innerHTML =
+    `<p class="search-msg">${report.groups.length} duplicate groups among ${report.albums} albums (scanned ${esc(when)}). Best quality first.</p>` +
+    report.groups.map(renderDuplicateGroup).join("");
+}
+
+function renderDuplicateGroup(g) {
+  const rows = g.items
+    .map((it, i) => {
+      const target = it.path || it.dir;
+      const name = g.kind === "track" ? `${it.title} \u2014 ${it.artist} / ${it.album}` : `${it.artist} \u2014 ${it.album}`;
+      const meta = [it.quality, g.kind === "album" ? `${it.track_count} tracks` : "", target].filter(Boolean).join(" \u00b7 ");
+      const btn = (action, label) =>
+        `<button class="fetch-btn" data-group="${esc(g.id)}" data-action="${action}" data-target="${esc(target)}">${label}</button>`;
+      return `
+      <div class="result-row">
+        <div class="result-info">
+          <span class="result-title">${esc(name)}${i === 0 ? ' <span class="badge badge-ok">best</span>' : ""}</span>
+          <span class="result-meta">${esc(meta)}</span>
+        </div>
+        ${btn("keep", "Keep only this")}
+        ${g.kind === "album" ? btn("merge", "Merge into this") : ""}
+        ${btn("delete", "Delete")}
+      </div>`;
+    })
+    .join("");
+  return `
+    <div class="dup-group">
+      <div class="steps-label">${esc(g.kind)} duplicates &middot; ${esc(dupReasons[g.reason] || g.reason)}</div>
+      ${rows}
+    </div>`;
+}
+
+function resolveDuplicate(btn) {
+  const { group, action, target } = btn.dataset;
+  const question = {
+    keep: `Keep ${target} and delete the other copies?`,
+    merge: `Move tracks missing from ${target} into it and delete the other copies?`,
+    delete: `Delete ${target}?`,
+  }[action];
+  if (!confirm(question)) return;
+  btn.disabled = true;
+  fetch("/api/library/duplicates/resolve", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ group, action, target }),
+  })
+    .then((r) => {
+      if (!r.ok)
+        return r.text().then((t) => {
+          throw new Error(errorMessage(t) || r.statusText);
+        });
+      return r.json();
+    })
+    .then(renderDuplicates)
+    .catch((err) => {
+      btn.disabled = false;
+      alert("Could not resolve: " + err.message);
+    });
+}
+
+// ── Utilities ──────────────────────────────────────────────────────────────────
+
+function showFetchError(msg) {
+  const list = document.getElementById("fetch-list");
+  const el = document.createElement("div");
+  el.className = "fetch-card fetch-card-err";
+  el.innerHTML = `<div class="fetch-header">
+    <span class="fetch-title">Fetch failed</span>
+    <span class="fetch-status fetch-status-err">\u2717 error</span>
+  </div>
+  <div class="fetch-log"><div class="log-line log-line-err">${esc(msg)}</div></div>`;
+  list.prepend(el);
+}
+
+// API errors come as {"error": {"message": ...}}; anything else is shown as-is.
+function errorMessage(text) {
+  try {
+    return JSON.parse(text).error?.message ?? text;
+  } catch {
+    return text;
+  }
+}
+
+function esc(s) {
+  return String(s ?? "")
+    .replace(/&/g, "&amp;")
+    .replace(/</g, "&lt;")
+    .replace(/>/g, "&gt;")
+    .replace(/"/g, "&quot;");
+}
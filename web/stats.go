@@ -0,0 +1,21 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gabehf/music-import/importer"
+)
+
+// handleAPIStats handles GET /api/stats.
+func handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	st, err := importer.CollectImportStats()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
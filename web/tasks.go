@@ -0,0 +1,101 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// backgroundTask is a long-running library job (a backfill or scan) driven
+// over HTTP: POST starts it, DELETE cancels it and GET reports progress.
+type backgroundTask struct {
+	name string // log prefix, e.g. "lyrics"
+	what string // for messages, e.g. "lyrics backfill"
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // non-nil while running
+	status struct {
+		StartedAt  time.Time `json:"started_at,omitzero"`
+		FinishedAt time.Time `json:"finished_at,omitzero"`
+		Current    string    `json:"current,omitempty"` // last progress line
+		Result     any       `json:"result,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}
+}
+
+// taskFunc runs a task against a local library, logging progress with logf.
+type taskFunc func(ctx context.Context, libraryDir string, logf func(string)) (any, error)
+
+// handle serves the task's endpoint; start builds the run from the POST
+// request's query parameters.
+func (t *backgroundTask) handle(w http.ResponseWriter, r *http.Request, start func(r *http.Request) taskFunc) {
+	switch r.Method {
+	case http.MethodGet:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]any{
+			"running": t.cancel != nil,
+			"status":  t.status,
+		})
+
+	case http.MethodPost:
+		libraryDir := os.Getenv("LIBRARY_DIR")
+		if libraryDir == "" || library.RemoteLibrary() != "" {
+			writeAPIError(w, http.StatusInternalServerError, t.what+" needs a local LIBRARY_DIR")
+			return
+		}
+		t.mu.Lock()
+		if t.cancel != nil {
+			t.mu.Unlock()
+			writeAPIError(w, http.StatusConflict, t.what+" already running")
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		t.cancel = cancel
+		t.status.StartedAt, t.status.FinishedAt = time.Now(), time.Time{}
+		t.status.Current, t.status.Result, t.status.Error = "", nil, ""
+		t.mu.Unlock()
+
+		run := start(r)
+		go func() {
+			defer cancel()
+			log.Printf("[%s] %s started", t.name, t.what)
+			result, err := run(ctx, libraryDir, func(msg string) {
+				log.Printf("[%s] %s", t.name, msg)
+				t.mu.Lock()
+				t.status.Current = msg
+				t.mu.Unlock()
+			})
+			if err != nil {
+				log.Printf("[%s] %s stopped: %v", t.name, t.what, err)
+			} else {
+				log.Printf("[%s] %s done", t.name, t.what)
+			}
+			t.mu.Lock()
+			t.status.Result = result
+			t.status.FinishedAt = time.Now()
+			if err != nil {
+				t.status.Error = err.Error()
+			}
+			t.cancel = nil
+			t.mu.Unlock()
+		}()
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodDelete:
+		t.mu.Lock()
+		if t.cancel != nil {
+			t.cancel()
+		}
+		t.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET, POST or DELETE only")
+	}
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/gabehf/music-import/library"
+)
+
+// handleAPITrash handles GET /api/trash, listing what the importer deleted,
+// most recent first.
+func handleAPITrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+	entries, err := library.TrashEntries()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []*library.TrashEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleAPITrashItem handles DELETE /api/trash/{id}, which deletes an item
+// for good, and POST /api/trash/{id}/restore, which puts it back.
+func handleAPITrashItem(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(r.PathValue("rest"), "/")
+	var err error
+	switch {
+	case r.Method == http.MethodDelete && action == "":
+		if err = library.DeleteFromTrash(id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case r.Method == http.MethodPost && action == "restore":
+		var e *library.TrashEntry
+		if e, err = library.RestoreFromTrash(id); err == nil {
+			writeJSON(w, http.StatusOK, e)
+			return
+		}
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "DELETE /api/trash/{id} or POST /api/trash/{id}/restore")
+		return
+	}
+	status := http.StatusInternalServerError
+	if errors.Is(err, fs.ErrNotExist) {
+		status = http.StatusNotFound
+	} else if errors.Is(err, fs.ErrExist) {
+		status = http.StatusConflict
+	}
+	writeAPIError(w, status, err.Error())
+}
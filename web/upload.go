@@ -0,0 +1,213 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabehf/music-import/importer"
+	"github.com/gabehf/music-import/library"
+)
+
+// uploadResult describes what an upload added to IMPORT_DIR.
+type uploadResult struct {
+	Folders []string      `json:"folders"` // album folders created; loose files are clustered on scan
+	Files   int           `json:"files"`
+	Skipped []string      `json:"skipped,omitempty"`
+	Job     *importer.Job `json:"job,omitempty"`
+}
+
+// handleAPIUpload handles POST /api/upload, a multipart form with:
+//
+//	folder  optional album folder name for loose files (otherwise they are
+//	        clustered by their album tag)
+//	import  "true" to start an import of the uploaded albums right away
+//	files   one or more audio/lyrics/image files or .zip albums
+//
+// Text fields must come before the files. Everything is written to a staging
+// folder first so a half-finished upload is never imported.
+func handleAPIUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+	importDir := library.LocalImportDir()
+	if importDir == "" {
+		writeAPIError(w, http.StatusInternalServerError, "IMPORT_DIR is not set")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importer.UploadMaxBytes())
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "expected multipart/form-data")
+		return
+	}
+
+	staging, err := os.MkdirTemp(importDir, importer.UploadStagingPrefix)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.RemoveAll(staging)
+
+	var (
+		folder   string
+		startNow bool
+		res      = uploadResult{Folders: []string{}}
+		zips     []string
+	)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d MB", tooBig.Limit>>20))
+				return
+			}
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if part.FileName() == "" {
+			val, _ := io.ReadAll(io.LimitReader(part, 1024))
+			switch part.FormName() {
+			case "folder":
+				raw := strings.TrimSpace(string(val))
+				if raw == "" {
+					continue
+				}
+				folder = library.Sanitize(raw)
+				if !validFolderName(folder) {
+					writeAPIError(w, http.StatusBadRequest, "invalid folder name: "+raw)
+					return
+				}
+			case "import":
+				startNow = string(val) == "true"
+			}
+			continue
+		}
+
+		name := library.Sanitize(filepath.Base(part.FileName()))
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".zip" && !importer.UploadAccepts(name) {
+			res.Skipped = append(res.Skipped, name)
+			continue
+		}
+		dst := filepath.Join(staging, name)
+		if ext == ".zip" {
+			dst = filepath.Join(staging, ".zip", name)
+			os.MkdirAll(filepath.Dir(dst), 0755)
+			zips = append(zips, dst)
+		}
+		out, err := os.Create(dst)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		_, err = io.Copy(out, part)
+		out.Close()
+		if err != nil {
+			var tooBig *http.MaxBytesError
+			if errors.As(err, &tooBig) {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds %d MB", tooBig.Limit>>20))
+				return
+			}
+			writeAPIError(w, http.StatusBadRequest, "reading upload: "+err.Error())
+			return
+		}
+		if ext != ".zip" {
+			res.Files++
+		}
+	}
+
+	// Each zip becomes its own album folder named after the archive.
+	for _, z := range zips {
+		base := strings.TrimSuffix(filepath.Base(z), filepath.Ext(z))
+		if !validFolderName(base) {
+			writeAPIError(w, http.StatusBadRequest, "invalid zip name: "+filepath.Base(z))
+			return
+		}
+		dir := filepath.Join(staging, base)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		n, skipped, err := importer.ExtractZip(z, dir)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, filepath.Base(z)+": "+err.Error())
+			return
+		}
+		if skipped > 0 {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("%d file(s) in %s", skipped, filepath.Base(z)))
+		}
+		res.Files += n
+	}
+	os.RemoveAll(filepath.Join(staging, ".zip"))
+
+	if res.Files == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no audio, lyrics or image files in upload")
+		return
+	}
+
+	// Publish: album folders from zips, then loose files into the named
+	// folder or the top level of IMPORT_DIR.
+	entries, _ := os.ReadDir(staging)
+	looseDir := importDir
+	if folder != "" {
+		looseDir = importer.UniqueDir(filepath.Join(importDir, folder))
+	}
+	for _, e := range entries {
+		src := filepath.Join(staging, e.Name())
+		if e.IsDir() {
+			dst := importer.UniqueDir(filepath.Join(importDir, e.Name()))
+			if err := os.Rename(src, dst); err != nil {
+				writeAPIError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			res.Folders = append(res.Folders, filepath.Base(dst))
+			continue
+		}
+		if err := os.MkdirAll(looseDir, 0755); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := os.Rename(src, importer.UniqueFile(looseDir, e.Name(), "")); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if folder != "" {
+		res.Folders = append(res.Folders, filepath.Base(looseDir))
+	}
+
+	if startNow {
+		// Loose files without a folder have no name yet, so import everything.
+		folders := res.Folders
+		if folder == "" && len(entries) > len(res.Folders) {
+			folders = nil
+		}
+		job, err := importer.StartJob(folders)
+		if err != nil {
+			writeAPIError(w, http.StatusConflict, "upload saved, but "+err.Error())
+			return
+		}
+		res.Job = job
+	}
+
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// validFolderName reports whether name can be used as an album folder
+// directly inside IMPORT_DIR: not empty, "." or "..", and a single path
+// element.
+func validFolderName(name string) bool {
+	return name != "" && name != "." && name != ".." && name == filepath.Base(name)
+}